@@ -42,15 +42,24 @@ import (
 	cloudplatformHandler "github.com/kkops/backend/internal/handler/cloudplatform"
 	dashboardHandler "github.com/kkops/backend/internal/handler/dashboard"
 	deploymentHandler "github.com/kkops/backend/internal/handler/deployment"
+	distributionHandler "github.com/kkops/backend/internal/handler/distribution"
 	environmentHandler "github.com/kkops/backend/internal/handler/environment"
+	factsHandler "github.com/kkops/backend/internal/handler/facts"
+	gitsyncHandler "github.com/kkops/backend/internal/handler/gitsync"
+	jobchainHandler "github.com/kkops/backend/internal/handler/jobchain"
+	maintenanceHandler "github.com/kkops/backend/internal/handler/maintenance"
 	operationtoolHandler "github.com/kkops/backend/internal/handler/operationtool"
+	pipelineHandler "github.com/kkops/backend/internal/handler/pipeline"
 	projectHandler "github.com/kkops/backend/internal/handler/project"
 	roleHandler "github.com/kkops/backend/internal/handler/role"
 	scheduledtaskHandler "github.com/kkops/backend/internal/handler/scheduledtask"
+	secretHandler "github.com/kkops/backend/internal/handler/secret"
 	sshkeyHandler "github.com/kkops/backend/internal/handler/sshkey"
 	tagHandler "github.com/kkops/backend/internal/handler/tag"
 	taskHandler "github.com/kkops/backend/internal/handler/task"
 	userHandler "github.com/kkops/backend/internal/handler/user"
+	variableHandler "github.com/kkops/backend/internal/handler/variable"
+	webhookHandler "github.com/kkops/backend/internal/handler/webhook"
 	websocketHandler "github.com/kkops/backend/internal/handler/websocket"
 	"github.com/kkops/backend/internal/middleware"
 	assetService "github.com/kkops/backend/internal/service/asset"
@@ -61,16 +70,25 @@ import (
 	cloudplatformService "github.com/kkops/backend/internal/service/cloudplatform"
 	dashboardService "github.com/kkops/backend/internal/service/dashboard"
 	deploymentService "github.com/kkops/backend/internal/service/deployment"
+	distributionService "github.com/kkops/backend/internal/service/distribution"
 	environmentService "github.com/kkops/backend/internal/service/environment"
+	factsService "github.com/kkops/backend/internal/service/facts"
+	gitsyncService "github.com/kkops/backend/internal/service/gitsync"
+	jobchainService "github.com/kkops/backend/internal/service/jobchain"
+	maintenanceService "github.com/kkops/backend/internal/service/maintenance"
 	operationtoolService "github.com/kkops/backend/internal/service/operationtool"
+	pipelineService "github.com/kkops/backend/internal/service/pipeline"
 	projectService "github.com/kkops/backend/internal/service/project"
 	rbacService "github.com/kkops/backend/internal/service/rbac"
 	roleService "github.com/kkops/backend/internal/service/role"
 	scheduledtaskService "github.com/kkops/backend/internal/service/scheduledtask"
+	secretService "github.com/kkops/backend/internal/service/secret"
 	sshkeyService "github.com/kkops/backend/internal/service/sshkey"
 	tagService "github.com/kkops/backend/internal/service/tag"
 	taskService "github.com/kkops/backend/internal/service/task"
 	userService "github.com/kkops/backend/internal/service/user"
+	variableService "github.com/kkops/backend/internal/service/variable"
+	webhookService "github.com/kkops/backend/internal/service/webhook"
 )
 
 func main() {
@@ -123,16 +141,26 @@ func main() {
 	sshkeySvc := sshkeyService.NewService(db, cfg)
 	authzSvc := authorizationService.NewService(db) // 授权服务
 	rbacSvc := rbacService.NewService(db)           // RBAC 服务
+	secretSvc := secretService.NewService(db, cfg)  // 密钥存储服务
 	taskSvc := taskService.NewService(db, authzSvc)
-	taskExecutionSvc := taskService.NewExecutionService(db, cfg, sshkeySvc)
+	maintenanceSvc := maintenanceService.NewService(db, authzSvc) // 维护窗口
+	variableSvc := variableService.NewService(db, cfg)            // 部署变量
+	taskExecutionSvc := taskService.NewExecutionService(db, cfg, sshkeySvc, secretSvc, maintenanceSvc)
 	dashboardSvc := dashboardService.NewService(db)
-	deploymentSvc := deploymentService.NewService(db, cfg)
+	deploymentSvc := deploymentService.NewService(db, cfg, secretSvc, maintenanceSvc, authzSvc, variableSvc)
 	scheduledTaskSvc := scheduledtaskService.NewService(db)
 	auditSvc := auditService.NewService(db)
 	operationtoolSvc := operationtoolService.NewService(db)
+	distributionSvc := distributionService.NewService(db, cfg, authzSvc)
+	webhookSvc := webhookService.NewService(db, cfg, taskExecutionSvc, deploymentSvc) // 入站 Webhook 触发
+	factsSvc := factsService.NewService(db, cfg)                                      // 主机事实采集
+
+	// 服务重启前未完成的部署不会再被执行：心跳过期后标记失败并释放其部署锁
+	deploymentSvc.StartRecovery(zapLogger)
+	defer deploymentSvc.StopRecovery()
 
 	// Initialize scheduler for scheduled tasks
-	scheduler := scheduledtaskService.NewScheduler(db, cfg, zapLogger)
+	scheduler := scheduledtaskService.NewScheduler(db, cfg, zapLogger, secretSvc, maintenanceSvc, deploymentSvc, factsSvc)
 	// 将调度器关联到服务，使新建的任务能被添加到调度器
 	scheduledTaskSvc.SetScheduler(scheduler)
 	if err := scheduler.Start(); err != nil {
@@ -141,6 +169,20 @@ func main() {
 		defer scheduler.Stop()
 	}
 
+	// 作业链：上游作业结束后触发下游作业
+	jobchainSvc := jobchainService.NewService(db, zapLogger, taskExecutionSvc, deploymentSvc, scheduler)
+	taskExecutionSvc.SetCompletionHook(jobchainSvc.OnJobFinished)
+	deploymentSvc.SetCompletionHook(jobchainSvc.OnJobFinished)
+	scheduler.SetCompletionHook(jobchainSvc.OnJobFinished)
+
+	// 发布流水线：版本按环境阶段依次晋级
+	pipelineSvc := pipelineService.NewService(db, deploymentSvc, authzSvc)
+
+	// Git 仓库同步：定期拉取模板与部署模块
+	gitsyncSvc := gitsyncService.NewService(db, cfg, zapLogger)
+	gitsyncSvc.Start()
+	defer gitsyncSvc.Stop()
+
 	// Initialize handlers
 	authHdl := authHandler.NewHandler(authSvc)
 	userHdl := userHandler.NewHandler(userSvc, authzSvc, rbacSvc)
@@ -160,6 +202,15 @@ func main() {
 	roleAssetHdl := roleHandler.NewAssetHandler(authzSvc)
 	userRoleHdl := userHandler.NewRoleHandler(authzSvc)
 	auditHdl := auditHandler.NewHandler(auditSvc)
+	distributionHdl := distributionHandler.NewHandler(distributionSvc)
+	secretHdl := secretHandler.NewHandler(secretSvc)
+	gitsyncHdl := gitsyncHandler.NewHandler(gitsyncSvc)
+	webhookHdl := webhookHandler.NewHandler(webhookSvc)
+	maintenanceHdl := maintenanceHandler.NewHandler(maintenanceSvc)
+	jobchainHdl := jobchainHandler.NewHandler(jobchainSvc)
+	pipelineHdl := pipelineHandler.NewHandler(pipelineSvc)
+	variableHdl := variableHandler.NewHandler(variableSvc)
+	factsHdl := factsHandler.NewHandler(factsSvc, authzSvc)
 
 	// API routes
 	api := r.Group("/api/v1")
@@ -180,6 +231,9 @@ func main() {
 			authGroup.POST("/change-password", middleware.AuthMiddleware(cfg), authHdl.ChangePassword)
 		}
 
+		// Inbound webhooks (public, authenticated by the trigger token / HMAC signature)
+		api.POST("/webhooks/:token", webhookHdl.Fire)
+
 		// User permissions (protected, but available before full menu load)
 		userPermGroup := api.Group("/user")
 		userPermGroup.Use(middleware.AuthMiddleware(cfg))
@@ -325,6 +379,21 @@ func main() {
 				assetsGroup.DELETE("/:id", assetHdl.DeleteAsset)
 				assetsGroup.POST("/import", assetHdl.ImportAssets)
 				assetsGroup.GET("/export", assetHdl.ExportAssets)
+				assetsGroup.GET("/:id/facts", factsHdl.ListFacts)
+				assetsGroup.POST("/:id/facts/collect", factsHdl.CollectFacts)
+			}
+
+			// Asset facts: collectors, mapping rules and conflicts
+			assetFactsGroup := protected.Group("/asset-facts")
+			{
+				assetFactsGroup.GET("/collectors", factsHdl.ListCollectors)
+				assetFactsGroup.GET("/rules", factsHdl.ListRules)
+				assetFactsGroup.POST("/rules", factsHdl.CreateRule)
+				assetFactsGroup.PUT("/rules/:id", factsHdl.UpdateRule)
+				assetFactsGroup.DELETE("/rules/:id", factsHdl.DeleteRule)
+				assetFactsGroup.GET("/conflicts", factsHdl.ListConflicts)
+				assetFactsGroup.POST("/conflicts/:id/accept", factsHdl.AcceptConflict)
+				assetFactsGroup.POST("/conflicts/:id/dismiss", factsHdl.DismissConflict)
 			}
 
 			// Execution template management (原 task-templates)
@@ -337,6 +406,10 @@ func main() {
 				templatesGroup.GET("/:id", taskHdl.GetTemplate)
 				templatesGroup.PUT("/:id", taskHdl.UpdateTemplate)
 				templatesGroup.DELETE("/:id", taskHdl.DeleteTemplate)
+				templatesGroup.GET("/:id/versions", taskHdl.ListTemplateVersions)
+				templatesGroup.GET("/:id/versions/diff", taskHdl.DiffTemplateVersions)
+				templatesGroup.GET("/:id/versions/:version", taskHdl.GetTemplateVersion)
+				templatesGroup.POST("/:id/versions/:version/restore", taskHdl.RestoreTemplateVersion)
 			}
 
 			// Execution management (原 tasks，运维执行)
@@ -371,6 +444,81 @@ func main() {
 				sshKeysGroup.POST("/:id/test", sshkeyHdl.TestSSHKey)
 			}
 
+			// Artifact management (文件分发制品)
+			artifactsGroup := protected.Group("/artifacts")
+			{
+				artifactsGroup.GET("", distributionHdl.ListArtifacts)
+				artifactsGroup.POST("", distributionHdl.UploadArtifact)
+				artifactsGroup.GET("/:id", distributionHdl.GetArtifact)
+				artifactsGroup.DELETE("/:id", distributionHdl.DeleteArtifact)
+			}
+
+			// File distribution management (文件分发)
+			distributionsGroup := protected.Group("/distributions")
+			{
+				distributionsGroup.GET("", distributionHdl.ListDistributions)
+				distributionsGroup.POST("", distributionHdl.CreateDistribution)
+				distributionsGroup.GET("/:id", distributionHdl.GetDistribution)
+				distributionsGroup.POST("/:id/cancel", distributionHdl.CancelDistribution)
+			}
+
+			// Secret management (密钥存储)
+			secretsGroup := protected.Group("/secrets")
+			{
+				secretsGroup.GET("", secretHdl.ListSecrets)
+				secretsGroup.POST("", secretHdl.CreateSecret)
+				secretsGroup.GET("/:id", secretHdl.GetSecret)
+				secretsGroup.PUT("/:id", secretHdl.UpdateSecret)
+				secretsGroup.DELETE("/:id", secretHdl.DeleteSecret)
+			}
+
+			// Git repository sync (Git 同步)
+			gitRepositoriesGroup := protected.Group("/git-repositories")
+			{
+				gitRepositoriesGroup.GET("", gitsyncHdl.ListRepositories)
+				gitRepositoriesGroup.POST("", gitsyncHdl.CreateRepository)
+				gitRepositoriesGroup.GET("/:id", gitsyncHdl.GetRepository)
+				gitRepositoriesGroup.PUT("/:id", gitsyncHdl.UpdateRepository)
+				gitRepositoriesGroup.DELETE("/:id", gitsyncHdl.DeleteRepository)
+				gitRepositoriesGroup.POST("/:id/sync", gitsyncHdl.SyncRepository)
+				gitRepositoriesGroup.GET("/:id/report", gitsyncHdl.GetReport)
+			}
+
+			// Webhook trigger management (Webhook 触发器)
+			webhookTriggersGroup := protected.Group("/webhook-triggers")
+			{
+				webhookTriggersGroup.GET("", webhookHdl.ListTriggers)
+				webhookTriggersGroup.POST("", webhookHdl.CreateTrigger)
+				webhookTriggersGroup.GET("/:id", webhookHdl.GetTrigger)
+				webhookTriggersGroup.PUT("/:id", webhookHdl.UpdateTrigger)
+				webhookTriggersGroup.DELETE("/:id", webhookHdl.DeleteTrigger)
+				webhookTriggersGroup.POST("/:id/rotate", webhookHdl.RotateTrigger)
+				webhookTriggersGroup.POST("/:id/revoke", webhookHdl.RevokeTrigger)
+			}
+
+			// Maintenance windows (维护窗口)
+			maintenanceWindowsGroup := protected.Group("/maintenance-windows")
+			{
+				maintenanceWindowsGroup.GET("", maintenanceHdl.ListWindows)
+				maintenanceWindowsGroup.POST("", maintenanceHdl.CreateWindow)
+				maintenanceWindowsGroup.GET("/check", maintenanceHdl.CheckAssets)
+				maintenanceWindowsGroup.GET("/:id", maintenanceHdl.GetWindow)
+				maintenanceWindowsGroup.PUT("/:id", maintenanceHdl.UpdateWindow)
+				maintenanceWindowsGroup.DELETE("/:id", maintenanceHdl.DeleteWindow)
+			}
+
+			// Job chains (作业链)
+			jobChainsGroup := protected.Group("/job-chains")
+			{
+				jobChainsGroup.GET("", jobchainHdl.ListLinks)
+				jobChainsGroup.POST("", jobchainHdl.CreateLink)
+				jobChainsGroup.GET("/runs", jobchainHdl.ListRuns)
+				jobChainsGroup.GET("/runs/:id/lineage", jobchainHdl.GetLineage)
+				jobChainsGroup.GET("/:id", jobchainHdl.GetLink)
+				jobChainsGroup.PUT("/:id", jobchainHdl.UpdateLink)
+				jobChainsGroup.DELETE("/:id", jobchainHdl.DeleteLink)
+			}
+
 			// Deployment module management
 			deploymentModulesGroup := protected.Group("/deployment-modules")
 			{
@@ -379,11 +527,15 @@ func main() {
 				deploymentModulesGroup.GET("/export", deploymentHdl.ExportModules)
 				deploymentModulesGroup.POST("/import", deploymentHdl.ImportModules)
 				deploymentModulesGroup.POST("/import/preview", deploymentHdl.PreviewImport)
+				deploymentModulesGroup.GET("/version-sources", deploymentHdl.ListVersionSources)
 				deploymentModulesGroup.GET("/:id", deploymentHdl.GetModule)
 				deploymentModulesGroup.PUT("/:id", deploymentHdl.UpdateModule)
 				deploymentModulesGroup.DELETE("/:id", deploymentHdl.DeleteModule)
 				deploymentModulesGroup.GET("/:id/versions", deploymentHdl.GetVersions)
 				deploymentModulesGroup.POST("/:id/deploy", deploymentHdl.Deploy)
+				deploymentModulesGroup.POST("/:id/rollback", deploymentHdl.Rollback)
+				deploymentModulesGroup.GET("/:id/hosts", deploymentHdl.HostVersions)
+				deploymentModulesGroup.GET("/:id/variables", deploymentHdl.GetModuleVariables)
 			}
 
 			// Deployment history management
@@ -392,6 +544,40 @@ func main() {
 				deploymentsGroup.GET("", deploymentHdl.ListDeployments)
 				deploymentsGroup.GET("/:id", deploymentHdl.GetDeployment)
 				deploymentsGroup.POST("/:id/cancel", deploymentHdl.CancelDeployment)
+				deploymentsGroup.POST("/:id/continue", deploymentHdl.ContinueDeployment)
+				deploymentsGroup.POST("/:id/retry", deploymentHdl.RetryDeployment)
+			}
+
+			// Deployment locks
+			deploymentLocksGroup := protected.Group("/deployment-locks")
+			{
+				deploymentLocksGroup.GET("", deploymentHdl.ListLocks)
+				deploymentLocksGroup.DELETE("/:id", deploymentHdl.BreakLock)
+			}
+
+			// Deployment variables (部署变量)
+			deploymentVariablesGroup := protected.Group("/deployment-variables")
+			{
+				deploymentVariablesGroup.GET("", variableHdl.ListVariables)
+				deploymentVariablesGroup.POST("", variableHdl.CreateVariable)
+				deploymentVariablesGroup.GET("/:id", variableHdl.GetVariable)
+				deploymentVariablesGroup.PUT("/:id", variableHdl.UpdateVariable)
+				deploymentVariablesGroup.DELETE("/:id", variableHdl.DeleteVariable)
+			}
+
+			// Release pipelines (发布流水线)
+			releasePipelinesGroup := protected.Group("/release-pipelines")
+			{
+				releasePipelinesGroup.GET("", pipelineHdl.ListPipelines)
+				releasePipelinesGroup.POST("", pipelineHdl.CreatePipeline)
+				releasePipelinesGroup.POST("/promotions/:id/approve", pipelineHdl.ApprovePromotion)
+				releasePipelinesGroup.POST("/promotions/:id/reject", pipelineHdl.RejectPromotion)
+				releasePipelinesGroup.GET("/:id", pipelineHdl.GetPipeline)
+				releasePipelinesGroup.PUT("/:id", pipelineHdl.UpdatePipeline)
+				releasePipelinesGroup.DELETE("/:id", pipelineHdl.DeletePipeline)
+				releasePipelinesGroup.GET("/:id/matrix", pipelineHdl.GetMatrix)
+				releasePipelinesGroup.GET("/:id/promotions", pipelineHdl.ListPromotions)
+				releasePipelinesGroup.POST("/:id/promotions", pipelineHdl.Promote)
 			}
 
 			// Scheduled task management (定时任务)
@@ -400,6 +586,8 @@ func main() {
 				tasksGroup.GET("", scheduledTaskHdl.ListScheduledTasks)
 				tasksGroup.POST("", scheduledTaskHdl.CreateScheduledTask)
 				tasksGroup.GET("/validate-cron", scheduledTaskHdl.ValidateCron)
+				tasksGroup.GET("/scheduler/status", scheduledTaskHdl.GetSchedulerStatus)
+				tasksGroup.GET("/calendar", scheduledTaskHdl.GetScheduleCalendar)
 				tasksGroup.GET("/export", scheduledTaskHdl.ExportScheduledTasks)
 				tasksGroup.POST("/import", scheduledTaskHdl.ImportScheduledTasks)
 				tasksGroup.GET("/:id", scheduledTaskHdl.GetScheduledTask)
@@ -407,7 +595,10 @@ func main() {
 				tasksGroup.DELETE("/:id", scheduledTaskHdl.DeleteScheduledTask)
 				tasksGroup.POST("/:id/enable", scheduledTaskHdl.EnableScheduledTask)
 				tasksGroup.POST("/:id/disable", scheduledTaskHdl.DisableScheduledTask)
+				tasksGroup.POST("/:id/run-now", scheduledTaskHdl.RunScheduledTaskNow)
 				tasksGroup.GET("/:id/executions", scheduledTaskHdl.GetScheduledTaskExecutions)
+				tasksGroup.GET("/:id/fires", scheduledTaskHdl.GetScheduledTaskFires)
+				tasksGroup.GET("/:id/upcoming", scheduledTaskHdl.GetUpcomingFires)
 			}
 		}
 	}
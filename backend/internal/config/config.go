@@ -20,6 +20,8 @@ type Config struct {
 	JWT        JWTConfig        `mapstructure:"jwt"`
 	Encryption EncryptionConfig `mapstructure:"encryption"`
 	Log        LogConfig        `mapstructure:"log"`
+	Storage    StorageConfig    `mapstructure:"storage"`
+	Scheduler  SchedulerConfig  `mapstructure:"scheduler"`
 }
 
 // ServerConfig holds server configuration
@@ -61,6 +63,19 @@ type EncryptionConfig struct {
 	Key string `mapstructure:"key"` // Encryption key for SSH keys and sensitive data
 }
 
+// StorageConfig holds local file storage configuration
+type StorageConfig struct {
+	ArtifactDir string `mapstructure:"artifact_dir"` // Directory for uploaded distribution artifacts
+	GitDir      string `mapstructure:"git_dir"`      // Working directory for Git repository checkouts
+}
+
+// SchedulerConfig holds scheduled task leader election configuration
+type SchedulerConfig struct {
+	InstanceID    string `mapstructure:"instance_id"`    // Unique replica ID, defaults to hostname-pid
+	LeaseTTL      int    `mapstructure:"lease_ttl"`      // seconds; a leader that stops renewing is replaced after this
+	RenewInterval int    `mapstructure:"renew_interval"` // seconds between lease renewals
+}
+
 // LogConfig holds logging configuration
 type LogConfig struct {
 	Level  string `mapstructure:"level"`  // debug, info, warn, error
@@ -98,6 +113,10 @@ func Load(configPath string) (*Config, error) {
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.format", "text") // text for dev, json for production
 	viper.SetDefault("log.output", "stdout")
+	viper.SetDefault("storage.artifact_dir", "./data/artifacts")
+	viper.SetDefault("storage.git_dir", "./data/git")
+	viper.SetDefault("scheduler.lease_ttl", 30)
+	viper.SetDefault("scheduler.renew_interval", 10)
 
 	// Read from environment variables
 	viper.AutomaticEnv()
@@ -484,13 +484,36 @@ func migrate(db *gorm.DB) error {
 		&model.AssetTag{},
 		&model.SSHKey{},
 		&model.TaskTemplate{},
+		&model.TaskTemplateVersion{},
 		&model.Task{},
 		&model.TaskExecution{},
 		&model.ScheduledTask{},
 		&model.DeploymentModule{},
 		&model.Deployment{},
+		&model.DeploymentBatch{},
+		&model.DeploymentTarget{},
+		&model.DeploymentLock{},
+		&model.ReleasePipeline{},
+		&model.PipelineStage{},
+		&model.PipelinePromotion{},
+		&model.DeploymentVariable{},
 		&model.AuditLog{},
 		&model.OperationTool{},
+		&model.FileArtifact{},
+		&model.Distribution{},
+		&model.DistributionTarget{},
+		&model.Secret{},
+		&model.GitRepository{},
+		&model.WebhookTrigger{},
+		&model.WebhookDelivery{},
+		&model.SchedulerLease{},
+		&model.ScheduledTaskFire{},
+		&model.MaintenanceWindow{},
+		&model.JobChainLink{},
+		&model.JobChainRun{},
+		&model.AssetFact{},
+		&model.FactMappingRule{},
+		&model.AssetFactConflict{},
 	); err != nil {
 		return err
 	}
@@ -506,10 +529,22 @@ func migrate(db *gorm.DB) error {
 	if err := seedDefaultTemplates(db); err != nil {
 		return err
 	}
+	// Record an initial version for templates created before versioning
+	if err := backfillTemplateVersions(db); err != nil {
+		return err
+	}
+	// Record the environment on deployments and host targets created before it was stored
+	if err := backfillDeploymentEnvironments(db); err != nil {
+		return err
+	}
 	// Initialize default scheduled tasks
 	if err := seedDefaultScheduledTasks(db); err != nil {
 		return err
 	}
+	// Initialize default fact mapping rules
+	if err := seedDefaultFactMappingRules(db); err != nil {
+		return err
+	}
 	// Initialize default operation tools
 	if err := seedDefaultOperationTools(db); err != nil {
 		return err
@@ -518,6 +553,77 @@ func migrate(db *gorm.DB) error {
 	return seedMenuPermissions(db)
 }
 
+// backfillTemplateVersions creates version 1 for templates that have no version history yet
+func backfillTemplateVersions(db *gorm.DB) error {
+	var templates []model.TaskTemplate
+	if err := db.Where("latest_version = 0").Find(&templates).Error; err != nil {
+		return err
+	}
+
+	for _, t := range templates {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&model.TaskTemplateVersion{
+				TemplateID:  t.ID,
+				Version:     1,
+				Name:        t.Name,
+				Description: t.Description,
+				Content:     t.Content,
+				Type:        t.Type,
+				ChangeNote:  "initial version",
+				CreatedBy:   t.CreatedBy,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&model.TaskTemplate{}).Where("id = ?", t.ID).Update("latest_version", 1).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to backfill version for template %d: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// backfillDeploymentEnvironments sets the environment of older deployments to their
+// module's environment and copies it to their host targets, so rollbacks can find
+// the history of an environment
+func backfillDeploymentEnvironments(db *gorm.DB) error {
+	if err := db.Exec(`UPDATE deployments SET environment_id = m.environment_id
+		FROM deployment_modules m
+		WHERE deployments.module_id = m.id AND deployments.environment_id IS NULL AND m.environment_id IS NOT NULL`).Error; err != nil {
+		return fmt.Errorf("failed to backfill deployment environments: %w", err)
+	}
+	if err := db.Exec(`UPDATE deployment_targets SET environment_id = d.environment_id
+		FROM deployments d
+		WHERE deployment_targets.deployment_id = d.id AND deployment_targets.environment_id IS NULL AND d.environment_id IS NOT NULL`).Error; err != nil {
+		return fmt.Errorf("failed to backfill deployment target environments: %w", err)
+	}
+	return nil
+}
+
+// seedDefaultFactMappingRules creates the mapping rules from collected facts to asset fields.
+// CPU, memory and disk keep the behaviour of the system info task (overwrite);
+// the host name is only filled when empty, a different name is reported as a conflict.
+func seedDefaultFactMappingRules(db *gorm.DB) error {
+	defaultRules := []model.FactMappingRule{
+		{FactName: "host.name", AssetField: "host_name", Mode: "fill_empty", Enabled: true, Description: "主机名仅在为空时写入，不一致时记录冲突"},
+		{FactName: "cpu.summary", AssetField: "cpu", Mode: "overwrite", Enabled: true, Description: "CPU 型号与核数"},
+		{FactName: "memory.total", AssetField: "memory", Mode: "overwrite", Enabled: true, Description: "内存总量"},
+		{FactName: "disk.total", AssetField: "disk", Mode: "overwrite", Enabled: true, Description: "根分区大小"},
+	}
+
+	for _, rule := range defaultRules {
+		var count int64
+		db.Model(&model.FactMappingRule{}).Where("asset_field = ?", rule.AssetField).Count(&count)
+		if count > 0 {
+			continue
+		}
+		if err := db.Create(&rule).Error; err != nil {
+			return fmt.Errorf("failed to create fact mapping rule %s: %w", rule.AssetField, err)
+		}
+	}
+	return nil
+}
+
 // seedDefaultOperationTools creates default operation tools
 func seedDefaultOperationTools(db *gorm.DB) error {
 	// 辅助函数：检查工具是否存在
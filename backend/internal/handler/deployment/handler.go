@@ -7,6 +7,7 @@ package deployment
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -147,6 +148,7 @@ func (h *Handler) UpdateModule(c *gin.Context) {
 // @Param id path int true "Module ID"
 // @Success 204
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /api/v1/deployment-modules/{id} [delete]
 func (h *Handler) DeleteModule(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -156,6 +158,10 @@ func (h *Handler) DeleteModule(c *gin.Context) {
 	}
 
 	if err := h.service.DeleteModule(uint(id)); err != nil {
+		if errors.Is(err, deployment.ErrModuleManagedByGit) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
 		return
 	}
@@ -165,10 +171,11 @@ func (h *Handler) DeleteModule(c *gin.Context) {
 
 // GetVersions handles version list retrieval from version source
 // @Summary Get versions
-// @Description Get available versions from version source URL
+// @Description Get available versions from the module's version source (custom JSON, HTTP with JSONPath, Docker Registry, Git tags, Maven metadata or a static list), filtered and sorted as configured
 // @Tags deployment
 // @Produce json
 // @Param id path int true "Module ID"
+// @Param refresh query bool false "Bypass the version cache"
 // @Success 200 {object} deployment.VersionSourceResponse
 // @Failure 400 {object} map[string]string
 // @Router /api/v1/deployment-modules/{id}/versions [get]
@@ -179,7 +186,8 @@ func (h *Handler) GetVersions(c *gin.Context) {
 		return
 	}
 
-	versions, err := h.service.GetVersions(uint(id))
+	refresh := c.Query("refresh") == "true"
+	versions, err := h.service.GetVersions(c.Request.Context(), uint(id), refresh)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -188,6 +196,17 @@ func (h *Handler) GetVersions(c *gin.Context) {
 	c.JSON(http.StatusOK, versions)
 }
 
+// ListVersionSources handles version source type listing
+// @Summary List version source types
+// @Description List the version source types a module can use
+// @Tags deployment
+// @Produce json
+// @Success 200 {array} versionsource.SourceInfo
+// @Router /api/v1/deployment-modules/version-sources [get]
+func (h *Handler) ListVersionSources(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListVersionSources())
+}
+
 // Deploy handles deployment execution
 // @Summary Execute deployment
 // @Description Execute deployment for a module with selected version
@@ -198,6 +217,7 @@ func (h *Handler) GetVersions(c *gin.Context) {
 // @Param request body deployment.DeployRequest true "Deploy request"
 // @Success 201 {object} deployment.DeploymentResponse
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "Another deployment holds the lock"
 // @Router /api/v1/deployment-modules/{id}/deploy [post]
 func (h *Handler) Deploy(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -215,6 +235,48 @@ func (h *Handler) Deploy(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 
 	resp, err := h.service.Deploy(uint(id), &req, userID)
+	if err != nil {
+		var locked *deployment.LockedError
+		if errors.As(err, &locked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "lock": locked.Lock})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Rollback handles module rollback
+// @Summary Roll back deployment module
+// @Description Redeploy, for each host, the last version that deployed successfully in the environment (the module's unless environment_id is given) before its current one. Hosts rolling back to the same version share one deployment; the module's rollback script is used when configured.
+// @Tags deployment
+// @Accept json
+// @Produce json
+// @Param id path int true "Module ID"
+// @Param request body deployment.RollbackRequest false "Rollback request"
+// @Success 201 {object} deployment.RollbackResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/deployment-modules/{id}/rollback [post]
+func (h *Handler) Rollback(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid module ID"})
+		return
+	}
+
+	var req deployment.RollbackRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint)
+
+	resp, err := h.service.Rollback(uint(id), &req, userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -223,6 +285,68 @@ func (h *Handler) Deploy(c *gin.Context) {
 	c.JSON(http.StatusCreated, resp)
 }
 
+// HostVersions handles host version inventory retrieval
+// @Summary Get host version inventory
+// @Description List, for every host the module has been deployed to, the version it currently runs (its newest successful deployment) and the result of its newest attempt
+// @Tags deployment
+// @Produce json
+// @Param id path int true "Module ID"
+// @Success 200 {array} deployment.HostVersion
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/deployment-modules/{id}/hosts [get]
+func (h *Handler) HostVersions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid module ID"})
+		return
+	}
+
+	versions, err := h.service.HostVersions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetModuleVariables handles effective variable preview
+// @Summary Get effective deployment variables
+// @Description List the variables a deployment of the module would use after applying precedence (project < environment < project+environment < module < module+environment); secret values are masked
+// @Tags deployment
+// @Produce json
+// @Param id path int true "Module ID"
+// @Param environment_id query int false "Environment ID, defaults to the module's environment"
+// @Success 200 {array} variable.Value
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/deployment-modules/{id}/variables [get]
+func (h *Handler) GetModuleVariables(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid module ID"})
+		return
+	}
+
+	var environmentID *uint
+	if v := c.Query("environment_id"); v != "" {
+		envID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid environment_id"})
+			return
+		}
+		id := uint(envID)
+		environmentID = &id
+	}
+
+	vars, err := h.service.EffectiveVariables(uint(id), environmentID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, vars)
+}
+
 // GetDeployment handles deployment record retrieval
 // @Summary Get deployment
 // @Description Get deployment record by ID
@@ -294,7 +418,7 @@ func (h *Handler) ListDeployments(c *gin.Context) {
 
 // CancelDeployment handles deployment cancellation
 // @Summary Cancel deployment
-// @Description Cancel a running deployment
+// @Description Cancel a pending, running or waiting deployment. No further hosts are started, running scripts are killed and hosts that did not run are marked skipped.
 // @Tags deployment
 // @Param id path int true "Deployment ID"
 // @Success 200 {object} map[string]string
@@ -315,6 +439,135 @@ func (h *Handler) CancelDeployment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "deployment cancelled"})
 }
 
+// ContinueDeployment handles releasing a manual rollout gate
+// @Summary Continue deployment
+// @Description Start the next batch of a rolling deployment that is waiting for manual confirmation
+// @Tags deployment
+// @Param id path int true "Deployment ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/deployments/{id}/continue [post]
+func (h *Handler) ContinueDeployment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment ID"})
+		return
+	}
+
+	if err := h.service.ContinueDeployment(uint(id)); err != nil {
+		if errors.Is(err, deployment.ErrDeploymentNotWaiting) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deployment continued"})
+}
+
+// RetryDeployment handles redeploying to individual hosts
+// @Summary Retry deployment
+// @Description Redeploy a finished deployment's version to the given hosts, or to the hosts that failed when none are given
+// @Tags deployment
+// @Accept json
+// @Produce json
+// @Param id path int true "Deployment ID"
+// @Param request body deployment.RetryRequest false "Retry request"
+// @Success 201 {object} deployment.DeploymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/deployments/{id}/retry [post]
+func (h *Handler) RetryDeployment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment ID"})
+		return
+	}
+
+	var req deployment.RetryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint)
+
+	resp, err := h.service.RetryDeployment(uint(id), &req, userID)
+	if err != nil {
+		var locked *deployment.LockedError
+		if errors.As(err, &locked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "lock": locked.Lock})
+			return
+		}
+		if errors.Is(err, deployment.ErrNoHostsToRetry) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListLocks handles listing held deployment locks
+// @Summary List deployment locks
+// @Description List the locks held by running deployments, with the user and deployment holding each lock
+// @Tags deployment
+// @Produce json
+// @Success 200 {array} deployment.LockResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/deployment-locks [get]
+func (h *Handler) ListLocks(c *gin.Context) {
+	locks, err := h.service.ListLocks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, locks)
+}
+
+// BreakLock handles removing a stale deployment lock
+// @Summary Break deployment lock
+// @Description Remove a deployment lock, e.g. one left behind by a deployment interrupted by a restart (admin only)
+// @Tags deployment
+// @Produce json
+// @Param id path int true "Lock ID"
+// @Success 200 {object} deployment.LockResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/deployment-locks/{id} [delete]
+func (h *Handler) BreakLock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lock ID"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+
+	resp, err := h.service.BreakLock(uint(id), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, deployment.ErrBreakLockNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, deployment.ErrLockNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // ExportModuleConfig 导出配置结构
 type ExportModuleConfig struct {
 	Name             string   `json:"name"`
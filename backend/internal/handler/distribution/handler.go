@@ -0,0 +1,252 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package distribution
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/distribution"
+)
+
+// Handler handles artifact and file distribution HTTP requests
+type Handler struct {
+	service *distribution.Service
+}
+
+// NewHandler creates a new distribution handler
+func NewHandler(service *distribution.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// UploadArtifact handles artifact upload
+// @Summary Upload artifact
+// @Description Upload a file (or tar.gz archive of a directory) for fleet distribution
+// @Tags distributions
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Artifact file"
+// @Param name formData string false "Artifact name"
+// @Param description formData string false "Description"
+// @Param kind formData string false "file or archive"
+// @Success 201 {object} distribution.ArtifactResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/artifacts [post]
+func (h *Handler) UploadArtifact(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	var req distribution.UploadArtifactRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to open file"})
+		return
+	}
+	defer f.Close()
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.UploadArtifact(userID, file.Filename, &req, f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListArtifacts handles artifact list retrieval
+// @Summary List artifacts
+// @Description Get list of uploaded artifacts
+// @Tags distributions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} distribution.ArtifactResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/artifacts [get]
+func (h *Handler) ListArtifacts(c *gin.Context) {
+	artifacts, err := h.service.ListArtifacts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, artifacts)
+}
+
+// GetArtifact handles artifact retrieval
+// @Summary Get artifact
+// @Description Get artifact by ID
+// @Tags distributions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Artifact ID"
+// @Success 200 {object} distribution.ArtifactResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/artifacts/{id} [get]
+func (h *Handler) GetArtifact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid artifact ID"})
+		return
+	}
+
+	resp, err := h.service.GetArtifact(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteArtifact handles artifact deletion
+// @Summary Delete artifact
+// @Description Delete an artifact by ID
+// @Tags distributions
+// @Security BearerAuth
+// @Param id path int true "Artifact ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/artifacts/{id} [delete]
+func (h *Handler) DeleteArtifact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid artifact ID"})
+		return
+	}
+
+	if err := h.service.DeleteArtifact(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateDistribution handles distribution creation
+// @Summary Create distribution
+// @Description Distribute an artifact to target assets in parallel over SFTP
+// @Tags distributions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body distribution.CreateDistributionRequest true "Create distribution request"
+// @Success 201 {object} distribution.DistributionResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/distributions [post]
+func (h *Handler) CreateDistribution(c *gin.Context) {
+	var req distribution.CreateDistributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateDistribution(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListDistributions handles distribution list retrieval
+// @Summary List distributions
+// @Description Get paginated list of distributions
+// @Tags distributions
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{} "Response with data, total, page, and size"
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/distributions [get]
+func (h *Handler) ListDistributions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	dists, total, err := h.service.ListDistributions(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  dists,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// GetDistribution handles distribution retrieval
+// @Summary Get distribution
+// @Description Get distribution with per-host results
+// @Tags distributions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Distribution ID"
+// @Success 200 {object} distribution.DistributionResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/distributions/{id} [get]
+func (h *Handler) GetDistribution(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid distribution ID"})
+		return
+	}
+
+	resp, err := h.service.GetDistribution(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "distribution not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelDistribution handles distribution cancellation
+// @Summary Cancel distribution
+// @Description Cancel a running distribution
+// @Tags distributions
+// @Security BearerAuth
+// @Param id path int true "Distribution ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/distributions/{id}/cancel [post]
+func (h *Handler) CancelDistribution(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid distribution ID"})
+		return
+	}
+
+	if err := h.service.CancelDistribution(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "distribution cancelled"})
+}
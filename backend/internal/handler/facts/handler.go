@@ -0,0 +1,334 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package facts
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/authorization"
+	"github.com/kkops/backend/internal/service/facts"
+)
+
+// Handler handles asset fact HTTP requests
+type Handler struct {
+	service  *facts.Service
+	authzSvc *authorization.Service
+}
+
+// NewHandler creates a new asset fact handler
+func NewHandler(service *facts.Service, authzSvc *authorization.Service) *Handler {
+	return &Handler{service: service, authzSvc: authzSvc}
+}
+
+// CollectRequest represents a request to collect facts from an asset
+type CollectRequest struct {
+	Collectors []string `json:"collectors"` // 为空时运行全部采集器
+}
+
+// ListFacts handles fact listing for an asset
+// @Summary List asset facts
+// @Description List the facts collected from an asset with their collection time
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Asset ID"
+// @Param prefix query string false "Fact name prefix, e.g. os."
+// @Success 200 {array} facts.FactResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/assets/{id}/facts [get]
+func (h *Handler) ListFacts(c *gin.Context) {
+	assetID, ok := h.assetParam(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.ListFacts(assetID, c.Query("prefix"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CollectFacts handles on-demand fact collection
+// @Summary Collect asset facts
+// @Description Run fact collectors on an asset over SSH, store the facts and apply the mapping rules
+// @Tags asset-facts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Asset ID"
+// @Param request body CollectRequest false "Collectors to run (all when empty)"
+// @Success 200 {object} facts.CollectResult
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/assets/{id}/facts/collect [post]
+func (h *Handler) CollectFacts(c *gin.Context) {
+	assetID, ok := h.assetParam(c)
+	if !ok {
+		return
+	}
+
+	var req CollectRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp, err := h.service.CollectAsset(c.Request.Context(), assetID, req.Collectors)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListCollectors handles collector listing
+// @Summary List fact collectors
+// @Description List the registered fact collectors
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} facts.CollectorInfo
+// @Router /api/v1/asset-facts/collectors [get]
+func (h *Handler) ListCollectors(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListCollectors())
+}
+
+// ListRules handles mapping rule listing
+// @Summary List fact mapping rules
+// @Description List the rules that map collected facts onto asset fields
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} model.FactMappingRule
+// @Router /api/v1/asset-facts/rules [get]
+func (h *Handler) ListRules(c *gin.Context) {
+	rules, err := h.service.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule handles mapping rule creation
+// @Summary Create fact mapping rule
+// @Description Map a fact onto an asset field. Mode overwrite replaces the field, fill_empty only fills an empty field and report never writes; differences that are not written are recorded as conflicts.
+// @Tags asset-facts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body facts.RuleRequest true "Rule"
+// @Success 201 {object} model.FactMappingRule
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/asset-facts/rules [post]
+func (h *Handler) CreateRule(c *gin.Context) {
+	var req facts.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.CreateRule(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule handles mapping rule update
+// @Summary Update fact mapping rule
+// @Description Update a fact mapping rule
+// @Tags asset-facts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Rule ID"
+// @Param request body facts.RuleRequest true "Rule"
+// @Success 200 {object} model.FactMappingRule
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/asset-facts/rules/{id} [put]
+func (h *Handler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule ID"})
+		return
+	}
+
+	var req facts.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.UpdateRule(uint(id), &req)
+	if err != nil {
+		if errors.Is(err, facts.ErrRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule handles mapping rule deletion
+// @Summary Delete fact mapping rule
+// @Description Delete a fact mapping rule; the asset field is no longer updated from facts
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Rule ID"
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/asset-facts/rules/{id} [delete]
+func (h *Handler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule ID"})
+		return
+	}
+
+	if err := h.service.DeleteRule(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "rule deleted successfully"})
+}
+
+// ListConflicts handles conflict listing
+// @Summary List fact conflicts
+// @Description List differences between asset fields and collected facts that the mapping rules did not write
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Status (open, accepted, dismissed, resolved)"
+// @Param asset_id query int false "Asset ID"
+// @Param page query int false "Page" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/asset-facts/conflicts [get]
+func (h *Handler) ListConflicts(c *gin.Context) {
+	var assetID uint
+	if v := c.Query("asset_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid asset_id"})
+			return
+		}
+		assetID = uint(id)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	conflicts, total, err := h.service.ListConflicts(strings.TrimSpace(c.Query("status")), assetID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  conflicts,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// AcceptConflict handles accepting a conflict
+// @Summary Accept fact conflict
+// @Description Write the collected value to the asset field and close the conflict
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Conflict ID"
+// @Success 200 {object} facts.ConflictResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/asset-facts/conflicts/{id}/accept [post]
+func (h *Handler) AcceptConflict(c *gin.Context) {
+	h.resolveConflict(c, h.service.AcceptConflict)
+}
+
+// DismissConflict handles dismissing a conflict
+// @Summary Dismiss fact conflict
+// @Description Keep the asset's value; the same conflict is not raised again until either value changes
+// @Tags asset-facts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Conflict ID"
+// @Success 200 {object} facts.ConflictResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/asset-facts/conflicts/{id}/dismiss [post]
+func (h *Handler) DismissConflict(c *gin.Context) {
+	h.resolveConflict(c, h.service.DismissConflict)
+}
+
+func (h *Handler) resolveConflict(c *gin.Context, resolve func(id, userID uint) (*facts.ConflictResponse, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conflict ID"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := resolve(uint(id), userID)
+	if err != nil {
+		if errors.Is(err, facts.ErrConflictNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// assetParam parses the asset ID path parameter and checks the user's access to it
+func (h *Handler) assetParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid asset ID"})
+		return 0, false
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	hasAccess, err := h.authzSvc.HasAssetAccess(userID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permission"})
+		return 0, false
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return 0, false
+	}
+	return uint(id), true
+}
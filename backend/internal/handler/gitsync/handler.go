@@ -0,0 +1,215 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/gitsync"
+)
+
+// Handler handles Git repository sync HTTP requests
+type Handler struct {
+	service *gitsync.Service
+}
+
+// NewHandler creates a new Git sync handler
+func NewHandler(service *gitsync.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateRepository handles Git repository registration
+// @Summary Create git repository
+// @Description Register a Git repository (URL or local path) as a source of templates and deployment modules
+// @Tags git-repositories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body gitsync.CreateRepositoryRequest true "Create repository request"
+// @Success 201 {object} gitsync.RepositoryResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/git-repositories [post]
+func (h *Handler) CreateRepository(c *gin.Context) {
+	var req gitsync.CreateRepositoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateRepository(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetRepository handles Git repository retrieval
+// @Summary Get git repository
+// @Description Get Git repository by ID, including last sync status
+// @Tags git-repositories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Repository ID"
+// @Success 200 {object} gitsync.RepositoryResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/git-repositories/{id} [get]
+func (h *Handler) GetRepository(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return
+	}
+
+	resp, err := h.service.GetRepository(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListRepositories handles Git repository listing
+// @Summary List git repositories
+// @Description List all Git repositories
+// @Tags git-repositories
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} gitsync.RepositoryResponse
+// @Router /api/v1/git-repositories [get]
+func (h *Handler) ListRepositories(c *gin.Context) {
+	resp, err := h.service.ListRepositories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateRepository handles Git repository update
+// @Summary Update git repository
+// @Description Update Git repository settings
+// @Tags git-repositories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Repository ID"
+// @Param request body gitsync.UpdateRepositoryRequest true "Update repository request"
+// @Success 200 {object} gitsync.RepositoryResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/git-repositories/{id} [put]
+func (h *Handler) UpdateRepository(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return
+	}
+
+	var req gitsync.UpdateRepositoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateRepository(uint(id), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteRepository handles Git repository deletion
+// @Summary Delete git repository
+// @Description Delete a Git repository; its managed templates and modules are detached, not deleted
+// @Tags git-repositories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Repository ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/git-repositories/{id} [delete]
+func (h *Handler) DeleteRepository(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return
+	}
+
+	if err := h.service.DeleteRepository(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "repository deleted successfully"})
+}
+
+// SyncRepository handles a manual sync
+// @Summary Sync git repository
+// @Description Pull the repository and upsert its templates and modules; dry_run only reports the drift
+// @Tags git-repositories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Repository ID"
+// @Param dry_run query bool false "Only report what would change"
+// @Success 200 {object} gitsync.SyncReport
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/git-repositories/{id}/sync [post]
+func (h *Handler) SyncRepository(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	report, err := h.service.Sync(uint(id), dryRun)
+	if err != nil {
+		if errors.Is(err, gitsync.ErrSyncInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetReport handles retrieval of the last sync report
+// @Summary Get last sync report
+// @Description Get the drift report of the last (non dry-run) sync
+// @Tags git-repositories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Repository ID"
+// @Success 200 {object} gitsync.SyncReport
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/git-repositories/{id}/report [get]
+func (h *Handler) GetReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return
+	}
+
+	report, err := h.service.GetLastReport(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package jobchain
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/jobchain"
+)
+
+// Handler handles job chain HTTP requests
+type Handler struct {
+	service *jobchain.Service
+}
+
+// NewHandler creates a new job chain handler
+func NewHandler(service *jobchain.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateLink handles chain link creation
+// @Summary Create job chain link
+// @Description Start a downstream task, scheduled task or deployment when an upstream job finishes with a matching status
+// @Tags job-chains
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body jobchain.CreateLinkRequest true "Create link request"
+// @Success 201 {object} jobchain.LinkResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/job-chains [post]
+func (h *Handler) CreateLink(c *gin.Context) {
+	var req jobchain.CreateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateLink(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetLink handles chain link retrieval
+// @Summary Get job chain link
+// @Description Get job chain link by ID
+// @Tags job-chains
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Link ID"
+// @Success 200 {object} jobchain.LinkResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/job-chains/{id} [get]
+func (h *Handler) GetLink(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link ID"})
+		return
+	}
+
+	resp, err := h.service.GetLink(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListLinks handles chain link listing
+// @Summary List job chain links
+// @Description List job chain links, optionally filtered by upstream or downstream job
+// @Tags job-chains
+// @Produce json
+// @Security BearerAuth
+// @Param source_type query string false "Upstream job type (task, scheduled_task, deployment)"
+// @Param source_id query int false "Upstream task ID, scheduled task ID or deployment module ID"
+// @Param target_type query string false "Downstream job type (task, scheduled_task, deployment)"
+// @Param target_id query int false "Downstream task ID, scheduled task ID or deployment module ID"
+// @Success 200 {array} jobchain.LinkResponse
+// @Router /api/v1/job-chains [get]
+func (h *Handler) ListLinks(c *gin.Context) {
+	sourceID, ok := queryID(c, "source_id")
+	if !ok {
+		return
+	}
+	targetID, ok := queryID(c, "target_id")
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.ListLinks(c.Query("source_type"), sourceID, c.Query("target_type"), targetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateLink handles chain link update
+// @Summary Update job chain link
+// @Description Update a job chain link's name, condition, downstream version or enabled state
+// @Tags job-chains
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Link ID"
+// @Param request body jobchain.UpdateLinkRequest true "Update link request"
+// @Success 200 {object} jobchain.LinkResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/job-chains/{id} [put]
+func (h *Handler) UpdateLink(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link ID"})
+		return
+	}
+
+	var req jobchain.UpdateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateLink(uint(id), &req)
+	if err != nil {
+		if errors.Is(err, jobchain.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteLink handles chain link deletion
+// @Summary Delete job chain link
+// @Description Delete a job chain link; its run history is kept
+// @Tags job-chains
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Link ID"
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/job-chains/{id} [delete]
+func (h *Handler) DeleteLink(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link ID"})
+		return
+	}
+
+	if err := h.service.DeleteLink(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "link deleted successfully"})
+}
+
+// ListRuns handles chain run history listing
+// @Summary List job chain runs
+// @Description List the downstream jobs started by job chains, newest first
+// @Tags job-chains
+// @Produce json
+// @Security BearerAuth
+// @Param link_id query int false "Link ID"
+// @Param source_type query string false "Upstream job type"
+// @Param source_id query int false "Upstream job ID"
+// @Param target_type query string false "Downstream job type"
+// @Param target_id query int false "Downstream job ID"
+// @Param page query int false "Page" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/job-chains/runs [get]
+func (h *Handler) ListRuns(c *gin.Context) {
+	filter := jobchain.ListRunsFilter{
+		SourceType: c.Query("source_type"),
+		TargetType: c.Query("target_type"),
+	}
+	var ok bool
+	if filter.LinkID, ok = queryID(c, "link_id"); !ok {
+		return
+	}
+	if filter.SourceID, ok = queryID(c, "source_id"); !ok {
+		return
+	}
+	if filter.TargetID, ok = queryID(c, "target_id"); !ok {
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+
+	runs, total, err := h.service.ListRuns(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  runs,
+		"total": total,
+		"page":  filter.Page,
+		"size":  filter.PageSize,
+	})
+}
+
+// GetLineage handles chain lineage retrieval
+// @Summary Get job chain lineage
+// @Description Get the chain from its first upstream job to the given run, and the runs it led to. Execution records and deployments started by a chain carry chain_run_id.
+// @Tags job-chains
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Chain run ID"
+// @Success 200 {object} jobchain.LineageResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/job-chains/runs/{id}/lineage [get]
+func (h *Handler) GetLineage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run ID"})
+		return
+	}
+
+	resp, err := h.service.GetLineage(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chain run not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// queryID parses an optional ID query parameter; it writes a 400 response and returns false when invalid
+func queryID(c *gin.Context, name string) (uint, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package maintenance
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/maintenance"
+)
+
+// Handler handles maintenance window HTTP requests
+type Handler struct {
+	service *maintenance.Service
+}
+
+// NewHandler creates a new maintenance window handler
+func NewHandler(service *maintenance.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateWindow handles maintenance window creation
+// @Summary Create maintenance window
+// @Description Create a recurring blackout or allow window attached to all hosts, an environment, a project or a single asset
+// @Tags maintenance-windows
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body maintenance.CreateWindowRequest true "Create window request"
+// @Success 201 {object} maintenance.WindowResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/maintenance-windows [post]
+func (h *Handler) CreateWindow(c *gin.Context) {
+	var req maintenance.CreateWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateWindow(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetWindow handles maintenance window retrieval
+// @Summary Get maintenance window
+// @Description Get maintenance window by ID, including whether it is currently open
+// @Tags maintenance-windows
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Window ID"
+// @Success 200 {object} maintenance.WindowResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/maintenance-windows/{id} [get]
+func (h *Handler) GetWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window ID"})
+		return
+	}
+
+	resp, err := h.service.GetWindow(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "maintenance window not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListWindows handles maintenance window listing
+// @Summary List maintenance windows
+// @Description List maintenance windows, optionally filtered by scope
+// @Tags maintenance-windows
+// @Produce json
+// @Security BearerAuth
+// @Param scope_type query string false "Scope type (global, environment, project, asset)"
+// @Param scope_id query int false "Environment, project or asset ID"
+// @Success 200 {array} maintenance.WindowResponse
+// @Router /api/v1/maintenance-windows [get]
+func (h *Handler) ListWindows(c *gin.Context) {
+	var scopeID uint
+	if v := c.Query("scope_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope_id"})
+			return
+		}
+		scopeID = uint(id)
+	}
+
+	resp, err := h.service.ListWindows(c.Query("scope_type"), scopeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateWindow handles maintenance window update
+// @Summary Update maintenance window
+// @Description Update a maintenance window; disable it to lift its restrictions
+// @Tags maintenance-windows
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Window ID"
+// @Param request body maintenance.UpdateWindowRequest true "Update window request"
+// @Success 200 {object} maintenance.WindowResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/maintenance-windows/{id} [put]
+func (h *Handler) UpdateWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window ID"})
+		return
+	}
+
+	var req maintenance.UpdateWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateWindow(uint(id), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteWindow handles maintenance window deletion
+// @Summary Delete maintenance window
+// @Description Delete a maintenance window
+// @Tags maintenance-windows
+// @Security BearerAuth
+// @Param id path int true "Window ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/maintenance-windows/{id} [delete]
+func (h *Handler) DeleteWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window ID"})
+		return
+	}
+
+	if err := h.service.DeleteWindow(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CheckAssets handles checking whether hosts may be changed
+// @Summary Check maintenance windows
+// @Description Check whether the given hosts may be changed at a point in time (default now)
+// @Tags maintenance-windows
+// @Produce json
+// @Security BearerAuth
+// @Param asset_ids query string true "Comma-separated asset IDs"
+// @Param at query string false "Time to check (RFC3339)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/maintenance-windows/check [get]
+func (h *Handler) CheckAssets(c *gin.Context) {
+	var assetIDs []uint
+	for _, part := range strings.Split(c.Query("asset_ids"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid asset_ids"})
+			return
+		}
+		assetIDs = append(assetIDs, uint(id))
+	}
+	if len(assetIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "asset_ids is required"})
+		return
+	}
+
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at, use RFC3339"})
+			return
+		}
+		at = t
+	}
+
+	err := h.service.Check(assetIDs, at)
+	var blocked *maintenance.BlockedError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"allowed": true})
+	case errors.As(err, &blocked):
+		c.JSON(http.StatusOK, gin.H{"allowed": false, "blocked": blocked})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
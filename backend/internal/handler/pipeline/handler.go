@@ -0,0 +1,370 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package pipeline
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/deployment"
+	"github.com/kkops/backend/internal/service/pipeline"
+)
+
+// Handler handles release pipeline HTTP requests
+type Handler struct {
+	service *pipeline.Service
+}
+
+// NewHandler creates a new release pipeline handler
+func NewHandler(service *pipeline.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreatePipeline handles release pipeline creation
+// @Summary Create release pipeline
+// @Description Define the environment stages a deployment module's versions are promoted through
+// @Tags release-pipelines
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body pipeline.CreatePipelineRequest true "Create pipeline request"
+// @Success 201 {object} pipeline.PipelineResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/release-pipelines [post]
+func (h *Handler) CreatePipeline(c *gin.Context) {
+	var req pipeline.CreatePipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreatePipeline(&req, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetPipeline handles release pipeline retrieval
+// @Summary Get release pipeline
+// @Description Get release pipeline by ID with its stages
+// @Tags release-pipelines
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Success 200 {object} pipeline.PipelineResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/release-pipelines/{id} [get]
+func (h *Handler) GetPipeline(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.GetPipeline(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListPipelines handles release pipeline listing
+// @Summary List release pipelines
+// @Description List release pipelines, optionally of one deployment module
+// @Tags release-pipelines
+// @Produce json
+// @Security BearerAuth
+// @Param module_id query int false "Deployment module ID"
+// @Success 200 {array} pipeline.PipelineResponse
+// @Router /api/v1/release-pipelines [get]
+func (h *Handler) ListPipelines(c *gin.Context) {
+	moduleID, ok := queryID(c, "module_id")
+	if !ok {
+		return
+	}
+
+	pipelines, err := h.service.ListPipelines(moduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelines)
+}
+
+// UpdatePipeline handles release pipeline updates
+// @Summary Update release pipeline
+// @Description Update a release pipeline; stages passed with their ID keep their promotion history
+// @Tags release-pipelines
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Param request body pipeline.UpdatePipelineRequest true "Update pipeline request"
+// @Success 200 {object} pipeline.PipelineResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/release-pipelines/{id} [put]
+func (h *Handler) UpdatePipeline(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+
+	var req pipeline.UpdatePipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdatePipeline(id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeletePipeline handles release pipeline deletion
+// @Summary Delete release pipeline
+// @Description Delete a release pipeline; the deployments it started are kept
+// @Tags release-pipelines
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/release-pipelines/{id} [delete]
+func (h *Handler) DeletePipeline(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeletePipeline(id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "pipeline deleted successfully"})
+}
+
+// GetMatrix handles the version by environment matrix
+// @Summary Get release pipeline matrix
+// @Description Show the status of the most recently promoted versions in every stage of the pipeline
+// @Tags release-pipelines
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Param limit query int false "Number of versions" default(20)
+// @Success 200 {object} pipeline.MatrixResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/release-pipelines/{id}/matrix [get]
+func (h *Handler) GetMatrix(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit > 100 {
+		limit = 100
+	}
+
+	resp, err := h.service.Matrix(id, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Promote handles promoting a version to a stage
+// @Summary Promote version
+// @Description Deploy a version to a pipeline stage. The version must have been deployed successfully to the previous stage; stages with an approval gate wait for an approver.
+// @Tags release-pipelines
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Param request body pipeline.PromoteRequest true "Promote request"
+// @Success 201 {object} pipeline.PromotionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "Version not promotable or deployment locked"
+// @Router /api/v1/release-pipelines/{id}/promotions [post]
+func (h *Handler) Promote(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+
+	var req pipeline.PromoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.Promote(id, &req, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListPromotions handles promotion history listing
+// @Summary List promotions
+// @Description List a release pipeline's promotion history, newest first
+// @Tags release-pipelines
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Pipeline ID"
+// @Param stage_id query int false "Stage ID"
+// @Param version query string false "Version"
+// @Param page query int false "Page" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/release-pipelines/{id}/promotions [get]
+func (h *Handler) ListPromotions(c *gin.Context) {
+	id, ok := pathID(c, "pipeline")
+	if !ok {
+		return
+	}
+
+	filter := pipeline.ListPromotionsFilter{Version: c.Query("version")}
+	if filter.StageID, ok = queryID(c, "stage_id"); !ok {
+		return
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+
+	promotions, total, err := h.service.ListPromotions(id, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  promotions,
+		"total": total,
+		"page":  filter.Page,
+		"size":  filter.PageSize,
+	})
+}
+
+// ApprovePromotion handles approving a promotion
+// @Summary Approve promotion
+// @Description Approve a promotion awaiting approval and deploy it as the requester. Only the stage's approvers (admins when none are set) may approve, and not the requester.
+// @Tags release-pipelines
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Promotion ID"
+// @Param request body pipeline.ReviewRequest false "Review note"
+// @Success 200 {object} pipeline.PromotionResponse
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/release-pipelines/promotions/{id}/approve [post]
+func (h *Handler) ApprovePromotion(c *gin.Context) {
+	h.review(c, h.service.Approve)
+}
+
+// RejectPromotion handles rejecting a promotion
+// @Summary Reject promotion
+// @Description Reject a promotion awaiting approval
+// @Tags release-pipelines
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Promotion ID"
+// @Param request body pipeline.ReviewRequest false "Review note"
+// @Success 200 {object} pipeline.PromotionResponse
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/release-pipelines/promotions/{id}/reject [post]
+func (h *Handler) RejectPromotion(c *gin.Context) {
+	h.review(c, h.service.Reject)
+}
+
+func (h *Handler) review(c *gin.Context, decide func(uint, *pipeline.ReviewRequest, uint) (*pipeline.PromotionResponse, error)) {
+	id, ok := pathID(c, "promotion")
+	if !ok {
+		return
+	}
+
+	var req pipeline.ReviewRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := decide(id, &req, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondError maps service errors to HTTP status codes
+func respondError(c *gin.Context, err error) {
+	var locked *deployment.LockedError
+	switch {
+	case errors.As(err, &locked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "lock": locked.Lock})
+	case errors.Is(err, pipeline.ErrPipelineNotFound), errors.Is(err, pipeline.ErrPromotionNotFound), errors.Is(err, pipeline.ErrStageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, pipeline.ErrNotApprover), errors.Is(err, pipeline.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, pipeline.ErrPromotionBlocked), errors.Is(err, pipeline.ErrPromotionNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+func pathID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func queryID(c *gin.Context, name string) (uint, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -92,6 +92,8 @@ func (h *Handler) GetScheduledTask(c *gin.Context) {
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(20)
 // @Param enabled query bool false "是否启用"
+// @Param target_type query string false "执行目标：script, deployment"
+// @Param deployment_module_id query int false "定时部署的部署模块 ID"
 // @Success 200 {object} scheduledtask.ListScheduledTasksResponse
 // @Failure 500 {object} map[string]string
 // @Router /tasks [get]
@@ -105,7 +107,18 @@ func (h *Handler) ListScheduledTasks(c *gin.Context) {
 		enabled = &e
 	}
 
-	result, err := h.service.ListScheduledTasks(page, pageSize, enabled)
+	var moduleID *uint
+	if v := c.Query("deployment_module_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的部署模块 ID"})
+			return
+		}
+		mid := uint(id)
+		moduleID = &mid
+	}
+
+	result, err := h.service.ListScheduledTasks(page, pageSize, enabled, c.Query("target_type"), moduleID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -203,6 +216,44 @@ func (h *Handler) EnableScheduledTask(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "任务已启用"})
 }
 
+// RunScheduledTaskNow godoc
+// @Summary 立即执行定时任务
+// @Description 立即在后台执行一次定时任务，不影响调度计划；可临时覆盖目标主机和超时时间，执行记录的触发类型为 manual
+// @Tags Scheduled Tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务 ID"
+// @Param request body scheduledtask.RunNowRequest false "覆盖参数"
+// @Success 202 {object} scheduledtask.RunNowResponse
+// @Failure 400 {object} map[string]string
+// @Router /tasks/{id}/run-now [post]
+func (h *Handler) RunScheduledTaskNow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务 ID"})
+		return
+	}
+
+	// 请求体可选，为空时按任务配置执行
+	var req scheduledtask.RunNowRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.RunScheduledTaskNow(uint(id), userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
 // DisableScheduledTask godoc
 // @Summary 禁用定时任务
 // @Description 禁用定时任务
@@ -268,6 +319,43 @@ func (h *Handler) GetScheduledTaskExecutions(c *gin.Context) {
 	})
 }
 
+// GetScheduledTaskFires godoc
+// @Summary 获取定时任务触发历史
+// @Description 获取定时任务每次触发的处理结果，包括因并发策略被跳过、排队或取消的触发及原因
+// @Tags Scheduled Tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务 ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/fires [get]
+func (h *Handler) GetScheduledTaskFires(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务 ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	fires, total, err := h.service.GetScheduledTaskFires(uint(id), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  fires,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
 // ValidateCron godoc
 // @Summary 验证 Cron 表达式
 // @Description 验证 Cron 表达式是否有效，并返回下次执行时间
@@ -276,6 +364,7 @@ func (h *Handler) GetScheduledTaskExecutions(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param cron_expression query string true "Cron 表达式"
+// @Param timezone query string false "IANA 时区，例如 Asia/Shanghai，默认服务器本地时区"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Router /tasks/validate-cron [get]
@@ -291,13 +380,106 @@ func (h *Handler) ValidateCron(c *gin.Context) {
 		return
 	}
 
-	nextRunAt, _ := scheduledtask.GetNextRunTime(cronExpr)
+	timezone := c.Query("timezone")
+	if err := scheduledtask.ValidateTimezone(timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid": false})
+		return
+	}
+
+	nextRunAt, _ := scheduledtask.GetNextRunTime(cronExpr, timezone)
 	c.JSON(http.StatusOK, gin.H{
 		"valid":       true,
 		"next_run_at": nextRunAt,
 	})
 }
 
+// GetSchedulerStatus godoc
+// @Summary 获取调度器状态
+// @Description 返回当前实例 ID、是否为主节点以及主节点租约信息（多副本部署时只有主节点触发任务）
+// @Tags Scheduled Tasks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} scheduledtask.SchedulerStatus
+// @Failure 503 {object} map[string]string
+// @Router /tasks/scheduler/status [get]
+func (h *Handler) GetSchedulerStatus(c *gin.Context) {
+	status, err := h.service.GetSchedulerStatus()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetUpcomingFires godoc
+// @Summary 获取定时任务后续触发时间
+// @Description 按任务时区计算接下来 N 次的触发时间
+// @Tags Scheduled Tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务 ID"
+// @Param count query int false "次数，最大 100" default(10)
+// @Success 200 {object} scheduledtask.UpcomingFiresResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/upcoming [get]
+func (h *Handler) GetUpcomingFires(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务 ID"})
+		return
+	}
+
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "10"))
+
+	resp, err := h.service.GetUpcomingFires(uint(id), count)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetScheduleCalendar godoc
+// @Summary 获取定时任务触发日历
+// @Description 返回时间窗口内所有启用任务的触发时间，并列出同一时刻触发多个任务的冲突
+// @Tags Scheduled Tasks
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "开始时间（RFC3339），默认当前时间"
+// @Param to query string false "结束时间（RFC3339），默认开始时间后 24 小时，窗口最长 31 天"
+// @Param limit query int false "最多返回的触发次数，最大 5000" default(1000)
+// @Success 200 {object} scheduledtask.ScheduleCalendarResponse
+// @Failure 400 {object} map[string]string
+// @Router /tasks/calendar [get]
+func (h *Handler) GetScheduleCalendar(c *gin.Context) {
+	var from, to time.Time
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间，请使用 RFC3339 格式"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间，请使用 RFC3339 格式"})
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+
+	resp, err := h.service.GetScheduleCalendar(from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // ExportScheduledTasks handles scheduled tasks export
 // @Summary Export scheduled tasks
 // @Description Export all scheduled tasks to JSON
@@ -0,0 +1,175 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package secret
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/secret"
+)
+
+// Handler handles secret management HTTP requests
+type Handler struct {
+	service *secret.Service
+}
+
+// NewHandler creates a new secret handler
+func NewHandler(service *secret.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateSecret handles secret creation
+// @Summary Create secret
+// @Description Create an encrypted secret referenced in scripts as ${secret:name}
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body secret.CreateSecretRequest true "Create secret request"
+// @Success 201 {object} secret.SecretResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/secrets [post]
+func (h *Handler) CreateSecret(c *gin.Context) {
+	var req secret.CreateSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateSecret(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetSecret handles secret retrieval
+// @Summary Get secret
+// @Description Get secret metadata by ID (the value is never returned)
+// @Tags secrets
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Secret ID"
+// @Success 200 {object} secret.SecretResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/secrets/{id} [get]
+func (h *Handler) GetSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secret ID"})
+		return
+	}
+
+	resp, err := h.service.GetSecret(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "secret not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListSecrets handles secret list retrieval
+// @Summary List secrets
+// @Description Get list of secrets (metadata only)
+// @Tags secrets
+// @Produce json
+// @Security BearerAuth
+// @Param project_id query int false "Filter by project ID"
+// @Param environment_id query int false "Filter by environment ID"
+// @Success 200 {array} secret.SecretResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/secrets [get]
+func (h *Handler) ListSecrets(c *gin.Context) {
+	projectID := queryUint(c, "project_id")
+	environmentID := queryUint(c, "environment_id")
+
+	secrets, err := h.service.ListSecrets(projectID, environmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, secrets)
+}
+
+// UpdateSecret handles secret update
+// @Summary Update secret
+// @Description Update a secret's value or description
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Secret ID"
+// @Param request body secret.UpdateSecretRequest true "Update secret request"
+// @Success 200 {object} secret.SecretResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/secrets/{id} [put]
+func (h *Handler) UpdateSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secret ID"})
+		return
+	}
+
+	var req secret.UpdateSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateSecret(uint(id), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteSecret handles secret deletion
+// @Summary Delete secret
+// @Description Delete a secret by ID
+// @Tags secrets
+// @Security BearerAuth
+// @Param id path int true "Secret ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/secrets/{id} [delete]
+func (h *Handler) DeleteSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secret ID"})
+		return
+	}
+
+	if err := h.service.DeleteSecret(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// queryUint parses an optional unsigned integer query parameter
+func queryUint(c *gin.Context, key string) *uint {
+	v := c.Query(key)
+	if v == "" {
+		return nil
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return nil
+	}
+	result := uint(id)
+	return &result
+}
@@ -6,6 +6,7 @@
 package task
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -112,7 +113,7 @@ func (h *Handler) ListTemplates(c *gin.Context) {
 
 // UpdateTemplate handles template update
 // @Summary Update template
-// @Description Update task template information
+// @Description Update task template information; each change is saved as a new version
 // @Tags templates
 // @Accept json
 // @Produce json
@@ -136,7 +137,8 @@ func (h *Handler) UpdateTemplate(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.UpdateTemplate(uint(id), &req)
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.UpdateTemplate(userID, uint(id), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -154,6 +156,7 @@ func (h *Handler) UpdateTemplate(c *gin.Context) {
 // @Success 204
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /api/v1/templates/{id} [delete]
 func (h *Handler) DeleteTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -163,6 +166,10 @@ func (h *Handler) DeleteTemplate(c *gin.Context) {
 	}
 
 	if err := h.service.DeleteTemplate(uint(id)); err != nil {
+		if errors.Is(err, task.ErrTemplateManagedByGit) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
 		return
 	}
@@ -335,7 +342,7 @@ func (h *Handler) DeleteTask(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Task ID"
-// @Param request body object true "Execution request" SchemaExample({"execution_type": "sync"})
+// @Param request body object true "Execution request" SchemaExample({"execution_type": "sync", "override_maintenance": false})
 // @Success 200 {object} map[string]string "Response with message"
 // @Failure 400 {object} map[string]string
 // @Router /api/v1/executions/{id}/execute [post]
@@ -347,7 +354,8 @@ func (h *Handler) ExecuteTask(c *gin.Context) {
 	}
 
 	var req struct {
-		ExecutionType string `json:"execution_type"` // sync or async
+		ExecutionType       string `json:"execution_type"`       // sync or async
+		OverrideMaintenance bool   `json:"override_maintenance"` // admin only: run despite maintenance windows
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		req.ExecutionType = "sync" // Default to sync
@@ -362,7 +370,13 @@ func (h *Handler) ExecuteTask(c *gin.Context) {
 		return
 	}
 
-	if err := h.executionService.ExecuteTask(uint(id), executionType); err != nil {
+	userID := c.MustGet("user_id").(uint)
+	if err := h.executionService.ExecuteTaskWithOptions(uint(id), task.ExecuteOptions{
+		ExecutionType:       executionType,
+		TriggerType:         "manual",
+		TriggeredBy:         &userID,
+		OverrideMaintenance: req.OverrideMaintenance,
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
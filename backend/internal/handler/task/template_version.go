@@ -0,0 +1,157 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package task
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/task"
+)
+
+// ListTemplateVersions handles template version history retrieval
+// @Summary List template versions
+// @Description Get the version history of a task template, newest first
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Success 200 {array} task.TemplateVersionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/templates/{id}/versions [get]
+func (h *Handler) ListTemplateVersions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	versions, err := h.service.ListTemplateVersions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetTemplateVersion handles single template version retrieval
+// @Summary Get template version
+// @Description Get a specific version of a task template
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Param version path int true "Version number"
+// @Success 200 {object} task.TemplateVersionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/templates/{id}/versions/{version} [get]
+func (h *Handler) GetTemplateVersion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+
+	resp, err := h.service.GetTemplateVersion(uint(id), version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template version not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DiffTemplateVersions handles template version comparison
+// @Summary Diff template versions
+// @Description Get a unified diff of the script content between two template versions
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Param from query int true "Base version"
+// @Param to query int true "Target version"
+// @Success 200 {object} task.TemplateDiffResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/templates/{id}/versions/diff [get]
+func (h *Handler) DiffTemplateVersions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from version"})
+		return
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to version"})
+		return
+	}
+
+	resp, err := h.service.DiffTemplateVersions(uint(id), from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RestoreTemplateVersion handles template version restore
+// @Summary Restore template version
+// @Description Restore an old version by saving its content as a new version
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Param version path int true "Version number"
+// @Param request body task.RestoreTemplateVersionRequest false "Restore request"
+// @Success 200 {object} task.TemplateResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/templates/{id}/versions/{version}/restore [post]
+func (h *Handler) RestoreTemplateVersion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+
+	var req task.RestoreTemplateVersionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.RestoreTemplateVersion(userID, uint(id), version, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
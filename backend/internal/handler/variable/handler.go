@@ -0,0 +1,194 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package variable
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/variable"
+)
+
+// Handler handles deployment variable HTTP requests
+type Handler struct {
+	service *variable.Service
+}
+
+// NewHandler creates a new deployment variable handler
+func NewHandler(service *variable.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateVariable handles variable creation
+// @Summary Create deployment variable
+// @Description Create a variable replacing ${KEY} in deployment scripts and exported as an environment variable. Set project_id, environment_id, both, module_id, or module_id and environment_id to choose its scope.
+// @Tags deployment-variables
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body variable.CreateVariableRequest true "Create variable request"
+// @Success 201 {object} variable.VariableResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/deployment-variables [post]
+func (h *Handler) CreateVariable(c *gin.Context) {
+	var req variable.CreateVariableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateVariable(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetVariable handles variable retrieval
+// @Summary Get deployment variable
+// @Description Get a deployment variable by ID; secret values are masked
+// @Tags deployment-variables
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Variable ID"
+// @Success 200 {object} variable.VariableResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/deployment-variables/{id} [get]
+func (h *Handler) GetVariable(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variable ID"})
+		return
+	}
+
+	resp, err := h.service.GetVariable(uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListVariables handles variable listing
+// @Summary List deployment variables
+// @Description List the variables defined on a project, environment or module
+// @Tags deployment-variables
+// @Produce json
+// @Security BearerAuth
+// @Param project_id query int false "Project ID"
+// @Param environment_id query int false "Environment ID"
+// @Param module_id query int false "Deployment module ID"
+// @Success 200 {array} variable.VariableResponse
+// @Router /api/v1/deployment-variables [get]
+func (h *Handler) ListVariables(c *gin.Context) {
+	var filter variable.ListFilter
+	var ok bool
+	if filter.ProjectID, ok = queryID(c, "project_id"); !ok {
+		return
+	}
+	if filter.EnvironmentID, ok = queryID(c, "environment_id"); !ok {
+		return
+	}
+	if filter.ModuleID, ok = queryID(c, "module_id"); !ok {
+		return
+	}
+
+	vars, err := h.service.ListVariables(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, vars)
+}
+
+// UpdateVariable handles variable updates
+// @Summary Update deployment variable
+// @Description Update a variable's value, secret flag or description; making a secret variable plain requires a new value
+// @Tags deployment-variables
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Variable ID"
+// @Param request body variable.UpdateVariableRequest true "Update variable request"
+// @Success 200 {object} variable.VariableResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/deployment-variables/{id} [put]
+func (h *Handler) UpdateVariable(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variable ID"})
+		return
+	}
+
+	var req variable.UpdateVariableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateVariable(uint(id), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteVariable handles variable deletion
+// @Summary Delete deployment variable
+// @Description Delete a deployment variable
+// @Tags deployment-variables
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Variable ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/deployment-variables/{id} [delete]
+func (h *Handler) DeleteVariable(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variable ID"})
+		return
+	}
+
+	if err := h.service.DeleteVariable(uint(id)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "variable deleted successfully"})
+}
+
+func respondError(c *gin.Context, err error) {
+	if errors.Is(err, variable.ErrVariableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+func queryID(c *gin.Context, name string) (uint, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
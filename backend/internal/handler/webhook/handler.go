@@ -0,0 +1,273 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kkops/backend/internal/service/webhook"
+)
+
+// maxPayloadSize 入站 Webhook 请求体的大小上限
+const maxPayloadSize = 1 << 20
+
+// Handler handles webhook trigger HTTP requests
+type Handler struct {
+	service *webhook.Service
+}
+
+// NewHandler creates a new webhook trigger handler
+func NewHandler(service *webhook.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateTrigger handles webhook trigger creation
+// @Summary Create webhook trigger
+// @Description Create an inbound webhook trigger for a task or deployment module; the token (and HMAC secret) are only returned once
+// @Tags webhook-triggers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body webhook.CreateTriggerRequest true "Create trigger request"
+// @Success 201 {object} webhook.TriggerResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/webhook-triggers [post]
+func (h *Handler) CreateTrigger(c *gin.Context) {
+	var req webhook.CreateTriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	resp, err := h.service.CreateTrigger(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetTrigger handles webhook trigger retrieval
+// @Summary Get webhook trigger
+// @Description Get webhook trigger by ID (credentials are not returned)
+// @Tags webhook-triggers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trigger ID"
+// @Success 200 {object} webhook.TriggerResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhook-triggers/{id} [get]
+func (h *Handler) GetTrigger(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger ID"})
+		return
+	}
+
+	resp, err := h.service.GetTrigger(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trigger not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListTriggers handles webhook trigger listing
+// @Summary List webhook triggers
+// @Description List webhook triggers, optionally filtered by target
+// @Tags webhook-triggers
+// @Produce json
+// @Security BearerAuth
+// @Param target_type query string false "Target type (task, deployment)"
+// @Param target_id query int false "Task ID or deployment module ID"
+// @Success 200 {array} webhook.TriggerResponse
+// @Router /api/v1/webhook-triggers [get]
+func (h *Handler) ListTriggers(c *gin.Context) {
+	var targetID uint
+	if v := c.Query("target_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid target_id"})
+			return
+		}
+		targetID = uint(id)
+	}
+
+	resp, err := h.service.ListTriggers(c.Query("target_type"), targetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateTrigger handles webhook trigger update
+// @Summary Update webhook trigger
+// @Description Update webhook trigger name, description or auth mode
+// @Tags webhook-triggers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trigger ID"
+// @Param request body webhook.UpdateTriggerRequest true "Update trigger request"
+// @Success 200 {object} webhook.TriggerResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/webhook-triggers/{id} [put]
+func (h *Handler) UpdateTrigger(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger ID"})
+		return
+	}
+
+	var req webhook.UpdateTriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateTrigger(uint(id), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RotateTrigger handles webhook trigger credential rotation
+// @Summary Rotate webhook trigger
+// @Description Issue a new token and HMAC secret; the old URL stops working immediately
+// @Tags webhook-triggers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trigger ID"
+// @Success 200 {object} webhook.TriggerResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhook-triggers/{id}/rotate [post]
+func (h *Handler) RotateTrigger(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger ID"})
+		return
+	}
+
+	resp, err := h.service.RotateTrigger(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trigger not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeTrigger handles webhook trigger revocation
+// @Summary Revoke webhook trigger
+// @Description Revoke a webhook trigger; rotate it to issue new credentials and re-activate it
+// @Tags webhook-triggers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trigger ID"
+// @Success 200 {object} webhook.TriggerResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhook-triggers/{id}/revoke [post]
+func (h *Handler) RevokeTrigger(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger ID"})
+		return
+	}
+
+	resp, err := h.service.RevokeTrigger(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trigger not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteTrigger handles webhook trigger deletion
+// @Summary Delete webhook trigger
+// @Description Delete a webhook trigger
+// @Tags webhook-triggers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trigger ID"
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/webhook-triggers/{id} [delete]
+func (h *Handler) DeleteTrigger(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger ID"})
+		return
+	}
+
+	if err := h.service.DeleteTrigger(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "trigger deleted successfully"})
+}
+
+// Fire handles an inbound webhook call (no login required; authenticated by the URL token and optional HMAC signature)
+// @Summary Fire webhook trigger
+// @Description Start the trigger's task or deployment. HMAC triggers require X-Webhook-Timestamp (unix seconds) and X-Webhook-Signature (sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))); a signed request is accepted only once
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param token path string true "Trigger token"
+// @Param version query string false "Deployment version"
+// @Param request body webhook.FireRequest false "Trigger parameters"
+// @Success 202 {object} webhook.FireResponse
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/webhooks/{token} [post]
+func (h *Handler) Fire(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPayloadSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+
+	resp, err := h.service.Fire(
+		c.Param("token"),
+		body,
+		c.GetHeader("X-Webhook-Timestamp"),
+		c.GetHeader("X-Webhook-Signature"),
+		c.Query("version"),
+	)
+	if err != nil {
+		if errors.Is(err, webhook.ErrInvalidToken) || errors.Is(err, webhook.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, webhook.ErrAssetNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, webhook.ErrReplayed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
@@ -157,6 +157,14 @@ func GetDefaultAuditRoutes() []AuditRoute {
 		{PathPattern: `^/api/v1/assets$`, Method: "POST", Module: "asset", Action: "create", ResourceName: "host_name"},
 		{PathPattern: `^/api/v1/assets/\d+$`, Method: "PUT", Module: "asset", Action: "update", ResourceName: "host_name"},
 		{PathPattern: `^/api/v1/assets/\d+$`, Method: "DELETE", Module: "asset", Action: "delete"},
+		{PathPattern: `^/api/v1/assets/\d+/facts/collect$`, Method: "POST", Module: "asset", Action: "collect_facts"},
+
+		// 主机事实
+		{PathPattern: `^/api/v1/asset-facts/rules$`, Method: "POST", Module: "asset_fact", Action: "create_rule", ResourceName: "asset_field"},
+		{PathPattern: `^/api/v1/asset-facts/rules/\d+$`, Method: "PUT", Module: "asset_fact", Action: "update_rule"},
+		{PathPattern: `^/api/v1/asset-facts/rules/\d+$`, Method: "DELETE", Module: "asset_fact", Action: "delete_rule"},
+		{PathPattern: `^/api/v1/asset-facts/conflicts/\d+/accept$`, Method: "POST", Module: "asset_fact", Action: "accept_conflict"},
+		{PathPattern: `^/api/v1/asset-facts/conflicts/\d+/dismiss$`, Method: "POST", Module: "asset_fact", Action: "dismiss_conflict"},
 
 		// 项目管理
 		{PathPattern: `^/api/v1/projects$`, Method: "POST", Module: "project", Action: "create", ResourceName: "name"},
@@ -184,6 +192,7 @@ func GetDefaultAuditRoutes() []AuditRoute {
 		{PathPattern: `^/api/v1/templates$`, Method: "POST", Module: "template", Action: "create", ResourceName: "name"},
 		{PathPattern: `^/api/v1/templates/\d+$`, Method: "PUT", Module: "template", Action: "update", ResourceName: "name"},
 		{PathPattern: `^/api/v1/templates/\d+$`, Method: "DELETE", Module: "template", Action: "delete"},
+		{PathPattern: `^/api/v1/templates/\d+/versions/\d+/restore$`, Method: "POST", Module: "template", Action: "restore"},
 
 		// 定时任务
 		{PathPattern: `^/api/v1/tasks$`, Method: "POST", Module: "scheduled_task", Action: "create", ResourceName: "name"},
@@ -196,12 +205,58 @@ func GetDefaultAuditRoutes() []AuditRoute {
 		{PathPattern: `^/api/v1/deployment-modules/\d+$`, Method: "PUT", Module: "deployment", Action: "update", ResourceName: "name"},
 		{PathPattern: `^/api/v1/deployment-modules/\d+$`, Method: "DELETE", Module: "deployment", Action: "delete"},
 		{PathPattern: `^/api/v1/deployment-modules/\d+/deploy$`, Method: "POST", Module: "deployment", Action: "execute"},
+		{PathPattern: `^/api/v1/deployment-modules/\d+/rollback$`, Method: "POST", Module: "deployment", Action: "rollback"},
+		{PathPattern: `^/api/v1/deployments/\d+/retry$`, Method: "POST", Module: "deployment", Action: "execute"},
+		{PathPattern: `^/api/v1/deployment-locks/\d+$`, Method: "DELETE", Module: "deployment", Action: "break_lock"},
+		{PathPattern: `^/api/v1/deployment-variables$`, Method: "POST", Module: "deployment_variable", Action: "create", ResourceName: "key"},
+		{PathPattern: `^/api/v1/deployment-variables/\d+$`, Method: "PUT", Module: "deployment_variable", Action: "update"},
+		{PathPattern: `^/api/v1/deployment-variables/\d+$`, Method: "DELETE", Module: "deployment_variable", Action: "delete"},
+		{PathPattern: `^/api/v1/release-pipelines$`, Method: "POST", Module: "release_pipeline", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/release-pipelines/\d+$`, Method: "PUT", Module: "release_pipeline", Action: "update", ResourceName: "name"},
+		{PathPattern: `^/api/v1/release-pipelines/\d+$`, Method: "DELETE", Module: "release_pipeline", Action: "delete"},
+		{PathPattern: `^/api/v1/release-pipelines/\d+/promotions$`, Method: "POST", Module: "release_pipeline", Action: "promote", ResourceName: "version"},
+		{PathPattern: `^/api/v1/release-pipelines/promotions/\d+/approve$`, Method: "POST", Module: "release_pipeline", Action: "approve"},
+		{PathPattern: `^/api/v1/release-pipelines/promotions/\d+/reject$`, Method: "POST", Module: "release_pipeline", Action: "reject"},
+
+		// 文件分发
+		{PathPattern: `^/api/v1/artifacts$`, Method: "POST", Module: "distribution", Action: "create"},
+		{PathPattern: `^/api/v1/artifacts/\d+$`, Method: "DELETE", Module: "distribution", Action: "delete"},
+		{PathPattern: `^/api/v1/distributions$`, Method: "POST", Module: "distribution", Action: "execute", ResourceName: "name"},
+		{PathPattern: `^/api/v1/distributions/\d+/cancel$`, Method: "POST", Module: "distribution", Action: "update"},
 
 		// SSH 密钥
 		{PathPattern: `^/api/v1/ssh-keys$`, Method: "POST", Module: "ssh_key", Action: "create", ResourceName: "name"},
 		{PathPattern: `^/api/v1/ssh-keys/\d+$`, Method: "PUT", Module: "ssh_key", Action: "update", ResourceName: "name"},
 		{PathPattern: `^/api/v1/ssh-keys/\d+$`, Method: "DELETE", Module: "ssh_key", Action: "delete"},
 
+		// 密钥管理
+		{PathPattern: `^/api/v1/secrets$`, Method: "POST", Module: "secret", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/secrets/\d+$`, Method: "PUT", Module: "secret", Action: "update"},
+		{PathPattern: `^/api/v1/secrets/\d+$`, Method: "DELETE", Module: "secret", Action: "delete"},
+
+		// Git 同步
+		{PathPattern: `^/api/v1/git-repositories$`, Method: "POST", Module: "git_repository", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/git-repositories/\d+$`, Method: "PUT", Module: "git_repository", Action: "update"},
+		{PathPattern: `^/api/v1/git-repositories/\d+$`, Method: "DELETE", Module: "git_repository", Action: "delete"},
+		{PathPattern: `^/api/v1/git-repositories/\d+/sync$`, Method: "POST", Module: "git_repository", Action: "sync"},
+
+		// Webhook 触发器
+		{PathPattern: `^/api/v1/webhook-triggers$`, Method: "POST", Module: "webhook_trigger", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/webhook-triggers/\d+$`, Method: "PUT", Module: "webhook_trigger", Action: "update"},
+		{PathPattern: `^/api/v1/webhook-triggers/\d+$`, Method: "DELETE", Module: "webhook_trigger", Action: "delete"},
+		{PathPattern: `^/api/v1/webhook-triggers/\d+/rotate$`, Method: "POST", Module: "webhook_trigger", Action: "rotate"},
+		{PathPattern: `^/api/v1/webhook-triggers/\d+/revoke$`, Method: "POST", Module: "webhook_trigger", Action: "revoke"},
+
+		// 维护窗口
+		{PathPattern: `^/api/v1/maintenance-windows$`, Method: "POST", Module: "maintenance_window", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/maintenance-windows/\d+$`, Method: "PUT", Module: "maintenance_window", Action: "update"},
+		{PathPattern: `^/api/v1/maintenance-windows/\d+$`, Method: "DELETE", Module: "maintenance_window", Action: "delete"},
+
+		// 作业链
+		{PathPattern: `^/api/v1/job-chains$`, Method: "POST", Module: "job_chain", Action: "create", ResourceName: "name"},
+		{PathPattern: `^/api/v1/job-chains/\d+$`, Method: "PUT", Module: "job_chain", Action: "update"},
+		{PathPattern: `^/api/v1/job-chains/\d+$`, Method: "DELETE", Module: "job_chain", Action: "delete"},
+
 		// 标签管理
 		{PathPattern: `^/api/v1/tags$`, Method: "POST", Module: "tag", Action: "create", ResourceName: "name"},
 		{PathPattern: `^/api/v1/tags/\d+$`, Method: "PUT", Module: "tag", Action: "update", ResourceName: "name"},
@@ -0,0 +1,52 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+)
+
+// AssetFact 主机事实：由采集器通过 SSH 采集的结构化信息，每台主机每个事实一条，重复采集时覆盖
+type AssetFact struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	AssetID     uint      `gorm:"not null;uniqueIndex:idx_asset_fact" json:"asset_id"`
+	Name        string    `gorm:"not null;size:100;uniqueIndex:idx_asset_fact" json:"name"` // 例如 os.distro, cpu.cores
+	Collector   string    `gorm:"size:50;index" json:"collector"`                           // 产生该事实的采集器
+	ValueType   string    `gorm:"size:20" json:"value_type"`                                // string, int, json
+	Value       string    `gorm:"type:text" json:"value"`
+	CollectedAt time.Time `json:"collected_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FactMappingRule 事实映射规则：决定哪个事实写入资产的哪个字段，每个资产字段最多一条规则
+type FactMappingRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	FactName    string    `gorm:"not null;size:100" json:"fact_name"`
+	AssetField  string    `gorm:"not null;size:50;uniqueIndex" json:"asset_field"` // host_name, cpu, memory, disk
+	Mode        string    `gorm:"not null;size:20" json:"mode"`                    // overwrite 直接覆盖, fill_empty 仅填充空值, report 只记录冲突
+	Enabled     bool      `json:"enabled"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AssetFactConflict 资产字段与采集到的事实不一致且规则不允许自动覆盖时记录的冲突
+type AssetFactConflict struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	AssetID    uint       `gorm:"not null;index" json:"asset_id"`
+	Asset      *Asset     `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	AssetField string     `gorm:"not null;size:50" json:"asset_field"`
+	FactName   string     `gorm:"size:100" json:"fact_name"`
+	AssetValue string     `gorm:"type:text" json:"asset_value"` // 资产当前的值
+	FactValue  string     `gorm:"type:text" json:"fact_value"`  // 采集到的值
+	Status     string     `gorm:"size:20;index" json:"status"`  // open, accepted, dismissed, resolved
+	DetectedAt time.Time  `json:"detected_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *uint      `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -13,25 +13,66 @@ import (
 
 // DeploymentModule represents a deployment module configuration
 type DeploymentModule struct {
-	ID               uint           `gorm:"primaryKey" json:"id"`
-	ProjectID        uint           `gorm:"not null;index" json:"project_id"`
-	Project          *Project       `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
-	EnvironmentID    *uint          `gorm:"index" json:"environment_id"`
-	Environment      *Environment   `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
-	TemplateID       *uint          `gorm:"index" json:"template_id"`                             // 关联执行模板
-	Template         *TaskTemplate  `gorm:"foreignKey:TemplateID" json:"template,omitempty"`      // 执行模板
-	Name             string         `gorm:"not null;size:100" json:"name"`
-	Description      string         `gorm:"type:text" json:"description"`
-	VersionSourceURL string         `gorm:"size:500;column:version_source_url" json:"version_source_url"`
-	DeployScript     string         `gorm:"type:text" json:"deploy_script"`
-	ScriptType       string         `gorm:"size:50;default:shell" json:"script_type"` // shell/python
-	Timeout          int            `gorm:"default:600" json:"timeout"`               // Timeout in seconds
-	AssetIDs         string         `gorm:"type:text" json:"asset_ids"`               // Comma-separated asset IDs
-	CreatedBy        uint           `json:"created_by"`
-	Creator          User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                  uint           `gorm:"primaryKey" json:"id"`
+	ProjectID           uint           `gorm:"not null;index" json:"project_id"`
+	Project             *Project       `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	EnvironmentID       *uint          `gorm:"index" json:"environment_id"`
+	Environment         *Environment   `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+	TemplateID          *uint          `gorm:"index" json:"template_id"`                        // 关联执行模板
+	Template            *TaskTemplate  `gorm:"foreignKey:TemplateID" json:"template,omitempty"` // 执行模板
+	TemplateVersion     *int           `json:"template_version"`                                // 模板版本：nil 使用自身脚本，0 跟随最新版本，>0 固定版本
+	Name                string         `gorm:"not null;size:100" json:"name"`
+	Description         string         `gorm:"type:text" json:"description"`
+	VersionSourceURL    string         `gorm:"size:500;column:version_source_url" json:"version_source_url"`
+	VersionSourceType   string         `gorm:"size:20" json:"version_source_type"`     // json（默认）, http, docker, git, maven, static
+	VersionSourcePath   string         `gorm:"size:500" json:"version_source_path"`    // JSONPath、镜像仓库名或 groupId:artifactId
+	VersionSourceStatic string         `gorm:"type:text" json:"version_source_static"` // static 类型的版本列表
+	VersionFilter       string         `gorm:"size:200" json:"version_filter"`         // 只保留匹配该正则表达式的版本
+	VersionSort         string         `gorm:"size:20" json:"version_sort"`            // semver, none
+	VersionAuthType     string         `gorm:"size:20" json:"version_auth_type"`       // basic, bearer, header
+	VersionAuthUser     string         `gorm:"size:100" json:"version_auth_user"`      // basic 认证的用户名
+	VersionAuthSecret   string         `gorm:"size:100" json:"version_auth_secret"`    // 保存密码或令牌的密钥名称
+	VersionAuthHeader   string         `gorm:"size:100" json:"version_auth_header"`    // header 认证的请求头名称
+	VersionCacheSeconds int            `json:"version_cache_seconds"`                  // 版本列表缓存时间，0 不缓存
+	DeployScript        string         `gorm:"type:text" json:"deploy_script"`
+	ScriptType          string         `gorm:"size:50;default:shell" json:"script_type"` // shell/python
+	Timeout             int            `gorm:"default:600" json:"timeout"`               // Timeout in seconds
+	AssetIDs            string         `gorm:"type:text" json:"asset_ids"`               // Comma-separated asset IDs
+	GitRepositoryID     *uint          `gorm:"index" json:"git_repository_id"`           // 由 Git 仓库托管时只读
+	GitPath             string         `gorm:"size:500" json:"git_path"`                 // 仓库内的源文件路径
+	RolloutBatchSize    int            `json:"rollout_batch_size"`                       // 每批主机数，0 视为 1（逐台执行）
+	RolloutBatchPercent int            `json:"rollout_batch_percent"`                    // 每批占目标主机的百分比，大于 0 时优先于每批主机数
+	RolloutPauseSeconds int            `json:"rollout_pause_seconds"`                    // 批次之间的等待时间（秒）
+	RolloutMaxFailures  int            `json:"rollout_max_failures"`                     // 失败主机数达到该值时中止剩余批次，0 不限制
+	RolloutManualGate   bool           `json:"rollout_manual_gate"`                      // 每批完成后等待人工确认再继续
+	CanaryEnabled       bool           `json:"canary_enabled"`                           // 先部署金丝雀主机并在观察期内通过主机健康检查后再继续
+	CanaryAssetIDs      string         `gorm:"type:text" json:"canary_asset_ids"`        // Comma-separated canary asset IDs
+	CanarySoakSeconds   int            `json:"canary_soak_seconds"`                      // 观察期：期间按间隔反复检查，0 只检查一次
+	CanaryCheckInterval int            `json:"canary_check_interval"`                    // 观察期内的检查间隔（秒），0 默认 30
+	CanaryRollback      bool           `json:"canary_rollback"`                          // 金丝雀失败时将金丝雀主机回滚到上一个成功版本
+	RollbackScript      string         `gorm:"type:text" json:"rollback_script"`         // 回滚专用脚本，为空时回滚使用部署脚本
+	AutoRollback        bool           `json:"auto_rollback"`                            // 部署失败主机数达到阈值时自动回滚
+	RollbackThreshold   int            `json:"rollback_threshold"`                       // 自动回滚的失败主机数阈值，0 视为 1
+	PreDeployScript     string         `gorm:"type:text" json:"pre_deploy_script"`       // 部署前在每台主机上执行（摘流、备份等），失败则不部署该主机
+	PreDeployTimeout    int            `json:"pre_deploy_timeout"`                       // 秒，0 使用部署超时
+	PostDeployScript    string         `gorm:"type:text" json:"post_deploy_script"`      // 健康检查通过后执行（预热、通知等）
+	PostDeployTimeout   int            `json:"post_deploy_timeout"`                      // 秒，0 使用部署超时
+	HostCheckType       string         `gorm:"size:20" json:"host_check_type"`           // 每台主机部署后的健康检查：command, http, tcp，为空不检查
+	HostCheckCommand    string         `gorm:"type:text" json:"host_check_command"`      // command：在主机上执行，退出码为 0 视为健康
+	HostCheckURL        string         `gorm:"size:500" json:"host_check_url"`           // http：支持 ${HOST_NAME} ${IP}
+	HostCheckStatus     int            `json:"host_check_status"`                        // http：期望的状态码，0 表示 2xx/3xx
+	HostCheckBody       string         `gorm:"size:500" json:"host_check_body"`          // http：响应体需包含的内容
+	HostCheckPort       int            `json:"host_check_port"`                          // tcp：主机上需可连接的端口
+	HostCheckTimeout    int            `json:"host_check_timeout"`                       // 每次检查的超时（秒），0 默认 10
+	HostCheckRetries    int            `json:"host_check_retries"`                       // 失败后的重试次数
+	HostCheckInterval   int            `json:"host_check_interval"`                      // 重试间隔（秒），0 默认 5
+	LockScope           string         `gorm:"size:20" json:"lock_scope"`                // 部署锁：module（默认，按模块和环境）, asset（按目标主机）
+	LockQueue           bool           `json:"lock_queue"`                               // 锁被占用时排队等待，否则拒绝部署
+	CreatedBy           uint           `json:"created_by"`
+	Creator             User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	Deployments []Deployment `gorm:"foreignKey:ModuleID" json:"deployments,omitempty"`
@@ -39,19 +80,92 @@ type DeploymentModule struct {
 
 // Deployment represents a deployment execution record
 type Deployment struct {
-	ID         uint              `gorm:"primaryKey" json:"id"`
-	ModuleID   uint              `gorm:"not null;index" json:"module_id"`
-	Module     *DeploymentModule `gorm:"foreignKey:ModuleID" json:"module,omitempty"`
-	Version    string            `gorm:"size:100" json:"version"`
-	Status     string            `gorm:"default:pending;size:20;index" json:"status"` // pending/running/success/failed/cancelled
-	AssetIDs   string            `gorm:"type:text" json:"asset_ids"`                  // Comma-separated asset IDs for this deployment
-	Output     string            `gorm:"type:text" json:"output"`
-	Error      string            `gorm:"type:text" json:"error"`
-	CreatedBy  uint              `json:"created_by"`
-	Creator    User              `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	StartedAt  *time.Time        `json:"started_at"`
-	FinishedAt *time.Time        `json:"finished_at"`
-	CreatedAt  time.Time         `json:"created_at"`
-	UpdatedAt  time.Time         `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt    `gorm:"index" json:"-"`
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	ModuleID        uint              `gorm:"not null;index" json:"module_id"`
+	Module          *DeploymentModule `gorm:"foreignKey:ModuleID" json:"module,omitempty"`
+	EnvironmentID   *uint             `gorm:"index" json:"environment_id,omitempty"` // 部署的环境；流水线阶段部署时为阶段的环境
+	Version         string            `gorm:"size:100" json:"version"`
+	TemplateVersion *int              `json:"template_version,omitempty"`                  // 部署时使用的模板版本
+	TriggerType     string            `gorm:"size:20;default:manual" json:"trigger_type"`  // manual, webhook, scheduled, chain, rollback, retry, pipeline
+	ScheduledTaskID *uint             `gorm:"index" json:"scheduled_task_id,omitempty"`    // 由定时部署触发时的定时任务 ID
+	ChainRunID      *uint             `gorm:"index" json:"chain_run_id,omitempty"`         // 由作业链触发时的链路记录 ID
+	Status          string            `gorm:"default:pending;size:20;index" json:"status"` // queued/pending/running/waiting/success/failed/cancelled
+	AssetIDs        string            `gorm:"type:text" json:"asset_ids"`                  // Comma-separated asset IDs for this deployment
+	CurrentBatch    int               `json:"current_batch"`                               // 正在执行或等待确认的批次序号
+	Variables       string            `gorm:"type:text" json:"variables"`                  // 生效的部署变量（JSON），敏感变量的值已掩码
+	HeartbeatAt     *time.Time        `json:"-"`                                           // 执行协程定期刷新；长时间未刷新说明执行它的进程已退出
+	RollbackID      *uint             `json:"rollback_id,omitempty"`                       // 失败后自动发起的回滚部署
+	RollbackOf      *uint             `gorm:"index" json:"rollback_of,omitempty"`          // 回滚部署：被回滚的部署
+	Output          string            `gorm:"type:text" json:"output"`
+	Error           string            `gorm:"type:text" json:"error"`
+	CreatedBy       uint              `json:"created_by"`
+	Creator         User              `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	StartedAt       *time.Time        `json:"started_at"`
+	FinishedAt      *time.Time        `json:"finished_at"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt    `gorm:"index" json:"-"`
+
+	// Relationships
+	Batches []DeploymentBatch  `gorm:"foreignKey:DeploymentID" json:"batches,omitempty"`
+	Targets []DeploymentTarget `gorm:"foreignKey:DeploymentID" json:"targets,omitempty"`
+}
+
+// DeploymentBatch represents one batch of a rolling deployment
+type DeploymentBatch struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	DeploymentID uint       `gorm:"not null;index" json:"deployment_id"`
+	Number       int        `gorm:"not null" json:"number"`                // 批次序号，从 1 开始
+	Canary       bool       `json:"canary"`                                // 金丝雀批次，完成后执行健康检查
+	AssetIDs     string     `gorm:"type:text" json:"asset_ids"`            // Comma-separated asset IDs in this batch
+	Status       string     `gorm:"size:20;default:pending" json:"status"` // pending/running/success/failed/skipped
+	SuccessCount int        `json:"success_count"`
+	FailedCount  int        `json:"failed_count"`
+	HealthStatus string     `gorm:"size:20" json:"health_status,omitempty"` // 金丝雀批次的健康检查结果：passed/failed
+	HealthOutput string     `gorm:"type:text" json:"health_output,omitempty"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// DeploymentTarget records the deployment of one version to one host
+type DeploymentTarget struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	DeploymentID  uint       `gorm:"not null;index" json:"deployment_id"`
+	ModuleID      uint       `gorm:"not null;index:idx_deployment_target_module_asset" json:"module_id"`
+	AssetID       uint       `gorm:"not null;index:idx_deployment_target_module_asset" json:"asset_id"`
+	EnvironmentID *uint      `gorm:"index" json:"environment_id"` // 部署的环境，回滚按环境查找历史版本
+	Version       string     `gorm:"size:100" json:"version"`
+	BatchNumber   int        `json:"batch_number"`
+	HostName      string     `gorm:"size:255" json:"host_name"`
+	IP            string     `gorm:"size:50" json:"ip"`
+	Status        string     `gorm:"size:20;default:pending;index" json:"status"` // pending/running/success/failed/skipped/cancelled
+	ExitCode      *int       `json:"exit_code"`
+	Stdout        string     `gorm:"type:text" json:"stdout"`
+	Stderr        string     `gorm:"type:text" json:"stderr"`
+	Error         string     `gorm:"type:text" json:"error"`       // 连接失败、超时等非脚本错误
+	PreDeploy     string     `gorm:"type:text" json:"pre_deploy"`  // 部署前钩子输出
+	PostDeploy    string     `gorm:"type:text" json:"post_deploy"` // 部署后钩子输出
+	CheckStatus   string     `gorm:"size:20" json:"check_status"`  // passed/failed，未配置健康检查时为空
+	CheckOutput   string     `gorm:"type:text" json:"check_output"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// DeploymentLock is an exclusive lock held by a running deployment, either on a
+// module in an environment or on a target asset
+type DeploymentLock struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	LockKey       string    `gorm:"size:100;not null;uniqueIndex" json:"lock_key"` // module:<模块>:env:<环境> 或 asset:<资产>
+	Scope         string    `gorm:"size:20;not null" json:"scope"`                 // module, asset
+	ModuleID      uint      `gorm:"index" json:"module_id"`
+	EnvironmentID *uint     `json:"environment_id"`
+	AssetID       *uint     `json:"asset_id"`
+	DeploymentID  uint      `gorm:"not null;index" json:"deployment_id"`
+	HolderID      uint      `json:"holder_id"`
+	Holder        User      `gorm:"foreignKey:HolderID" json:"holder,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
 }
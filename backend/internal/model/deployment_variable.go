@@ -0,0 +1,33 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeploymentVariable 部署变量：部署时替换脚本中的 ${KEY} 并导出为环境变量
+// 按设置的范围区分级别，优先级从低到高：项目、环境、项目+环境、模块、模块+环境
+type DeploymentVariable struct {
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	Key           string            `gorm:"not null;size:100;index" json:"key"`
+	Value         string            `gorm:"type:text" json:"-"` // 敏感变量加密存储
+	Secret        bool              `json:"secret"`             // 敏感变量：加密存储，展示和输出中掩码
+	ProjectID     *uint             `gorm:"index" json:"project_id"`
+	Project       *Project          `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	EnvironmentID *uint             `gorm:"index" json:"environment_id"`
+	Environment   *Environment      `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+	ModuleID      *uint             `gorm:"index" json:"module_id"`
+	Module        *DeploymentModule `gorm:"foreignKey:ModuleID" json:"module,omitempty"`
+	Description   string            `gorm:"type:text" json:"description"`
+	CreatedBy     uint              `json:"created_by"`
+	Creator       User              `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt    `gorm:"index" json:"-"`
+}
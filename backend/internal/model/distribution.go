@@ -0,0 +1,74 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FileArtifact 上传到服务器的分发制品（单个文件或 tar.gz 目录归档）
+type FileArtifact struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"not null;size:255" json:"name"`
+	FileName    string         `gorm:"size:255" json:"file_name"`        // 原始文件名
+	Kind        string         `gorm:"size:20;default:file" json:"kind"` // file, archive（tar.gz，分发时解压为目录）
+	Size        int64          `json:"size"`                             // 字节数
+	Checksum    string         `gorm:"size:64;index" json:"checksum"`    // SHA-256（十六进制）
+	StoragePath string         `gorm:"size:500" json:"-"`                // 服务器本地存储路径
+	Description string         `gorm:"type:text" json:"description"`
+	CreatedBy   uint           `json:"created_by"`
+	Creator     User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Distribution 文件分发任务：将一个制品并行复制到多台主机
+type Distribution struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `gorm:"not null;size:100" json:"name"`
+	ArtifactID     uint           `gorm:"not null;index" json:"artifact_id"`
+	Artifact       *FileArtifact  `gorm:"foreignKey:ArtifactID" json:"artifact,omitempty"`
+	DestPath       string         `gorm:"not null;size:500" json:"dest_path"`          // 目标路径（文件路径或解压目录）
+	Owner          string         `gorm:"size:100" json:"owner"`                       // chown 参数，如 app:app
+	Mode           string         `gorm:"size:10" json:"mode"`                         // chmod 参数（八进制），如 0644
+	Atomic         bool           `json:"atomic"`                                      // 先写临时文件再 rename
+	VerifyChecksum bool           `json:"verify_checksum"`                             // 传输后校验 SHA-256
+	SkipIfMatch    bool           `json:"skip_if_match"`                               // 目标校验和一致时跳过
+	Concurrency    int            `gorm:"default:10" json:"concurrency"`               // 最大并行主机数
+	AssetIDs       string         `gorm:"type:text" json:"asset_ids"`                  // Comma-separated asset IDs
+	Status         string         `gorm:"default:pending;size:20;index" json:"status"` // pending, running, success, partial, failed, cancelled
+	CreatedBy      uint           `json:"created_by"`
+	Creator        User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	StartedAt      *time.Time     `json:"started_at"`
+	FinishedAt     *time.Time     `json:"finished_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Targets []DistributionTarget `gorm:"foreignKey:DistributionID" json:"targets,omitempty"`
+}
+
+// DistributionTarget 分发任务在单台主机上的执行记录（对应 TaskExecution）
+type DistributionTarget struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	DistributionID   uint           `gorm:"not null;index" json:"distribution_id"`
+	AssetID          uint           `gorm:"not null;index" json:"asset_id"`
+	Asset            Asset          `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	Status           string         `gorm:"default:pending;size:20;index" json:"status"` // pending, running, success, skipped, failed, cancelled
+	BytesTransferred int64          `json:"bytes_transferred"`
+	RemoteChecksum   string         `gorm:"size:64" json:"remote_checksum"`
+	Output           string         `gorm:"type:text" json:"output"`
+	Error            string         `gorm:"type:text" json:"error"`
+	StartedAt        *time.Time     `json:"started_at"`
+	FinishedAt       *time.Time     `json:"finished_at"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
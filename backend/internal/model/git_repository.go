@@ -0,0 +1,34 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GitRepository 模板与部署模块的 Git 同步源
+type GitRepository struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"not null;size:100" json:"name"`
+	URL           string         `gorm:"not null;size:500" json:"url"` // 远程地址或本地路径（支持裸仓库）
+	Branch        string         `gorm:"size:100" json:"branch"`       // 同步分支
+	SubDir        string         `gorm:"size:255" json:"sub_dir"`      // 仓库内的同步根目录
+	SyncInterval  int            `json:"sync_interval"`                // 自动拉取间隔（秒），0 表示仅手动同步
+	Enabled       bool           `json:"enabled"`                      // 是否启用自动拉取
+	AdoptExisting bool           `json:"adopt_existing"`               // 是否接管同名的未托管模板/模块
+	LastSyncAt    *time.Time     `json:"last_sync_at"`                 // 最近一次同步时间
+	LastCommit    string         `gorm:"size:64" json:"last_commit"`   // 最近一次同步的提交
+	LastStatus    string         `gorm:"size:20" json:"last_status"`   // success, partial, failed
+	LastError     string         `gorm:"type:text" json:"last_error"`  // 最近一次同步的错误信息
+	LastReport    string         `gorm:"type:text" json:"-"`           // 最近一次同步的漂移报告（JSON）
+	CreatedBy     uint           `json:"created_by"`
+	Creator       User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobChainLink 作业链：上游作业（执行任务、定时任务、部署）结束后按条件触发下游作业
+type JobChainLink struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"not null;size:100" json:"name"`
+	Description   string         `gorm:"type:text" json:"description"`
+	SourceType    string         `gorm:"not null;size:20;index:idx_job_chain_source" json:"source_type"` // task, scheduled_task, deployment
+	SourceID      uint           `gorm:"not null;index:idx_job_chain_source" json:"source_id"`           // 任务 ID、定时任务 ID 或部署模块 ID
+	Condition     string         `gorm:"not null;size:20" json:"condition"`                              // success, failure, always
+	TargetType    string         `gorm:"not null;size:20" json:"target_type"`                            // task, scheduled_task, deployment
+	TargetID      uint           `gorm:"not null" json:"target_id"`                                      // 任务 ID、定时任务 ID 或部署模块 ID
+	TargetVersion string         `gorm:"size:100" json:"target_version"`                                 // 下游为部署时的版本，为空时沿用上游的部署版本
+	Enabled       bool           `json:"enabled"`
+	CreatedBy     uint           `json:"created_by"` // 下游作业以创建者的身份发起
+	Creator       User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// JobChainRun 作业链的一次触发记录；下游作业的执行记录通过 ChainRunID 关联到它，
+// ParentRunID 指向触发上游作业的记录，用于回溯整条链路
+type JobChainRun struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	LinkID        uint      `gorm:"not null;index" json:"link_id"`
+	ParentRunID   *uint     `gorm:"index" json:"parent_run_id,omitempty"`
+	Depth         int       `json:"depth"` // 链路深度，由非链路方式启动的作业触发时为 1
+	SourceType    string    `gorm:"size:20;index:idx_job_chain_run_source" json:"source_type"`
+	SourceID      uint      `gorm:"index:idx_job_chain_run_source" json:"source_id"`
+	SourceRunID   uint      `json:"source_run_id,omitempty"` // 上游为部署时的部署记录 ID
+	SourceStatus  string    `gorm:"size:20" json:"source_status"`
+	SourceVersion string    `gorm:"size:100" json:"source_version"`
+	FailedHosts   string    `gorm:"type:text" json:"failed_hosts"` // 上游失败的主机，逗号分隔
+	TargetType    string    `gorm:"size:20" json:"target_type"`
+	TargetID      uint      `json:"target_id"`
+	DeploymentID  *uint     `json:"deployment_id,omitempty"`     // 下游为部署时创建的部署记录 ID
+	Status        string    `gorm:"size:20;index" json:"status"` // started, failed, skipped
+	Error         string    `gorm:"type:text" json:"error"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaintenanceWindow 维护窗口：按 Cron 表达式周期性开启、持续一段时间的时间窗口
+// blackout 窗口开启期间禁止自动化操作作用范围内的主机；
+// allow 窗口表示审批过的变更窗口，作用范围内的主机只允许在任一 allow 窗口开启时执行
+type MaintenanceWindow struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `gorm:"not null;size:100" json:"name"`
+	Description    string         `gorm:"type:text" json:"description"`
+	Kind           string         `gorm:"not null;size:20" json:"kind"`                                   // blackout, allow
+	CronExpression string         `gorm:"not null;size:100" json:"cron_expression"`                       // 窗口开始时间（6 字段 Cron）
+	Duration       int            `gorm:"not null" json:"duration"`                                       // 窗口持续时长（分钟）
+	Timezone       string         `gorm:"size:64" json:"timezone"`                                        // IANA 时区，为空时使用服务器本地时区
+	ScopeType      string         `gorm:"not null;size:20;index:idx_maintenance_scope" json:"scope_type"` // global, environment, project, asset
+	ScopeID        *uint          `gorm:"index:idx_maintenance_scope" json:"scope_id"`                    // global 时为空
+	Action         string         `gorm:"size:20" json:"action"`                                          // 定时任务被拦截时：reject（默认）拒绝本次触发，defer 延后到允许执行时
+	Enabled        bool           `json:"enabled"`
+	CreatedBy      uint           `json:"created_by"`
+	Creator        User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -84,6 +84,36 @@ var AllMenuPermissions = []MenuPermission{
 		Name:        "部署管理",
 		Description: "部署管理所有操作（查看、创建、编辑、删除、部署）",
 	},
+	{
+		Resource:    "distributions",
+		Action:      "*",
+		Name:        "文件分发",
+		Description: "文件分发所有操作（上传制品、分发、取消）",
+	},
+	{
+		Resource:    "webhook-triggers",
+		Action:      "*",
+		Name:        "Webhook 触发器",
+		Description: "Webhook 触发器所有操作（查看、创建、编辑、删除、轮换、吊销）",
+	},
+	{
+		Resource:    "git-repositories",
+		Action:      "*",
+		Name:        "Git 同步",
+		Description: "Git 仓库同步所有操作（查看、创建、编辑、删除、同步）",
+	},
+	{
+		Resource:    "maintenance-windows",
+		Action:      "*",
+		Name:        "维护窗口",
+		Description: "维护窗口所有操作（查看、创建、编辑、删除）",
+	},
+	{
+		Resource:    "job-chains",
+		Action:      "*",
+		Name:        "作业链",
+		Description: "作业链所有操作（查看、创建、编辑、删除、查看链路记录）",
+	},
 	// 安全管理
 	{
 		Resource:    "ssh-keys",
@@ -91,6 +121,12 @@ var AllMenuPermissions = []MenuPermission{
 		Name:        "SSH 密钥管理",
 		Description: "SSH 密钥管理所有操作（查看、创建、编辑、删除）",
 	},
+	{
+		Resource:    "secrets",
+		Action:      "*",
+		Name:        "密钥管理",
+		Description: "密钥管理所有操作（查看、创建、编辑、删除），密钥值不可读取",
+	},
 	// 系统管理
 	{
 		Resource:    "users",
@@ -122,6 +158,7 @@ var RoutePermissionMap = map[string]string{
 	"/api/v1/environments":     "environments:*",
 	"/api/v1/cloud-platforms":  "cloud-platforms:*",
 	"/api/v1/assets":           "assets:*",
+	"/api/v1/asset-facts":      "assets:*",
 	// 任务管理
 	"/api/v1/executions":           "executions:*",
 	"/api/v1/execution-records":    "executions:*",
@@ -129,8 +166,18 @@ var RoutePermissionMap = map[string]string{
 	"/api/v1/tasks":                "tasks:*",
 	"/api/v1/deployment-modules":   "deployments:*",
 	"/api/v1/deployments":          "deployments:*",
+	"/api/v1/deployment-locks":     "deployments:*",
+	"/api/v1/release-pipelines":    "deployments:*",
+	"/api/v1/deployment-variables": "deployments:*",
+	"/api/v1/artifacts":            "distributions:*",
+	"/api/v1/distributions":        "distributions:*",
+	"/api/v1/git-repositories":     "git-repositories:*",
+	"/api/v1/webhook-triggers":     "webhook-triggers:*",
+	"/api/v1/maintenance-windows":  "maintenance-windows:*",
+	"/api/v1/job-chains":           "job-chains:*",
 	// 安全管理
 	"/api/v1/ssh/keys": "ssh-keys:*",
+	"/api/v1/secrets":  "secrets:*",
 	// 系统管理（仅管理员）
 	"/api/v1/users":      "users:*",
 	"/api/v1/roles":      "roles:*",
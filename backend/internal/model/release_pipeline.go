@@ -0,0 +1,66 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReleasePipeline 发布流水线：同一个部署模块按环境阶段依次部署，版本只能从上一阶段晋级
+type ReleasePipeline struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	Name        string            `gorm:"not null;size:100" json:"name"`
+	Description string            `gorm:"type:text" json:"description"`
+	ModuleID    uint              `gorm:"not null;index" json:"module_id"` // 提供部署脚本的模块
+	Module      *DeploymentModule `gorm:"foreignKey:ModuleID" json:"module,omitempty"`
+	CreatedBy   uint              `json:"created_by"`
+	Creator     User              `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt    `gorm:"index" json:"-"`
+
+	// Relationships
+	Stages []PipelineStage `gorm:"foreignKey:PipelineID" json:"stages,omitempty"`
+}
+
+// PipelineStage 流水线的一个环境阶段，按 Position 顺序晋级
+type PipelineStage struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	PipelineID      uint           `gorm:"not null;index" json:"pipeline_id"`
+	Position        int            `gorm:"not null" json:"position"` // 阶段顺序，从 1 开始
+	Name            string         `gorm:"not null;size:100" json:"name"`
+	EnvironmentID   uint           `gorm:"not null" json:"environment_id"`
+	Environment     *Environment   `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+	AssetIDs        string         `gorm:"type:text" json:"asset_ids"` // 该环境的目标主机，逗号分隔
+	RequireApproval bool           `json:"require_approval"`           // 晋级到该阶段需要审批
+	Approvers       string         `gorm:"type:text" json:"approvers"` // 可审批的用户 ID，逗号分隔；为空时由管理员审批
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// PipelinePromotion 一次晋级：把版本部署到某个阶段，首个阶段即直接部署
+type PipelinePromotion struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	PipelineID   uint       `gorm:"not null;index:idx_pipeline_promotion" json:"pipeline_id"`
+	StageID      uint       `gorm:"not null;index:idx_pipeline_promotion" json:"stage_id"`
+	Version      string     `gorm:"size:100;index:idx_pipeline_promotion" json:"version"`
+	FromStageID  *uint      `json:"from_stage_id,omitempty"`     // 来源阶段，首个阶段为空
+	Status       string     `gorm:"size:20;index" json:"status"` // pending_approval, rejected, deployed, failed
+	DeploymentID *uint      `json:"deployment_id,omitempty"`     // 晋级发起的部署记录
+	RequestedBy  uint       `json:"requested_by"`                // 部署以申请人的身份发起
+	Requester    User       `gorm:"foreignKey:RequestedBy" json:"requester,omitempty"`
+	ReviewedBy   *uint      `json:"reviewed_by,omitempty"` // 审批人
+	Reviewer     *User      `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	Comment      string     `gorm:"type:text" json:"comment"`     // 申请说明
+	ReviewNote   string     `gorm:"type:text" json:"review_note"` // 审批意见
+	Error        string     `gorm:"type:text" json:"error"`       // 发起部署失败的原因
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
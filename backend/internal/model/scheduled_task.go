@@ -13,30 +13,66 @@ import (
 
 // ScheduledTask 定时任务模型
 type ScheduledTask struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	Name           string         `gorm:"size:100;not null" json:"name"`
-	Description    string         `gorm:"type:text" json:"description"`
-	CronExpression string         `gorm:"size:100;not null" json:"cron_expression"`
-	TemplateID     *uint          `gorm:"index" json:"template_id,omitempty"`
-	Content        string         `gorm:"type:text" json:"content"`
-	Type           string         `gorm:"size:50;default:shell" json:"type"`
-	AssetIDs       string         `gorm:"type:text" json:"asset_ids"`
-	Timeout        int            `gorm:"default:300" json:"timeout"`
-	Enabled        bool           `gorm:"default:false" json:"enabled"`
-	UpdateAssets   bool           `gorm:"default:false" json:"update_assets"` // 是否更新资产信息
-	LastRunAt      *time.Time     `json:"last_run_at,omitempty"`
-	NextRunAt      *time.Time     `json:"next_run_at,omitempty"`
-	LastStatus     string         `gorm:"size:50" json:"last_status,omitempty"`
-	CreatedBy      uint           `gorm:"not null" json:"created_by"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	Name               string         `gorm:"size:100;not null" json:"name"`
+	Description        string         `gorm:"type:text" json:"description"`
+	TargetType         string         `gorm:"size:20" json:"target_type"`                   // script（默认）执行脚本, deployment 部署模块版本, facts 采集主机事实
+	DeploymentModuleID *uint          `gorm:"index" json:"deployment_module_id,omitempty"`  // deployment 类型：部署模块
+	DeploymentVersion  string         `gorm:"size:100" json:"deployment_version,omitempty"` // deployment 类型：部署的版本
+	FactCollectors     string         `gorm:"type:text" json:"fact_collectors,omitempty"`   // facts 类型：逗号分隔的采集器名称，为空时运行全部采集器
+	ScheduleType       string         `gorm:"size:20" json:"schedule_type"`                 // cron（默认）, interval, once
+	CronExpression     string         `gorm:"size:100;not null" json:"cron_expression"`
+	IntervalMinutes    int            `json:"interval_minutes"`        // interval 类型的执行间隔（分钟）
+	RunAt              *time.Time     `json:"run_at,omitempty"`        // once 类型的执行时间，执行后任务自动禁用
+	JitterSeconds      int            `json:"jitter_seconds"`          // 各目标主机在 [0, N] 秒内错开执行
+	Timezone           string         `gorm:"size:64" json:"timezone"` // IANA 时区，例如 Asia/Shanghai，为空时使用服务器本地时区
+	TemplateID         *uint          `gorm:"index" json:"template_id,omitempty"`
+	TemplateVersion    *int           `json:"template_version"` // 模板版本：nil 使用自身脚本，0 跟随最新版本，>0 固定版本
+	Content            string         `gorm:"type:text" json:"content"`
+	Type               string         `gorm:"size:50;default:shell" json:"type"`
+	AssetIDs           string         `gorm:"type:text" json:"asset_ids"`
+	Timeout            int            `gorm:"default:300" json:"timeout"`
+	Enabled            bool           `gorm:"default:false" json:"enabled"`
+	UpdateAssets       bool           `gorm:"default:false" json:"update_assets"` // 是否更新资产信息
+	ConcurrencyPolicy  string         `gorm:"size:20" json:"concurrency_policy"`  // 上次执行未结束时的策略：allow, skip, queue, replace
+	MisfirePolicy      string         `gorm:"size:20" json:"misfire_policy"`      // 停机期间错过的触发：skip, run_once, run_all
+	MisfireMaxRuns     int            `json:"misfire_max_runs"`                   // run_all 策略最多补跑的次数
+	StartingDeadline   int            `json:"starting_deadline"`                  // 秒，超过该时长的错过触发不再补跑，0 表示不限制
+	LastRunAt          *time.Time     `json:"last_run_at,omitempty"`
+	NextRunAt          *time.Time     `json:"next_run_at,omitempty"`
+	LastStatus         string         `gorm:"size:50" json:"last_status,omitempty"`
+	CreatedBy          uint           `gorm:"not null" json:"created_by"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// 关联
-	Template *TaskTemplate `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
-	Creator  *User         `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	Template         *TaskTemplate     `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	DeploymentModule *DeploymentModule `gorm:"foreignKey:DeploymentModuleID" json:"deployment_module,omitempty"`
+	Creator          *User             `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 }
 
 // ScheduledTaskExecution 定时任务执行记录（复用 TaskExecution 但额外添加关联字段）
 // TaskExecution 表示每次执行的记录
 // 增加 ScheduledTaskID 字段关联到定时任务
+
+// SchedulerLease 调度器主节点租约，多副本部署时只有持有租约的实例运行 Cron
+type SchedulerLease struct {
+	Name       string    `gorm:"primaryKey;size:50" json:"name"`
+	Holder     string    `gorm:"size:255;not null" json:"holder"` // 持有租约的实例 ID
+	AcquiredAt time.Time `json:"acquired_at"`                     // 当前持有者获得租约的时间
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+}
+
+// ScheduledTaskFire 定时任务的触发记录，(任务, 触发时间) 唯一，保证每个调度时刻在集群内只执行一次
+type ScheduledTaskFire struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	ScheduledTaskID uint       `gorm:"not null;uniqueIndex:idx_scheduled_task_fire" json:"scheduled_task_id"`
+	FireTime        time.Time  `gorm:"not null;uniqueIndex:idx_scheduled_task_fire" json:"fire_time"` // 计划触发时刻（秒级）
+	Instance        string     `gorm:"size:255" json:"instance"`                                      // 执行该次触发的实例 ID
+	Status          string     `gorm:"size:20;index" json:"status"`                                   // running, queued, deferred, success, partial, failed, skipped, blocked, cancelled, missed
+	Reason          string     `gorm:"size:255" json:"reason"`                                        // 跳过/取消的原因
+	FinishedAt      *time.Time `json:"finished_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Secret 加密存储的密钥/口令，脚本中通过 ${secret:name} 引用
+// ProjectID、EnvironmentID 为空表示对所有项目/环境生效
+type Secret struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"not null;size:100;index" json:"name"`
+	ProjectID     *uint          `gorm:"index" json:"project_id"`
+	Project       *Project       `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	EnvironmentID *uint          `gorm:"index" json:"environment_id"`
+	Environment   *Environment   `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+	Value         string         `gorm:"type:text" json:"-"` // Encrypted value
+	Description   string         `gorm:"type:text" json:"description"`
+	CreatedBy     uint           `json:"created_by"`
+	Creator       User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
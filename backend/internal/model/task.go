@@ -13,40 +13,60 @@ import (
 
 // TaskTemplate represents a task template
 type TaskTemplate struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"not null;size:100" json:"name"`
-	Description string         `gorm:"type:text" json:"description"`
-	Content     string         `gorm:"type:text" json:"content"` // Script or command content
-	Type        string         `gorm:"size:50" json:"type"`      // shell, python, etc.
-	CreatedBy   uint           `json:"created_by"`
-	Creator     User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Name            string         `gorm:"not null;size:100" json:"name"`
+	Description     string         `gorm:"type:text" json:"description"`
+	Content         string         `gorm:"type:text" json:"content"`       // Script or command content
+	Type            string         `gorm:"size:50" json:"type"`            // shell, python, etc.
+	LatestVersion   int            `json:"latest_version"`                 // 最新版本号（每次保存递增）
+	GitRepositoryID *uint          `gorm:"index" json:"git_repository_id"` // 由 Git 仓库托管时只读
+	GitPath         string         `gorm:"size:500" json:"git_path"`       // 仓库内的源文件路径
+	CreatedBy       uint           `json:"created_by"`
+	Creator         User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
-	Tasks []Task `gorm:"foreignKey:TemplateID" json:"tasks,omitempty"`
+	Tasks    []Task                `gorm:"foreignKey:TemplateID" json:"tasks,omitempty"`
+	Versions []TaskTemplateVersion `gorm:"foreignKey:TemplateID" json:"versions,omitempty"`
+}
+
+// TaskTemplateVersion 模板的不可变历史版本，每次保存模板时生成
+type TaskTemplateVersion struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TemplateID  uint      `gorm:"not null;uniqueIndex:idx_template_version" json:"template_id"`
+	Version     int       `gorm:"not null;uniqueIndex:idx_template_version" json:"version"`
+	Name        string    `gorm:"not null;size:100" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	Content     string    `gorm:"type:text" json:"content"`
+	Type        string    `gorm:"size:50" json:"type"`
+	ChangeNote  string    `gorm:"type:text" json:"change_note"` // 变更说明
+	CreatedBy   uint      `json:"created_by"`
+	Creator     User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // Task represents an execution task
 type Task struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	TemplateID  *uint          `json:"template_id"`
-	Template    *TaskTemplate  `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
-	Name        string         `gorm:"not null;size:100" json:"name"`
-	Description string         `gorm:"type:text" json:"description"`
-	Content     string         `gorm:"type:text" json:"content"`                    // Script or command content
-	Type        string         `gorm:"size:50" json:"type"`                         // shell, python, etc.
-	Timeout     int            `gorm:"default:600" json:"timeout"`                  // Execution timeout in seconds (default 10 minutes)
-	Status      string         `gorm:"default:pending;size:20;index" json:"status"` // pending, running, success, failed, cancelled
-	AssetIDs    string         `gorm:"type:text" json:"asset_ids_str"`              // Comma-separated asset IDs for execution
-	CreatedBy   uint           `json:"created_by"`
-	Creator     User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	StartedAt   *time.Time     `json:"started_at"`
-	FinishedAt  *time.Time     `json:"finished_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	TemplateID      *uint          `json:"template_id"`
+	Template        *TaskTemplate  `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	TemplateVersion *int           `json:"template_version"` // 模板版本：nil 使用自身脚本，0 跟随最新版本，>0 固定版本
+	Name            string         `gorm:"not null;size:100" json:"name"`
+	Description     string         `gorm:"type:text" json:"description"`
+	Content         string         `gorm:"type:text" json:"content"`                    // Script or command content
+	Type            string         `gorm:"size:50" json:"type"`                         // shell, python, etc.
+	Timeout         int            `gorm:"default:600" json:"timeout"`                  // Execution timeout in seconds (default 10 minutes)
+	Status          string         `gorm:"default:pending;size:20;index" json:"status"` // pending, running, success, failed, cancelled
+	AssetIDs        string         `gorm:"type:text" json:"asset_ids_str"`              // Comma-separated asset IDs for execution
+	CreatedBy       uint           `json:"created_by"`
+	Creator         User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	StartedAt       *time.Time     `json:"started_at"`
+	FinishedAt      *time.Time     `json:"finished_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	Executions []TaskExecution `gorm:"foreignKey:TaskID" json:"executions,omitempty"`
@@ -55,16 +75,19 @@ type Task struct {
 // TaskExecution represents a task execution on a specific host
 type TaskExecution struct {
 	ID              uint           `gorm:"primaryKey" json:"id"`
-	TaskID          *uint          `gorm:"index" json:"task_id,omitempty"`                      // 关联的执行任务 ID（可为空）
+	TaskID          *uint          `gorm:"index" json:"task_id,omitempty"` // 关联的执行任务 ID（可为空）
 	Task            *Task          `gorm:"foreignKey:TaskID" json:"task,omitempty"`
-	ScheduledTaskID *uint          `gorm:"index" json:"scheduled_task_id,omitempty"`            // 关联的定时任务 ID（可为空）
+	ScheduledTaskID *uint          `gorm:"index" json:"scheduled_task_id,omitempty"` // 关联的定时任务 ID（可为空）
+	TemplateVersion *int           `json:"template_version,omitempty"`               // 执行时使用的模板版本
 	AssetID         uint           `gorm:"not null;index" json:"asset_id"`
 	Asset           Asset          `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
-	TriggerType     string         `gorm:"size:20;default:manual" json:"trigger_type"`          // manual, scheduled
-	Status          string         `gorm:"default:pending;size:20;index" json:"status"`         // pending, running, success, failed, cancelled
+	TriggerType     string         `gorm:"size:20;default:manual" json:"trigger_type"`  // manual, scheduled, webhook, chain
+	TriggeredBy     *uint          `gorm:"index" json:"triggered_by,omitempty"`         // 手动触发的用户 ID
+	ChainRunID      *uint          `gorm:"index" json:"chain_run_id,omitempty"`         // 由作业链触发时的链路记录 ID
+	Status          string         `gorm:"default:pending;size:20;index" json:"status"` // pending, running, success, failed, cancelled
 	ExitCode        *int           `json:"exit_code"`
-	Output          string         `gorm:"type:text" json:"output"`                             // Command output
-	Error           string         `gorm:"type:text" json:"error"`                              // Error message
+	Output          string         `gorm:"type:text" json:"output"` // Command output
+	Error           string         `gorm:"type:text" json:"error"`  // Error message
 	StartedAt       *time.Time     `json:"started_at"`
 	FinishedAt      *time.Time     `json:"finished_at"`
 	CreatedAt       time.Time      `json:"created_at"`
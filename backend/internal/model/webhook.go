@@ -0,0 +1,42 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookTrigger 入站 Webhook 触发器，CI 通过秘密 URL（可选 HMAC 签名）触发任务或部署
+type WebhookTrigger struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Name            string         `gorm:"not null;size:100" json:"name"`
+	Description     string         `gorm:"type:text" json:"description"`
+	TargetType      string         `gorm:"not null;size:20;index:idx_webhook_target" json:"target_type"` // task, deployment
+	TargetID        uint           `gorm:"not null;index:idx_webhook_target" json:"target_id"`           // 任务 ID 或部署模块 ID
+	AuthMode        string         `gorm:"size:20" json:"auth_mode"`                                     // token: 仅校验 URL 令牌；hmac: 同时校验请求签名
+	TokenHash       string         `gorm:"size:64;uniqueIndex" json:"-"`                                 // URL 令牌的 SHA-256，用于查找
+	TokenPrefix     string         `gorm:"size:20" json:"token_prefix"`                                  // 令牌前几位，仅用于展示
+	SecretEncrypted string         `gorm:"type:text" json:"-"`                                           // 加密存储的 HMAC 签名密钥
+	Status          string         `gorm:"size:20" json:"status"`                                        // active, revoked
+	LastTriggeredAt *time.Time     `json:"last_triggered_at"`
+	TriggerCount    int            `json:"trigger_count"`
+	CreatedBy       uint           `json:"created_by"`
+	Creator         User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// WebhookDelivery 已接受的 HMAC 签名请求，(触发器, 签名) 唯一，在签名有效期内拒绝重放
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TriggerID uint      `gorm:"not null;uniqueIndex:idx_webhook_delivery" json:"trigger_id"`
+	Signature string    `gorm:"size:64;not null;uniqueIndex:idx_webhook_delivery" json:"signature"` // 请求签名（hex）
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`                                            // 签名时间戳超出容差后可清理
+	CreatedAt time.Time `json:"created_at"`
+}
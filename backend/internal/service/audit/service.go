@@ -74,6 +74,7 @@ var SensitiveFields = []string{
 	"token",
 	"secret",
 	"api_key",
+	"value", // 密钥管理请求中的密钥值
 }
 
 // CreateLog 创建审计日志
@@ -0,0 +1,130 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Health check results
+const (
+	HealthPassed = "passed"
+	HealthFailed = "failed"
+)
+
+const defaultCanaryCheckInterval = 30 * time.Second
+
+// CanaryStrategy describes the canary stage of a module's deployments. The canary
+// hosts are checked with the module's host check (see HookStrategy).
+type CanaryStrategy struct {
+	Enabled         bool   `json:"enabled"`
+	AssetIDs        []uint `json:"asset_ids"`        // 金丝雀主机，需包含在部署目标中
+	SoakSeconds     int    `json:"soak_seconds"`     // 观察期，期间按间隔反复执行主机健康检查；0 只检查一次
+	IntervalSeconds int    `json:"interval_seconds"` // 观察期内的检查间隔，0 默认 30 秒
+	Rollback        bool   `json:"rollback"`         // 失败时将金丝雀主机回滚到上一个成功版本
+}
+
+// validate checks the canary configuration
+func (c *CanaryStrategy) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.AssetIDs) == 0 {
+		return errors.New("canary asset_ids is required when canary is enabled")
+	}
+	if c.SoakSeconds < 0 || c.IntervalSeconds < 0 {
+		return errors.New("canary soak_seconds and interval_seconds must not be negative")
+	}
+	return nil
+}
+
+// apply copies the canary configuration onto a module
+func (c *CanaryStrategy) apply(m *model.DeploymentModule) {
+	m.CanaryEnabled = c.Enabled
+	m.CanaryAssetIDs = joinAssetIDs(c.AssetIDs)
+	m.CanarySoakSeconds = c.SoakSeconds
+	m.CanaryCheckInterval = c.IntervalSeconds
+	m.CanaryRollback = c.Rollback
+}
+
+// moduleCanary returns the canary configuration of a module
+func moduleCanary(m *model.DeploymentModule) CanaryStrategy {
+	return CanaryStrategy{
+		Enabled:         m.CanaryEnabled,
+		AssetIDs:        parseAssetIDs(m.CanaryAssetIDs),
+		SoakSeconds:     m.CanarySoakSeconds,
+		IntervalSeconds: m.CanaryCheckInterval,
+		Rollback:        m.CanaryRollback,
+	}
+}
+
+// validateCanaryCheck ensures a module with a canary stage has a host check to gate it on
+func validateCanaryCheck(m *model.DeploymentModule) error {
+	if m.CanaryEnabled && m.HostCheckType == "" {
+		return errors.New("canary requires hooks.host_check to be configured")
+	}
+	return nil
+}
+
+// splitCanary separates the module's canary hosts from the other targets, keeping target order
+func splitCanary(assetIDs []uint, m *model.DeploymentModule) (canary, rest []uint) {
+	canarySet := make(map[uint]bool)
+	for _, id := range parseAssetIDs(m.CanaryAssetIDs) {
+		canarySet[id] = true
+	}
+	for _, id := range assetIDs {
+		if canarySet[id] {
+			canary = append(canary, id)
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	return canary, rest
+}
+
+// checkCanary runs the module's host check against the canary hosts for the
+// soak period, with the last round at or after its end. It returns passed,
+// failed or cancelled with the check output.
+func (s *Service) checkCanary(ctx context.Context, module *model.DeploymentModule, assetIDs []uint, scripts *hostScripts) (string, string) {
+	var assets []model.Asset
+	if err := s.db.Preload("SSHKey").Where("id IN ?", assetIDs).Find(&assets).Error; err != nil {
+		return HealthFailed, fmt.Sprintf("failed to load canary hosts: %v", err)
+	}
+
+	interval := defaultCanaryCheckInterval
+	if module.CanaryCheckInterval > 0 {
+		interval = time.Duration(module.CanaryCheckInterval) * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(module.CanarySoakSeconds) * time.Second)
+
+	var outputs []string
+	for round := 1; ; round++ {
+		for i := range assets {
+			status, output := s.checkHost(ctx, &assets[i], module, scripts.check)
+			if ctx.Err() != nil {
+				return "cancelled", strings.Join(outputs, "\n")
+			}
+			outputs = append(outputs, fmt.Sprintf("[第 %d 轮] %s: %s\n%s", round, assets[i].HostName, status, output))
+			if status != HealthPassed {
+				return HealthFailed, strings.Join(outputs, "\n")
+			}
+		}
+
+		// 最后一轮在观察期结束时执行，保证观察满 soak_seconds
+		if !time.Now().Before(deadline) {
+			return HealthPassed, strings.Join(outputs, "\n")
+		}
+		if !sleepContext(ctx, min(interval, time.Until(deadline))) {
+			return "cancelled", strings.Join(outputs, "\n")
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/secret"
+	"github.com/kkops/backend/internal/service/task"
+)
+
+// Host check types
+const (
+	CheckCommand = "command" // 在主机上执行命令，退出码为 0 视为健康
+	CheckHTTP    = "http"    // 由服务端请求 URL，校验状态码和响应体
+	CheckTCP     = "tcp"     // 由服务端连接主机端口
+)
+
+const (
+	defaultHostCheckTimeout  = 10 // seconds
+	defaultHostCheckInterval = 5  // seconds
+	hostCheckBodyLimit       = 1 << 20
+)
+
+// HookStrategy describes the hooks and health check run on every host around the deploy script
+type HookStrategy struct {
+	PreDeploy         string    `json:"pre_deploy"`          // 部署前执行，失败则不部署该主机
+	PreDeployTimeout  int       `json:"pre_deploy_timeout"`  // 秒，0 使用部署超时
+	PostDeploy        string    `json:"post_deploy"`         // 健康检查通过后执行
+	PostDeployTimeout int       `json:"post_deploy_timeout"` // 秒，0 使用部署超时
+	HostCheck         HostCheck `json:"host_check"`
+}
+
+// HostCheck describes the health check a host must pass to count as deployed
+type HostCheck struct {
+	Type     string `json:"type"`     // command, http, tcp；为空不检查
+	Command  string `json:"command"`  // command 类型的脚本
+	URL      string `json:"url"`      // http 类型的 URL，支持 ${HOST_NAME} ${IP}
+	Status   int    `json:"status"`   // http：期望的状态码，0 表示 2xx/3xx
+	Body     string `json:"body"`     // http：响应体需包含的内容
+	Port     int    `json:"port"`     // tcp 类型的端口
+	Timeout  int    `json:"timeout"`  // 每次检查的超时（秒），0 默认 10
+	Retries  int    `json:"retries"`  // 失败后的重试次数
+	Interval int    `json:"interval"` // 重试间隔（秒），0 默认 5
+}
+
+// hostScripts are the resolved scripts run on each host
+type hostScripts struct {
+	deploy     *secret.Resolved
+	preDeploy  *secret.Resolved // 未配置时为 nil
+	postDeploy *secret.Resolved
+	check      *secret.Resolved // command 类型健康检查，部署后与金丝雀观察期共用
+}
+
+// validate checks the hook configuration
+func (h *HookStrategy) validate() error {
+	if h.PreDeployTimeout < 0 || h.PostDeployTimeout < 0 {
+		return errors.New("hook timeouts must not be negative")
+	}
+	c := &h.HostCheck
+	if c.Timeout < 0 || c.Retries < 0 || c.Interval < 0 {
+		return errors.New("host_check timeout, retries and interval must not be negative")
+	}
+	switch c.Type {
+	case "":
+	case CheckCommand:
+		if strings.TrimSpace(c.Command) == "" {
+			return errors.New("host_check command is required")
+		}
+	case CheckHTTP:
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return errors.New("host_check url must be an http(s) URL")
+		}
+		if c.Status != 0 && (c.Status < 100 || c.Status > 599) {
+			return errors.New("host_check status must be a valid HTTP status code")
+		}
+	case CheckTCP:
+		if c.Port <= 0 || c.Port > 65535 {
+			return errors.New("host_check port must be between 1 and 65535")
+		}
+	default:
+		return errors.New("host_check type must be command, http or tcp")
+	}
+	return nil
+}
+
+// apply copies the hook configuration onto a module
+func (h *HookStrategy) apply(m *model.DeploymentModule) {
+	m.PreDeployScript = h.PreDeploy
+	m.PreDeployTimeout = h.PreDeployTimeout
+	m.PostDeployScript = h.PostDeploy
+	m.PostDeployTimeout = h.PostDeployTimeout
+	m.HostCheckType = h.HostCheck.Type
+	m.HostCheckCommand = h.HostCheck.Command
+	m.HostCheckURL = strings.TrimSpace(h.HostCheck.URL)
+	m.HostCheckStatus = h.HostCheck.Status
+	m.HostCheckBody = h.HostCheck.Body
+	m.HostCheckPort = h.HostCheck.Port
+	m.HostCheckTimeout = h.HostCheck.Timeout
+	m.HostCheckRetries = h.HostCheck.Retries
+	m.HostCheckInterval = h.HostCheck.Interval
+}
+
+// moduleHooks returns the hook configuration of a module
+func moduleHooks(m *model.DeploymentModule) HookStrategy {
+	return HookStrategy{
+		PreDeploy:         m.PreDeployScript,
+		PreDeployTimeout:  m.PreDeployTimeout,
+		PostDeploy:        m.PostDeployScript,
+		PostDeployTimeout: m.PostDeployTimeout,
+		HostCheck: HostCheck{
+			Type:     m.HostCheckType,
+			Command:  m.HostCheckCommand,
+			URL:      m.HostCheckURL,
+			Status:   m.HostCheckStatus,
+			Body:     m.HostCheckBody,
+			Port:     m.HostCheckPort,
+			Timeout:  m.HostCheckTimeout,
+			Retries:  m.HostCheckRetries,
+			Interval: m.HostCheckInterval,
+		},
+	}
+}
+
+// resolveHostScripts renders the deploy script, hooks and check command with the
+// deployment variables and resolves their secrets. The variables in effect are
+// recorded on the deployment. Chained deployments receive the upstream job's context.
+func (s *Service) resolveHostScripts(deployment *model.Deployment, module *model.DeploymentModule) (*hostScripts, error) {
+	vars, err := s.variableSvc.Effective(module.ProjectID, module.EnvironmentID, module.ID)
+	if err != nil {
+		return nil, fmt.Errorf("deployment variables: %w", err)
+	}
+	s.recordVariables(deployment, vars)
+
+	chainEnv := task.ChainEnv(s.db, deployment.ChainRunID)
+	resolve := func(script string) (*secret.Resolved, error) {
+		resolved, err := s.resolveScript(script, deployment, module, vars)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range chainEnv {
+			resolved.Env[k] = v
+		}
+		return resolved, nil
+	}
+
+	scripts := &hostScripts{}
+	if scripts.deploy, err = resolve(module.DeployScript); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(module.PreDeployScript) != "" {
+		if scripts.preDeploy, err = resolve(module.PreDeployScript); err != nil {
+			return nil, fmt.Errorf("pre-deploy hook: %w", err)
+		}
+	}
+	if strings.TrimSpace(module.PostDeployScript) != "" {
+		if scripts.postDeploy, err = resolve(module.PostDeployScript); err != nil {
+			return nil, fmt.Errorf("post-deploy hook: %w", err)
+		}
+	}
+	if module.HostCheckType == CheckCommand {
+		if scripts.check, err = resolve(module.HostCheckCommand); err != nil {
+			return nil, fmt.Errorf("host check: %w", err)
+		}
+	}
+	return scripts, nil
+}
+
+// deployHost runs the pre-deploy hook, the deploy script, the health check and
+// the post-deploy hook on one host, stopping at the first step that fails
+func (s *Service) deployHost(ctx context.Context, asset *model.Asset, module *model.DeploymentModule, scripts *hostScripts) hostOutcome {
+	outcome := hostOutcome{host: asset.HostName, exitCode: -1}
+	fail := func(step string, err error, r *secret.Resolved) hostOutcome {
+		if ctx.Err() != nil {
+			outcome.cancelled = true
+			outcome.err = fmt.Sprintf("[%s] cancelled", asset.HostName)
+			return outcome
+		}
+		outcome.err = r.Mask(fmt.Sprintf("[%s] %s%v", asset.HostName, step, err))
+		return outcome
+	}
+
+	if scripts.preDeploy != nil {
+		output, err := s.runHook(ctx, asset, scripts.preDeploy, hookTimeout(module.PreDeployTimeout, module.Timeout))
+		outcome.preDeploy = output
+		if err != nil || ctx.Err() != nil {
+			return fail("pre-deploy hook: ", err, scripts.preDeploy)
+		}
+	}
+
+	stdout, stderr, exitCode, err := s.executeScriptOnAsset(ctx, asset, scripts.deploy.Script, scripts.deploy.Env, module.Timeout)
+	outcome.stdout = scripts.deploy.Mask(stdout)
+	outcome.stderr = scripts.deploy.Mask(stderr)
+	outcome.exitCode = exitCode
+	outcome.output = hostOutput(asset, outcome.stdout, outcome.stderr)
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("script exited with code %d", exitCode)
+	}
+	if err != nil || ctx.Err() != nil {
+		return fail("", err, scripts.deploy)
+	}
+
+	if module.HostCheckType != "" {
+		outcome.checkStatus, outcome.checkOutput = s.checkHost(ctx, asset, module, scripts.check)
+		if outcome.checkStatus != HealthPassed {
+			return fail("", errors.New("health check failed"), scripts.check)
+		}
+	}
+
+	if scripts.postDeploy != nil {
+		output, err := s.runHook(ctx, asset, scripts.postDeploy, hookTimeout(module.PostDeployTimeout, module.Timeout))
+		outcome.postDeploy = output
+		if err != nil || ctx.Err() != nil {
+			return fail("post-deploy hook: ", err, scripts.postDeploy)
+		}
+	}
+	return outcome
+}
+
+// runHook runs a hook script on a host; a non-zero exit code is an error
+func (s *Service) runHook(ctx context.Context, asset *model.Asset, hook *secret.Resolved, timeout int) (string, error) {
+	stdout, stderr, exitCode, err := s.executeScriptOnAsset(ctx, asset, hook.Script, hook.Env, timeout)
+	output := hook.Mask(strings.TrimSpace(stdout + "\n" + stderr))
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exited with code %d", exitCode)
+	}
+	return output, err
+}
+
+// checkHost runs the module's host check until it passes or the retries are used up
+func (s *Service) checkHost(ctx context.Context, asset *model.Asset, module *model.DeploymentModule, check *secret.Resolved) (string, string) {
+	timeout := module.HostCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHostCheckTimeout
+	}
+	interval := module.HostCheckInterval
+	if interval <= 0 {
+		interval = defaultHostCheckInterval
+	}
+
+	var outputs []string
+	for attempt := 1; ; attempt++ {
+		var output string
+		var err error
+		switch module.HostCheckType {
+		case CheckCommand:
+			output, err = s.runHook(ctx, asset, check, timeout)
+		case CheckHTTP:
+			url := strings.ReplaceAll(module.HostCheckURL, "${HOST_NAME}", asset.HostName)
+			url = strings.ReplaceAll(url, "${IP}", asset.IP)
+			err = checkHTTP(ctx, url, module.HostCheckStatus, module.HostCheckBody, time.Duration(timeout)*time.Second)
+		case CheckTCP:
+			err = checkTCP(ctx, asset.IP, module.HostCheckPort, time.Duration(timeout)*time.Second)
+		}
+
+		line := fmt.Sprintf("[第 %d 次] ok", attempt)
+		if err != nil {
+			line = fmt.Sprintf("[第 %d 次] %v", attempt, err)
+		}
+		if output != "" {
+			line += "\n" + output
+		}
+		outputs = append(outputs, line)
+
+		if err == nil {
+			return HealthPassed, strings.Join(outputs, "\n")
+		}
+		if attempt > module.HostCheckRetries || !sleepContext(ctx, time.Duration(interval)*time.Second) {
+			return HealthFailed, strings.Join(outputs, "\n")
+		}
+	}
+}
+
+// checkHTTP requests the URL and checks the status code (2xx/3xx when expect is
+// 0) and, when body is set, that the response contains it
+func checkHTTP(ctx context.Context, url string, expect int, body string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case expect > 0 && resp.StatusCode != expect:
+		return fmt.Errorf("%s returned status %d, expected %d", url, resp.StatusCode, expect)
+	case expect == 0 && resp.StatusCode >= 400:
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if body == "" {
+		return nil
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, hostCheckBodyLimit))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(content), body) {
+		return fmt.Errorf("%s response does not contain %q", url, body)
+	}
+	return nil
+}
+
+// checkTCP checks that the port accepts connections
+func checkTCP(ctx context.Context, host string, port int, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func hookTimeout(timeout, fallback int) int {
+	if timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
@@ -0,0 +1,412 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Lock scopes
+const (
+	LockModule = "module" // 同一模块在同一环境同时只能有一个部署
+	LockAsset  = "asset"  // 同一主机同时只能被一个部署操作
+)
+
+const (
+	// lockPollInterval 排队的部署尝试获取锁的间隔
+	lockPollInterval = 5 * time.Second
+	// heartbeatInterval 执行协程刷新部署心跳的间隔
+	heartbeatInterval = 30 * time.Second
+	// heartbeatTimeout 超过该时间未刷新心跳的部署视为执行进程已退出（如服务重启）
+	heartbeatTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrLockNotFound is returned when breaking a lock that does not exist
+	ErrLockNotFound = errors.New("deployment lock not found")
+	// ErrBreakLockNotAllowed is returned when a non-admin tries to break a lock
+	ErrBreakLockNotAllowed = errors.New("only administrators can break deployment locks")
+)
+
+// activeStatuses 持有锁的部署所处的状态；其他状态或心跳超时的部署遗留的锁视为过期
+var activeStatuses = []string{"pending", "running", "waiting"}
+
+// unfinishedStatuses 尚未结束、由执行协程负责推进的部署状态
+var unfinishedStatuses = []string{"queued", "pending", "running", "waiting"}
+
+// errInterrupted 执行进程退出后遗留的部署记录的错误信息
+const errInterrupted = "deployment interrupted: the server running it stopped"
+
+// LockStrategy describes how a module's deployments are serialized
+type LockStrategy struct {
+	Scope string `json:"scope"` // module（默认）, asset
+	Queue bool   `json:"queue"` // 锁被占用时排队等待，否则拒绝部署
+}
+
+// LockResponse represents a held deployment lock
+type LockResponse struct {
+	ID               uint      `json:"id"`
+	LockKey          string    `json:"lock_key"`
+	Scope            string    `json:"scope"`
+	ModuleID         uint      `json:"module_id"`
+	EnvironmentID    *uint     `json:"environment_id"`
+	AssetID          *uint     `json:"asset_id"`
+	DeploymentID     uint      `json:"deployment_id"`
+	DeploymentStatus string    `json:"deployment_status"`
+	HolderID         uint      `json:"holder_id"`
+	HolderName       string    `json:"holder_name"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// LockedError is returned when a deployment is rejected because another deployment holds the lock
+type LockedError struct {
+	Lock LockResponse
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s is locked by deployment #%d started by %s at %s",
+		e.Lock.LockKey, e.Lock.DeploymentID, e.Lock.HolderName, e.Lock.CreatedAt.Format(time.RFC3339))
+}
+
+// validate checks the lock configuration
+func (l *LockStrategy) validate() error {
+	switch l.Scope {
+	case "", LockModule, LockAsset:
+		return nil
+	}
+	return errors.New("lock scope must be module or asset")
+}
+
+// apply copies the lock configuration onto a module
+func (l *LockStrategy) apply(m *model.DeploymentModule) {
+	m.LockScope = l.Scope
+	m.LockQueue = l.Queue
+}
+
+// moduleLock returns the lock configuration of a module
+func moduleLock(m *model.DeploymentModule) LockStrategy {
+	scope := m.LockScope
+	if scope == "" {
+		scope = LockModule
+	}
+	return LockStrategy{Scope: scope, Queue: m.LockQueue}
+}
+
+// planLocks returns the locks a deployment of the module to the hosts needs
+func planLocks(module *model.DeploymentModule, assetIDs []uint) []model.DeploymentLock {
+	if module.LockScope == LockAsset {
+		locks := make([]model.DeploymentLock, len(assetIDs))
+		for i := range assetIDs {
+			assetID := assetIDs[i]
+			locks[i] = model.DeploymentLock{
+				LockKey:  fmt.Sprintf("asset:%d", assetID),
+				Scope:    LockAsset,
+				ModuleID: module.ID,
+				AssetID:  &assetID,
+			}
+		}
+		return locks
+	}
+
+	var env uint
+	if module.EnvironmentID != nil {
+		env = *module.EnvironmentID
+	}
+	return []model.DeploymentLock{{
+		LockKey:       fmt.Sprintf("module:%d:env:%d", module.ID, env),
+		Scope:         LockModule,
+		ModuleID:      module.ID,
+		EnvironmentID: module.EnvironmentID,
+	}}
+}
+
+// createDeployment saves a new deployment together with its locks. When a lock
+// is held by another deployment it queues the deployment if the module (or the
+// request) allows it and returns a LockedError otherwise.
+func (s *Service) createDeployment(deployment *model.Deployment, module *model.DeploymentModule, assetIDs []uint, queue bool) error {
+	locks := planLocks(module, assetIDs)
+	s.releaseStaleLocks(locks)
+
+	now := time.Now()
+	deployment.HeartbeatAt = &now
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(deployment).Error; err != nil {
+			return err
+		}
+		return createLocks(tx, deployment, locks)
+	})
+	if err == nil {
+		return nil
+	}
+
+	locked := s.lockHolder(locks)
+	if locked == nil {
+		return err
+	}
+	if !queue && !module.LockQueue {
+		return locked
+	}
+
+	// 事务已回滚，以排队状态重新创建；执行协程获取到锁后再开始部署
+	deployment.ID = 0
+	deployment.CreatedAt = time.Time{}
+	deployment.Status = "queued"
+	return s.db.Create(deployment).Error
+}
+
+// createLocks inserts the locks for a deployment; the unique lock key makes a held lock fail the insert
+func createLocks(tx *gorm.DB, deployment *model.Deployment, locks []model.DeploymentLock) error {
+	for i := range locks {
+		lock := locks[i]
+		lock.DeploymentID = deployment.ID
+		lock.HolderID = deployment.CreatedBy
+		if err := tx.Create(&lock).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForLock blocks a queued deployment until it obtains its locks and is
+// next in line for the module. It returns false when the deployment was cancelled.
+func (s *Service) waitForLock(ctx context.Context, deployment *model.Deployment, module *model.DeploymentModule) bool {
+	locks := planLocks(module, parseAssetIDs(deployment.AssetIDs))
+	for {
+		// 只等待仍有进程在执行的排队部署，服务重启遗留的排队记录不会阻塞后续部署
+		var earlier int64
+		s.db.Model(&model.Deployment{}).
+			Where("module_id = ? AND status = ? AND id < ? AND heartbeat_at >= ?",
+				deployment.ModuleID, "queued", deployment.ID, time.Now().Add(-heartbeatTimeout)).
+			Count(&earlier)
+
+		if earlier == 0 {
+			s.releaseStaleLocks(locks)
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				if err := createLocks(tx, deployment, locks); err != nil {
+					return err
+				}
+				result := tx.Model(&model.Deployment{}).Where("id = ? AND status = ?", deployment.ID, "queued").Update("status", "pending")
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return errDeploymentCancelled
+				}
+				return nil
+			})
+			if err == nil {
+				deployment.Status = "pending"
+				return true
+			}
+			if errors.Is(err, errDeploymentCancelled) {
+				return false
+			}
+		}
+
+		if !sleepContext(ctx, lockPollInterval) {
+			return false
+		}
+	}
+}
+
+// errDeploymentCancelled 排队期间部署被取消
+var errDeploymentCancelled = errors.New("deployment cancelled")
+
+// releaseLocks releases all locks held by a deployment
+func (s *Service) releaseLocks(deploymentID uint) {
+	s.db.Where("deployment_id = ?", deploymentID).Delete(&model.DeploymentLock{})
+}
+
+// releaseStaleLocks removes locks on the given keys whose deployment has finished,
+// no longer exists or is no longer run by any process
+func (s *Service) releaseStaleLocks(locks []model.DeploymentLock) {
+	keys := make([]string, len(locks))
+	for i, l := range locks {
+		keys[i] = l.LockKey
+	}
+	s.db.Where("lock_key IN ? AND deployment_id NOT IN (?)", keys,
+		s.db.Model(&model.Deployment{}).Select("id").
+			Where("status IN ? AND heartbeat_at >= ?", activeStatuses, time.Now().Add(-heartbeatTimeout))).
+		Delete(&model.DeploymentLock{})
+}
+
+// keepAlive refreshes the deployment's heartbeat until the returned function is called
+func (s *Service) keepAlive(deploymentID uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				s.db.Model(&model.Deployment{}).Where("id = ?", deploymentID).Update("heartbeat_at", now)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// RecoverInterrupted marks deployments left unfinished by a stopped process (e.g.
+// a server restart) as failed and releases their locks. Deployments still run by
+// another replica keep refreshing their heartbeat and are left alone. It returns
+// the number of deployments recovered.
+func (s *Service) RecoverInterrupted() (int, error) {
+	cutoff := time.Now().Add(-heartbeatTimeout)
+	var stale []model.Deployment
+	if err := s.db.Select("id").
+		Where("status IN ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", unfinishedStatuses, cutoff).
+		Find(&stale).Error; err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, d := range stale {
+		now := time.Now()
+		result := s.db.Model(&model.Deployment{}).
+			Where("id = ? AND status IN ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", d.ID, unfinishedStatuses, cutoff).
+			Updates(map[string]interface{}{"status": "failed", "error": errInterrupted, "finished_at": now})
+		if result.Error != nil {
+			return recovered, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		s.abandon(d.ID, TargetFailed, now)
+		recovered++
+	}
+	return recovered, nil
+}
+
+// StartRecovery runs RecoverInterrupted now and then every heartbeatTimeout until
+// StopRecovery is called. A restart within heartbeatTimeout leaves the previous
+// process's deployments with fresh heartbeats, so a single sweep at startup would
+// miss them; the periodic sweep picks them up once their heartbeat expires.
+func (s *Service) StartRecovery(logger *zap.Logger) {
+	s.recoverStop = make(chan struct{})
+	s.recoverWg.Add(1)
+	go func() {
+		defer s.recoverWg.Done()
+		ticker := time.NewTicker(heartbeatTimeout)
+		defer ticker.Stop()
+		for {
+			if n, err := s.RecoverInterrupted(); err != nil {
+				logger.Error("恢复中断的部署失败", zap.Error(err))
+			} else if n > 0 {
+				logger.Warn("已将中断的部署标记为失败", zap.Int("count", n))
+			}
+			select {
+			case <-s.recoverStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopRecovery stops the recovery loop and waits for it to exit
+func (s *Service) StopRecovery() {
+	if s.recoverStop == nil {
+		return
+	}
+	close(s.recoverStop)
+	s.recoverWg.Wait()
+}
+
+// abandon releases the locks of a deployment that has no execution goroutine and
+// closes its unfinished batches and targets; running targets get runningStatus
+func (s *Service) abandon(deploymentID uint, runningStatus string, now time.Time) {
+	s.releaseLocks(deploymentID)
+	s.db.Model(&model.DeploymentBatch{}).
+		Where("deployment_id = ? AND status IN ?", deploymentID, []string{BatchPending, BatchRunning}).
+		Update("status", BatchSkipped)
+	s.db.Model(&model.DeploymentTarget{}).
+		Where("deployment_id = ? AND status = ?", deploymentID, TargetPending).
+		Update("status", TargetSkipped)
+	s.db.Model(&model.DeploymentTarget{}).
+		Where("deployment_id = ? AND status = ?", deploymentID, TargetRunning).
+		Updates(map[string]interface{}{"status": runningStatus, "finished_at": now})
+}
+
+// lockHolder returns a LockedError for the first of the locks that is held, or nil
+func (s *Service) lockHolder(locks []model.DeploymentLock) *LockedError {
+	keys := make([]string, len(locks))
+	for i, l := range locks {
+		keys[i] = l.LockKey
+	}
+	var held model.DeploymentLock
+	if err := s.db.Preload("Holder").Where("lock_key IN ?", keys).Order("id").First(&held).Error; err != nil {
+		return nil
+	}
+	return &LockedError{Lock: s.lockToResponse(&held)}
+}
+
+// ListLocks returns the held deployment locks
+func (s *Service) ListLocks() ([]LockResponse, error) {
+	var locks []model.DeploymentLock
+	if err := s.db.Preload("Holder").Order("id").Find(&locks).Error; err != nil {
+		return nil, err
+	}
+	result := make([]LockResponse, len(locks))
+	for i := range locks {
+		result[i] = s.lockToResponse(&locks[i])
+	}
+	return result, nil
+}
+
+// BreakLock removes a lock, typically one left by a deployment that stopped
+// without releasing it. Only administrators may break locks.
+func (s *Service) BreakLock(id, userID uint) (*LockResponse, error) {
+	isAdmin, err := s.authzSvc.IsAdmin(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrBreakLockNotAllowed
+	}
+
+	var lock model.DeploymentLock
+	if err := s.db.Preload("Holder").First(&lock, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLockNotFound
+		}
+		return nil, err
+	}
+	if err := s.db.Delete(&lock).Error; err != nil {
+		return nil, err
+	}
+	resp := s.lockToResponse(&lock)
+	return &resp, nil
+}
+
+func (s *Service) lockToResponse(l *model.DeploymentLock) LockResponse {
+	resp := LockResponse{
+		ID:               l.ID,
+		LockKey:          l.LockKey,
+		Scope:            l.Scope,
+		ModuleID:         l.ModuleID,
+		EnvironmentID:    l.EnvironmentID,
+		AssetID:          l.AssetID,
+		DeploymentID:     l.DeploymentID,
+		DeploymentStatus: s.currentStatus(l.DeploymentID),
+		HolderID:         l.HolderID,
+		CreatedAt:        l.CreatedAt,
+	}
+	if l.Holder.ID > 0 {
+		resp.HolderName = l.Holder.Username
+	}
+	return resp
+}
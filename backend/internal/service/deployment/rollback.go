@@ -0,0 +1,240 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// rollbackHistoryLimit 查找上一个成功版本时每台主机最多回溯的部署记录数
+const rollbackHistoryLimit = 100
+
+// RollbackStrategy describes how a module is rolled back
+type RollbackStrategy struct {
+	Script    string `json:"script"`    // 回滚专用脚本，为空时使用部署脚本；${VERSION} 为回滚到的版本
+	Auto      bool   `json:"auto"`      // 部署失败主机数达到阈值时自动回滚这些部署涉及的主机
+	Threshold int    `json:"threshold"` // 自动回滚的失败主机数阈值，0 视为 1
+}
+
+// RollbackRequest represents a request to roll a module back
+type RollbackRequest struct {
+	AssetIDs            []uint `json:"asset_ids"`            // 为空时回滚模块配置的全部主机
+	EnvironmentID       *uint  `json:"environment_id"`       // 回滚的环境（如流水线阶段的环境），为空时使用模块的环境
+	OverrideMaintenance bool   `json:"override_maintenance"` // 仅管理员：越过维护窗口强制回滚
+}
+
+// RollbackSkip explains why a host was not rolled back
+type RollbackSkip struct {
+	AssetID uint   `json:"asset_id"`
+	Reason  string `json:"reason"`
+}
+
+// RollbackResponse lists the rollback deployments started, one per target version
+type RollbackResponse struct {
+	Deployments []DeploymentResponse `json:"deployments"`
+	Skipped     []RollbackSkip       `json:"skipped,omitempty"`
+}
+
+// validate checks the rollback configuration
+func (r *RollbackStrategy) validate() error {
+	if r.Threshold < 0 {
+		return errors.New("rollback threshold must not be negative")
+	}
+	return nil
+}
+
+// apply copies the rollback configuration onto a module
+func (r *RollbackStrategy) apply(m *model.DeploymentModule) {
+	m.RollbackScript = r.Script
+	m.AutoRollback = r.Auto
+	m.RollbackThreshold = r.Threshold
+}
+
+// moduleRollback returns the rollback configuration of a module
+func moduleRollback(m *model.DeploymentModule) RollbackStrategy {
+	return RollbackStrategy{
+		Script:    m.RollbackScript,
+		Auto:      m.AutoRollback,
+		Threshold: m.RollbackThreshold,
+	}
+}
+
+// Rollback redeploys, for every host, the last version that deployed successfully
+// on it in the environment before the version it currently runs. Hosts sharing a
+// target version are rolled back by one deployment.
+func (s *Service) Rollback(moduleID uint, req *RollbackRequest, userID uint) (*RollbackResponse, error) {
+	var module model.DeploymentModule
+	if err := s.db.First(&module, moduleID).Error; err != nil {
+		return nil, err
+	}
+
+	assetIDs := req.AssetIDs
+	if len(assetIDs) == 0 {
+		assetIDs = parseAssetIDs(module.AssetIDs)
+	}
+	if len(assetIDs) == 0 {
+		return nil, errors.New("no target assets specified")
+	}
+
+	environmentID := module.EnvironmentID
+	if req.EnvironmentID != nil {
+		environmentID = req.EnvironmentID
+	}
+
+	targets, skipped, err := s.rollbackTargets(moduleID, environmentID, assetIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no successful version to roll back to")
+	}
+
+	resp := &RollbackResponse{Deployments: []DeploymentResponse{}, Skipped: skipped}
+	for _, version := range sortedVersions(targets) {
+		d, err := s.Deploy(moduleID, &DeployRequest{
+			Version:             version,
+			AssetIDs:            targets[version],
+			OverrideMaintenance: req.OverrideMaintenance,
+			TriggerType:         "rollback",
+			SkipCanary:          true,
+			QueueOnLock:         true, // 同一模块的多个回滚部署依次执行
+			EnvironmentID:       environmentID,
+		}, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to roll back to %s: %w", version, err)
+		}
+		resp.Deployments = append(resp.Deployments, *d)
+	}
+	return resp, nil
+}
+
+// rollbackFailed rolls the hosts touched by a failed deployment back to their
+// previous successful version. It returns the first rollback deployment ID and a
+// note for the deployment's error output.
+func (s *Service) rollbackFailed(deployment *model.Deployment, assetIDs []uint) (*uint, string) {
+	targets, _, err := s.rollbackTargets(deployment.ModuleID, deployment.EnvironmentID, assetIDs, deployment)
+	if err != nil {
+		return nil, fmt.Sprintf("查找回滚版本失败: %v", err)
+	}
+	if len(targets) == 0 {
+		return nil, "没有可回滚的成功版本，未执行回滚"
+	}
+
+	var firstID *uint
+	var notes []string
+	for _, version := range sortedVersions(targets) {
+		resp, err := s.Deploy(deployment.ModuleID, &DeployRequest{
+			Version:       version,
+			AssetIDs:      targets[version],
+			TriggerType:   "rollback",
+			RollbackOf:    &deployment.ID,
+			SkipCanary:    true,
+			QueueOnLock:   true,
+			EnvironmentID: deployment.EnvironmentID,
+		}, deployment.CreatedBy)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("回滚到 %s 失败: %v", version, err))
+			continue
+		}
+		if firstID == nil {
+			firstID = &resp.ID
+		}
+		notes = append(notes, fmt.Sprintf("已发起回滚部署 #%d，将 %d 台主机回滚到 %s", resp.ID, len(targets[version]), version))
+	}
+	return firstID, strings.Join(notes, "\n")
+}
+
+// rollbackTargets groups hosts by the version they should be rolled back to.
+// Only the history in the given environment is considered. A host's current
+// version is its newest finished deployment target (or the given failed
+// deployment); its rollback version is the newest successful target before
+// that with a different version.
+func (s *Service) rollbackTargets(moduleID uint, environmentID *uint, assetIDs []uint, failed *model.Deployment) (map[string][]uint, []RollbackSkip, error) {
+	// 按主机分别截取最近的记录，避免部署频繁的主机挤占其他主机的历史
+	recent := s.db.Model(&model.DeploymentTarget{}).
+		Select("id, asset_id, version, status, ROW_NUMBER() OVER (PARTITION BY asset_id ORDER BY id DESC) AS row_num").
+		Where("module_id = ? AND asset_id IN ? AND status IN ?", moduleID, assetIDs, []string{TargetSuccess, TargetFailed, TargetCancelled})
+	if environmentID != nil {
+		recent = recent.Where("environment_id = ?", *environmentID)
+	} else {
+		recent = recent.Where("environment_id IS NULL")
+	}
+	if failed != nil {
+		recent = recent.Where("deployment_id < ?", failed.ID)
+	}
+	var history []model.DeploymentTarget
+	if err := s.db.Table("(?) AS recent", recent).Select("id, asset_id, version, status").
+		Where("row_num <= ?", rollbackHistoryLimit).Order("id DESC").Find(&history).Error; err != nil {
+		return nil, nil, err
+	}
+
+	targets := make(map[string][]uint)
+	var skipped []RollbackSkip
+	for _, assetID := range assetIDs {
+		current := ""
+		if failed != nil {
+			current = failed.Version
+		}
+		target := ""
+		for _, t := range history {
+			if t.AssetID != assetID {
+				continue
+			}
+			if current == "" {
+				current = t.Version
+				continue
+			}
+			if t.Status == TargetSuccess && t.Version != current {
+				target = t.Version
+				break
+			}
+		}
+
+		switch {
+		case current == "":
+			skipped = append(skipped, RollbackSkip{AssetID: assetID, Reason: "no deployment history for this host"})
+		case target == "":
+			skipped = append(skipped, RollbackSkip{AssetID: assetID, Reason: "no earlier successful version"})
+		default:
+			targets[target] = append(targets[target], assetID)
+		}
+	}
+	return targets, skipped, nil
+}
+
+// touchedAssets returns the hosts of the batches that ran
+func touchedAssets(batches []model.DeploymentBatch) []uint {
+	var ids []uint
+	for _, b := range batches {
+		if b.Status == BatchSuccess || b.Status == BatchFailed {
+			ids = append(ids, parseAssetIDs(b.AssetIDs)...)
+		}
+	}
+	return ids
+}
+
+func containsAsset(assetIDs string, id uint) bool {
+	for _, v := range parseAssetIDs(assetIDs) {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedVersions(targets map[string][]uint) []string {
+	versions := make([]string, 0, len(targets))
+	for v := range targets {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
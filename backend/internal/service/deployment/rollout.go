@@ -0,0 +1,391 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Batch statuses
+const (
+	BatchPending = "pending"
+	BatchRunning = "running"
+	BatchSuccess = "success"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped" // 部署中止或取消后未执行的批次
+)
+
+// gatePollInterval 等待人工确认时查询部署状态的间隔
+const gatePollInterval = 3 * time.Second
+
+// ErrDeploymentNotWaiting is returned when continuing a deployment that is not waiting at a gate
+var ErrDeploymentNotWaiting = errors.New("deployment is not waiting for confirmation")
+
+// RolloutStrategy describes how a module's deployments are rolled out across hosts.
+// The zero value deploys to one host at a time and never aborts, as before batching existed.
+type RolloutStrategy struct {
+	BatchSize    int  `json:"batch_size"`    // 每批主机数，0 视为 1
+	BatchPercent int  `json:"batch_percent"` // 每批占目标主机的百分比（1-100），大于 0 时优先于 batch_size
+	PauseSeconds int  `json:"pause_seconds"` // 批次之间的等待时间（秒）
+	MaxFailures  int  `json:"max_failures"`  // 失败主机数达到该值时中止剩余批次，0 不限制
+	ManualGate   bool `json:"manual_gate"`   // 每批完成后等待人工确认（POST /deployments/{id}/continue）
+}
+
+// BatchResponse represents one batch of a deployment
+type BatchResponse struct {
+	Number       int        `json:"number"`
+	Canary       bool       `json:"canary"`
+	AssetIDs     []uint     `json:"asset_ids"`
+	Status       string     `json:"status"`
+	SuccessCount int        `json:"success_count"`
+	FailedCount  int        `json:"failed_count"`
+	HealthStatus string     `json:"health_status,omitempty"`
+	HealthOutput string     `json:"health_output,omitempty"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// validate checks that the strategy values are in range
+func (r *RolloutStrategy) validate() error {
+	if r.BatchSize < 0 || r.PauseSeconds < 0 || r.MaxFailures < 0 {
+		return errors.New("rollout batch_size, pause_seconds and max_failures must not be negative")
+	}
+	if r.BatchPercent < 0 || r.BatchPercent > 100 {
+		return errors.New("rollout batch_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// apply copies the strategy onto a module
+func (r *RolloutStrategy) apply(m *model.DeploymentModule) {
+	m.RolloutBatchSize = r.BatchSize
+	m.RolloutBatchPercent = r.BatchPercent
+	m.RolloutPauseSeconds = r.PauseSeconds
+	m.RolloutMaxFailures = r.MaxFailures
+	m.RolloutManualGate = r.ManualGate
+}
+
+// moduleRollout returns the rollout strategy configured on a module
+func moduleRollout(m *model.DeploymentModule) RolloutStrategy {
+	return RolloutStrategy{
+		BatchSize:    m.RolloutBatchSize,
+		BatchPercent: m.RolloutBatchPercent,
+		PauseSeconds: m.RolloutPauseSeconds,
+		MaxFailures:  m.RolloutMaxFailures,
+		ManualGate:   m.RolloutManualGate,
+	}
+}
+
+// planBatches splits the target hosts into batches of the strategy's size
+func planBatches(assetIDs []uint, strategy RolloutStrategy) [][]uint {
+	size := strategy.BatchSize
+	if strategy.BatchPercent > 0 {
+		size = int(math.Ceil(float64(len(assetIDs)) * float64(strategy.BatchPercent) / 100))
+	}
+	if size <= 0 {
+		size = 1
+	}
+
+	var batches [][]uint
+	for start := 0; start < len(assetIDs); start += size {
+		end := start + size
+		if end > len(assetIDs) {
+			end = len(assetIDs)
+		}
+		batches = append(batches, assetIDs[start:end])
+	}
+	return batches
+}
+
+// createBatches records the planned batches of a deployment. With canary the
+// module's canary hosts form the first batch and the rest follow the rollout strategy.
+func (s *Service) createBatches(deploymentID uint, assetIDs []uint, module *model.DeploymentModule, canary bool) ([]model.DeploymentBatch, error) {
+	var batches []model.DeploymentBatch
+	if canary {
+		var canaryIDs []uint
+		canaryIDs, assetIDs = splitCanary(assetIDs, module)
+		batches = append(batches, model.DeploymentBatch{
+			DeploymentID: deploymentID,
+			Number:       1,
+			Canary:       true,
+			AssetIDs:     joinAssetIDs(canaryIDs),
+			Status:       BatchPending,
+		})
+	}
+	for _, ids := range planBatches(assetIDs, moduleRollout(module)) {
+		batches = append(batches, model.DeploymentBatch{
+			DeploymentID: deploymentID,
+			Number:       len(batches) + 1,
+			AssetIDs:     joinAssetIDs(ids),
+			Status:       BatchPending,
+		})
+	}
+	if err := s.db.Create(&batches).Error; err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// hostOutcome is the result of deploying to one host
+type hostOutcome struct {
+	host      string
+	output    string // 带主机标题的合并输出，写入部署记录的 Output
+	stdout    string
+	stderr    string
+	exitCode  int // -1 表示脚本未执行完成（连接失败、超时、取消等）
+	err       string
+	cancelled bool // 部署被取消，脚本已被终止或未开始
+
+	preDeploy   string // 钩子输出与健康检查结果单独记录，不计入 output
+	postDeploy  string
+	checkStatus string
+	checkOutput string
+}
+
+// rolloutResult collects the outcome of all batches
+type rolloutResult struct {
+	outputs      []string
+	errors       []string
+	failedHosts  []string
+	aborted      string // 中止原因
+	cancelled    bool
+	canaryFailed bool   // 金丝雀部署或健康检查失败
+	canaryIDs    []uint // 金丝雀主机，用于回滚
+}
+
+// runBatches deploys batch by batch. Hosts in a batch run in parallel; between
+// batches it pauses, waits at the manual gate if configured, and aborts the
+// remaining batches once the failure limit is reached or ctx is cancelled.
+func (s *Service) runBatches(ctx context.Context, deployment *model.Deployment, module *model.DeploymentModule, batches []model.DeploymentBatch, scripts *hostScripts) *rolloutResult {
+	strategy := moduleRollout(module)
+	result := &rolloutResult{}
+
+	for i := range batches {
+		batch := &batches[i]
+
+		if i > 0 {
+			if strategy.MaxFailures > 0 && len(result.failedHosts) >= strategy.MaxFailures {
+				result.aborted = fmt.Sprintf("失败主机数达到上限 %d，已中止剩余 %d 个批次", strategy.MaxFailures, len(batches)-i)
+				s.skipBatches(batches[i:])
+				return result
+			}
+			if !s.waitBeforeBatch(ctx, deployment, batch.Number, strategy) {
+				result.cancelled = true
+				s.skipBatches(batches[i:])
+				return result
+			}
+		}
+
+		deployment.CurrentBatch = batch.Number
+		s.db.Model(deployment).Update("current_batch", batch.Number)
+
+		now := time.Now()
+		batch.Status = BatchRunning
+		batch.StartedAt = &now
+		s.db.Save(batch)
+
+		outcomes := s.runBatch(ctx, deployment.ID, parseAssetIDs(batch.AssetIDs), module, scripts)
+		for _, o := range outcomes {
+			if o.cancelled {
+				result.cancelled = true
+			} else if o.err != "" {
+				batch.FailedCount++
+				result.errors = append(result.errors, o.err)
+				result.failedHosts = append(result.failedHosts, o.host)
+			} else {
+				batch.SuccessCount++
+			}
+			if o.output != "" {
+				result.outputs = append(result.outputs, o.output)
+			}
+		}
+
+		finishedAt := time.Now()
+		batch.FinishedAt = &finishedAt
+		batch.Status = BatchSuccess
+		if batch.FailedCount > 0 {
+			batch.Status = BatchFailed
+		}
+		s.db.Save(batch)
+		if result.cancelled {
+			s.skipBatches(batches[i+1:])
+			return result
+		}
+
+		// 中间结果随批次写入，便于执行过程中查看
+		s.db.Model(deployment).Updates(map[string]interface{}{
+			"output": strings.Join(result.outputs, "\n\n"),
+			"error":  strings.Join(result.errors, "\n"),
+		})
+
+		if batch.Canary && !s.passCanary(ctx, deployment, module, batch, result, scripts) {
+			s.skipBatches(batches[i+1:])
+			return result
+		}
+	}
+	return result
+}
+
+// passCanary gates the rollout on the canary batch: the canary hosts must all
+// deploy successfully and pass the host check for the soak period
+func (s *Service) passCanary(ctx context.Context, deployment *model.Deployment, module *model.DeploymentModule, batch *model.DeploymentBatch, result *rolloutResult, scripts *hostScripts) bool {
+	canaryIDs := parseAssetIDs(batch.AssetIDs)
+	if batch.FailedCount > 0 {
+		result.aborted = "金丝雀主机部署失败，已中止发布"
+		result.canaryFailed = true
+		result.canaryIDs = canaryIDs
+		return false
+	}
+
+	status, output := s.checkCanary(ctx, module, canaryIDs, scripts)
+	if status == "cancelled" {
+		result.cancelled = true
+		return false
+	}
+	batch.HealthStatus = status
+	batch.HealthOutput = output
+	s.db.Save(batch)
+
+	if status != HealthPassed {
+		result.aborted = "金丝雀健康检查失败，已中止发布"
+		result.canaryFailed = true
+		result.canaryIDs = canaryIDs
+		return false
+	}
+	return true
+}
+
+// runBatch deploys to all hosts of a batch in parallel and records each host's
+// target; outcomes keep the batch's host order. Cancelling ctx kills the running scripts.
+func (s *Service) runBatch(ctx context.Context, deploymentID uint, assetIDs []uint, module *model.DeploymentModule, scripts *hostScripts) []hostOutcome {
+	outcomes := make([]hostOutcome, len(assetIDs))
+	var wg sync.WaitGroup
+	for i, assetID := range assetIDs {
+		wg.Add(1)
+		go func(i int, assetID uint) {
+			defer wg.Done()
+			s.startTarget(deploymentID, assetID)
+			defer func() { s.finishTarget(deploymentID, assetID, &outcomes[i]) }()
+
+			var asset model.Asset
+			if err := s.db.Preload("SSHKey").First(&asset, assetID).Error; err != nil {
+				outcomes[i] = hostOutcome{
+					host:     strconv.FormatUint(uint64(assetID), 10),
+					exitCode: -1,
+					err:      fmt.Sprintf("[%d] Failed to get asset: %v", assetID, err),
+				}
+				return
+			}
+
+			outcome := s.deployHost(ctx, &asset, module, scripts)
+			outcomes[i] = outcome
+		}(i, assetID)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// waitBeforeBatch pauses before the next batch and, with a manual gate, waits
+// until the deployment is continued. It returns false when the deployment was cancelled.
+func (s *Service) waitBeforeBatch(ctx context.Context, deployment *model.Deployment, next int, strategy RolloutStrategy) bool {
+	if strategy.PauseSeconds > 0 && !sleepContext(ctx, time.Duration(strategy.PauseSeconds)*time.Second) {
+		return false
+	}
+	if !strategy.ManualGate {
+		return ctx.Err() == nil
+	}
+
+	// 进入等待确认状态；continue 接口将状态改回 running 后继续下一批
+	deployment.Status = "waiting"
+	deployment.CurrentBatch = next
+	s.db.Model(&model.Deployment{}).Where("id = ? AND status = ?", deployment.ID, "running").
+		Updates(map[string]interface{}{"status": "waiting", "current_batch": next})
+	for {
+		if s.currentStatus(deployment.ID) == "running" {
+			deployment.Status = "running"
+			return true
+		}
+		if !sleepContext(ctx, gatePollInterval) {
+			return false
+		}
+	}
+}
+
+// sleepContext waits for d and returns false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// skipBatches marks batches, and their hosts' targets, that will not run
+func (s *Service) skipBatches(batches []model.DeploymentBatch) {
+	for i := range batches {
+		batches[i].Status = BatchSkipped
+		s.db.Save(&batches[i])
+	}
+	if len(batches) > 0 {
+		s.skipTargets(batches[0].DeploymentID, batches)
+	}
+}
+
+// currentStatus reads a deployment's status from the database
+func (s *Service) currentStatus(id uint) string {
+	var d model.Deployment
+	if err := s.db.Select("id, status").First(&d, id).Error; err != nil {
+		return ""
+	}
+	return d.Status
+}
+
+// ContinueDeployment releases a deployment waiting at a manual gate so that its next batch starts
+func (s *Service) ContinueDeployment(id uint) error {
+	result := s.db.Model(&model.Deployment{}).Where("id = ? AND status = ?", id, "waiting").Update("status", "running")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeploymentNotWaiting
+	}
+	return nil
+}
+
+func batchToResponse(b *model.DeploymentBatch) BatchResponse {
+	return BatchResponse{
+		Number:       b.Number,
+		Canary:       b.Canary,
+		AssetIDs:     parseAssetIDs(b.AssetIDs),
+		Status:       b.Status,
+		SuccessCount: b.SuccessCount,
+		FailedCount:  b.FailedCount,
+		HealthStatus: b.HealthStatus,
+		HealthOutput: b.HealthOutput,
+		StartedAt:    b.StartedAt,
+		FinishedAt:   b.FinishedAt,
+	}
+}
+
+func joinAssetIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -7,69 +7,118 @@ package deployment
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/kkops/backend/internal/config"
 	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/authorization"
+	"github.com/kkops/backend/internal/service/maintenance"
+	"github.com/kkops/backend/internal/service/secret"
+	"github.com/kkops/backend/internal/service/task"
+	"github.com/kkops/backend/internal/service/variable"
+	"github.com/kkops/backend/internal/service/versionsource"
 	"github.com/kkops/backend/internal/utils"
 )
 
 // Service handles deployment management business logic
 type Service struct {
-	db     *gorm.DB
-	config *config.Config
+	db             *gorm.DB
+	config         *config.Config
+	secretSvc      *secret.Service
+	maintenanceSvc *maintenance.Service
+	authzSvc       *authorization.Service
+	variableSvc    *variable.Service
+	versionSvc     *versionsource.Service
+	onComplete     task.CompletionHook
+	running        map[uint]context.CancelFunc
+	runningMux     sync.Mutex
+	recoverStop    chan struct{}
+	recoverWg      sync.WaitGroup
 }
 
+// ErrModuleManagedByGit is returned when modifying a module synced from a Git repository
+var ErrModuleManagedByGit = errors.New("module is managed by a git repository; change it in git instead")
+
 // NewService creates a new deployment service
-func NewService(db *gorm.DB, cfg *config.Config) *Service {
-	return &Service{db: db, config: cfg}
+func NewService(db *gorm.DB, cfg *config.Config, secretSvc *secret.Service, maintenanceSvc *maintenance.Service, authzSvc *authorization.Service, variableSvc *variable.Service) *Service {
+	return &Service{
+		db:             db,
+		config:         cfg,
+		secretSvc:      secretSvc,
+		maintenanceSvc: maintenanceSvc,
+		authzSvc:       authzSvc,
+		variableSvc:    variableSvc,
+		versionSvc:     versionsource.NewService(secretSvc),
+		running:        make(map[uint]context.CancelFunc),
+	}
 }
 
-// VersionSourceResponse represents the response from version source URL
-type VersionSourceResponse struct {
-	Versions []string `json:"versions"`
-	Latest   string   `json:"latest"`
+// SetCompletionHook registers a callback that is invoked when a deployment finishes
+func (s *Service) SetCompletionHook(hook task.CompletionHook) {
+	s.onComplete = hook
 }
 
 // CreateModuleRequest represents a request to create a deployment module
 type CreateModuleRequest struct {
-	ProjectID        uint   `json:"project_id" binding:"required"`
-	EnvironmentID    *uint  `json:"environment_id"`
-	TemplateID       *uint  `json:"template_id"` // 可选：关联执行模板
-	Name             string `json:"name" binding:"required"`
-	Description      string `json:"description"`
-	VersionSourceURL string `json:"version_source_url"`
-	DeployScript     string `json:"deploy_script"`
-	ScriptType       string `json:"script_type"`
-	Timeout          int    `json:"timeout"`
-	AssetIDs         []uint `json:"asset_ids"`
+	ProjectID        uint                  `json:"project_id" binding:"required"`
+	EnvironmentID    *uint                 `json:"environment_id"`
+	TemplateID       *uint                 `json:"template_id"`      // 可选：关联执行模板
+	TemplateVersion  *int                  `json:"template_version"` // nil 使用自身脚本，0 跟随模板最新版本，>0 固定版本
+	Name             string                `json:"name" binding:"required"`
+	Description      string                `json:"description"`
+	VersionSourceURL string                `json:"version_source_url"`
+	DeployScript     string                `json:"deploy_script"`
+	ScriptType       string                `json:"script_type"`
+	Timeout          int                   `json:"timeout"`
+	AssetIDs         []uint                `json:"asset_ids"`
+	Rollout          *RolloutStrategy      `json:"rollout"`        // 滚动发布策略，为空时逐台执行
+	Canary           *CanaryStrategy       `json:"canary"`         // 金丝雀发布，为空时不启用
+	Rollback         *RollbackStrategy     `json:"rollback"`       // 回滚脚本与自动回滚
+	Hooks            *HookStrategy         `json:"hooks"`          // 部署前后钩子与主机健康检查
+	Lock             *LockStrategy         `json:"lock"`           // 部署锁，为空时按模块和环境加锁并拒绝并发部署
+	VersionSource    *versionsource.Config `json:"version_source"` // 版本来源，url 为空时使用 version_source_url
 }
 
 // UpdateModuleRequest represents a request to update a deployment module
 type UpdateModuleRequest struct {
-	ProjectID        *uint  `json:"project_id"`
-	EnvironmentID    *uint  `json:"environment_id"`
-	TemplateID       *uint  `json:"template_id"` // 可选：关联执行模板
-	Name             string `json:"name"`
-	Description      string `json:"description"`
-	VersionSourceURL string `json:"version_source_url"`
-	DeployScript     string `json:"deploy_script"`
-	ScriptType       string `json:"script_type"`
-	Timeout          int    `json:"timeout"`
-	AssetIDs         []uint `json:"asset_ids"`
+	ProjectID        *uint                 `json:"project_id"`
+	EnvironmentID    *uint                 `json:"environment_id"`
+	TemplateID       *uint                 `json:"template_id"`      // 可选：关联执行模板
+	TemplateVersion  *int                  `json:"template_version"` // 0 跟随最新版本，>0 固定版本，<0 取消关联改用自身脚本
+	Name             string                `json:"name"`
+	Description      string                `json:"description"`
+	VersionSourceURL string                `json:"version_source_url"`
+	DeployScript     string                `json:"deploy_script"`
+	ScriptType       string                `json:"script_type"`
+	Timeout          int                   `json:"timeout"`
+	AssetIDs         []uint                `json:"asset_ids"`
+	Rollout          *RolloutStrategy      `json:"rollout"`        // 传入时整体替换滚动发布策略
+	Canary           *CanaryStrategy       `json:"canary"`         // 传入时整体替换金丝雀配置
+	Rollback         *RollbackStrategy     `json:"rollback"`       // 传入时整体替换回滚配置
+	Hooks            *HookStrategy         `json:"hooks"`          // 传入时整体替换钩子与健康检查配置
+	Lock             *LockStrategy         `json:"lock"`           // 传入时整体替换部署锁配置
+	VersionSource    *versionsource.Config `json:"version_source"` // 传入时整体替换版本来源配置
 }
 
 // DeployRequest represents a request to execute deployment
 type DeployRequest struct {
-	Version  string `json:"version" binding:"required"`
-	AssetIDs []uint `json:"asset_ids" binding:"required"`
+	Version             string `json:"version" binding:"required"`
+	AssetIDs            []uint `json:"asset_ids" binding:"required"`
+	OverrideMaintenance bool   `json:"override_maintenance"` // 仅管理员：越过维护窗口强制部署
+	TriggerType         string `json:"-"`                    // manual（默认）, webhook, scheduled, chain, pipeline
+	ScheduledTaskID     *uint  `json:"-"`                    // 由定时部署触发时的定时任务 ID
+	ChainRunID          *uint  `json:"-"`                    // 由作业链触发时的链路记录 ID
+	SkipCanary          bool   `json:"-"`                    // 回滚部署不经过金丝雀阶段
+	RollbackOf          *uint  `json:"-"`                    // 自动回滚时被回滚的部署 ID
+	QueueOnLock         bool   `json:"-"`                    // 锁被占用时总是排队（回滚部署）
+	EnvironmentID       *uint  `json:"-"`                    // 部署到其他环境（流水线阶段），为空时使用模块的环境
 }
 
 // TemplateInfo represents basic template information
@@ -81,42 +130,63 @@ type TemplateInfo struct {
 
 // ModuleResponse represents a deployment module response
 type ModuleResponse struct {
-	ID               uint          `json:"id"`
-	ProjectID        uint          `json:"project_id"`
-	ProjectName      string        `json:"project_name"`
-	EnvironmentID    *uint         `json:"environment_id"`
-	EnvironmentName  string        `json:"environment_name"`
-	TemplateID       *uint         `json:"template_id"`
-	TemplateName     string        `json:"template_name,omitempty"` // 模板名称（用于导出）
-	Template         *TemplateInfo `json:"template,omitempty"`      // 关联的执行模板信息
-	Name             string        `json:"name"`
-	Description      string        `json:"description"`
-	VersionSourceURL string        `json:"version_source_url"`
-	DeployScript     string        `json:"deploy_script"`
-	ScriptType       string        `json:"script_type"`
-	Timeout          int           `json:"timeout"`
-	AssetIDs         []uint        `json:"asset_ids"`
-	CreatedBy        uint          `json:"created_by"`
-	CreatedAt        time.Time     `json:"created_at"`
-	UpdatedAt        time.Time     `json:"updated_at"`
+	ID               uint                 `json:"id"`
+	ProjectID        uint                 `json:"project_id"`
+	ProjectName      string               `json:"project_name"`
+	EnvironmentID    *uint                `json:"environment_id"`
+	EnvironmentName  string               `json:"environment_name"`
+	TemplateID       *uint                `json:"template_id"`
+	TemplateName     string               `json:"template_name,omitempty"` // 模板名称（用于导出）
+	Template         *TemplateInfo        `json:"template,omitempty"`      // 关联的执行模板信息
+	TemplateVersion  *int                 `json:"template_version"`
+	Name             string               `json:"name"`
+	Description      string               `json:"description"`
+	VersionSourceURL string               `json:"version_source_url"`
+	DeployScript     string               `json:"deploy_script"`
+	ScriptType       string               `json:"script_type"`
+	Timeout          int                  `json:"timeout"`
+	AssetIDs         []uint               `json:"asset_ids"`
+	Rollout          RolloutStrategy      `json:"rollout"`
+	Canary           CanaryStrategy       `json:"canary"`
+	Rollback         RollbackStrategy     `json:"rollback"`
+	Hooks            HookStrategy         `json:"hooks"`
+	Lock             LockStrategy         `json:"lock"`
+	VersionSource    versionsource.Config `json:"version_source"`
+	GitRepositoryID  *uint                `json:"git_repository_id"`
+	GitPath          string               `json:"git_path"`
+	ManagedByGit     bool                 `json:"managed_by_git"` // 由 Git 托管的模块只读
+	CreatedBy        uint                 `json:"created_by"`
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
 }
 
 // DeploymentResponse represents a deployment record response
 type DeploymentResponse struct {
-	ID           uint       `json:"id"`
-	ModuleID     uint       `json:"module_id"`
-	ModuleName   string     `json:"module_name"`
-	ProjectName  string     `json:"project_name"`
-	Version      string     `json:"version"`
-	Status       string     `json:"status"`
-	AssetIDs     []uint     `json:"asset_ids"`
-	Output       string     `json:"output"`
-	Error        string     `json:"error"`
-	CreatedBy    uint       `json:"created_by"`
-	CreatorName  string     `json:"creator_name"`
-	StartedAt    *time.Time `json:"started_at"`
-	FinishedAt   *time.Time `json:"finished_at"`
-	CreatedAt    time.Time  `json:"created_at"`
+	ID              uint             `json:"id"`
+	ModuleID        uint             `json:"module_id"`
+	ModuleName      string           `json:"module_name"`
+	ProjectName     string           `json:"project_name"`
+	EnvironmentID   *uint            `json:"environment_id,omitempty"`
+	Version         string           `json:"version"`
+	TemplateVersion *int             `json:"template_version,omitempty"` // 部署时使用的模板版本
+	TriggerType     string           `json:"trigger_type"`
+	ScheduledTaskID *uint            `json:"scheduled_task_id,omitempty"`
+	ChainRunID      *uint            `json:"chain_run_id,omitempty"`
+	Status          string           `json:"status"`
+	AssetIDs        []uint           `json:"asset_ids"`
+	CurrentBatch    int              `json:"current_batch"`
+	Variables       []variable.Value `json:"variables,omitempty"` // 生效的部署变量，敏感变量的值已掩码
+	Batches         []BatchResponse  `json:"batches,omitempty"`   // 仅在查询单条部署记录时返回
+	Targets         []TargetResponse `json:"targets,omitempty"`   // 每台主机的执行结果，仅在查询单条部署记录时返回
+	RollbackID      *uint            `json:"rollback_id,omitempty"`
+	RollbackOf      *uint            `json:"rollback_of,omitempty"`
+	Output          string           `json:"output"`
+	Error           string           `json:"error"`
+	CreatedBy       uint             `json:"created_by"`
+	CreatorName     string           `json:"creator_name"`
+	StartedAt       *time.Time       `json:"started_at"`
+	FinishedAt      *time.Time       `json:"finished_at"`
+	CreatedAt       time.Time        `json:"created_at"`
 }
 
 // CreateModule creates a new deployment module
@@ -151,6 +221,10 @@ func (s *Service) CreateModule(req *CreateModuleRequest, userID uint) (*ModuleRe
 		scriptType = "shell"
 	}
 
+	if err := task.ValidateTemplateVersion(s.db, req.TemplateID, req.TemplateVersion); err != nil {
+		return nil, err
+	}
+
 	timeout := req.Timeout
 	if timeout == 0 {
 		timeout = 600
@@ -160,6 +234,7 @@ func (s *Service) CreateModule(req *CreateModuleRequest, userID uint) (*ModuleRe
 		ProjectID:        req.ProjectID,
 		EnvironmentID:    req.EnvironmentID,
 		TemplateID:       req.TemplateID,
+		TemplateVersion:  req.TemplateVersion,
 		Name:             req.Name,
 		Description:      req.Description,
 		VersionSourceURL: req.VersionSourceURL,
@@ -169,6 +244,17 @@ func (s *Service) CreateModule(req *CreateModuleRequest, userID uint) (*ModuleRe
 		AssetIDs:         assetIDsStr,
 		CreatedBy:        userID,
 	}
+	settings := ModuleSettings{
+		Rollout:       req.Rollout,
+		Canary:        req.Canary,
+		Rollback:      req.Rollback,
+		Hooks:         req.Hooks,
+		Lock:          req.Lock,
+		VersionSource: req.VersionSource,
+	}
+	if err := ApplySettings(&module, &settings, req.VersionSourceURL); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.Create(&module).Error; err != nil {
 		return nil, err
@@ -218,6 +304,9 @@ func (s *Service) UpdateModule(id uint, req *UpdateModuleRequest) (*ModuleRespon
 	if err := s.db.First(&module, id).Error; err != nil {
 		return nil, err
 	}
+	if module.GitRepositoryID != nil {
+		return nil, ErrModuleManagedByGit
+	}
 
 	if req.ProjectID != nil {
 		module.ProjectID = *req.ProjectID
@@ -244,6 +333,19 @@ func (s *Service) UpdateModule(id uint, req *UpdateModuleRequest) (*ModuleRespon
 			}
 		}
 	}
+	if req.TemplateVersion != nil {
+		if *req.TemplateVersion < 0 {
+			module.TemplateVersion = nil
+		} else {
+			module.TemplateVersion = req.TemplateVersion
+		}
+	}
+	if module.TemplateID == nil {
+		module.TemplateVersion = nil
+	}
+	if err := task.ValidateTemplateVersion(s.db, module.TemplateID, module.TemplateVersion); err != nil {
+		return nil, err
+	}
 	if req.Name != "" {
 		module.Name = req.Name
 	}
@@ -269,6 +371,49 @@ func (s *Service) UpdateModule(id uint, req *UpdateModuleRequest) (*ModuleRespon
 		}
 		module.AssetIDs = strings.Join(ids, ",")
 	}
+	if req.Rollout != nil {
+		if err := req.Rollout.validate(); err != nil {
+			return nil, err
+		}
+		req.Rollout.apply(&module)
+	}
+	if req.Canary != nil {
+		if err := req.Canary.validate(); err != nil {
+			return nil, err
+		}
+		req.Canary.apply(&module)
+	}
+	if req.Rollback != nil {
+		if err := req.Rollback.validate(); err != nil {
+			return nil, err
+		}
+		req.Rollback.apply(&module)
+	}
+	if req.Hooks != nil {
+		if err := req.Hooks.validate(); err != nil {
+			return nil, err
+		}
+		req.Hooks.apply(&module)
+	}
+	if req.Lock != nil {
+		if err := req.Lock.validate(); err != nil {
+			return nil, err
+		}
+		req.Lock.apply(&module)
+	}
+	if req.VersionSource != nil {
+		versionSource := *req.VersionSource
+		if versionSource.URL == "" {
+			versionSource.URL = req.VersionSourceURL
+		}
+		if err := versionsource.Validate(&versionSource); err != nil {
+			return nil, err
+		}
+		applyVersionSource(&module, &versionSource)
+	}
+	if err := validateCanaryCheck(&module); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.Save(&module).Error; err != nil {
 		return nil, err
@@ -279,47 +424,46 @@ func (s *Service) UpdateModule(id uint, req *UpdateModuleRequest) (*ModuleRespon
 
 // DeleteModule deletes a deployment module
 func (s *Service) DeleteModule(id uint) error {
-	return s.db.Delete(&model.DeploymentModule{}, id).Error
+	var module model.DeploymentModule
+	if err := s.db.First(&module, id).Error; err != nil {
+		return err
+	}
+	if module.GitRepositoryID != nil {
+		return ErrModuleManagedByGit
+	}
+	return s.db.Delete(&module).Error
 }
 
-// GetVersions fetches versions from the module's version source URL
-func (s *Service) GetVersions(moduleID uint) (*VersionSourceResponse, error) {
+// Deploy executes deployment for a module
+func (s *Service) Deploy(moduleID uint, req *DeployRequest, userID uint) (*DeploymentResponse, error) {
 	var module model.DeploymentModule
-	if err := s.db.First(&module, moduleID).Error; err != nil {
+	if err := s.db.Preload("Project").Preload("Environment").First(&module, moduleID).Error; err != nil {
 		return nil, err
 	}
-
-	if module.VersionSourceURL == "" {
-		return nil, fmt.Errorf("version source URL not configured")
-	}
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	// 流水线阶段部署到阶段的环境：脚本变量、密钥和部署锁都按该环境解析
+	if req.EnvironmentID != nil {
+		var environment model.Environment
+		if err := s.db.First(&environment, *req.EnvironmentID).Error; err != nil {
+			return nil, err
+		}
+		module.EnvironmentID = &environment.ID
+		module.Environment = &environment
 	}
 
-	resp, err := client.Get(module.VersionSourceURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch versions: %w", err)
+	// 未指定目标主机时使用模块配置的主机（Webhook 触发通常不带主机列表）
+	if len(req.AssetIDs) == 0 {
+		req.AssetIDs = parseAssetIDs(module.AssetIDs)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("version source returned status %d", resp.StatusCode)
+	if len(req.AssetIDs) == 0 {
+		return nil, errors.New("no target assets specified")
 	}
-
-	var versionResp VersionSourceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&versionResp); err != nil {
-		return nil, fmt.Errorf("failed to parse version response: %w", err)
+	useCanary := module.CanaryEnabled && !req.SkipCanary
+	if canaryIDs, _ := splitCanary(req.AssetIDs, &module); useCanary && len(canaryIDs) == 0 {
+		return nil, errors.New("none of the module's canary hosts are among the deployment targets")
 	}
 
-	return &versionResp, nil
-}
-
-// Deploy executes deployment for a module
-func (s *Service) Deploy(moduleID uint, req *DeployRequest, userID uint) (*DeploymentResponse, error) {
-	var module model.DeploymentModule
-	if err := s.db.Preload("Project").Preload("Environment").First(&module, moduleID).Error; err != nil {
+	// 目标主机处于禁止变更的维护窗口时拒绝部署（管理员可越过）
+	if err := s.maintenanceSvc.Enforce(req.AssetIDs, userID, req.OverrideMaintenance); err != nil {
 		return nil, err
 	}
 
@@ -333,34 +477,187 @@ func (s *Service) Deploy(moduleID uint, req *DeployRequest, userID uint) (*Deplo
 		assetIDsStr = strings.Join(ids, ",")
 	}
 
-	// Create deployment record
+	// Resolve the deploy script from the pinned or latest template version
+	script, err := task.ResolveTemplateScript(s.db, module.TemplateID, module.TemplateVersion, module.DeployScript, module.ScriptType)
+	if err != nil {
+		return nil, err
+	}
+	module.DeployScript = script.Content
+	module.ScriptType = script.Type
+	// Rollbacks run the dedicated rollback script when the module has one
+	if req.TriggerType == "rollback" && module.RollbackScript != "" {
+		module.DeployScript = module.RollbackScript
+		script.Version = nil
+	}
+
+	// Create deployment record together with its locks; a held lock queues or rejects the deployment
 	deployment := model.Deployment{
-		ModuleID:  moduleID,
-		Version:   req.Version,
-		Status:    "pending",
-		AssetIDs:  assetIDsStr,
-		CreatedBy: userID,
+		ModuleID:        moduleID,
+		EnvironmentID:   module.EnvironmentID,
+		Version:         req.Version,
+		TemplateVersion: script.Version,
+		TriggerType:     req.TriggerType,
+		ScheduledTaskID: req.ScheduledTaskID,
+		ChainRunID:      req.ChainRunID,
+		RollbackOf:      req.RollbackOf,
+		Status:          "pending",
+		AssetIDs:        assetIDsStr,
+		CreatedBy:       userID,
+	}
+
+	if err := s.createDeployment(&deployment, &module, req.AssetIDs, req.QueueOnLock); err != nil {
+		return nil, err
 	}
 
-	if err := s.db.Create(&deployment).Error; err != nil {
+	// Plan the rollout batches up front so they are visible while the deployment runs
+	batches, err := s.createBatches(deployment.ID, req.AssetIDs, &module, useCanary)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createTargets(&deployment, batches); err != nil {
 		return nil, err
 	}
 
-	// Execute deployment asynchronously
-	go s.executeDeployment(&deployment, &module, req.AssetIDs)
+	// Execute deployment asynchronously; CancelDeployment cancels ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	s.runningMux.Lock()
+	s.running[deployment.ID] = cancel
+	s.runningMux.Unlock()
+
+	go s.executeDeployment(ctx, &deployment, &module, batches)
 
 	return s.GetDeployment(deployment.ID)
 }
 
 // executeDeployment performs the actual deployment execution
-func (s *Service) executeDeployment(deployment *model.Deployment, module *model.DeploymentModule, assetIDs []uint) {
-	// Update status to running
+func (s *Service) executeDeployment(ctx context.Context, deployment *model.Deployment, module *model.DeploymentModule, batches []model.DeploymentBatch) {
+	var failedHosts []string
+	defer func() { s.notifyCompletion(deployment, failedHosts) }()
+	defer func() {
+		s.runningMux.Lock()
+		if cancel, ok := s.running[deployment.ID]; ok {
+			cancel()
+			delete(s.running, deployment.ID)
+		}
+		s.runningMux.Unlock()
+	}()
+	defer s.releaseLocks(deployment.ID)
+	defer s.keepAlive(deployment.ID)()
+
+	// Queued deployments wait until the deployment holding the lock finishes
+	if deployment.Status == "queued" && !s.waitForLock(ctx, deployment, module) {
+		s.skipBatches(batches)
+		return
+	}
+
+	// Update status to running unless the deployment was cancelled before it started
 	now := time.Now()
-	deployment.Status = "running"
 	deployment.StartedAt = &now
-	s.db.Save(deployment)
+	if !s.transition(deployment, "pending", map[string]interface{}{"status": "running", "started_at": now}) {
+		s.skipBatches(batches)
+		return
+	}
+	deployment.Status = "running"
+
+	// Prepare the deploy script and hooks: variables are replaced and ${secret:name}
+	// references resolved; secret values are injected as environment variables
+	scripts, err := s.resolveHostScripts(deployment, module)
+	if err != nil {
+		s.skipBatches(batches)
+		s.transition(deployment, "running", map[string]interface{}{
+			"status":      "failed",
+			"error":       err.Error(),
+			"finished_at": time.Now(),
+		})
+		return
+	}
+
+	result := s.runBatches(ctx, deployment, module, batches, scripts)
+	failedHosts = result.failedHosts
+	if ctx.Err() != nil {
+		result.cancelled = true
+	}
+
+	// Update deployment record
+	deployment.Output = strings.Join(result.outputs, "\n\n")
+	deployment.Error = strings.Join(result.errors, "\n")
+	if result.aborted != "" {
+		deployment.Error = strings.TrimSpace(deployment.Error + "\n" + result.aborted)
+	}
+	if result.cancelled {
+		// 取消时已记录结束时间和状态，这里只补充执行输出
+		deployment.Status = "cancelled"
+		s.db.Model(deployment).Updates(map[string]interface{}{"output": deployment.Output, "error": deployment.Error})
+		return
+	}
+	// 释放锁后再回滚，回滚部署需要获取同一把锁
+	s.releaseLocks(deployment.ID)
+	s.autoRollback(deployment, module, batches, result)
+
+	status := "success"
+	if len(result.failedHosts) > 0 {
+		status = "failed"
+	}
+	s.transition(deployment, "running", map[string]interface{}{
+		"status":        status,
+		"output":        deployment.Output,
+		"error":         deployment.Error,
+		"rollback_id":   deployment.RollbackID,
+		"current_batch": deployment.CurrentBatch,
+		"finished_at":   time.Now(),
+	})
+}
+
+// transition updates the deployment only while it is still in the given status,
+// so that a concurrent cancellation is never overwritten. It returns false and
+// marks the deployment cancelled when the update did not apply.
+func (s *Service) transition(deployment *model.Deployment, from string, updates map[string]interface{}) bool {
+	result := s.db.Model(&model.Deployment{}).Where("id = ? AND status = ?", deployment.ID, from).Updates(updates)
+	if result.Error == nil && result.RowsAffected == 0 {
+		deployment.Status = "cancelled"
+		if output, ok := updates["output"]; ok {
+			s.db.Model(deployment).Updates(map[string]interface{}{"output": output, "error": updates["error"]})
+		}
+		return false
+	}
+	if status, ok := updates["status"].(string); ok {
+		deployment.Status = status
+	}
+	return true
+}
+
+// autoRollback rolls back a failed deployment's hosts: only the canary hosts when
+// the canary failed, otherwise every host that ran once the failure threshold is
+// reached. Rollback deployments are never rolled back themselves.
+func (s *Service) autoRollback(deployment *model.Deployment, module *model.DeploymentModule, batches []model.DeploymentBatch, result *rolloutResult) {
+	if deployment.TriggerType == "rollback" || (!result.canaryFailed && len(result.failedHosts) == 0) {
+		return
+	}
+
+	var assetIDs []uint
+	switch {
+	case result.canaryFailed && module.CanaryRollback:
+		assetIDs = result.canaryIDs
+	case module.AutoRollback:
+		threshold := module.RollbackThreshold
+		if threshold <= 0 {
+			threshold = 1
+		}
+		if len(result.failedHosts) < threshold {
+			return
+		}
+		assetIDs = touchedAssets(batches)
+	default:
+		return
+	}
+
+	rollbackID, note := s.rollbackFailed(deployment, assetIDs)
+	deployment.RollbackID = rollbackID
+	deployment.Error = strings.TrimSpace(deployment.Error + "\n" + note)
+}
 
-	// Get project and environment names for variable replacement
+// renderScript replaces the built-in and user-defined deployment variables in a script
+func renderScript(script string, deployment *model.Deployment, module *model.DeploymentModule, vars []variable.Value) string {
 	projectName := ""
 	if module.Project != nil {
 		projectName = module.Project.Name
@@ -370,57 +667,45 @@ func (s *Service) executeDeployment(deployment *model.Deployment, module *model.
 		environmentName = module.Environment.Name
 	}
 
-	// Prepare script with variable replacement
-	script := module.DeployScript
 	script = strings.ReplaceAll(script, "${VERSION}", deployment.Version)
 	script = strings.ReplaceAll(script, "${MODULE_NAME}", module.Name)
 	script = strings.ReplaceAll(script, "${PROJECT_NAME}", projectName)
 	script = strings.ReplaceAll(script, "${ENVIRONMENT_NAME}", environmentName)
 
-	// Collect outputs
-	var outputs []string
-	var errors []string
-	allSuccess := true
-
-	// Execute on each asset
-	for _, assetID := range assetIDs {
-		var asset model.Asset
-		if err := s.db.Preload("SSHKey").First(&asset, assetID).Error; err != nil {
-			errors = append(errors, fmt.Sprintf("[%s] Failed to get asset: %v", asset.HostName, err))
-			allSuccess = false
-			continue
-		}
-
-		// Execute script via SSH
-		output, err := s.executeScriptOnAsset(&asset, script, module.Timeout)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("[%s] %v", asset.HostName, err))
-			allSuccess = false
-		}
-		if output != "" {
-			outputs = append(outputs, fmt.Sprintf("=== %s (%s) ===\n%s", asset.HostName, asset.IP, output))
+	// 普通变量直接替换；敏感变量的值不写入脚本，改为读取导出的环境变量（shell 中 ${KEY} 本身即是）
+	for _, v := range vars {
+		ref := "${" + v.Key + "}"
+		switch {
+		case !v.Secret:
+			script = strings.ReplaceAll(script, ref, v.Value)
+		case module.ScriptType == "python":
+			script = strings.ReplaceAll(script, ref, fmt.Sprintf("__import__('os').environ['%s']", v.Key))
 		}
 	}
+	return script
+}
 
-	// Update deployment record
-	finishedAt := time.Now()
-	deployment.FinishedAt = &finishedAt
-	deployment.Output = strings.Join(outputs, "\n\n")
-	deployment.Error = strings.Join(errors, "\n")
-
-	if allSuccess {
-		deployment.Status = "success"
-	} else {
-		deployment.Status = "failed"
-	}
-
-	s.db.Save(deployment)
+// notifyCompletion reports a finished deployment to the completion hook
+func (s *Service) notifyCompletion(deployment *model.Deployment, failedHosts []string) {
+	if s.onComplete == nil {
+		return
+	}
+	s.onComplete(task.JobResult{
+		JobType:     task.JobDeployment,
+		JobID:       deployment.ModuleID,
+		RunID:       deployment.ID,
+		Status:      deployment.Status,
+		Version:     deployment.Version,
+		FailedHosts: failedHosts,
+		ChainRunID:  deployment.ChainRunID,
+	})
 }
 
-// executeScriptOnAsset executes a script on a single asset via SSH
-func (s *Service) executeScriptOnAsset(asset *model.Asset, script string, timeout int) (string, error) {
+// executeScriptOnAsset executes a script on a single asset via SSH and returns its
+// stdout, stderr and exit code. The exit code is -1 when the script did not finish.
+func (s *Service) executeScriptOnAsset(ctx context.Context, asset *model.Asset, script string, env map[string]string, timeout int) (string, string, int, error) {
 	if asset.SSHKey == nil {
-		return "", fmt.Errorf("no SSH key configured for asset")
+		return "", "", -1, fmt.Errorf("no SSH key configured for asset")
 	}
 
 	sshUser := asset.SSHUser
@@ -439,7 +724,7 @@ func (s *Service) executeScriptOnAsset(asset *model.Asset, script string, timeou
 	// Decrypt private key
 	privateKeyBytes, err := utils.Decrypt(asset.SSHKey.PrivateKey, s.config.Encryption.Key)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt private key: %w", err)
+		return "", "", -1, fmt.Errorf("failed to decrypt private key: %w", err)
 	}
 
 	// Decrypt passphrase if exists
@@ -447,7 +732,7 @@ func (s *Service) executeScriptOnAsset(asset *model.Asset, script string, timeou
 	if asset.SSHKey.Passphrase != "" {
 		passphraseBytes, err = utils.Decrypt(asset.SSHKey.Passphrase, s.config.Encryption.Key)
 		if err != nil {
-			return "", fmt.Errorf("failed to decrypt passphrase: %w", err)
+			return "", "", -1, fmt.Errorf("failed to decrypt passphrase: %w", err)
 		}
 	}
 
@@ -473,22 +758,24 @@ func (s *Service) executeScriptOnAsset(asset *model.Asset, script string, timeou
 		)
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to connect: %w", err)
+		return "", "", -1, fmt.Errorf("failed to connect: %w", err)
 	}
 	defer client.Close()
 
-	// Execute command with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	// Execute command with timeout; cancelling ctx kills the remote script
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	output, _, err := client.ExecuteCommandWithTimeout(ctx, script)
-	return output, err
+	return client.ExecuteCommandWithEnvSplit(ctx, script, env)
 }
 
 // GetDeployment retrieves a deployment record by ID
 func (s *Service) GetDeployment(id uint) (*DeploymentResponse, error) {
 	var deployment model.Deployment
-	if err := s.db.Preload("Module.Project").Preload("Creator").First(&deployment, id).Error; err != nil {
+	if err := s.db.Preload("Module.Project").Preload("Creator").
+		Preload("Batches", func(db *gorm.DB) *gorm.DB { return db.Order("number") }).
+		Preload("Targets", func(db *gorm.DB) *gorm.DB { return db.Order("batch_number, id") }).
+		First(&deployment, id).Error; err != nil {
 		return nil, err
 	}
 
@@ -526,22 +813,41 @@ func (s *Service) ListDeployments(moduleID *uint, page, pageSize int) ([]Deploym
 	return result, total, nil
 }
 
-// CancelDeployment cancels a running deployment
+// CancelDeployment cancels a running deployment: no further hosts are started,
+// running scripts are killed and hosts that did not run are marked skipped
 func (s *Service) CancelDeployment(id uint) error {
 	var deployment model.Deployment
 	if err := s.db.First(&deployment, id).Error; err != nil {
 		return err
 	}
 
-	if deployment.Status != "pending" && deployment.Status != "running" {
+	if deployment.Status != "queued" && deployment.Status != "pending" && deployment.Status != "running" && deployment.Status != "waiting" {
 		return fmt.Errorf("deployment is not running")
 	}
 
 	now := time.Now()
-	deployment.Status = "cancelled"
-	deployment.FinishedAt = &now
+	result := s.db.Model(&model.Deployment{}).
+		Where("id = ? AND status IN ?", id, unfinishedStatuses).
+		Updates(map[string]interface{}{"status": "cancelled", "finished_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("deployment is not running")
+	}
 
-	return s.db.Save(&deployment).Error
+	s.runningMux.Lock()
+	cancel, ok := s.running[id]
+	s.runningMux.Unlock()
+	if ok {
+		// 执行协程负责终止远程脚本并标记未执行的主机
+		cancel()
+		return nil
+	}
+
+	// 服务重启后遗留的部署，没有执行协程，直接标记并释放锁
+	s.abandon(id, TargetCancelled, now)
+	return nil
 }
 
 // Helper functions
@@ -582,6 +888,7 @@ func (s *Service) moduleToResponse(m *model.DeploymentModule) *ModuleResponse {
 		TemplateID:       m.TemplateID,
 		TemplateName:     templateName,
 		Template:         templateInfo,
+		TemplateVersion:  m.TemplateVersion,
 		Name:             m.Name,
 		Description:      m.Description,
 		VersionSourceURL: m.VersionSourceURL,
@@ -589,6 +896,15 @@ func (s *Service) moduleToResponse(m *model.DeploymentModule) *ModuleResponse {
 		ScriptType:       m.ScriptType,
 		Timeout:          m.Timeout,
 		AssetIDs:         assetIDs,
+		Rollout:          moduleRollout(m),
+		Canary:           moduleCanary(m),
+		Rollback:         moduleRollback(m),
+		Hooks:            moduleHooks(m),
+		Lock:             moduleLock(m),
+		VersionSource:    moduleVersionSource(m),
+		GitRepositoryID:  m.GitRepositoryID,
+		GitPath:          m.GitPath,
+		ManagedByGit:     m.GitRepositoryID != nil,
 		CreatedBy:        m.CreatedBy,
 		CreatedAt:        m.CreatedAt,
 		UpdatedAt:        m.UpdatedAt,
@@ -610,21 +926,42 @@ func (s *Service) deploymentToResponse(d *model.Deployment) *DeploymentResponse
 		creatorName = d.Creator.Username
 	}
 
+	var batches []BatchResponse
+	for i := range d.Batches {
+		batches = append(batches, batchToResponse(&d.Batches[i]))
+	}
+
+	var targets []TargetResponse
+	for i := range d.Targets {
+		targets = append(targets, targetToResponse(&d.Targets[i]))
+	}
+
 	return &DeploymentResponse{
-		ID:          d.ID,
-		ModuleID:    d.ModuleID,
-		ModuleName:  moduleName,
-		ProjectName: projectName,
-		Version:     d.Version,
-		Status:      d.Status,
-		AssetIDs:    assetIDs,
-		Output:      d.Output,
-		Error:       d.Error,
-		CreatedBy:   d.CreatedBy,
-		CreatorName: creatorName,
-		StartedAt:   d.StartedAt,
-		FinishedAt:  d.FinishedAt,
-		CreatedAt:   d.CreatedAt,
+		ID:              d.ID,
+		ModuleID:        d.ModuleID,
+		ModuleName:      moduleName,
+		ProjectName:     projectName,
+		EnvironmentID:   d.EnvironmentID,
+		Version:         d.Version,
+		TemplateVersion: d.TemplateVersion,
+		TriggerType:     d.TriggerType,
+		ScheduledTaskID: d.ScheduledTaskID,
+		ChainRunID:      d.ChainRunID,
+		Status:          d.Status,
+		AssetIDs:        assetIDs,
+		CurrentBatch:    d.CurrentBatch,
+		Variables:       parseVariables(d.Variables),
+		Batches:         batches,
+		Targets:         targets,
+		RollbackID:      d.RollbackID,
+		RollbackOf:      d.RollbackOf,
+		Output:          d.Output,
+		Error:           d.Error,
+		CreatedBy:       d.CreatedBy,
+		CreatorName:     creatorName,
+		StartedAt:       d.StartedAt,
+		FinishedAt:      d.FinishedAt,
+		CreatedAt:       d.CreatedAt,
 	}
 }
 
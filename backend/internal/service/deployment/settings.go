@@ -0,0 +1,81 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/versionsource"
+)
+
+// ModuleSettings are the deployment strategies of a module. Git sync reads them
+// from module YAML files under the same keys as the module API.
+type ModuleSettings struct {
+	Rollout       *RolloutStrategy      `json:"rollout"`
+	Canary        *CanaryStrategy       `json:"canary"`
+	Rollback      *RollbackStrategy     `json:"rollback"`
+	Hooks         *HookStrategy         `json:"hooks"`
+	Lock          *LockStrategy         `json:"lock"`
+	VersionSource *versionsource.Config `json:"version_source"`
+}
+
+// ApplySettings validates the settings and copies them onto a module, replacing
+// all of its strategies; omitted sections reset to their defaults. versionSourceURL
+// is used when the version source has no URL of its own.
+func ApplySettings(m *model.DeploymentModule, settings *ModuleSettings, versionSourceURL string) error {
+	var rollout RolloutStrategy
+	if settings.Rollout != nil {
+		rollout = *settings.Rollout
+	}
+	if err := rollout.validate(); err != nil {
+		return err
+	}
+	var canary CanaryStrategy
+	if settings.Canary != nil {
+		canary = *settings.Canary
+	}
+	if err := canary.validate(); err != nil {
+		return err
+	}
+	var rollback RollbackStrategy
+	if settings.Rollback != nil {
+		rollback = *settings.Rollback
+	}
+	if err := rollback.validate(); err != nil {
+		return err
+	}
+	var hooks HookStrategy
+	if settings.Hooks != nil {
+		hooks = *settings.Hooks
+	}
+	if err := hooks.validate(); err != nil {
+		return err
+	}
+	var lock LockStrategy
+	if settings.Lock != nil {
+		lock = *settings.Lock
+	}
+	if err := lock.validate(); err != nil {
+		return err
+	}
+	versionSource := versionsource.Config{URL: versionSourceURL}
+	if settings.VersionSource != nil {
+		versionSource = *settings.VersionSource
+		if versionSource.URL == "" {
+			versionSource.URL = versionSourceURL
+		}
+	}
+	if err := versionsource.Validate(&versionSource); err != nil {
+		return err
+	}
+
+	rollout.apply(m)
+	canary.apply(m)
+	rollback.apply(m)
+	hooks.apply(m)
+	lock.apply(m)
+	applyVersionSource(m, &versionSource)
+	return validateCanaryCheck(m)
+}
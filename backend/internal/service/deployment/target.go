@@ -0,0 +1,281 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Target statuses
+const (
+	TargetPending   = "pending"
+	TargetRunning   = "running"
+	TargetSuccess   = "success"
+	TargetFailed    = "failed"
+	TargetSkipped   = "skipped" // 所在批次未执行
+	TargetCancelled = "cancelled"
+)
+
+// ErrNoHostsToRetry is returned when a deployment has no failed hosts to retry
+var ErrNoHostsToRetry = errors.New("no failed hosts to retry")
+
+// TargetResponse represents the deployment of one version to one host
+type TargetResponse struct {
+	AssetID     uint       `json:"asset_id"`
+	HostName    string     `json:"host_name"`
+	IP          string     `json:"ip"`
+	BatchNumber int        `json:"batch_number"`
+	Status      string     `json:"status"`
+	ExitCode    *int       `json:"exit_code"`
+	Stdout      string     `json:"stdout"`
+	Stderr      string     `json:"stderr"`
+	Error       string     `json:"error"`
+	PreDeploy   string     `json:"pre_deploy"`
+	PostDeploy  string     `json:"post_deploy"`
+	CheckStatus string     `json:"check_status"`
+	CheckOutput string     `json:"check_output"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Duration    float64    `json:"duration"` // 秒
+}
+
+// HostVersion is the version a host currently runs, derived from its deployment targets
+type HostVersion struct {
+	ModuleID     uint       `json:"module_id"`
+	AssetID      uint       `json:"asset_id"`
+	HostName     string     `json:"host_name"`
+	IP           string     `json:"ip"`
+	Version      string     `json:"version"`       // 最近一次部署成功的版本
+	DeploymentID uint       `json:"deployment_id"` // 部署该版本的部署记录
+	DeployedAt   *time.Time `json:"deployed_at"`
+	LastVersion  string     `json:"last_version"` // 最近一次尝试部署的版本
+	LastStatus   string     `json:"last_status"`  // 最近一次尝试的结果，失败时主机可能处于不一致状态
+}
+
+// RetryRequest represents a request to redeploy a deployment's version to some of its hosts
+type RetryRequest struct {
+	AssetIDs            []uint `json:"asset_ids"`            // 为空时重试全部失败的主机
+	OverrideMaintenance bool   `json:"override_maintenance"` // 仅管理员：越过维护窗口强制部署
+}
+
+// createTargets records one pending target per host of the planned batches
+func (s *Service) createTargets(deployment *model.Deployment, batches []model.DeploymentBatch) error {
+	var assets []model.Asset
+	if err := s.db.Select("id, host_name, ip").Where("id IN ?", parseAssetIDs(deployment.AssetIDs)).Find(&assets).Error; err != nil {
+		return err
+	}
+	assetMap := make(map[uint]model.Asset, len(assets))
+	for _, a := range assets {
+		assetMap[a.ID] = a
+	}
+
+	var targets []model.DeploymentTarget
+	for _, b := range batches {
+		for _, id := range parseAssetIDs(b.AssetIDs) {
+			targets = append(targets, model.DeploymentTarget{
+				DeploymentID:  deployment.ID,
+				ModuleID:      deployment.ModuleID,
+				AssetID:       id,
+				EnvironmentID: deployment.EnvironmentID,
+				Version:       deployment.Version,
+				BatchNumber:   b.Number,
+				HostName:      assetMap[id].HostName,
+				IP:            assetMap[id].IP,
+				Status:        TargetPending,
+			})
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return s.db.Create(&targets).Error
+}
+
+// startTarget marks a host's target as running
+func (s *Service) startTarget(deploymentID, assetID uint) {
+	now := time.Now()
+	s.db.Model(&model.DeploymentTarget{}).
+		Where("deployment_id = ? AND asset_id = ?", deploymentID, assetID).
+		Updates(map[string]interface{}{"status": TargetRunning, "started_at": now})
+}
+
+// finishTarget records a host's result
+func (s *Service) finishTarget(deploymentID, assetID uint, o *hostOutcome) {
+	status := TargetSuccess
+	switch {
+	case o.cancelled:
+		status = TargetCancelled
+	case o.err != "":
+		status = TargetFailed
+	}
+	updates := map[string]interface{}{
+		"status":       status,
+		"stdout":       o.stdout,
+		"stderr":       o.stderr,
+		"error":        o.err,
+		"pre_deploy":   o.preDeploy,
+		"post_deploy":  o.postDeploy,
+		"check_status": o.checkStatus,
+		"check_output": o.checkOutput,
+		"finished_at":  time.Now(),
+	}
+	if o.exitCode >= 0 {
+		updates["exit_code"] = o.exitCode
+	}
+	s.db.Model(&model.DeploymentTarget{}).
+		Where("deployment_id = ? AND asset_id = ?", deploymentID, assetID).
+		Updates(updates)
+}
+
+// skipTargets marks the hosts of batches that will not run
+func (s *Service) skipTargets(deploymentID uint, batches []model.DeploymentBatch) {
+	if len(batches) == 0 {
+		return
+	}
+	numbers := make([]int, len(batches))
+	for i, b := range batches {
+		numbers[i] = b.Number
+	}
+	s.db.Model(&model.DeploymentTarget{}).
+		Where("deployment_id = ? AND batch_number IN ? AND status = ?", deploymentID, numbers, TargetPending).
+		Update("status", TargetSkipped)
+}
+
+// RetryDeployment redeploys a finished deployment's version to some of its hosts,
+// by default the ones that failed
+func (s *Service) RetryDeployment(id uint, req *RetryRequest, userID uint) (*DeploymentResponse, error) {
+	var deployment model.Deployment
+	if err := s.db.First(&deployment, id).Error; err != nil {
+		return nil, err
+	}
+	switch deployment.Status {
+	case "success", "failed", "cancelled":
+	default:
+		return nil, fmt.Errorf("deployment is %s, only finished deployments can be retried", deployment.Status)
+	}
+
+	assetIDs := req.AssetIDs
+	if len(assetIDs) == 0 {
+		if err := s.db.Model(&model.DeploymentTarget{}).
+			Where("deployment_id = ? AND status = ?", id, TargetFailed).
+			Order("id").Pluck("asset_id", &assetIDs).Error; err != nil {
+			return nil, err
+		}
+		if len(assetIDs) == 0 {
+			return nil, ErrNoHostsToRetry
+		}
+	}
+	for _, assetID := range assetIDs {
+		if !containsAsset(deployment.AssetIDs, assetID) {
+			return nil, fmt.Errorf("asset %d is not a target of deployment %d", assetID, id)
+		}
+	}
+
+	// 重试沿用原部署的版本，金丝雀阶段已在原部署中完成
+	return s.Deploy(deployment.ModuleID, &DeployRequest{
+		Version:             deployment.Version,
+		AssetIDs:            assetIDs,
+		OverrideMaintenance: req.OverrideMaintenance,
+		TriggerType:         "retry",
+		SkipCanary:          true,
+		EnvironmentID:       deployment.EnvironmentID,
+	}, userID)
+}
+
+// HostVersions returns the version each host of a module currently runs: the
+// newest successful target per host, with the newest attempt alongside it
+func (s *Service) HostVersions(moduleID uint) ([]HostVersion, error) {
+	var module model.DeploymentModule
+	if err := s.db.Select("id").First(&module, moduleID).Error; err != nil {
+		return nil, err
+	}
+
+	var succeeded []model.DeploymentTarget
+	if err := s.db.Where("id IN (?)", s.db.Model(&model.DeploymentTarget{}).
+		Select("MAX(id)").
+		Where("module_id = ? AND status = ?", moduleID, TargetSuccess).
+		Group("asset_id")).
+		Find(&succeeded).Error; err != nil {
+		return nil, err
+	}
+	var attempted []model.DeploymentTarget
+	if err := s.db.Where("id IN (?)", s.db.Model(&model.DeploymentTarget{}).
+		Select("MAX(id)").
+		Where("module_id = ? AND status IN ?", moduleID, []string{TargetSuccess, TargetFailed, TargetCancelled}).
+		Group("asset_id")).
+		Order("asset_id").
+		Find(&attempted).Error; err != nil {
+		return nil, err
+	}
+
+	current := make(map[uint]model.DeploymentTarget, len(succeeded))
+	for _, t := range succeeded {
+		current[t.AssetID] = t
+	}
+
+	versions := make([]HostVersion, 0, len(attempted))
+	for _, last := range attempted {
+		hv := HostVersion{
+			ModuleID:    moduleID,
+			AssetID:     last.AssetID,
+			HostName:    last.HostName,
+			IP:          last.IP,
+			LastVersion: last.Version,
+			LastStatus:  last.Status,
+		}
+		if t, ok := current[last.AssetID]; ok {
+			hv.Version = t.Version
+			hv.DeploymentID = t.DeploymentID
+			hv.DeployedAt = t.FinishedAt
+		}
+		versions = append(versions, hv)
+	}
+	return versions, nil
+}
+
+func targetToResponse(t *model.DeploymentTarget) TargetResponse {
+	resp := TargetResponse{
+		AssetID:     t.AssetID,
+		HostName:    t.HostName,
+		IP:          t.IP,
+		BatchNumber: t.BatchNumber,
+		Status:      t.Status,
+		ExitCode:    t.ExitCode,
+		Stdout:      t.Stdout,
+		Stderr:      t.Stderr,
+		Error:       t.Error,
+		PreDeploy:   t.PreDeploy,
+		PostDeploy:  t.PostDeploy,
+		CheckStatus: t.CheckStatus,
+		CheckOutput: t.CheckOutput,
+		StartedAt:   t.StartedAt,
+		FinishedAt:  t.FinishedAt,
+	}
+	if t.StartedAt != nil && t.FinishedAt != nil {
+		resp.Duration = t.FinishedAt.Sub(*t.StartedAt).Seconds()
+	}
+	return resp
+}
+
+// hostOutput formats a host's output for the deployment's combined output
+func hostOutput(asset *model.Asset, stdout, stderr string) string {
+	output := strings.TrimRight(stdout, "\n")
+	if stderr = strings.TrimRight(stderr, "\n"); stderr != "" {
+		if output != "" {
+			output += "\n"
+		}
+		output += stderr
+	}
+	if output == "" {
+		return ""
+	}
+	return fmt.Sprintf("=== %s (%s) ===\n%s", asset.HostName, asset.IP, output)
+}
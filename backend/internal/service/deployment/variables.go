@@ -0,0 +1,71 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"encoding/json"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/secret"
+	"github.com/kkops/backend/internal/service/variable"
+)
+
+// EffectiveVariables returns the variables a deployment of the module would use,
+// with secret values masked. environmentID selects another environment than the
+// module's own, as pipeline stages do.
+func (s *Service) EffectiveVariables(moduleID uint, environmentID *uint) ([]variable.Value, error) {
+	var module model.DeploymentModule
+	if err := s.db.First(&module, moduleID).Error; err != nil {
+		return nil, err
+	}
+	if environmentID == nil {
+		environmentID = module.EnvironmentID
+	}
+
+	vars, err := s.variableSvc.Effective(module.ProjectID, environmentID, module.ID)
+	if err != nil {
+		return nil, err
+	}
+	return variable.Masked(vars), nil
+}
+
+// resolveScript renders a script with the deployment variables, resolves its
+// secrets and exports the variables to the script's environment
+func (s *Service) resolveScript(script string, deployment *model.Deployment, module *model.DeploymentModule, vars []variable.Value) (*secret.Resolved, error) {
+	resolved, err := s.secretSvc.Resolve(renderScript(script, deployment, module, vars), module.ScriptType, &module.ProjectID, module.EnvironmentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		resolved.Export(v.Key, v.Value, v.Secret)
+	}
+	return resolved, nil
+}
+
+// recordVariables stores the variables in effect on the deployment, secret values masked
+func (s *Service) recordVariables(deployment *model.Deployment, vars []variable.Value) {
+	if len(vars) == 0 {
+		return
+	}
+	data, err := json.Marshal(variable.Masked(vars))
+	if err != nil {
+		return
+	}
+	deployment.Variables = string(data)
+	s.db.Model(deployment).Update("variables", deployment.Variables)
+}
+
+// parseVariables decodes the variables recorded on a deployment
+func parseVariables(data string) []variable.Value {
+	if data == "" {
+		return nil
+	}
+	var vars []variable.Value
+	if err := json.Unmarshal([]byte(data), &vars); err != nil {
+		return nil
+	}
+	return vars
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package deployment
+
+import (
+	"context"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/versionsource"
+)
+
+// VersionSourceResponse represents the versions available from a module's version source
+type VersionSourceResponse = versionsource.Result
+
+// GetVersions fetches versions from the module's version source. Results are
+// served from the cache configured on the module unless refresh is set.
+func (s *Service) GetVersions(ctx context.Context, moduleID uint, refresh bool) (*VersionSourceResponse, error) {
+	var module model.DeploymentModule
+	if err := s.db.First(&module, moduleID).Error; err != nil {
+		return nil, err
+	}
+
+	cfg := moduleVersionSource(&module)
+	return s.versionSvc.Fetch(ctx, &cfg, &module.ProjectID, module.EnvironmentID, refresh)
+}
+
+// ListVersionSources returns the available version source types
+func (s *Service) ListVersionSources() []versionsource.SourceInfo {
+	return s.versionSvc.ListSources()
+}
+
+// applyVersionSource copies a version source configuration onto a module
+func applyVersionSource(m *model.DeploymentModule, cfg *versionsource.Config) {
+	m.VersionSourceURL = cfg.URL
+	m.VersionSourceType = cfg.Type
+	m.VersionSourcePath = cfg.Path
+	m.VersionSourceStatic = cfg.Static
+	m.VersionFilter = cfg.Filter
+	m.VersionSort = cfg.Sort
+	m.VersionAuthType = cfg.AuthType
+	m.VersionAuthUser = cfg.Username
+	m.VersionAuthSecret = cfg.Secret
+	m.VersionAuthHeader = cfg.Header
+	m.VersionCacheSeconds = cfg.CacheSeconds
+}
+
+// moduleVersionSource returns the version source configuration of a module
+func moduleVersionSource(m *model.DeploymentModule) versionsource.Config {
+	return versionsource.Config{
+		Type:         m.VersionSourceType,
+		URL:          m.VersionSourceURL,
+		Path:         m.VersionSourcePath,
+		Static:       m.VersionSourceStatic,
+		Filter:       m.VersionFilter,
+		Sort:         m.VersionSort,
+		AuthType:     m.VersionAuthType,
+		Username:     m.VersionAuthUser,
+		Secret:       m.VersionAuthSecret,
+		Header:       m.VersionAuthHeader,
+		CacheSeconds: m.VersionCacheSeconds,
+	}
+}
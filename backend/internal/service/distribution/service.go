@@ -0,0 +1,536 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package distribution
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/authorization"
+)
+
+var (
+	modePattern  = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+	ownerPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(:[A-Za-z0-9._-]+)?$`)
+)
+
+// Service handles artifact upload and fleet file distribution
+type Service struct {
+	db       *gorm.DB
+	config   *config.Config
+	authzSvc *authorization.Service
+
+	// 正在运行的分发任务的取消函数
+	running    map[uint]context.CancelFunc
+	runningMux sync.Mutex
+}
+
+// NewService creates a new distribution service
+func NewService(db *gorm.DB, cfg *config.Config, authzSvc *authorization.Service) *Service {
+	return &Service{
+		db:       db,
+		config:   cfg,
+		authzSvc: authzSvc,
+		running:  make(map[uint]context.CancelFunc),
+	}
+}
+
+// UploadArtifactRequest represents metadata for an uploaded artifact
+type UploadArtifactRequest struct {
+	Name        string `form:"name"`
+	Description string `form:"description"`
+	Kind        string `form:"kind"` // file, archive（为空时根据文件名推断）
+}
+
+// ArtifactResponse represents an artifact response
+type ArtifactResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	FileName    string    `json:"file_name"`
+	Kind        string    `json:"kind"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	Description string    `json:"description"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateDistributionRequest represents a request to distribute an artifact
+type CreateDistributionRequest struct {
+	Name           string `json:"name" binding:"required"`
+	ArtifactID     uint   `json:"artifact_id" binding:"required"`
+	DestPath       string `json:"dest_path" binding:"required"`
+	Owner          string `json:"owner"`
+	Mode           string `json:"mode"`
+	Atomic         *bool  `json:"atomic"`
+	VerifyChecksum *bool  `json:"verify_checksum"`
+	SkipIfMatch    *bool  `json:"skip_if_match"`
+	Concurrency    int    `json:"concurrency"`
+	AssetIDs       []uint `json:"asset_ids" binding:"required"`
+}
+
+// DistributionResponse represents a distribution response
+type DistributionResponse struct {
+	ID             uint                       `json:"id"`
+	Name           string                     `json:"name"`
+	ArtifactID     uint                       `json:"artifact_id"`
+	ArtifactName   string                     `json:"artifact_name"`
+	Checksum       string                     `json:"checksum"`
+	DestPath       string                     `json:"dest_path"`
+	Owner          string                     `json:"owner"`
+	Mode           string                     `json:"mode"`
+	Atomic         bool                       `json:"atomic"`
+	VerifyChecksum bool                       `json:"verify_checksum"`
+	SkipIfMatch    bool                       `json:"skip_if_match"`
+	Concurrency    int                        `json:"concurrency"`
+	AssetIDs       []uint                     `json:"asset_ids"`
+	Status         string                     `json:"status"`
+	Summary        map[string]int             `json:"summary"` // 各状态主机数量
+	Targets        []model.DistributionTarget `json:"targets,omitempty"`
+	CreatedBy      uint                       `json:"created_by"`
+	CreatorName    string                     `json:"creator_name"`
+	StartedAt      *time.Time                 `json:"started_at"`
+	FinishedAt     *time.Time                 `json:"finished_at"`
+	CreatedAt      time.Time                  `json:"created_at"`
+}
+
+// UploadArtifact stores an uploaded file on the server and records its checksum
+func (s *Service) UploadArtifact(userID uint, fileName string, req *UploadArtifactRequest, r io.Reader) (*ArtifactResponse, error) {
+	dir := s.config.Storage.ArtifactDir
+	if dir == "" {
+		dir = "./data/artifacts"
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store artifact: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	// 以校验和命名，相同内容只存一份
+	storagePath := filepath.Join(dir, checksum)
+	if err := os.Rename(tmp.Name(), storagePath); err != nil {
+		return nil, fmt.Errorf("failed to store artifact: %w", err)
+	}
+
+	kind := req.Kind
+	if kind == "" {
+		kind = "file"
+		lower := strings.ToLower(fileName)
+		if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+			kind = "archive"
+		}
+	}
+	if kind != "file" && kind != "archive" {
+		return nil, errors.New("kind must be 'file' or 'archive'")
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fileName
+	}
+
+	artifact := model.FileArtifact{
+		Name:        name,
+		FileName:    fileName,
+		Kind:        kind,
+		Size:        size,
+		Checksum:    checksum,
+		StoragePath: storagePath,
+		Description: req.Description,
+		CreatedBy:   userID,
+	}
+	if err := s.db.Create(&artifact).Error; err != nil {
+		return nil, err
+	}
+
+	return artifactToResponse(&artifact), nil
+}
+
+// GetArtifact retrieves an artifact by ID
+func (s *Service) GetArtifact(id uint) (*ArtifactResponse, error) {
+	var artifact model.FileArtifact
+	if err := s.db.First(&artifact, id).Error; err != nil {
+		return nil, err
+	}
+	return artifactToResponse(&artifact), nil
+}
+
+// ListArtifacts retrieves all artifacts
+func (s *Service) ListArtifacts() ([]ArtifactResponse, error) {
+	var artifacts []model.FileArtifact
+	if err := s.db.Order("created_at DESC").Find(&artifacts).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]ArtifactResponse, len(artifacts))
+	for i := range artifacts {
+		result[i] = *artifactToResponse(&artifacts[i])
+	}
+	return result, nil
+}
+
+// DeleteArtifact deletes an artifact and its stored file when no longer referenced
+func (s *Service) DeleteArtifact(id uint) error {
+	var artifact model.FileArtifact
+	if err := s.db.First(&artifact, id).Error; err != nil {
+		return err
+	}
+
+	var running int64
+	s.db.Model(&model.Distribution{}).
+		Where("artifact_id = ? AND status IN ?", id, []string{"pending", "running"}).
+		Count(&running)
+	if running > 0 {
+		return errors.New("artifact is used by a running distribution")
+	}
+
+	if err := s.db.Delete(&artifact).Error; err != nil {
+		return err
+	}
+
+	var refs int64
+	s.db.Model(&model.FileArtifact{}).Where("storage_path = ?", artifact.StoragePath).Count(&refs)
+	if refs == 0 {
+		os.Remove(artifact.StoragePath)
+	}
+	return nil
+}
+
+// CreateDistribution creates a distribution and starts copying the artifact to target assets
+func (s *Service) CreateDistribution(userID uint, req *CreateDistributionRequest) (*DistributionResponse, error) {
+	var artifact model.FileArtifact
+	if err := s.db.First(&artifact, req.ArtifactID).Error; err != nil {
+		return nil, errors.New("artifact not found")
+	}
+
+	if !strings.HasPrefix(req.DestPath, "/") {
+		return nil, errors.New("dest_path must be an absolute path")
+	}
+	if req.Mode != "" && !modePattern.MatchString(req.Mode) {
+		return nil, errors.New("mode must be an octal permission such as 0644")
+	}
+	if req.Owner != "" && !ownerPattern.MatchString(req.Owner) {
+		return nil, errors.New("owner must be in the form user or user:group")
+	}
+	if len(req.AssetIDs) == 0 {
+		return nil, errors.New("at least one asset is required")
+	}
+
+	// 检查用户对目标资产的访问权限
+	if s.authzSvc != nil {
+		authorizedAssets, err := s.authzSvc.HasMultipleAssetAccess(userID, req.AssetIDs)
+		if err != nil {
+			return nil, errors.New("failed to check asset permissions")
+		}
+		if len(authorizedAssets) != len(req.AssetIDs) {
+			return nil, errors.New("no permission to distribute to selected assets")
+		}
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	ids := make([]string, len(req.AssetIDs))
+	for i, id := range req.AssetIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	dist := model.Distribution{
+		Name:           req.Name,
+		ArtifactID:     artifact.ID,
+		DestPath:       req.DestPath,
+		Owner:          req.Owner,
+		Mode:           req.Mode,
+		Atomic:         boolOrDefault(req.Atomic, true),
+		VerifyChecksum: boolOrDefault(req.VerifyChecksum, true),
+		SkipIfMatch:    boolOrDefault(req.SkipIfMatch, true),
+		Concurrency:    concurrency,
+		AssetIDs:       strings.Join(ids, ","),
+		Status:         "pending",
+		CreatedBy:      userID,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&dist).Error; err != nil {
+			return err
+		}
+		targets := make([]model.DistributionTarget, len(req.AssetIDs))
+		for i, assetID := range req.AssetIDs {
+			targets[i] = model.DistributionTarget{
+				DistributionID: dist.ID,
+				AssetID:        assetID,
+				Status:         "pending",
+			}
+		}
+		return tx.Create(&targets).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.runningMux.Lock()
+	s.running[dist.ID] = cancel
+	s.runningMux.Unlock()
+
+	go s.executeDistribution(ctx, dist.ID, &artifact)
+
+	return s.GetDistribution(dist.ID)
+}
+
+// GetDistribution retrieves a distribution with its per-host records
+func (s *Service) GetDistribution(id uint) (*DistributionResponse, error) {
+	var dist model.Distribution
+	if err := s.db.Preload("Artifact").Preload("Creator").
+		Preload("Targets", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Targets.Asset").
+		First(&dist, id).Error; err != nil {
+		return nil, err
+	}
+	return distributionToResponse(&dist), nil
+}
+
+// ListDistributions retrieves distributions with pagination
+func (s *Service) ListDistributions(page, pageSize int) ([]DistributionResponse, int64, error) {
+	var dists []model.Distribution
+	var total int64
+
+	if err := s.db.Model(&model.Distribution{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := s.db.Preload("Artifact").Preload("Creator").Preload("Targets").
+		Order("created_at DESC").
+		Offset(offset).Limit(pageSize).
+		Find(&dists).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]DistributionResponse, len(dists))
+	for i := range dists {
+		resp := distributionToResponse(&dists[i])
+		resp.Targets = nil
+		result[i] = *resp
+	}
+	return result, total, nil
+}
+
+// CancelDistribution stops a running distribution; hosts not yet started are marked cancelled
+func (s *Service) CancelDistribution(id uint) error {
+	var dist model.Distribution
+	if err := s.db.First(&dist, id).Error; err != nil {
+		return err
+	}
+	if dist.Status != "pending" && dist.Status != "running" {
+		return errors.New("distribution is not running")
+	}
+
+	s.runningMux.Lock()
+	cancel, ok := s.running[id]
+	s.runningMux.Unlock()
+	if ok {
+		cancel()
+		return nil
+	}
+
+	// 服务重启后遗留的任务，没有执行协程，直接标记取消
+	now := time.Now()
+	s.db.Model(&model.DistributionTarget{}).
+		Where("distribution_id = ? AND status IN ?", id, []string{"pending", "running"}).
+		Updates(map[string]interface{}{"status": "cancelled", "finished_at": now})
+	dist.Status = "cancelled"
+	dist.FinishedAt = &now
+	return s.db.Save(&dist).Error
+}
+
+// executeDistribution copies the artifact to all targets with bounded parallelism
+func (s *Service) executeDistribution(ctx context.Context, distID uint, artifact *model.FileArtifact) {
+	defer func() {
+		s.runningMux.Lock()
+		if cancel, ok := s.running[distID]; ok {
+			cancel()
+			delete(s.running, distID)
+		}
+		s.runningMux.Unlock()
+	}()
+
+	var dist model.Distribution
+	if err := s.db.First(&dist, distID).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	dist.Status = "running"
+	dist.StartedAt = &now
+	s.db.Save(&dist)
+
+	var targets []model.DistributionTarget
+	s.db.Where("distribution_id = ?", distID).Order("id ASC").Find(&targets)
+
+	sem := make(chan struct{}, dist.Concurrency)
+	var wg sync.WaitGroup
+	for i := range targets {
+		target := targets[i]
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.distributeToAsset(ctx, &dist, artifact, &target)
+		}()
+	}
+	wg.Wait()
+
+	finishedAt := time.Now()
+	if ctx.Err() != nil {
+		s.db.Model(&model.DistributionTarget{}).
+			Where("distribution_id = ? AND status = ?", distID, "pending").
+			Updates(map[string]interface{}{"status": "cancelled", "finished_at": finishedAt})
+	}
+
+	var counts []struct {
+		Status string
+		Count  int
+	}
+	s.db.Model(&model.DistributionTarget{}).
+		Select("status, count(*) as count").
+		Where("distribution_id = ?", distID).
+		Group("status").Scan(&counts)
+
+	summary := make(map[string]int)
+	for _, c := range counts {
+		summary[c.Status] = c.Count
+	}
+	ok := summary["success"] + summary["skipped"]
+
+	switch {
+	case ctx.Err() != nil:
+		dist.Status = "cancelled"
+	case ok == len(targets):
+		dist.Status = "success"
+	case ok > 0:
+		dist.Status = "partial"
+	default:
+		dist.Status = "failed"
+	}
+	dist.FinishedAt = &finishedAt
+	s.db.Save(&dist)
+}
+
+func artifactToResponse(a *model.FileArtifact) *ArtifactResponse {
+	return &ArtifactResponse{
+		ID:          a.ID,
+		Name:        a.Name,
+		FileName:    a.FileName,
+		Kind:        a.Kind,
+		Size:        a.Size,
+		Checksum:    a.Checksum,
+		Description: a.Description,
+		CreatedBy:   a.CreatedBy,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+func distributionToResponse(d *model.Distribution) *DistributionResponse {
+	summary := make(map[string]int)
+	for _, t := range d.Targets {
+		summary[t.Status]++
+	}
+
+	resp := &DistributionResponse{
+		ID:             d.ID,
+		Name:           d.Name,
+		ArtifactID:     d.ArtifactID,
+		DestPath:       d.DestPath,
+		Owner:          d.Owner,
+		Mode:           d.Mode,
+		Atomic:         d.Atomic,
+		VerifyChecksum: d.VerifyChecksum,
+		SkipIfMatch:    d.SkipIfMatch,
+		Concurrency:    d.Concurrency,
+		AssetIDs:       parseAssetIDs(d.AssetIDs),
+		Status:         d.Status,
+		Summary:        summary,
+		Targets:        d.Targets,
+		CreatedBy:      d.CreatedBy,
+		StartedAt:      d.StartedAt,
+		FinishedAt:     d.FinishedAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Artifact != nil {
+		resp.ArtifactName = d.Artifact.Name
+		resp.Checksum = d.Artifact.Checksum
+	}
+	if d.Creator.ID > 0 {
+		resp.CreatorName = d.Creator.Username
+	}
+	return resp
+}
+
+func boolOrDefault(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func parseAssetIDs(s string) []uint {
+	if s == "" {
+		return []uint{}
+	}
+
+	parts := strings.Split(s, ",")
+	result := make([]uint, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err == nil {
+			result = append(result, uint(id))
+		}
+	}
+	return result
+}
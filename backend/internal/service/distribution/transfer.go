@@ -0,0 +1,331 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package distribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// markerFile 目录分发时记录制品校验和的标记文件
+const markerFile = ".kkops-artifact.sha256"
+
+// distributeToAsset copies the artifact to a single asset and records the result
+func (s *Service) distributeToAsset(ctx context.Context, dist *model.Distribution, artifact *model.FileArtifact, target *model.DistributionTarget) {
+	now := time.Now()
+	target.Status = "running"
+	target.StartedAt = &now
+	s.db.Save(target)
+
+	var log []string
+	logf := func(format string, args ...interface{}) {
+		log = append(log, fmt.Sprintf(format, args...))
+	}
+
+	finish := func(status string, err error) {
+		finishedAt := time.Now()
+		target.Status = status
+		target.FinishedAt = &finishedAt
+		target.Output = strings.Join(log, "\n")
+		if err != nil {
+			target.Error = err.Error()
+		}
+		s.db.Save(target)
+	}
+
+	// 取消后不再执行后续步骤，目标记为已取消而不是失败
+	cancelled := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		finish("cancelled", errors.New("distribution was cancelled"))
+		return true
+	}
+
+	var asset model.Asset
+	if err := s.db.Preload("SSHKey").First(&asset, target.AssetID).Error; err != nil {
+		finish("failed", fmt.Errorf("failed to get asset: %w", err))
+		return
+	}
+
+	client, err := s.connectToAsset(&asset)
+	if err != nil {
+		finish("failed", fmt.Errorf("SSH connection failed: %w", err))
+		return
+	}
+	defer client.Close()
+
+	runContext := func(ctx context.Context, command string) (string, error) {
+		execCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+		output, exitCode, err := client.ExecuteCommandWithTimeout(execCtx, command)
+		if err != nil {
+			return output, err
+		}
+		if exitCode != 0 {
+			return output, fmt.Errorf("command exited with code %d: %s", exitCode, strings.TrimSpace(output))
+		}
+		return strings.TrimSpace(output), nil
+	}
+	run := func(command string) (string, error) {
+		return runContext(ctx, command)
+	}
+	// 清理临时文件不受取消影响
+	cleanup := func(p string) {
+		runContext(context.Background(), fmt.Sprintf("rm -f %s", shellQuote(p)))
+	}
+
+	dest := dist.DestPath
+	isArchive := artifact.Kind == "archive"
+
+	// 目标已是相同内容时跳过传输，但仍按分发配置设置属主和权限
+	if dist.SkipIfMatch {
+		if cancelled() {
+			return
+		}
+		checkCmd := fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", shellQuote(dest))
+		if isArchive {
+			checkCmd = fmt.Sprintf("cat %s 2>/dev/null", shellQuote(path.Join(dest, markerFile)))
+		}
+		if remote, err := run(checkCmd); err == nil && remote == artifact.Checksum {
+			target.RemoteChecksum = remote
+			logf("checksum matches %s, skipped", remote)
+			if commands := ownershipCommands(dist, dest, isArchive); len(commands) > 0 {
+				if _, err := run("set -e; " + strings.Join(commands, "; ")); err != nil {
+					if cancelled() {
+						return
+					}
+					finish("failed", fmt.Errorf("failed to apply owner and mode: %w", err))
+					return
+				}
+				logf("owner and mode applied")
+			}
+			finish("skipped", nil)
+			return
+		}
+	}
+
+	// 上传到临时路径（非原子模式下文件直接写入目标路径）
+	uploadPath := dest
+	if isArchive {
+		uploadPath = fmt.Sprintf("/tmp/kkops-dist-%d-%d.tar.gz", dist.ID, target.ID)
+	} else if dist.Atomic {
+		uploadPath = fmt.Sprintf("%s.kkops-tmp-%d", dest, target.ID)
+	}
+
+	if cancelled() {
+		return
+	}
+	if _, err := run(fmt.Sprintf("mkdir -p %s", shellQuote(path.Dir(uploadPath)))); err != nil {
+		if cancelled() {
+			return
+		}
+		finish("failed", fmt.Errorf("failed to create parent directory: %w", err))
+		return
+	}
+
+	written, err := s.upload(ctx, client, artifact.StoragePath, uploadPath)
+	target.BytesTransferred = written
+	if err != nil {
+		cleanup(uploadPath)
+		if cancelled() {
+			return
+		}
+		finish("failed", fmt.Errorf("upload failed: %w", err))
+		return
+	}
+	logf("uploaded %d bytes to %s", written, uploadPath)
+
+	if dist.VerifyChecksum {
+		remote, err := run(fmt.Sprintf("sha256sum %s | cut -d' ' -f1", shellQuote(uploadPath)))
+		if err != nil || remote != artifact.Checksum {
+			cleanup(uploadPath)
+			if cancelled() {
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("checksum mismatch: expected %s, got %s", artifact.Checksum, remote)
+			}
+			finish("failed", err)
+			return
+		}
+		target.RemoteChecksum = remote
+		logf("checksum verified %s", remote)
+	}
+
+	var commands []string
+	if isArchive {
+		commands = archiveCommands(dist, artifact, target, uploadPath)
+	} else {
+		commands = ownershipCommands(dist, uploadPath, false)
+		if uploadPath != dest {
+			commands = append(commands, fmt.Sprintf("mv -f %s %s", shellQuote(uploadPath), shellQuote(dest)))
+		}
+	}
+
+	if len(commands) > 0 {
+		if ctx.Err() != nil {
+			cleanup(uploadPath)
+			cancelled()
+			return
+		}
+		output, err := run("set -e; " + strings.Join(commands, "; "))
+		if output != "" {
+			logf("%s", output)
+		}
+		if err != nil {
+			cleanup(uploadPath)
+			if cancelled() {
+				return
+			}
+			finish("failed", err)
+			return
+		}
+	}
+
+	logf("installed to %s", dest)
+	finish("success", nil)
+}
+
+// archiveCommands builds the shell steps to unpack a tar.gz artifact into the destination directory
+func archiveCommands(dist *model.Distribution, artifact *model.FileArtifact, target *model.DistributionTarget, tarball string) []string {
+	dest := dist.DestPath
+	extractDir := dest
+	if dist.Atomic {
+		extractDir = fmt.Sprintf("%s.kkops-tmp-%d", dest, target.ID)
+	}
+
+	var commands []string
+	if dist.Atomic {
+		commands = append(commands, fmt.Sprintf("rm -rf %s", shellQuote(extractDir)))
+	}
+	// 非原子模式直接解压到目标目录，保留已有内容
+	commands = append(commands,
+		fmt.Sprintf("mkdir -p %s", shellQuote(extractDir)),
+		fmt.Sprintf("tar -xzf %s -C %s", shellQuote(tarball), shellQuote(extractDir)),
+		fmt.Sprintf("echo %s > %s", artifact.Checksum, shellQuote(path.Join(extractDir, markerFile))),
+	)
+	commands = append(commands, ownershipCommands(dist, extractDir, true)...)
+	if dist.Atomic {
+		old := fmt.Sprintf("%s.kkops-old-%d", dest, target.ID)
+		commands = append(commands,
+			fmt.Sprintf("if [ -e %s ]; then mv %s %s; fi", shellQuote(dest), shellQuote(dest), shellQuote(old)),
+			fmt.Sprintf("mv %s %s", shellQuote(extractDir), shellQuote(dest)),
+			fmt.Sprintf("rm -rf %s", shellQuote(old)),
+		)
+	}
+	return append(commands, fmt.Sprintf("rm -f %s", shellQuote(tarball)))
+}
+
+// ownershipCommands builds the chown/chmod steps for the distribution's owner and
+// mode; directories (unpacked archives) are chowned recursively
+func ownershipCommands(dist *model.Distribution, target string, dir bool) []string {
+	var commands []string
+	if dist.Owner != "" {
+		chown := "chown"
+		if dir {
+			chown = "chown -R"
+		}
+		commands = append(commands, fmt.Sprintf("%s %s %s", chown, shellQuote(dist.Owner), shellQuote(target)))
+	}
+	if dist.Mode != "" {
+		commands = append(commands, fmt.Sprintf("chmod %s %s", dist.Mode, shellQuote(target)))
+	}
+	return commands
+}
+
+// upload copies a local file to the remote path over SFTP
+func (s *Service) upload(ctx context.Context, client *utils.SSHClient, localPath, remotePath string) (int64, error) {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer local.Close()
+
+	sftpClient, err := sftp.NewClient(client.Client())
+	if err != nil {
+		return 0, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer sftpClient.Close()
+
+	remote, err := sftpClient.Create(remotePath)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(remote, &contextReader{ctx: ctx, r: local})
+	if closeErr := remote.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// connectToAsset establishes an SSH connection to an asset
+func (s *Service) connectToAsset(asset *model.Asset) (*utils.SSHClient, error) {
+	if asset.SSHKey == nil {
+		return nil, fmt.Errorf("no SSH key configured for asset")
+	}
+
+	sshUser := asset.SSHUser
+	if sshUser == "" {
+		sshUser = asset.SSHKey.SSHUser
+	}
+	if sshUser == "" {
+		sshUser = "root"
+	}
+
+	sshPort := asset.SSHPort
+	if sshPort == 0 {
+		sshPort = 22
+	}
+
+	privateKeyBytes, err := utils.Decrypt(asset.SSHKey.PrivateKey, s.config.Encryption.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
+	var passphraseBytes []byte
+	if asset.SSHKey.Passphrase != "" {
+		passphraseBytes, err = utils.Decrypt(asset.SSHKey.Passphrase, s.config.Encryption.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt passphrase: %w", err)
+		}
+	}
+
+	if len(passphraseBytes) > 0 {
+		return utils.NewSSHClientWithPassphrase(asset.IP, sshPort, sshUser, privateKeyBytes, passphraseBytes, 30*time.Second)
+	}
+	return utils.NewSSHClient(asset.IP, sshPort, sshUser, privateKeyBytes, 30*time.Second)
+}
+
+// contextReader aborts a copy once the context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// shellQuote quotes a string for safe use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
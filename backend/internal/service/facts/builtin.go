@@ -0,0 +1,311 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package facts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// commandCollector is a collector backed by a fixed shell command and a parse function
+type commandCollector struct {
+	name        string
+	description string
+	command     string
+	parse       func(output string) ([]Fact, error)
+}
+
+func (c *commandCollector) Name() string                        { return c.name }
+func (c *commandCollector) Description() string                 { return c.description }
+func (c *commandCollector) Command() string                     { return c.command }
+func (c *commandCollector) Parse(output string) ([]Fact, error) { return c.parse(output) }
+
+func init() {
+	Register(&commandCollector{
+		name:        "hostname",
+		description: "主机名（host.name）",
+		command:     "hostname 2>/dev/null || cat /etc/hostname",
+		parse:       parseHostname,
+	})
+	Register(&commandCollector{
+		name:        "os",
+		description: "操作系统与发行版（os.name, os.distro, os.version, os.pretty_name）",
+		command:     "cat /etc/os-release 2>/dev/null",
+		parse:       parseOSRelease,
+	})
+	Register(&commandCollector{
+		name:        "kernel",
+		description: "内核（kernel.name, kernel.release, kernel.arch）",
+		command:     "uname -s; uname -r; uname -m",
+		parse:       parseKernel,
+	})
+	Register(&commandCollector{
+		name:        "cpu",
+		description: "CPU 型号与核数（cpu.model, cpu.cores, cpu.summary）",
+		command:     "nproc 2>/dev/null; grep -m1 'model name' /proc/cpuinfo 2>/dev/null | cut -d: -f2",
+		parse:       parseCPU,
+	})
+	Register(&commandCollector{
+		name:        "memory",
+		description: "内存总量（memory.total_mb, memory.total）",
+		command:     "awk '/MemTotal/ {print $2}' /proc/meminfo 2>/dev/null",
+		parse:       parseMemory,
+	})
+	Register(&commandCollector{
+		name:        "disks",
+		description: "本地文件系统（disks, disk.root_gb, disk.total）",
+		command:     "df -P -k -x tmpfs -x devtmpfs -x squashfs -x overlay 2>/dev/null",
+		parse:       parseDisks,
+	})
+	Register(&commandCollector{
+		name:        "network",
+		description: "网络接口与地址（network.interfaces, network.interface_count）",
+		command:     "ip -o addr show 2>/dev/null",
+		parse:       parseNetwork,
+	})
+	Register(&commandCollector{
+		name:        "uptime",
+		description: "运行时长（uptime.seconds）",
+		command:     "cat /proc/uptime 2>/dev/null",
+		parse:       parseUptime,
+	})
+	Register(&commandCollector{
+		name:        "packages",
+		description: "已安装软件包（packages.manager, packages.count, packages.list）",
+		command: `if command -v dpkg-query >/dev/null 2>&1; then echo dpkg; dpkg-query -W -f='${Package} ${Version}\n' 2>/dev/null; ` +
+			`elif command -v rpm >/dev/null 2>&1; then echo rpm; rpm -qa --qf '%{NAME} %{VERSION}-%{RELEASE}\n' 2>/dev/null; fi`,
+		parse: parsePackages,
+	})
+}
+
+// lines splits command output into trimmed, non-empty lines
+func lines(output string) []string {
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func parseHostname(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) == 0 {
+		return nil, errors.New("hostname is empty")
+	}
+	return []Fact{stringFact("host.name", l[0])}, nil
+}
+
+func parseOSRelease(output string) ([]Fact, error) {
+	values := map[string]string{}
+	for _, line := range lines(output) {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	if values["ID"] == "" && values["NAME"] == "" {
+		return nil, errors.New("/etc/os-release not found")
+	}
+	return []Fact{
+		stringFact("os.name", values["NAME"]),
+		stringFact("os.distro", values["ID"]),
+		stringFact("os.version", values["VERSION_ID"]),
+		stringFact("os.pretty_name", values["PRETTY_NAME"]),
+	}, nil
+}
+
+func parseKernel(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) < 3 {
+		return nil, fmt.Errorf("unexpected uname output: %q", output)
+	}
+	return []Fact{
+		stringFact("kernel.name", l[0]),
+		stringFact("kernel.release", l[1]),
+		stringFact("kernel.arch", l[2]),
+	}, nil
+}
+
+func parseCPU(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) == 0 {
+		return nil, errors.New("nproc returned no output")
+	}
+	cores, err := strconv.ParseInt(l[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid core count %q", l[0])
+	}
+	cpuModel := "Unknown"
+	if len(l) > 1 {
+		cpuModel = l[1]
+	}
+	// cpu.summary 与早期系统信息采集脚本输出的格式保持一致
+	return []Fact{
+		stringFact("cpu.model", cpuModel),
+		intFact("cpu.cores", cores),
+		stringFact("cpu.summary", fmt.Sprintf("%s (%d核)", cpuModel, cores)),
+	}, nil
+}
+
+func parseMemory(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) == 0 {
+		return nil, errors.New("MemTotal not found in /proc/meminfo")
+	}
+	kb, err := strconv.ParseInt(l[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MemTotal %q", l[0])
+	}
+	mb := kb / 1024
+	return []Fact{
+		intFact("memory.total_mb", mb),
+		stringFact("memory.total", fmt.Sprintf("%dMB", mb)),
+	}, nil
+}
+
+// diskInfo describes one mounted filesystem
+type diskInfo struct {
+	Device     string `json:"device"`
+	Mount      string `json:"mount"`
+	SizeGB     int64  `json:"size_gb"`
+	UsedGB     int64  `json:"used_gb"`
+	UsePercent string `json:"use_percent"`
+}
+
+func parseDisks(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) < 2 {
+		return nil, errors.New("df returned no filesystems")
+	}
+
+	var disks []diskInfo
+	var rootGB int64 = -1
+	for _, line := range l[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		sizeKB, _ := strconv.ParseInt(fields[1], 10, 64)
+		usedKB, _ := strconv.ParseInt(fields[2], 10, 64)
+		d := diskInfo{
+			Device:     fields[0],
+			Mount:      strings.Join(fields[5:], " "),
+			SizeGB:     kbToGB(sizeKB),
+			UsedGB:     kbToGB(usedKB),
+			UsePercent: fields[4],
+		}
+		if d.Mount == "/" {
+			rootGB = d.SizeGB
+		}
+		disks = append(disks, d)
+	}
+	if len(disks) == 0 {
+		return nil, errors.New("df returned no filesystems")
+	}
+
+	disksFact, err := jsonFact("disks", disks)
+	if err != nil {
+		return nil, err
+	}
+	result := []Fact{disksFact}
+	if rootGB >= 0 {
+		// disk.total 与早期系统信息采集脚本一样取根分区大小
+		result = append(result,
+			intFact("disk.root_gb", rootGB),
+			stringFact("disk.total", fmt.Sprintf("%dGB", rootGB)))
+	}
+	return result, nil
+}
+
+// kbToGB converts kilobytes to gigabytes, rounding up like df -BG
+func kbToGB(kb int64) int64 {
+	return int64(math.Ceil(float64(kb) / (1024 * 1024)))
+}
+
+// networkInterface describes one interface and its addresses
+type networkInterface struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+}
+
+func parseNetwork(output string) ([]Fact, error) {
+	var interfaces []*networkInterface
+	byName := map[string]*networkInterface{}
+	for _, line := range lines(output) {
+		// 2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0 ...
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], ":")
+		if name == "lo" {
+			continue
+		}
+		iface, ok := byName[name]
+		if !ok {
+			iface = &networkInterface{Name: name}
+			byName[name] = iface
+			interfaces = append(interfaces, iface)
+		}
+		iface.Addresses = append(iface.Addresses, fields[3])
+	}
+	if len(interfaces) == 0 {
+		return nil, errors.New("no network interfaces found")
+	}
+
+	interfacesFact, err := jsonFact("network.interfaces", interfaces)
+	if err != nil {
+		return nil, err
+	}
+	return []Fact{interfacesFact, intFact("network.interface_count", int64(len(interfaces)))}, nil
+}
+
+func parseUptime(output string) ([]Fact, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return nil, errors.New("/proc/uptime not found")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uptime %q", fields[0])
+	}
+	return []Fact{intFact("uptime.seconds", int64(seconds))}, nil
+}
+
+// packageInfo describes one installed package
+type packageInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func parsePackages(output string) ([]Fact, error) {
+	l := lines(output)
+	if len(l) == 0 {
+		return nil, errors.New("no supported package manager (dpkg, rpm) found")
+	}
+
+	packages := make([]packageInfo, 0, len(l)-1)
+	for _, line := range l[1:] {
+		name, version, _ := strings.Cut(line, " ")
+		packages = append(packages, packageInfo{Name: name, Version: version})
+	}
+
+	listFact, err := jsonFact("packages.list", packages)
+	if err != nil {
+		return nil, err
+	}
+	return []Fact{
+		stringFact("packages.manager", l[0]),
+		intFact("packages.count", int64(len(packages))),
+		listFact,
+	}, nil
+}
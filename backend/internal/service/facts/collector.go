@@ -0,0 +1,102 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package facts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Fact value types
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeJSON   = "json"
+)
+
+// Fact is a single typed value reported by a collector
+type Fact struct {
+	Name  string
+	Type  string // string, int, json
+	Value string
+}
+
+// Collector gathers one group of facts from a host over SSH
+type Collector interface {
+	// Name is the unique collector name, e.g. "os"
+	Name() string
+	// Description is shown when listing collectors
+	Description() string
+	// Command is the shell command run on the host; its combined output is passed to Parse
+	Command() string
+	// Parse converts the command output into facts
+	Parse(output string) ([]Fact, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Collector{}
+)
+
+// Register makes a collector available to fact collection. It panics when a
+// collector with the same name is already registered.
+func Register(c Collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[c.Name()]; ok {
+		panic(fmt.Sprintf("facts: collector %q registered twice", c.Name()))
+	}
+	registry[c.Name()] = c
+}
+
+// Collectors returns all registered collectors sorted by name
+func Collectors() []Collector {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := make([]Collector, 0, len(registry))
+	for _, c := range registry {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+// ResolveCollectors looks up collectors by name; an empty list selects every registered collector
+func ResolveCollectors(names []string) ([]Collector, error) {
+	if len(names) == 0 {
+		return Collectors(), nil
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := make([]Collector, 0, len(names))
+	for _, name := range names {
+		c, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的事实采集器: %s", name)
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func stringFact(name, value string) Fact {
+	return Fact{Name: name, Type: TypeString, Value: value}
+}
+
+func intFact(name string, value int64) Fact {
+	return Fact{Name: name, Type: TypeInt, Value: strconv.FormatInt(value, 10)}
+}
+
+func jsonFact(name string, value interface{}) (Fact, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Fact{}, err
+	}
+	return Fact{Name: name, Type: TypeJSON, Value: string(data)}, nil
+}
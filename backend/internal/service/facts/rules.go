@@ -0,0 +1,351 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package facts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Mapping rule modes
+const (
+	ModeOverwrite = "overwrite"  // 事实与资产字段不同时直接覆盖
+	ModeFillEmpty = "fill_empty" // 仅在资产字段为空时写入，否则记录冲突
+	ModeReport    = "report"     // 从不写入，只记录冲突
+)
+
+// Conflict statuses
+const (
+	ConflictOpen      = "open"      // 待处理
+	ConflictAccepted  = "accepted"  // 已采用事实值
+	ConflictDismissed = "dismissed" // 保留资产值；同样的冲突不再重复提示
+	ConflictResolved  = "resolved"  // 资产字段与事实已一致
+)
+
+// assetFields 可由事实更新的资产字段及其列名
+var assetFields = map[string]string{
+	"host_name": "host_name",
+	"cpu":       "cpu",
+	"memory":    "memory",
+	"disk":      "disk",
+}
+
+var (
+	// ErrRuleNotFound is returned when a mapping rule does not exist
+	ErrRuleNotFound = errors.New("fact mapping rule not found")
+	// ErrConflictNotFound is returned when a conflict does not exist
+	ErrConflictNotFound = errors.New("fact conflict not found")
+)
+
+// RuleRequest represents a request to create or update a mapping rule
+type RuleRequest struct {
+	FactName    string `json:"fact_name" binding:"required"`
+	AssetField  string `json:"asset_field" binding:"required,oneof=host_name cpu memory disk"`
+	Mode        string `json:"mode" binding:"required,oneof=overwrite fill_empty report"`
+	Enabled     *bool  `json:"enabled"` // 默认启用
+	Description string `json:"description"`
+}
+
+// ConflictResponse represents a fact conflict
+type ConflictResponse struct {
+	ID         uint       `json:"id"`
+	AssetID    uint       `json:"asset_id"`
+	HostName   string     `json:"host_name,omitempty"`
+	AssetField string     `json:"asset_field"`
+	FactName   string     `json:"fact_name"`
+	AssetValue string     `json:"asset_value"`
+	FactValue  string     `json:"fact_value"`
+	Status     string     `json:"status"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *uint      `json:"resolved_by,omitempty"`
+}
+
+// ListRules returns all mapping rules
+func (s *Service) ListRules() ([]model.FactMappingRule, error) {
+	var rules []model.FactMappingRule
+	if err := s.db.Order("asset_field").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateRule creates a mapping rule; each asset field can have only one rule
+func (s *Service) CreateRule(req *RuleRequest) (*model.FactMappingRule, error) {
+	var count int64
+	s.db.Model(&model.FactMappingRule{}).Where("asset_field = ?", req.AssetField).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("资产字段 %s 已存在映射规则", req.AssetField)
+	}
+
+	rule := model.FactMappingRule{
+		FactName:    req.FactName,
+		AssetField:  req.AssetField,
+		Mode:        req.Mode,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Description: req.Description,
+	}
+	if err := s.db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateRule replaces a mapping rule
+func (s *Service) UpdateRule(id uint, req *RuleRequest) (*model.FactMappingRule, error) {
+	var rule model.FactMappingRule
+	if err := s.db.First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRuleNotFound
+		}
+		return nil, err
+	}
+
+	if req.AssetField != rule.AssetField {
+		var count int64
+		s.db.Model(&model.FactMappingRule{}).Where("asset_field = ? AND id <> ?", req.AssetField, id).Count(&count)
+		if count > 0 {
+			return nil, fmt.Errorf("资产字段 %s 已存在映射规则", req.AssetField)
+		}
+	}
+
+	rule.FactName = req.FactName
+	rule.AssetField = req.AssetField
+	rule.Mode = req.Mode
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	rule.Description = req.Description
+	if err := s.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteRule deletes a mapping rule
+func (s *Service) DeleteRule(id uint) error {
+	return s.db.Delete(&model.FactMappingRule{}, id).Error
+}
+
+// ListConflicts lists fact conflicts, newest first
+func (s *Service) ListConflicts(status string, assetID uint, page, pageSize int) ([]ConflictResponse, int64, error) {
+	query := s.db.Model(&model.AssetFactConflict{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if assetID > 0 {
+		query = query.Where("asset_id = ?", assetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var conflicts []model.AssetFactConflict
+	if err := query.Preload("Asset").Order("detected_at DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&conflicts).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]ConflictResponse, len(conflicts))
+	for i := range conflicts {
+		result[i] = conflictToResponse(&conflicts[i])
+	}
+	return result, total, nil
+}
+
+// AcceptConflict writes the collected value to the asset and closes the conflict
+func (s *Service) AcceptConflict(id, userID uint) (*ConflictResponse, error) {
+	conflict, err := s.openConflict(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkHostName(conflict.AssetID, conflict.AssetField, conflict.FactValue); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&model.Asset{}).Where("id = ?", conflict.AssetID).
+		Update(assetFields[conflict.AssetField], conflict.FactValue).Error; err != nil {
+		return nil, err
+	}
+
+	return s.closeConflict(conflict, ConflictAccepted, userID)
+}
+
+// DismissConflict keeps the asset's value; the same conflict is not raised again
+func (s *Service) DismissConflict(id, userID uint) (*ConflictResponse, error) {
+	conflict, err := s.openConflict(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.closeConflict(conflict, ConflictDismissed, userID)
+}
+
+func (s *Service) openConflict(id uint) (*model.AssetFactConflict, error) {
+	var conflict model.AssetFactConflict
+	if err := s.db.First(&conflict, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConflictNotFound
+		}
+		return nil, err
+	}
+	if conflict.Status != ConflictOpen {
+		return nil, fmt.Errorf("冲突已处理（%s）", conflict.Status)
+	}
+	return &conflict, nil
+}
+
+func (s *Service) closeConflict(conflict *model.AssetFactConflict, status string, userID uint) (*ConflictResponse, error) {
+	now := time.Now()
+	conflict.Status = status
+	conflict.ResolvedAt = &now
+	conflict.ResolvedBy = &userID
+	if err := s.db.Save(conflict).Error; err != nil {
+		return nil, err
+	}
+	s.db.Preload("Asset").First(conflict, conflict.ID)
+	resp := conflictToResponse(conflict)
+	return &resp, nil
+}
+
+// applyRules maps collected facts onto the asset according to the enabled
+// rules. It returns the asset fields that were updated and the conflicts that
+// were raised or refreshed.
+func (s *Service) applyRules(asset *model.Asset, values map[string]string) ([]string, []ConflictResponse, error) {
+	var rules []model.FactMappingRule
+	if err := s.db.Where("enabled = ?", true).Order("asset_field").Find(&rules).Error; err != nil {
+		return nil, nil, err
+	}
+
+	updated := []string{}
+	conflicts := []ConflictResponse{}
+	updates := map[string]interface{}{}
+	for _, rule := range rules {
+		value, ok := values[rule.FactName]
+		column, known := assetFields[rule.AssetField]
+		if !ok || value == "" || !known {
+			continue
+		}
+
+		current := assetFieldValue(asset, rule.AssetField)
+		if current == value {
+			s.db.Model(&model.AssetFactConflict{}).
+				Where("asset_id = ? AND asset_field = ? AND status = ?", asset.ID, rule.AssetField, ConflictOpen).
+				Updates(map[string]interface{}{"status": ConflictResolved, "resolved_at": time.Now()})
+			continue
+		}
+
+		write := rule.Mode == ModeOverwrite || (rule.Mode == ModeFillEmpty && current == "")
+		if write && s.checkHostName(asset.ID, rule.AssetField, value) == nil {
+			updates[column] = value
+			updated = append(updated, rule.AssetField)
+			continue
+		}
+
+		conflict, err := s.raiseConflict(asset, rule, current, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if conflict != nil {
+			resp := conflictToResponse(conflict)
+			resp.HostName = asset.HostName
+			conflicts = append(conflicts, resp)
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(&model.Asset{}).Where("id = ?", asset.ID).Updates(updates).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return updated, conflicts, nil
+}
+
+// raiseConflict records or refreshes the open conflict for an asset field. A
+// conflict the user dismissed is not raised again while both values are unchanged.
+func (s *Service) raiseConflict(asset *model.Asset, rule model.FactMappingRule, assetValue, factValue string) (*model.AssetFactConflict, error) {
+	var latest model.AssetFactConflict
+	err := s.db.Where("asset_id = ? AND asset_field = ? AND status IN ?", asset.ID, rule.AssetField, []string{ConflictOpen, ConflictDismissed}).
+		Order("id DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err == nil && latest.Status == ConflictDismissed && latest.AssetValue == assetValue && latest.FactValue == factValue {
+		return nil, nil
+	}
+
+	conflict := model.AssetFactConflict{
+		AssetID:    asset.ID,
+		AssetField: rule.AssetField,
+		Status:     ConflictOpen,
+	}
+	if err == nil && latest.Status == ConflictOpen {
+		conflict = latest
+	}
+	conflict.FactName = rule.FactName
+	conflict.AssetValue = assetValue
+	conflict.FactValue = factValue
+	conflict.DetectedAt = time.Now()
+	if err := s.db.Save(&conflict).Error; err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+// checkHostName rejects writing a host name that another asset already uses
+func (s *Service) checkHostName(assetID uint, field, value string) error {
+	if field != "host_name" {
+		return nil
+	}
+	var count int64
+	s.db.Model(&model.Asset{}).Where("host_name = ? AND id <> ?", value, assetID).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("主机名 %s 已被其他资产使用", value)
+	}
+	return nil
+}
+
+// assetFieldValue returns the current value of a mappable asset field
+func assetFieldValue(asset *model.Asset, field string) string {
+	switch field {
+	case "host_name":
+		return asset.HostName
+	case "cpu":
+		return asset.CPU
+	case "memory":
+		return asset.Memory
+	case "disk":
+		return asset.Disk
+	}
+	return ""
+}
+
+func conflictToResponse(c *model.AssetFactConflict) ConflictResponse {
+	resp := ConflictResponse{
+		ID:         c.ID,
+		AssetID:    c.AssetID,
+		AssetField: c.AssetField,
+		FactName:   c.FactName,
+		AssetValue: c.AssetValue,
+		FactValue:  c.FactValue,
+		Status:     c.Status,
+		DetectedAt: c.DetectedAt,
+		ResolvedAt: c.ResolvedAt,
+		ResolvedBy: c.ResolvedBy,
+	}
+	if c.Asset != nil {
+		resp.HostName = c.Asset.HostName
+	}
+	return resp
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package facts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// collectorTimeout 单个采集器命令的超时时间
+const collectorTimeout = 60 * time.Second
+
+// scriptCollector 从定时任务脚本输出的 JSON 中解析出的事实所使用的采集器名称
+const scriptCollector = "script"
+
+// legacyFactNames 早期系统信息采集脚本输出的 JSON 字段与事实名称的对应关系
+var legacyFactNames = map[string]string{
+	"hostname": "host.name",
+	"cpu":      "cpu.summary",
+	"memory":   "memory.total",
+	"disk":     "disk.total",
+}
+
+// Service handles fact collection, storage and mapping facts onto assets
+type Service struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewService creates a new fact collection service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{db: db, config: cfg}
+}
+
+// CollectorInfo describes a registered collector
+type CollectorInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// FactResponse represents a stored fact
+type FactResponse struct {
+	Name        string          `json:"name"`
+	Collector   string          `json:"collector"`
+	ValueType   string          `json:"value_type"`
+	Value       json.RawMessage `json:"value"` // int 为数字，json 为原始 JSON，其余为字符串
+	CollectedAt time.Time       `json:"collected_at"`
+}
+
+// CollectResult describes the outcome of collecting facts from one asset
+type CollectResult struct {
+	AssetID   uint               `json:"asset_id"`
+	Facts     []FactResponse     `json:"facts"`
+	Updated   []string           `json:"updated"`          // 按映射规则更新的资产字段
+	Conflicts []ConflictResponse `json:"conflicts"`        // 本次采集产生或刷新的冲突
+	Errors    map[string]string  `json:"errors,omitempty"` // 采集器名称 -> 错误信息
+}
+
+// Summary returns a one-line description of the result for execution output
+func (r *CollectResult) Summary() string {
+	parts := []string{fmt.Sprintf("采集事实 %d 项", len(r.Facts))}
+	if len(r.Updated) > 0 {
+		parts = append(parts, "更新资产字段: "+strings.Join(r.Updated, ", "))
+	}
+	if len(r.Conflicts) > 0 {
+		fields := make([]string, len(r.Conflicts))
+		for i, c := range r.Conflicts {
+			fields[i] = c.AssetField
+		}
+		parts = append(parts, "冲突: "+strings.Join(fields, ", "))
+	}
+	names := make([]string, 0, len(r.Errors))
+	for name := range r.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("采集器 %s 失败: %s", name, r.Errors[name]))
+	}
+	return strings.Join(parts, "；")
+}
+
+// ListCollectors returns the registered collectors
+func (s *Service) ListCollectors() []CollectorInfo {
+	collectors := Collectors()
+	result := make([]CollectorInfo, len(collectors))
+	for i, c := range collectors {
+		result[i] = CollectorInfo{Name: c.Name(), Description: c.Description()}
+	}
+	return result
+}
+
+// ListFacts returns the facts stored for an asset, optionally filtered by name prefix (e.g. "os.")
+func (s *Service) ListFacts(assetID uint, prefix string) ([]FactResponse, error) {
+	query := s.db.Where("asset_id = ?", assetID).Order("name")
+	if prefix != "" {
+		query = query.Where("name LIKE ?", prefix+"%")
+	}
+	var stored []model.AssetFact
+	if err := query.Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	result := make([]FactResponse, len(stored))
+	for i := range stored {
+		result[i] = factToResponse(&stored[i])
+	}
+	return result, nil
+}
+
+// CollectAsset runs the named collectors (all when empty) on an asset over SSH,
+// stores the facts and applies the mapping rules. Collector failures are
+// reported in the result; an error is only returned when nothing could run.
+func (s *Service) CollectAsset(ctx context.Context, assetID uint, names []string) (*CollectResult, error) {
+	collectors, err := ResolveCollectors(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var asset model.Asset
+	if err := s.db.Preload("SSHKey").First(&asset, assetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("asset not found")
+		}
+		return nil, err
+	}
+
+	client, err := s.connectToAsset(&asset)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result := &CollectResult{AssetID: assetID, Errors: map[string]string{}}
+	var collected []model.AssetFact
+	now := time.Now()
+	for _, c := range collectors {
+		cmdCtx, cancel := context.WithTimeout(ctx, collectorTimeout)
+		output, _, err := client.ExecuteCommandWithTimeout(cmdCtx, c.Command())
+		cancel()
+		if err != nil {
+			result.Errors[c.Name()] = err.Error()
+			continue
+		}
+		facts, err := c.Parse(output)
+		if err != nil {
+			result.Errors[c.Name()] = err.Error()
+			continue
+		}
+		for _, f := range facts {
+			collected = append(collected, model.AssetFact{
+				AssetID:     assetID,
+				Name:        f.Name,
+				Collector:   c.Name(),
+				ValueType:   f.Type,
+				Value:       f.Value,
+				CollectedAt: now,
+			})
+		}
+	}
+
+	if err := s.store(&asset, collected, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// IngestJSON stores the JSON object printed by a scheduled task script as facts
+// of the "script" collector and applies the mapping rules. Keys written by the
+// bundled system info template (hostname, cpu, memory, disk) map to the
+// matching built-in fact names; other keys are stored as custom.<key>.
+func (s *Service) IngestJSON(assetID uint, output string) (*CollectResult, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start == -1 || end == -1 || end < start {
+		return nil, errors.New("no JSON object found in output")
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &values); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %w", err)
+	}
+
+	var asset model.Asset
+	if err := s.db.First(&asset, assetID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	collected := make([]model.AssetFact, 0, len(values))
+	for key, raw := range values {
+		name, ok := legacyFactNames[key]
+		if !ok {
+			name = "custom." + key
+		}
+		fact := model.AssetFact{AssetID: assetID, Name: name, Collector: scriptCollector, CollectedAt: now}
+		switch v := raw.(type) {
+		case string:
+			fact.ValueType, fact.Value = TypeString, v
+		case float64:
+			if v == float64(int64(v)) {
+				fact.ValueType, fact.Value = TypeInt, fmt.Sprintf("%d", int64(v))
+			} else {
+				fact.ValueType, fact.Value = TypeString, fmt.Sprintf("%v", v)
+			}
+		default:
+			data, _ := json.Marshal(v)
+			fact.ValueType, fact.Value = TypeJSON, string(data)
+		}
+		collected = append(collected, fact)
+	}
+
+	result := &CollectResult{AssetID: assetID}
+	if err := s.store(&asset, collected, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// store upserts collected facts and applies the mapping rules to the asset
+func (s *Service) store(asset *model.Asset, collected []model.AssetFact, result *CollectResult) error {
+	result.Facts = []FactResponse{}
+	if len(collected) == 0 {
+		return nil
+	}
+
+	// 同一批次中重复的事实名只保留最后一条，避免 upsert 同一行两次
+	index := make(map[string]int, len(collected))
+	unique := collected[:0]
+	for _, f := range collected {
+		if i, ok := index[f.Name]; ok {
+			unique[i] = f
+			continue
+		}
+		index[f.Name] = len(unique)
+		unique = append(unique, f)
+	}
+	collected = unique
+
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"collector", "value_type", "value", "collected_at", "updated_at"}),
+	}).Create(&collected).Error; err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(collected))
+	for i := range collected {
+		values[collected[i].Name] = collected[i].Value
+		result.Facts = append(result.Facts, factToResponse(&collected[i]))
+	}
+
+	updated, conflicts, err := s.applyRules(asset, values)
+	if err != nil {
+		return err
+	}
+	result.Updated = updated
+	result.Conflicts = conflicts
+	return nil
+}
+
+// connectToAsset establishes an SSH connection to an asset
+func (s *Service) connectToAsset(asset *model.Asset) (*utils.SSHClient, error) {
+	if asset.SSHKey == nil {
+		return nil, fmt.Errorf("no SSH key configured for asset")
+	}
+
+	sshUser := asset.SSHUser
+	if sshUser == "" {
+		sshUser = asset.SSHKey.SSHUser
+	}
+	if sshUser == "" {
+		sshUser = "root"
+	}
+
+	sshPort := asset.SSHPort
+	if sshPort == 0 {
+		sshPort = 22
+	}
+
+	privateKeyBytes, err := utils.Decrypt(asset.SSHKey.PrivateKey, s.config.Encryption.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
+	var passphraseBytes []byte
+	if asset.SSHKey.Passphrase != "" {
+		passphraseBytes, err = utils.Decrypt(asset.SSHKey.Passphrase, s.config.Encryption.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt passphrase: %w", err)
+		}
+	}
+
+	if len(passphraseBytes) > 0 {
+		return utils.NewSSHClientWithPassphrase(asset.IP, sshPort, sshUser, privateKeyBytes, passphraseBytes, 30*time.Second)
+	}
+	return utils.NewSSHClient(asset.IP, sshPort, sshUser, privateKeyBytes, 30*time.Second)
+}
+
+func factToResponse(f *model.AssetFact) FactResponse {
+	value := json.RawMessage(f.Value)
+	if f.ValueType != TypeInt && f.ValueType != TypeJSON || !json.Valid(value) {
+		value, _ = json.Marshal(f.Value)
+	}
+	return FactResponse{
+		Name:        f.Name,
+		Collector:   f.Collector,
+		ValueType:   f.ValueType,
+		Value:       value,
+		CollectedAt: f.CollectedAt,
+	}
+}
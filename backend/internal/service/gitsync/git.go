@@ -0,0 +1,89 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// checkout fetches the repository branch into its working directory and returns
+// the sync root (the sub-directory inside the checkout) and the commit hash
+func (s *Service) checkout(ctx context.Context, repo *model.GitRepository) (string, string, error) {
+	dir, err := filepath.Abs(filepath.Join(s.config.Storage.GitDir, strconv.FormatUint(uint64(repo.ID), 10)))
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", "", fmt.Errorf("failed to create checkout directory: %w", err)
+		}
+		if _, err := runGit(ctx, dir, "init", "--quiet"); err != nil {
+			return "", "", err
+		}
+	}
+
+	// 每次直接从 URL 拉取指定分支，仓库地址变更后无需重建工作目录
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--depth", "1", repo.URL, repo.Branch); err != nil {
+		return "", "", err
+	}
+	if _, err := runGit(ctx, dir, "checkout", "--quiet", "--force", "FETCH_HEAD"); err != nil {
+		return "", "", err
+	}
+	if _, err := runGit(ctx, dir, "clean", "-fdxq"); err != nil {
+		return "", "", err
+	}
+
+	commit, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	// 返回解析符号链接后的真实路径，后续读取文件都以它为根校验
+	root, err := resolveInside(dir, repo.SubDir)
+	if errors.Is(err, errEscapesRepository) {
+		return "", "", fmt.Errorf("sub_dir escapes the repository")
+	}
+	notFound := fmt.Errorf("sub_dir %q not found in branch %s", repo.SubDir, repo.Branch)
+	if err != nil {
+		return "", "", notFound
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return "", "", notFound
+	}
+
+	return root, commit, nil
+}
+
+// runGit runs a git command in dir and returns its trimmed standard output
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// 禁止交互式凭据提示，避免后台同步挂起
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
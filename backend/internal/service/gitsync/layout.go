@@ -0,0 +1,257 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kkops/backend/internal/service/deployment"
+)
+
+// Repository layout (relative to the configured sub-directory):
+//
+//	templates/<name>.sh|.bash   shell template; an optional "# description: ..." comment sets the description
+//	templates/<name>.py         python template
+//	modules/<name>.yaml|.yml    deployment module (see moduleSpec)
+const (
+	templatesDir = "templates"
+	modulesDir   = "modules"
+)
+
+// errEscapesRepository is returned when a path, after following symlinks, points outside the sync root
+var errEscapesRepository = errors.New("path escapes the repository")
+
+// templateTypes maps template file extensions to template types
+var templateTypes = map[string]string{
+	".sh":   "shell",
+	".bash": "shell",
+	".py":   "python",
+}
+
+// templateSpec is a template declared in the repository
+type templateSpec struct {
+	Path        string
+	Name        string
+	Description string
+	Content     string
+	Type        string
+}
+
+// moduleSpec is a deployment module declared in a module YAML file
+type moduleSpec struct {
+	Path             string   `yaml:"-"`
+	Name             string   `yaml:"name"`
+	Description      string   `yaml:"description"`
+	Project          string   `yaml:"project"`
+	Environment      string   `yaml:"environment"`
+	Template         string   `yaml:"template"`
+	TemplateVersion  *int     `yaml:"template_version"`
+	VersionSourceURL string   `yaml:"version_source_url"`
+	DeployScript     string   `yaml:"deploy_script"`
+	DeployScriptFile string   `yaml:"deploy_script_file"` // 相对同步根目录的脚本文件，与 deploy_script 二选一
+	ScriptType       string   `yaml:"script_type"`
+	Timeout          int      `yaml:"timeout"`
+	TargetHosts      []string `yaml:"target_hosts"`
+	CanaryHosts      []string `yaml:"canary_hosts"` // 金丝雀主机的名称或 IP，替换 canary.asset_ids
+
+	// rollout, canary, rollback, hooks, lock, version_source，字段与模块 API 相同
+	Settings deployment.ModuleSettings `yaml:"-"`
+}
+
+// parseError records a file that could not be parsed
+type parseError struct {
+	Path string
+	Err  error
+}
+
+// loadLayout reads template files and module YAML files from the sync root
+func loadLayout(root string) ([]templateSpec, []moduleSpec, []parseError) {
+	var templates []templateSpec
+	var modules []moduleSpec
+	var errs []parseError
+
+	templateFiles, err := listFiles(root, templatesDir)
+	if err != nil {
+		errs = append(errs, parseError{templatesDir, err})
+	}
+	for _, path := range templateFiles {
+		ext := strings.ToLower(filepath.Ext(path))
+		templateType, ok := templateTypes[ext]
+		if !ok {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			errs = append(errs, parseError{path, err})
+			continue
+		}
+		templates = append(templates, templateSpec{
+			Path:        path,
+			Name:        strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Description: scriptDescription(string(content)),
+			Content:     string(content),
+			Type:        templateType,
+		})
+	}
+
+	moduleFiles, err := listFiles(root, modulesDir)
+	if err != nil {
+		errs = append(errs, parseError{modulesDir, err})
+	}
+	for _, path := range moduleFiles {
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		spec, err := parseModule(root, path)
+		if err != nil {
+			errs = append(errs, parseError{path, err})
+			continue
+		}
+		modules = append(modules, *spec)
+	}
+
+	return templates, modules, errs
+}
+
+// parseModule reads and validates a module YAML file
+func parseModule(root, path string) (*moduleSpec, error) {
+	data, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return nil, err
+	}
+
+	var spec moduleSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if err := parseSettings(data, &spec.Settings); err != nil {
+		return nil, fmt.Errorf("invalid deployment settings: %w", err)
+	}
+	spec.Path = path
+
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if spec.Project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+	if spec.DeployScript != "" && spec.DeployScriptFile != "" {
+		return nil, fmt.Errorf("deploy_script and deploy_script_file are mutually exclusive")
+	}
+	if spec.DeployScriptFile != "" {
+		// 仓库中的符号链接可能指向服务器上的任意文件，按解析后的真实路径校验
+		scriptPath, err := resolveInside(root, spec.DeployScriptFile)
+		if errors.Is(err, errEscapesRepository) {
+			return nil, fmt.Errorf("deploy_script_file escapes the repository")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deploy_script_file: %w", err)
+		}
+		if info, err := os.Stat(scriptPath); err == nil && !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("deploy_script_file must be a regular file")
+		}
+		script, err := os.ReadFile(scriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deploy_script_file: %w", err)
+		}
+		spec.DeployScript = string(script)
+	}
+	if spec.DeployScript == "" && spec.Template == "" {
+		return nil, fmt.Errorf("deploy_script, deploy_script_file or template is required")
+	}
+	if spec.ScriptType == "" {
+		spec.ScriptType = "shell"
+	}
+	if spec.Timeout <= 0 {
+		spec.Timeout = 600
+	}
+
+	return &spec, nil
+}
+
+// parseSettings reads the deployment strategies of a module YAML file. They use
+// the JSON field names of the module API, so the YAML is decoded through JSON.
+func parseSettings(data []byte, settings *deployment.ModuleSettings) error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, settings)
+}
+
+// listFiles returns the regular files directly inside root/dir, as slash paths relative to root.
+// Symlinked files are skipped; dir itself may be a symlink only if it stays inside root.
+func listFiles(root, dir string) ([]string, error) {
+	realDir, err := resolveInside(root, dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(realDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			paths = append(paths, dir+"/"+e.Name())
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// resolveInside joins rel to root, follows symlinks in both and checks that the
+// real path is still inside root
+func resolveInside(root, rel string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(realRoot, rel))
+	if err != nil {
+		return "", err
+	}
+	if target != realRoot && !strings.HasPrefix(target, realRoot+string(filepath.Separator)) {
+		return "", errEscapesRepository
+	}
+	return target, nil
+}
+
+// scriptDescription extracts a "# description: ..." comment from the script header
+func scriptDescription(content string) string {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#!") {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if len(comment) > len("description:") && strings.EqualFold(comment[:len("description:")], "description:") {
+			return strings.TrimSpace(comment[len("description:"):])
+		}
+	}
+	return ""
+}
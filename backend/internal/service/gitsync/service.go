@@ -0,0 +1,351 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+)
+
+// pollInterval 后台检查到期仓库的间隔
+const pollInterval = 30 * time.Second
+
+var (
+	// ErrSyncInProgress is returned when the repository is already being synced
+	ErrSyncInProgress = errors.New("repository sync is already in progress")
+
+	branchPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+)
+
+// Service handles Git repository sources and template/module synchronization
+type Service struct {
+	db      *gorm.DB
+	config  *config.Config
+	logger  *zap.Logger
+	mu      sync.Mutex
+	running map[uint]bool // repositoryID -> 正在同步
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewService creates a new Git sync service
+func NewService(db *gorm.DB, cfg *config.Config, logger *zap.Logger) *Service {
+	return &Service{
+		db:      db,
+		config:  cfg,
+		logger:  logger,
+		running: make(map[uint]bool),
+	}
+}
+
+// CreateRepositoryRequest represents a request to register a Git repository
+type CreateRepositoryRequest struct {
+	Name          string `json:"name" binding:"required"`
+	URL           string `json:"url" binding:"required"`
+	Branch        string `json:"branch"`
+	SubDir        string `json:"sub_dir"`
+	SyncInterval  *int   `json:"sync_interval"` // 默认 300 秒，0 表示仅手动同步
+	Enabled       *bool  `json:"enabled"`       // 默认启用
+	AdoptExisting bool   `json:"adopt_existing"`
+}
+
+// UpdateRepositoryRequest represents a request to update a Git repository
+type UpdateRepositoryRequest struct {
+	Name          string  `json:"name"`
+	URL           string  `json:"url"`
+	Branch        string  `json:"branch"`
+	SubDir        *string `json:"sub_dir"`
+	SyncInterval  *int    `json:"sync_interval"`
+	Enabled       *bool   `json:"enabled"`
+	AdoptExisting *bool   `json:"adopt_existing"`
+}
+
+// RepositoryResponse represents a Git repository response
+type RepositoryResponse struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Branch        string     `json:"branch"`
+	SubDir        string     `json:"sub_dir"`
+	SyncInterval  int        `json:"sync_interval"`
+	Enabled       bool       `json:"enabled"`
+	AdoptExisting bool       `json:"adopt_existing"`
+	LastSyncAt    *time.Time `json:"last_sync_at"`
+	LastCommit    string     `json:"last_commit"`
+	LastStatus    string     `json:"last_status"`
+	LastError     string     `json:"last_error"`
+	TemplateCount int64      `json:"template_count"` // 当前托管的模板数
+	ModuleCount   int64      `json:"module_count"`   // 当前托管的部署模块数
+	CreatedBy     uint       `json:"created_by"`
+	CreatorName   string     `json:"creator_name"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// CreateRepository registers a new Git repository
+func (s *Service) CreateRepository(userID uint, req *CreateRepositoryRequest) (*RepositoryResponse, error) {
+	repo := model.GitRepository{
+		Name:          req.Name,
+		URL:           strings.TrimSpace(req.URL),
+		Branch:        strings.TrimSpace(req.Branch),
+		SyncInterval:  300,
+		Enabled:       true,
+		AdoptExisting: req.AdoptExisting,
+		CreatedBy:     userID,
+	}
+	if repo.Branch == "" {
+		repo.Branch = "main"
+	}
+	if req.SyncInterval != nil {
+		repo.SyncInterval = *req.SyncInterval
+	}
+	if req.Enabled != nil {
+		repo.Enabled = *req.Enabled
+	}
+
+	subDir, err := cleanSubDir(req.SubDir)
+	if err != nil {
+		return nil, err
+	}
+	repo.SubDir = subDir
+
+	if err := validateRepository(&repo); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&repo).Error; err != nil {
+		return nil, err
+	}
+
+	return s.GetRepository(repo.ID)
+}
+
+// GetRepository retrieves a Git repository by ID
+func (s *Service) GetRepository(id uint) (*RepositoryResponse, error) {
+	var repo model.GitRepository
+	if err := s.db.Preload("Creator").First(&repo, id).Error; err != nil {
+		return nil, err
+	}
+	return s.repositoryToResponse(&repo), nil
+}
+
+// ListRepositories lists all Git repositories
+func (s *Service) ListRepositories() ([]RepositoryResponse, error) {
+	var repos []model.GitRepository
+	if err := s.db.Preload("Creator").Order("name").Find(&repos).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]RepositoryResponse, len(repos))
+	for i := range repos {
+		result[i] = *s.repositoryToResponse(&repos[i])
+	}
+	return result, nil
+}
+
+// UpdateRepository updates a Git repository
+func (s *Service) UpdateRepository(id uint, req *UpdateRepositoryRequest) (*RepositoryResponse, error) {
+	var repo model.GitRepository
+	if err := s.db.First(&repo, id).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		repo.Name = req.Name
+	}
+	if req.URL != "" {
+		repo.URL = strings.TrimSpace(req.URL)
+	}
+	if req.Branch != "" {
+		repo.Branch = strings.TrimSpace(req.Branch)
+	}
+	if req.SubDir != nil {
+		subDir, err := cleanSubDir(*req.SubDir)
+		if err != nil {
+			return nil, err
+		}
+		repo.SubDir = subDir
+	}
+	if req.SyncInterval != nil {
+		repo.SyncInterval = *req.SyncInterval
+	}
+	if req.Enabled != nil {
+		repo.Enabled = *req.Enabled
+	}
+	if req.AdoptExisting != nil {
+		repo.AdoptExisting = *req.AdoptExisting
+	}
+
+	if err := validateRepository(&repo); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&repo).Error; err != nil {
+		return nil, err
+	}
+
+	return s.GetRepository(repo.ID)
+}
+
+// DeleteRepository deletes a Git repository; its managed templates and modules
+// are detached (become editable again) rather than deleted
+func (s *Service) DeleteRepository(id uint) error {
+	var repo model.GitRepository
+	if err := s.db.First(&repo, id).Error; err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.TaskTemplate{}).Where("git_repository_id = ?", id).
+			Updates(map[string]interface{}{"git_repository_id": nil, "git_path": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.DeploymentModule{}).Where("git_repository_id = ?", id).
+			Updates(map[string]interface{}{"git_repository_id": nil, "git_path": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&repo).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// 清理本地检出目录（失败不影响删除结果）
+	os.RemoveAll(filepath.Join(s.config.Storage.GitDir, strconv.FormatUint(uint64(id), 10)))
+	return nil
+}
+
+// Start starts the background loop that pulls repositories whose sync interval has elapsed
+func (s *Service) Start() {
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.syncDue()
+			}
+		}
+	}()
+	s.logger.Info("Git 同步服务已启动")
+}
+
+// Stop stops the background sync loop and waits for it to exit
+func (s *Service) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.wg.Wait()
+	s.logger.Info("Git 同步服务已停止")
+}
+
+// syncDue syncs every enabled repository whose sync interval has elapsed
+func (s *Service) syncDue() {
+	var repos []model.GitRepository
+	if err := s.db.Where("enabled = ? AND sync_interval > 0", true).Find(&repos).Error; err != nil {
+		s.logger.Error("加载 Git 仓库失败", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	for _, repo := range repos {
+		if repo.LastSyncAt != nil && now.Sub(*repo.LastSyncAt) < time.Duration(repo.SyncInterval)*time.Second {
+			continue
+		}
+		report, err := s.Sync(repo.ID, false)
+		if err != nil {
+			if !errors.Is(err, ErrSyncInProgress) {
+				s.logger.Error("Git 仓库同步失败", zap.Uint("repository_id", repo.ID), zap.String("name", repo.Name), zap.Error(err))
+			}
+			continue
+		}
+		s.logger.Info("Git 仓库同步完成",
+			zap.Uint("repository_id", repo.ID),
+			zap.String("name", repo.Name),
+			zap.String("commit", report.Commit),
+			zap.String("status", report.Status))
+	}
+}
+
+func (s *Service) repositoryToResponse(repo *model.GitRepository) *RepositoryResponse {
+	resp := &RepositoryResponse{
+		ID:            repo.ID,
+		Name:          repo.Name,
+		URL:           repo.URL,
+		Branch:        repo.Branch,
+		SubDir:        repo.SubDir,
+		SyncInterval:  repo.SyncInterval,
+		Enabled:       repo.Enabled,
+		AdoptExisting: repo.AdoptExisting,
+		LastSyncAt:    repo.LastSyncAt,
+		LastCommit:    repo.LastCommit,
+		LastStatus:    repo.LastStatus,
+		LastError:     repo.LastError,
+		CreatedBy:     repo.CreatedBy,
+		CreatorName:   repo.Creator.Username,
+		CreatedAt:     repo.CreatedAt,
+		UpdatedAt:     repo.UpdatedAt,
+	}
+	s.db.Model(&model.TaskTemplate{}).Where("git_repository_id = ?", repo.ID).Count(&resp.TemplateCount)
+	s.db.Model(&model.DeploymentModule{}).Where("git_repository_id = ?", repo.ID).Count(&resp.ModuleCount)
+	return resp
+}
+
+// validateRepository rejects values that git would interpret as options
+func validateRepository(repo *model.GitRepository) error {
+	if repo.URL == "" || strings.HasPrefix(repo.URL, "-") {
+		return fmt.Errorf("invalid repository url")
+	}
+	if strings.HasPrefix(repo.Branch, "-") || !branchPattern.MatchString(repo.Branch) {
+		return fmt.Errorf("invalid branch name")
+	}
+	if repo.SyncInterval < 0 {
+		return fmt.Errorf("sync_interval must not be negative")
+	}
+	if repo.SyncInterval > 0 && repo.SyncInterval < 60 {
+		return fmt.Errorf("sync_interval must be at least 60 seconds")
+	}
+	return nil
+}
+
+// cleanSubDir normalizes a sub-directory and rejects paths outside the repository
+func cleanSubDir(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return "", nil
+	}
+	if path.IsAbs(dir) {
+		return "", fmt.Errorf("sub_dir must be a relative path")
+	}
+	dir = path.Clean(dir)
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		return "", fmt.Errorf("sub_dir must stay inside the repository")
+	}
+	if dir == "." {
+		return "", nil
+	}
+	return dir, nil
+}
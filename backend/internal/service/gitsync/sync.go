@@ -0,0 +1,467 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+	"github.com/kkops/backend/internal/service/task"
+)
+
+// syncTimeout 单次同步（拉取 + 写库）的超时时间
+const syncTimeout = 5 * time.Minute
+
+// Report item actions
+const (
+	ActionCreate    = "create"    // 新建
+	ActionUpdate    = "update"    // 内容变更（或接管同名对象）
+	ActionUnchanged = "unchanged" // 与仓库一致
+	ActionConflict  = "conflict"  // 存在同名的未托管对象或被其他仓库托管
+	ActionDetach    = "detach"    // 已从仓库删除，解除托管但保留数据
+	ActionError     = "error"     // 文件无法解析或引用无效
+)
+
+// errDryRun rolls back the dry-run transaction after the report is built
+var errDryRun = errors.New("dry run")
+
+// ReportItem describes what a sync did (or would do) to one template or module
+type ReportItem struct {
+	Kind   string `json:"kind"` // template, module
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SyncReport is the drift report of a sync run
+type SyncReport struct {
+	RepositoryID uint           `json:"repository_id"`
+	Commit       string         `json:"commit"`
+	DryRun       bool           `json:"dry_run"`
+	Status       string         `json:"status"` // success, partial, failed
+	Error        string         `json:"error,omitempty"`
+	Summary      map[string]int `json:"summary"` // action -> count
+	Items        []ReportItem   `json:"items"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+}
+
+func (r *SyncReport) add(kind, name, path, action, detail string) {
+	r.Items = append(r.Items, ReportItem{Kind: kind, Name: name, Path: path, Action: action, Detail: detail})
+	r.Summary[action]++
+}
+
+// GetLastReport returns the report of the last non dry-run sync
+func (s *Service) GetLastReport(id uint) (*SyncReport, error) {
+	var repo model.GitRepository
+	if err := s.db.First(&repo, id).Error; err != nil {
+		return nil, err
+	}
+	if repo.LastReport == "" {
+		return nil, fmt.Errorf("repository has not been synced yet")
+	}
+
+	var report SyncReport
+	if err := json.Unmarshal([]byte(repo.LastReport), &report); err != nil {
+		return nil, fmt.Errorf("failed to decode sync report: %w", err)
+	}
+	return &report, nil
+}
+
+// Sync pulls the repository and upserts its templates and modules. With dryRun the
+// changes are computed inside a transaction that is rolled back, so the report shows
+// the drift between the database and the repository without applying it.
+func (s *Service) Sync(id uint, dryRun bool) (*SyncReport, error) {
+	s.mu.Lock()
+	if s.running[id] {
+		s.mu.Unlock()
+		return nil, ErrSyncInProgress
+	}
+	s.running[id] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	var repo model.GitRepository
+	if err := s.db.First(&repo, id).Error; err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{
+		RepositoryID: repo.ID,
+		DryRun:       dryRun,
+		Summary:      make(map[string]int),
+		Items:        []ReportItem{},
+		StartedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	root, commit, err := s.checkout(ctx, &repo)
+	if err == nil {
+		report.Commit = commit
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := s.apply(tx, &repo, root, report); err != nil {
+				return err
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	switch {
+	case err != nil:
+		report.Status = "failed"
+		report.Error = err.Error()
+	case report.Summary[ActionConflict] > 0 || report.Summary[ActionError] > 0:
+		report.Status = "partial"
+	default:
+		report.Status = "success"
+	}
+
+	if !dryRun {
+		data, _ := json.Marshal(report)
+		updates := map[string]interface{}{
+			"last_sync_at": report.FinishedAt,
+			"last_status":  report.Status,
+			"last_error":   report.Error,
+			"last_report":  string(data),
+		}
+		if report.Commit != "" {
+			updates["last_commit"] = report.Commit
+		}
+		if err := s.db.Model(&repo).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// apply upserts the repository content inside tx and records every decision in report
+func (s *Service) apply(tx *gorm.DB, repo *model.GitRepository, root string, report *SyncReport) error {
+	templates, modules, parseErrs := loadLayout(root)
+	for _, pe := range parseErrs {
+		kind := "template"
+		if strings.HasPrefix(pe.Path, modulesDir+"/") {
+			kind = "module"
+		}
+		report.add(kind, "", pe.Path, ActionError, pe.Err.Error())
+	}
+
+	note := "synced from git " + shortCommit(report.Commit)
+
+	// 模板优先同步，模块可以按名称引用同一次同步中新建的模板
+	seen := make(map[string]bool)
+	for _, spec := range templates {
+		seen[spec.Path] = true
+		action, detail, err := s.applyTemplate(tx, repo, &spec, note)
+		if err != nil {
+			return err
+		}
+		report.add("template", spec.Name, spec.Path, action, detail)
+	}
+	// 解析失败的文件保持托管状态，避免因一次错误提交而解除托管
+	for _, pe := range parseErrs {
+		seen[pe.Path] = true
+	}
+
+	var managedTemplates []model.TaskTemplate
+	if err := tx.Where("git_repository_id = ?", repo.ID).Find(&managedTemplates).Error; err != nil {
+		return err
+	}
+	for _, t := range managedTemplates {
+		if seen[t.GitPath] {
+			continue
+		}
+		if err := tx.Model(&t).Updates(map[string]interface{}{"git_repository_id": nil, "git_path": ""}).Error; err != nil {
+			return err
+		}
+		report.add("template", t.Name, t.GitPath, ActionDetach, "file removed from repository")
+	}
+
+	for _, spec := range modules {
+		seen[spec.Path] = true
+		action, detail, err := s.applyModule(tx, repo, &spec)
+		if err != nil {
+			return err
+		}
+		report.add("module", spec.Name, spec.Path, action, detail)
+	}
+
+	var managedModules []model.DeploymentModule
+	if err := tx.Where("git_repository_id = ?", repo.ID).Find(&managedModules).Error; err != nil {
+		return err
+	}
+	for _, m := range managedModules {
+		if seen[m.GitPath] {
+			continue
+		}
+		if err := tx.Model(&m).Updates(map[string]interface{}{"git_repository_id": nil, "git_path": ""}).Error; err != nil {
+			return err
+		}
+		report.add("module", m.Name, m.GitPath, ActionDetach, "file removed from repository")
+	}
+
+	return nil
+}
+
+// applyTemplate creates or updates one template; database errors abort the sync
+func (s *Service) applyTemplate(tx *gorm.DB, repo *model.GitRepository, spec *templateSpec, note string) (string, string, error) {
+	var template model.TaskTemplate
+	err := tx.Where("git_repository_id = ? AND git_path = ?", repo.ID, spec.Path).First(&template).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
+	}
+
+	adopted := false
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var existing model.TaskTemplate
+		err := tx.Where("name = ?", spec.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			if existing.GitRepositoryID != nil {
+				return ActionConflict, fmt.Sprintf("template %q is managed by git repository %d", spec.Name, *existing.GitRepositoryID), nil
+			}
+			if !repo.AdoptExisting {
+				return ActionConflict, fmt.Sprintf("unmanaged template %q already exists", spec.Name), nil
+			}
+			template = existing
+			adopted = true
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			template = model.TaskTemplate{
+				Name:            spec.Name,
+				Description:     spec.Description,
+				Content:         spec.Content,
+				Type:            spec.Type,
+				GitRepositoryID: &repo.ID,
+				GitPath:         spec.Path,
+				CreatedBy:       repo.CreatedBy,
+			}
+			if err := tx.Create(&template).Error; err != nil {
+				return "", "", err
+			}
+			if err := task.SaveTemplateVersion(tx, &template, repo.CreatedBy, note); err != nil {
+				return "", "", err
+			}
+			return ActionCreate, "", nil
+		default:
+			return "", "", err
+		}
+	}
+
+	changed := template.Name != spec.Name || template.Description != spec.Description ||
+		template.Content != spec.Content || template.Type != spec.Type
+
+	template.Name = spec.Name
+	template.Description = spec.Description
+	template.Content = spec.Content
+	template.Type = spec.Type
+	template.GitRepositoryID = &repo.ID
+	template.GitPath = spec.Path
+
+	if changed {
+		if err := task.SaveTemplateVersion(tx, &template, repo.CreatedBy, note); err != nil {
+			return "", "", err
+		}
+	} else if adopted {
+		if err := tx.Save(&template).Error; err != nil {
+			return "", "", err
+		}
+	} else {
+		return ActionUnchanged, "", nil
+	}
+
+	if adopted {
+		return ActionUpdate, "adopted existing template", nil
+	}
+	return ActionUpdate, fmt.Sprintf("new version %d", template.LatestVersion), nil
+}
+
+// applyModule creates or updates one deployment module; invalid references are
+// reported as errors, database errors abort the sync
+func (s *Service) applyModule(tx *gorm.DB, repo *model.GitRepository, spec *moduleSpec) (string, string, error) {
+	var project model.Project
+	if err := tx.Where("name = ?", spec.Project).First(&project).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ActionError, fmt.Sprintf("project %q not found", spec.Project), nil
+		}
+		return "", "", err
+	}
+
+	var environmentID *uint
+	if spec.Environment != "" {
+		var environment model.Environment
+		if err := tx.Where("name = ?", spec.Environment).First(&environment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ActionError, fmt.Sprintf("environment %q not found", spec.Environment), nil
+			}
+			return "", "", err
+		}
+		environmentID = &environment.ID
+	}
+
+	deployScript := spec.DeployScript
+	scriptType := spec.ScriptType
+	var templateID *uint
+	if spec.Template != "" {
+		// 优先使用本仓库托管的同名模板
+		var template model.TaskTemplate
+		err := tx.Where("name = ? AND git_repository_id = ?", spec.Template, repo.ID).First(&template).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = tx.Where("name = ?", spec.Template).First(&template).Error
+		}
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ActionError, fmt.Sprintf("template %q not found", spec.Template), nil
+			}
+			return "", "", err
+		}
+		templateID = &template.ID
+		if deployScript == "" {
+			deployScript = template.Content
+			scriptType = template.Type
+		}
+	}
+	if err := task.ValidateTemplateVersion(tx, templateID, spec.TemplateVersion); err != nil {
+		return ActionError, err.Error(), nil
+	}
+
+	assetIDs, missing, err := resolveHosts(tx, spec.TargetHosts)
+	if err != nil {
+		return "", "", err
+	}
+	if len(missing) > 0 {
+		return ActionError, "target hosts not found: " + strings.Join(missing, ", "), nil
+	}
+
+	settings := spec.Settings
+	if len(spec.CanaryHosts) > 0 {
+		if settings.Canary == nil {
+			return ActionError, "canary_hosts requires a canary section", nil
+		}
+		canaryIDs, missing, err := resolveHosts(tx, spec.CanaryHosts)
+		if err != nil {
+			return "", "", err
+		}
+		if len(missing) > 0 {
+			return ActionError, "canary hosts not found: " + strings.Join(missing, ", "), nil
+		}
+		canary := *settings.Canary
+		canary.AssetIDs = canaryIDs
+		settings.Canary = &canary
+	}
+
+	var module model.DeploymentModule
+	err = tx.Where("git_repository_id = ? AND git_path = ?", repo.ID, spec.Path).First(&module).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
+	}
+
+	action := ActionUpdate
+	detail := ""
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var existing model.DeploymentModule
+		err := tx.Where("name = ? AND project_id = ?", spec.Name, project.ID).First(&existing).Error
+		switch {
+		case err == nil:
+			if existing.GitRepositoryID != nil {
+				return ActionConflict, fmt.Sprintf("module %q is managed by git repository %d", spec.Name, *existing.GitRepositoryID), nil
+			}
+			if !repo.AdoptExisting {
+				return ActionConflict, fmt.Sprintf("unmanaged module %q already exists in project %q", spec.Name, spec.Project), nil
+			}
+			module = existing
+			detail = "adopted existing module"
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			action = ActionCreate
+			module.CreatedBy = repo.CreatedBy
+		default:
+			return "", "", err
+		}
+	}
+
+	before := module
+	module.Name = spec.Name
+	module.Description = spec.Description
+	module.ProjectID = project.ID
+	module.EnvironmentID = environmentID
+	module.TemplateID = templateID
+	module.TemplateVersion = spec.TemplateVersion
+	module.DeployScript = deployScript
+	module.ScriptType = scriptType
+	module.Timeout = spec.Timeout
+	module.AssetIDs = joinIDs(assetIDs)
+	module.GitRepositoryID = &repo.ID
+	module.GitPath = spec.Path
+	if err := deployment.ApplySettings(&module, &settings, spec.VersionSourceURL); err != nil {
+		return ActionError, err.Error(), nil
+	}
+	if action == ActionUpdate && detail == "" && reflect.DeepEqual(before, module) {
+		return ActionUnchanged, "", nil
+	}
+
+	if err := tx.Save(&module).Error; err != nil {
+		return "", "", err
+	}
+	return action, detail, nil
+}
+
+// resolveHosts maps host names or IPs to asset IDs
+func resolveHosts(tx *gorm.DB, hosts []string) ([]uint, []string, error) {
+	ids := make([]uint, 0, len(hosts))
+	var missing []string
+	for _, host := range hosts {
+		var asset model.Asset
+		err := tx.Where("host_name = ? OR ip = ?", host, host).First(&asset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			missing = append(missing, host)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, asset.ID)
+	}
+	return ids, missing, nil
+}
+
+// joinIDs formats asset IDs as the comma-separated list stored on modules
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
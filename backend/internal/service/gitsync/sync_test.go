@@ -0,0 +1,357 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package gitsync
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+)
+
+// testRepo is a bare repository with a working clone used to push fixtures
+type testRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	r := &testRepo{t: t, bare: filepath.Join(dir, "remote.git"), work: filepath.Join(dir, "work")}
+	r.git(dir, "init", "--quiet", "--bare", r.bare)
+	r.git(dir, "init", "--quiet", r.work)
+	return r
+}
+
+func (r *testRepo) git(dir string, args ...string) {
+	r.t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if _, err := runGit(context.Background(), dir, args...); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) write(path, content string) {
+	r.t.Helper()
+	full := filepath.Join(r.work, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) remove(path string) {
+	r.t.Helper()
+	if err := os.Remove(filepath.Join(r.work, path)); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) push(message string) {
+	r.t.Helper()
+	r.git(r.work, "add", "-A")
+	r.git(r.work, "commit", "--quiet", "-m", message)
+	r.git(r.work, "push", "--quiet", "--force", r.bare, "HEAD:main")
+}
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&model.User{},
+		&model.Project{},
+		&model.Environment{},
+		&model.Asset{},
+		&model.TaskTemplate{},
+		&model.TaskTemplateVersion{},
+		&model.DeploymentModule{},
+		&model.GitRepository{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Storage.GitDir = t.TempDir()
+	return NewService(db, cfg, zap.NewNop()), db
+}
+
+// actions indexes report items by kind/name
+func actions(report *SyncReport) map[string]string {
+	result := make(map[string]string)
+	for _, item := range report.Items {
+		key := item.Kind + "/" + item.Name
+		if item.Name == "" {
+			key = item.Kind + "/" + item.Path
+		}
+		result[key] = item.Action
+	}
+	return result
+}
+
+func expectActions(t *testing.T, report *SyncReport, want map[string]string) {
+	t.Helper()
+	got := actions(report)
+	for key, action := range want {
+		if got[key] != action {
+			t.Errorf("%s: action = %q, want %q (report: %+v)", key, got[key], action, report.Items)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	repo := newTestRepo(t)
+	svc, db := newTestService(t)
+
+	db.Create(&model.Project{Name: "demo"})
+	db.Create(&model.Asset{HostName: "web-1", IP: "10.0.0.1"})
+	// 未托管的同名模板，不接管时应报告冲突
+	db.Create(&model.TaskTemplate{Name: "backup", Content: "echo local", Type: "shell"})
+
+	repo.write("templates/deploy.sh", "#!/bin/bash\n# description: deploy app\necho v1\n")
+	repo.write("templates/backup.sh", "echo repo\n")
+	repo.write("modules/web.yaml", "name: web\nproject: demo\ntemplate: deploy\ntarget_hosts: [web-1]\n")
+	repo.write("modules/api.yaml", "name: api\nproject: demo\ndeploy_script: echo api\n")
+	repo.push("initial")
+
+	gitRepo := model.GitRepository{Name: "ops", URL: repo.bare, Branch: "main"}
+	if err := db.Create(&gitRepo).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 预览不写库
+	report, err := svc.Sync(gitRepo.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != "partial" {
+		t.Fatalf("dry run status = %q (%s)", report.Status, report.Error)
+	}
+	expectActions(t, report, map[string]string{
+		"template/deploy": ActionCreate,
+		"template/backup": ActionConflict,
+		"module/web":      ActionCreate,
+		"module/api":      ActionCreate,
+	})
+	var count int64
+	db.Model(&model.DeploymentModule{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("dry run created %d modules", count)
+	}
+	db.Model(&model.TaskTemplate{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("dry run created templates, count = %d", count)
+	}
+
+	report, err = svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{
+		"template/deploy": ActionCreate,
+		"template/backup": ActionConflict,
+		"module/web":      ActionCreate,
+		"module/api":      ActionCreate,
+	})
+
+	var web model.DeploymentModule
+	if err := db.Where("name = ?", "web").First(&web).Error; err != nil {
+		t.Fatal(err)
+	}
+	if web.GitRepositoryID == nil || *web.GitRepositoryID != gitRepo.ID || web.GitPath != "modules/web.yaml" {
+		t.Errorf("web module not managed by the repository: %+v", web)
+	}
+	if !strings.Contains(web.DeployScript, "echo v1") {
+		t.Errorf("web deploy script = %q", web.DeployScript)
+	}
+
+	// 无变化时再次同步
+	report, err = svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{
+		"template/deploy": ActionUnchanged,
+		"module/web":      ActionUnchanged,
+		"module/api":      ActionUnchanged,
+	})
+
+	repo.write("templates/deploy.sh", "#!/bin/bash\n# description: deploy app\necho v2\n")
+	repo.remove("modules/api.yaml")
+	repo.push("update deploy, remove api")
+
+	report, err = svc.Sync(gitRepo.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{
+		"template/deploy": ActionUpdate,
+		"module/web":      ActionUpdate,
+		"module/api":      ActionDetach,
+	})
+	var api model.DeploymentModule
+	db.Where("name = ?", "api").First(&api)
+	if api.GitRepositoryID == nil {
+		t.Fatal("dry run detached the api module")
+	}
+
+	report, err = svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{
+		"template/deploy": ActionUpdate,
+		"module/web":      ActionUpdate,
+		"module/api":      ActionDetach,
+	})
+
+	var deploy model.TaskTemplate
+	db.Where("name = ?", "deploy").First(&deploy)
+	if deploy.LatestVersion != 2 || !strings.Contains(deploy.Content, "echo v2") {
+		t.Errorf("deploy template = version %d %q", deploy.LatestVersion, deploy.Content)
+	}
+	api = model.DeploymentModule{}
+	db.Where("name = ?", "api").First(&api)
+	if api.ID == 0 || api.GitRepositoryID != nil || api.GitPath != "" {
+		t.Errorf("api module should be kept and detached: %+v", api)
+	}
+}
+
+func TestSyncRejectsSymlinkEscape(t *testing.T) {
+	repo := newTestRepo(t)
+	svc, db := newTestService(t)
+	db.Create(&model.Project{Name: "demo"})
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "passwd"), []byte("root:x:0:0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(repo.work, "link")); err != nil {
+		t.Fatal(err)
+	}
+	repo.write("modules/evil.yaml", "name: evil\nproject: demo\ndeploy_script_file: link/passwd\n")
+	repo.push("symlink")
+
+	gitRepo := model.GitRepository{Name: "ops", URL: repo.bare, Branch: "main"}
+	db.Create(&gitRepo)
+
+	report, err := svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{"module/modules/evil.yaml": ActionError})
+
+	var count int64
+	db.Model(&model.DeploymentModule{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("module with escaping script file was created")
+	}
+}
+
+func TestSyncModuleSettings(t *testing.T) {
+	repo := newTestRepo(t)
+	svc, db := newTestService(t)
+
+	db.Create(&model.Project{Name: "demo"})
+	web1 := model.Asset{HostName: "web-1", IP: "10.0.0.1"}
+	db.Create(&web1)
+	db.Create(&model.Asset{HostName: "web-2", IP: "10.0.0.2"})
+
+	repo.write("modules/web.yaml", `name: web
+project: demo
+deploy_script: echo deploy
+target_hosts: [web-1, web-2]
+canary_hosts: [web-1]
+rollout:
+  batch_size: 1
+  manual_gate: true
+canary:
+  enabled: true
+  soak_seconds: 60
+hooks:
+  host_check:
+    type: http
+    url: http://${IP}:8080/health
+    retries: 2
+lock:
+  scope: asset
+  queue: true
+`)
+	// 启用金丝雀但没有主机健康检查
+	repo.write("modules/api.yaml", "name: api\nproject: demo\ndeploy_script: echo api\ncanary:\n  enabled: true\n  asset_ids: [1]\n")
+	repo.push("settings")
+
+	gitRepo := model.GitRepository{Name: "ops", URL: repo.bare, Branch: "main"}
+	db.Create(&gitRepo)
+
+	report, err := svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{
+		"module/web": ActionCreate,
+		"module/api": ActionError,
+	})
+
+	var web model.DeploymentModule
+	if err := db.Where("name = ?", "web").First(&web).Error; err != nil {
+		t.Fatal(err)
+	}
+	if web.RolloutBatchSize != 1 || !web.RolloutManualGate {
+		t.Errorf("rollout not applied: %+v", web)
+	}
+	if !web.CanaryEnabled || web.CanarySoakSeconds != 60 || web.CanaryAssetIDs != strconv.FormatUint(uint64(web1.ID), 10) {
+		t.Errorf("canary not applied: enabled %v, soak %d, hosts %q", web.CanaryEnabled, web.CanarySoakSeconds, web.CanaryAssetIDs)
+	}
+	if web.HostCheckType != "http" || web.HostCheckURL != "http://${IP}:8080/health" || web.HostCheckRetries != 2 {
+		t.Errorf("host check not applied: %q %q %d", web.HostCheckType, web.HostCheckURL, web.HostCheckRetries)
+	}
+	if web.LockScope != "asset" || !web.LockQueue {
+		t.Errorf("lock not applied: %q %v", web.LockScope, web.LockQueue)
+	}
+
+	report, err = svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{"module/web": ActionUnchanged})
+
+	// 删除的配置段恢复默认值
+	repo.write("modules/web.yaml", "name: web\nproject: demo\ndeploy_script: echo deploy\ntarget_hosts: [web-1, web-2]\n")
+	repo.push("drop settings")
+	report, err = svc.Sync(gitRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, report, map[string]string{"module/web": ActionUpdate})
+
+	web = model.DeploymentModule{}
+	db.Where("name = ?", "web").First(&web)
+	if web.CanaryEnabled || web.RolloutManualGate || web.HostCheckType != "" || web.LockScope != "" || web.LockQueue {
+		t.Errorf("settings not reset: %+v", web)
+	}
+}
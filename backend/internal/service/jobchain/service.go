@@ -0,0 +1,559 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package jobchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+	"github.com/kkops/backend/internal/service/scheduledtask"
+	"github.com/kkops/backend/internal/service/task"
+)
+
+// Link conditions
+const (
+	ConditionSuccess = "success" // 上游成功时触发
+	ConditionFailure = "failure" // 上游失败（含部分失败）时触发
+	ConditionAlways  = "always"  // 上游结束即触发（含取消）
+)
+
+// maxChainDepth 单条链路允许的最大深度，防止链路配置意外形成无限循环
+const maxChainDepth = 10
+
+// ErrLinkNotFound is returned when a chain link does not exist
+var ErrLinkNotFound = errors.New("job chain link not found")
+
+// Service manages job chain links and starts downstream jobs when upstream jobs finish
+type Service struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	executionSvc  *task.ExecutionService
+	deploymentSvc *deployment.Service
+	scheduler     *scheduledtask.Scheduler
+}
+
+// NewService creates a new job chain service
+func NewService(db *gorm.DB, logger *zap.Logger, executionSvc *task.ExecutionService, deploymentSvc *deployment.Service, scheduler *scheduledtask.Scheduler) *Service {
+	return &Service{
+		db:            db,
+		logger:        logger,
+		executionSvc:  executionSvc,
+		deploymentSvc: deploymentSvc,
+		scheduler:     scheduler,
+	}
+}
+
+// CreateLinkRequest represents a request to create a chain link
+type CreateLinkRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Description   string `json:"description"`
+	SourceType    string `json:"source_type" binding:"required,oneof=task scheduled_task deployment"`
+	SourceID      uint   `json:"source_id" binding:"required"`
+	Condition     string `json:"condition" binding:"omitempty,oneof=success failure always"` // 默认 success
+	TargetType    string `json:"target_type" binding:"required,oneof=task scheduled_task deployment"`
+	TargetID      uint   `json:"target_id" binding:"required"`
+	TargetVersion string `json:"target_version"` // 下游为部署时的版本，为空时沿用上游的部署版本
+	Enabled       *bool  `json:"enabled"`        // 默认启用
+}
+
+// UpdateLinkRequest represents a request to update a chain link
+type UpdateLinkRequest struct {
+	Name          string  `json:"name"`
+	Description   *string `json:"description"`
+	Condition     string  `json:"condition" binding:"omitempty,oneof=success failure always"`
+	TargetVersion *string `json:"target_version"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// LinkResponse represents a chain link response
+type LinkResponse struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	SourceType    string    `json:"source_type"`
+	SourceID      uint      `json:"source_id"`
+	SourceName    string    `json:"source_name"`
+	Condition     string    `json:"condition"`
+	TargetType    string    `json:"target_type"`
+	TargetID      uint      `json:"target_id"`
+	TargetName    string    `json:"target_name"`
+	TargetVersion string    `json:"target_version"`
+	Enabled       bool      `json:"enabled"`
+	CreatedBy     uint      `json:"created_by"`
+	CreatorName   string    `json:"creator_name"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RunResponse represents a chain run in execution history
+type RunResponse struct {
+	ID            uint      `json:"id"`
+	LinkID        uint      `json:"link_id"`
+	LinkName      string    `json:"link_name"`
+	ParentRunID   *uint     `json:"parent_run_id,omitempty"`
+	Depth         int       `json:"depth"`
+	SourceType    string    `json:"source_type"`
+	SourceID      uint      `json:"source_id"`
+	SourceName    string    `json:"source_name"`
+	SourceRunID   uint      `json:"source_run_id,omitempty"`
+	SourceStatus  string    `json:"source_status"`
+	SourceVersion string    `json:"source_version,omitempty"`
+	FailedHosts   []string  `json:"failed_hosts"`
+	TargetType    string    `json:"target_type"`
+	TargetID      uint      `json:"target_id"`
+	TargetName    string    `json:"target_name"`
+	DeploymentID  *uint     `json:"deployment_id,omitempty"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LineageResponse shows where a chain run sits in its chain
+type LineageResponse struct {
+	Chain      []RunResponse `json:"chain"`      // 从链路起点到当前记录（含当前记录）
+	Downstream []RunResponse `json:"downstream"` // 当前记录触发的下游作业又触发的链路记录
+}
+
+// ListRunsFilter filters chain run history
+type ListRunsFilter struct {
+	LinkID     uint
+	SourceType string
+	SourceID   uint
+	TargetType string
+	TargetID   uint
+	Page       int
+	PageSize   int
+}
+
+// CreateLink creates a chain link after checking both jobs exist and the link does not form a cycle
+func (s *Service) CreateLink(userID uint, req *CreateLinkRequest) (*LinkResponse, error) {
+	if err := s.checkJob(req.SourceType, req.SourceID); err != nil {
+		return nil, err
+	}
+	if err := s.checkJob(req.TargetType, req.TargetID); err != nil {
+		return nil, err
+	}
+	if err := s.checkCycle(req.SourceType, req.SourceID, req.TargetType, req.TargetID); err != nil {
+		return nil, err
+	}
+
+	condition := req.Condition
+	if condition == "" {
+		condition = ConditionSuccess
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	link := model.JobChainLink{
+		Name:          req.Name,
+		Description:   req.Description,
+		SourceType:    req.SourceType,
+		SourceID:      req.SourceID,
+		Condition:     condition,
+		TargetType:    req.TargetType,
+		TargetID:      req.TargetID,
+		TargetVersion: strings.TrimSpace(req.TargetVersion),
+		Enabled:       enabled,
+		CreatedBy:     userID,
+	}
+	if err := s.db.Create(&link).Error; err != nil {
+		return nil, err
+	}
+	return s.GetLink(link.ID)
+}
+
+// GetLink retrieves a chain link by ID
+func (s *Service) GetLink(id uint) (*LinkResponse, error) {
+	var link model.JobChainLink
+	if err := s.db.Preload("Creator").First(&link, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLinkNotFound
+		}
+		return nil, err
+	}
+	return s.linkToResponse(&link), nil
+}
+
+// ListLinks lists chain links, optionally filtered by source or target job
+func (s *Service) ListLinks(sourceType string, sourceID uint, targetType string, targetID uint) ([]LinkResponse, error) {
+	query := s.db.Preload("Creator").Order("id DESC")
+	if sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+	if sourceID > 0 {
+		query = query.Where("source_id = ?", sourceID)
+	}
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID > 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var links []model.JobChainLink
+	if err := query.Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]LinkResponse, len(links))
+	for i := range links {
+		result[i] = *s.linkToResponse(&links[i])
+	}
+	return result, nil
+}
+
+// UpdateLink updates a chain link's name, condition, target version or enabled state
+func (s *Service) UpdateLink(id uint, req *UpdateLinkRequest) (*LinkResponse, error) {
+	var link model.JobChainLink
+	if err := s.db.First(&link, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLinkNotFound
+		}
+		return nil, err
+	}
+
+	if req.Name != "" {
+		link.Name = req.Name
+	}
+	if req.Description != nil {
+		link.Description = *req.Description
+	}
+	if req.Condition != "" {
+		link.Condition = req.Condition
+	}
+	if req.TargetVersion != nil {
+		link.TargetVersion = strings.TrimSpace(*req.TargetVersion)
+	}
+	if req.Enabled != nil {
+		link.Enabled = *req.Enabled
+	}
+
+	if err := s.db.Save(&link).Error; err != nil {
+		return nil, err
+	}
+	return s.GetLink(id)
+}
+
+// DeleteLink deletes a chain link; its run history is kept
+func (s *Service) DeleteLink(id uint) error {
+	return s.db.Delete(&model.JobChainLink{}, id).Error
+}
+
+// ListRuns lists chain run history, newest first
+func (s *Service) ListRuns(filter ListRunsFilter) ([]RunResponse, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	query := s.db.Model(&model.JobChainRun{})
+	if filter.LinkID > 0 {
+		query = query.Where("link_id = ?", filter.LinkID)
+	}
+	if filter.SourceType != "" {
+		query = query.Where("source_type = ?", filter.SourceType)
+	}
+	if filter.SourceID > 0 {
+		query = query.Where("source_id = ?", filter.SourceID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []model.JobChainRun
+	if err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return s.runsToResponse(runs), total, nil
+}
+
+// GetLineage returns the chain from its first upstream job to the given run, and the runs it led to
+func (s *Service) GetLineage(runID uint) (*LineageResponse, error) {
+	var run model.JobChainRun
+	if err := s.db.First(&run, runID).Error; err != nil {
+		return nil, err
+	}
+
+	chain := []model.JobChainRun{run}
+	for current := run; current.ParentRunID != nil && len(chain) <= maxChainDepth; {
+		var parent model.JobChainRun
+		if err := s.db.First(&parent, *current.ParentRunID).Error; err != nil {
+			break
+		}
+		chain = append([]model.JobChainRun{parent}, chain...)
+		current = parent
+	}
+
+	var downstream []model.JobChainRun
+	if err := s.db.Where("parent_run_id = ?", run.ID).Order("id").Find(&downstream).Error; err != nil {
+		return nil, err
+	}
+
+	return &LineageResponse{
+		Chain:      s.runsToResponse(chain),
+		Downstream: s.runsToResponse(downstream),
+	}, nil
+}
+
+// OnJobFinished starts the downstream jobs of every enabled link whose condition
+// matches the finished job. It is registered as the completion hook of the task,
+// deployment and scheduled task services.
+func (s *Service) OnJobFinished(result task.JobResult) {
+	var links []model.JobChainLink
+	if err := s.db.Where("source_type = ? AND source_id = ? AND enabled = ?", result.JobType, result.JobID, true).
+		Order("id").Find(&links).Error; err != nil {
+		s.logger.Error("查询作业链失败", zap.String("job_type", result.JobType), zap.Uint("job_id", result.JobID), zap.Error(err))
+		return
+	}
+
+	depth := 1
+	if result.ChainRunID != nil {
+		var parent model.JobChainRun
+		if err := s.db.Select("id, depth").First(&parent, *result.ChainRunID).Error; err == nil {
+			depth = parent.Depth + 1
+		}
+	}
+
+	for i := range links {
+		link := &links[i]
+		if !conditionMatches(link.Condition, result.Status) {
+			continue
+		}
+
+		run := model.JobChainRun{
+			LinkID:        link.ID,
+			ParentRunID:   result.ChainRunID,
+			Depth:         depth,
+			SourceType:    result.JobType,
+			SourceID:      result.JobID,
+			SourceRunID:   result.RunID,
+			SourceStatus:  result.Status,
+			SourceVersion: result.Version,
+			FailedHosts:   strings.Join(result.FailedHosts, ","),
+			TargetType:    link.TargetType,
+			TargetID:      link.TargetID,
+			Status:        "started",
+		}
+		if depth > maxChainDepth {
+			run.Status = "skipped"
+			run.Error = fmt.Sprintf("超过作业链最大深度 %d", maxChainDepth)
+		}
+		if err := s.db.Create(&run).Error; err != nil {
+			s.logger.Error("创建作业链记录失败", zap.Uint("link_id", link.ID), zap.Error(err))
+			continue
+		}
+		if run.Status == "skipped" {
+			continue
+		}
+
+		if err := s.startTarget(link, &run); err != nil {
+			run.Status = "failed"
+			run.Error = err.Error()
+			s.logger.Warn("作业链下游作业启动失败",
+				zap.Uint("link_id", link.ID),
+				zap.Uint("chain_run_id", run.ID),
+				zap.Error(err))
+		}
+		s.db.Save(&run)
+	}
+}
+
+// startTarget starts the downstream job of a link for the given chain run
+func (s *Service) startTarget(link *model.JobChainLink, run *model.JobChainRun) error {
+	switch link.TargetType {
+	case task.JobTask:
+		return s.executionSvc.ExecuteTaskWithOptions(link.TargetID, task.ExecuteOptions{
+			ExecutionType: "async",
+			TriggerType:   "chain",
+			ChainRunID:    &run.ID,
+		})
+	case task.JobScheduledTask:
+		return s.scheduler.RunChained(link.TargetID, run.ID)
+	case task.JobDeployment:
+		version := link.TargetVersion
+		if version == "" {
+			version = run.SourceVersion
+		}
+		if version == "" {
+			return errors.New("no version to deploy: set target_version on the link or chain it after a deployment")
+		}
+		resp, err := s.deploymentSvc.Deploy(link.TargetID, &deployment.DeployRequest{
+			Version:     version,
+			TriggerType: "chain",
+			ChainRunID:  &run.ID,
+		}, link.CreatedBy)
+		if err != nil {
+			return err
+		}
+		run.DeploymentID = &resp.ID
+		return nil
+	default:
+		return fmt.Errorf("unsupported target type: %s", link.TargetType)
+	}
+}
+
+// conditionMatches reports whether a link condition matches an upstream status
+func conditionMatches(condition, status string) bool {
+	switch condition {
+	case ConditionAlways:
+		return true
+	case ConditionFailure:
+		return status == "failed" || status == "partial"
+	default:
+		return status == "success"
+	}
+}
+
+// checkJob verifies that a job referenced by a link exists
+func (s *Service) checkJob(jobType string, id uint) error {
+	switch jobType {
+	case task.JobTask:
+		if err := s.db.Select("id").First(&model.Task{}, id).Error; err != nil {
+			return errors.New("task not found")
+		}
+	case task.JobScheduledTask:
+		if err := s.db.Select("id").First(&model.ScheduledTask{}, id).Error; err != nil {
+			return errors.New("scheduled task not found")
+		}
+	case task.JobDeployment:
+		if err := s.db.Select("id").First(&model.DeploymentModule{}, id).Error; err != nil {
+			return errors.New("deployment module not found")
+		}
+	default:
+		return fmt.Errorf("unsupported job type: %s", jobType)
+	}
+	return nil
+}
+
+// checkCycle rejects a new link when the target job can already reach the source job
+func (s *Service) checkCycle(sourceType string, sourceID uint, targetType string, targetID uint) error {
+	type node struct {
+		jobType string
+		id      uint
+	}
+	source := node{sourceType, sourceID}
+	queue := []node{{targetType, targetID}}
+	visited := map[node]bool{}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == source {
+			return errors.New("link would create a cycle in the job chain")
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		var links []model.JobChainLink
+		if err := s.db.Select("target_type, target_id").
+			Where("source_type = ? AND source_id = ?", current.jobType, current.id).
+			Find(&links).Error; err != nil {
+			return err
+		}
+		for _, l := range links {
+			queue = append(queue, node{l.TargetType, l.TargetID})
+		}
+	}
+	return nil
+}
+
+// jobName returns the display name of a job, or an empty string when it no longer exists
+func (s *Service) jobName(jobType string, id uint) string {
+	var name string
+	switch jobType {
+	case task.JobTask:
+		s.db.Model(&model.Task{}).Where("id = ?", id).Pluck("name", &name)
+	case task.JobScheduledTask:
+		s.db.Model(&model.ScheduledTask{}).Where("id = ?", id).Pluck("name", &name)
+	case task.JobDeployment:
+		s.db.Model(&model.DeploymentModule{}).Where("id = ?", id).Pluck("name", &name)
+	}
+	return name
+}
+
+func (s *Service) linkToResponse(l *model.JobChainLink) *LinkResponse {
+	return &LinkResponse{
+		ID:            l.ID,
+		Name:          l.Name,
+		Description:   l.Description,
+		SourceType:    l.SourceType,
+		SourceID:      l.SourceID,
+		SourceName:    s.jobName(l.SourceType, l.SourceID),
+		Condition:     l.Condition,
+		TargetType:    l.TargetType,
+		TargetID:      l.TargetID,
+		TargetName:    s.jobName(l.TargetType, l.TargetID),
+		TargetVersion: l.TargetVersion,
+		Enabled:       l.Enabled,
+		CreatedBy:     l.CreatedBy,
+		CreatorName:   l.Creator.Username,
+		CreatedAt:     l.CreatedAt,
+		UpdatedAt:     l.UpdatedAt,
+	}
+}
+
+func (s *Service) runsToResponse(runs []model.JobChainRun) []RunResponse {
+	linkNames := map[uint]string{}
+	result := make([]RunResponse, len(runs))
+	for i, r := range runs {
+		name, ok := linkNames[r.LinkID]
+		if !ok {
+			s.db.Unscoped().Model(&model.JobChainLink{}).Where("id = ?", r.LinkID).Pluck("name", &name)
+			linkNames[r.LinkID] = name
+		}
+
+		failedHosts := []string{}
+		if r.FailedHosts != "" {
+			failedHosts = strings.Split(r.FailedHosts, ",")
+		}
+
+		result[i] = RunResponse{
+			ID:            r.ID,
+			LinkID:        r.LinkID,
+			LinkName:      name,
+			ParentRunID:   r.ParentRunID,
+			Depth:         r.Depth,
+			SourceType:    r.SourceType,
+			SourceID:      r.SourceID,
+			SourceName:    s.jobName(r.SourceType, r.SourceID),
+			SourceRunID:   r.SourceRunID,
+			SourceStatus:  r.SourceStatus,
+			SourceVersion: r.SourceVersion,
+			FailedHosts:   failedHosts,
+			TargetType:    r.TargetType,
+			TargetID:      r.TargetID,
+			TargetName:    s.jobName(r.TargetType, r.TargetID),
+			DeploymentID:  r.DeploymentID,
+			Status:        r.Status,
+			Error:         r.Error,
+			CreatedAt:     r.CreatedAt,
+		}
+	}
+	return result
+}
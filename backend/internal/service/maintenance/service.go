@@ -0,0 +1,287 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/authorization"
+)
+
+// Window kinds, scopes and actions
+const (
+	KindBlackout = "blackout" // 窗口开启期间禁止变更
+	KindAllow    = "allow"    // 作用范围内只允许在窗口开启期间变更
+
+	ScopeGlobal      = "global"
+	ScopeEnvironment = "environment"
+	ScopeProject     = "project"
+	ScopeAsset       = "asset"
+
+	ActionReject = "reject" // 定时任务触发被拦截时直接拒绝（默认）
+	ActionDefer  = "defer"  // 定时任务触发被拦截时延后到允许执行的时刻
+)
+
+// Service manages maintenance windows and checks runs against them
+type Service struct {
+	db       *gorm.DB
+	authzSvc *authorization.Service
+}
+
+// NewService creates a new maintenance window service
+func NewService(db *gorm.DB, authzSvc *authorization.Service) *Service {
+	return &Service{db: db, authzSvc: authzSvc}
+}
+
+// CreateWindowRequest represents a request to create a maintenance window
+type CreateWindowRequest struct {
+	Name           string `json:"name" binding:"required"`
+	Description    string `json:"description"`
+	Kind           string `json:"kind" binding:"required,oneof=blackout allow"`
+	CronExpression string `json:"cron_expression" binding:"required"` // 窗口开始时间，6 字段格式
+	Duration       int    `json:"duration" binding:"required,min=1"`  // 分钟
+	Timezone       string `json:"timezone"`
+	ScopeType      string `json:"scope_type" binding:"required,oneof=global environment project asset"`
+	ScopeID        *uint  `json:"scope_id"`
+	Action         string `json:"action" binding:"omitempty,oneof=reject defer"`
+	Enabled        *bool  `json:"enabled"` // 默认启用
+}
+
+// UpdateWindowRequest represents a request to update a maintenance window
+type UpdateWindowRequest struct {
+	Name           string  `json:"name"`
+	Description    *string `json:"description"`
+	Kind           string  `json:"kind" binding:"omitempty,oneof=blackout allow"`
+	CronExpression string  `json:"cron_expression"`
+	Duration       int     `json:"duration" binding:"omitempty,min=1"`
+	Timezone       *string `json:"timezone"`
+	ScopeType      string  `json:"scope_type" binding:"omitempty,oneof=global environment project asset"`
+	ScopeID        *uint   `json:"scope_id"`
+	Action         string  `json:"action" binding:"omitempty,oneof=reject defer"`
+	Enabled        *bool   `json:"enabled"`
+}
+
+// WindowResponse represents a maintenance window response
+type WindowResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Kind           string     `json:"kind"`
+	CronExpression string     `json:"cron_expression"`
+	Duration       int        `json:"duration"`
+	Timezone       string     `json:"timezone"`
+	ScopeType      string     `json:"scope_type"`
+	ScopeID        *uint      `json:"scope_id"`
+	ScopeName      string     `json:"scope_name"`
+	Action         string     `json:"action"`
+	Enabled        bool       `json:"enabled"`
+	Active         bool       `json:"active"`                 // 当前是否处于窗口内
+	ActiveUntil    *time.Time `json:"active_until,omitempty"` // 当前窗口的结束时间
+	NextStart      *time.Time `json:"next_start,omitempty"`   // 下一次开启时间
+	CreatedBy      uint       `json:"created_by"`
+	CreatorName    string     `json:"creator_name"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CreateWindow creates a maintenance window
+func (s *Service) CreateWindow(userID uint, req *CreateWindowRequest) (*WindowResponse, error) {
+	w := model.MaintenanceWindow{
+		Name:           req.Name,
+		Description:    req.Description,
+		Kind:           req.Kind,
+		CronExpression: req.CronExpression,
+		Duration:       req.Duration,
+		Timezone:       req.Timezone,
+		ScopeType:      req.ScopeType,
+		ScopeID:        req.ScopeID,
+		Action:         req.Action,
+		Enabled:        true,
+		CreatedBy:      userID,
+	}
+	if req.Enabled != nil {
+		w.Enabled = *req.Enabled
+	}
+	if w.Action == "" {
+		w.Action = ActionReject
+	}
+	if err := s.validateWindow(&w); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&w).Error; err != nil {
+		return nil, err
+	}
+	return s.GetWindow(w.ID)
+}
+
+// GetWindow retrieves a maintenance window by ID
+func (s *Service) GetWindow(id uint) (*WindowResponse, error) {
+	var w model.MaintenanceWindow
+	if err := s.db.Preload("Creator").First(&w, id).Error; err != nil {
+		return nil, err
+	}
+	return s.windowToResponse(&w), nil
+}
+
+// ListWindows lists maintenance windows, optionally filtered by scope
+func (s *Service) ListWindows(scopeType string, scopeID uint) ([]WindowResponse, error) {
+	query := s.db.Preload("Creator").Order("id DESC")
+	if scopeType != "" {
+		query = query.Where("scope_type = ?", scopeType)
+	}
+	if scopeID > 0 {
+		query = query.Where("scope_id = ?", scopeID)
+	}
+
+	var windows []model.MaintenanceWindow
+	if err := query.Find(&windows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]WindowResponse, len(windows))
+	for i := range windows {
+		result[i] = *s.windowToResponse(&windows[i])
+	}
+	return result, nil
+}
+
+// UpdateWindow updates a maintenance window
+func (s *Service) UpdateWindow(id uint, req *UpdateWindowRequest) (*WindowResponse, error) {
+	var w model.MaintenanceWindow
+	if err := s.db.First(&w, id).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		w.Name = req.Name
+	}
+	if req.Description != nil {
+		w.Description = *req.Description
+	}
+	if req.Kind != "" {
+		w.Kind = req.Kind
+	}
+	if req.CronExpression != "" {
+		w.CronExpression = req.CronExpression
+	}
+	if req.Duration > 0 {
+		w.Duration = req.Duration
+	}
+	if req.Timezone != nil {
+		w.Timezone = *req.Timezone
+	}
+	if req.ScopeType != "" {
+		w.ScopeType = req.ScopeType
+		w.ScopeID = req.ScopeID
+	} else if req.ScopeID != nil {
+		w.ScopeID = req.ScopeID
+	}
+	if req.Action != "" {
+		w.Action = req.Action
+	}
+	if req.Enabled != nil {
+		w.Enabled = *req.Enabled
+	}
+	if err := s.validateWindow(&w); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&w).Error; err != nil {
+		return nil, err
+	}
+	return s.GetWindow(id)
+}
+
+// DeleteWindow deletes a maintenance window
+func (s *Service) DeleteWindow(id uint) error {
+	return s.db.Delete(&model.MaintenanceWindow{}, id).Error
+}
+
+// validateWindow checks the schedule and that the scope target exists
+func (s *Service) validateWindow(w *model.MaintenanceWindow) error {
+	if _, err := parseSchedule(w.CronExpression, w.Timezone); err != nil {
+		return fmt.Errorf("invalid window schedule: %w", err)
+	}
+
+	if w.ScopeType == ScopeGlobal {
+		w.ScopeID = nil
+		return nil
+	}
+	if w.ScopeID == nil || *w.ScopeID == 0 {
+		return fmt.Errorf("scope_id is required for %s scope", w.ScopeType)
+	}
+
+	var target interface{}
+	switch w.ScopeType {
+	case ScopeEnvironment:
+		target = &model.Environment{}
+	case ScopeProject:
+		target = &model.Project{}
+	case ScopeAsset:
+		target = &model.Asset{}
+	default:
+		return fmt.Errorf("unsupported scope type: %s", w.ScopeType)
+	}
+	if err := s.db.Select("id").First(target, *w.ScopeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%s %d not found", w.ScopeType, *w.ScopeID)
+		}
+		return err
+	}
+	return nil
+}
+
+// windowToResponse converts a model to a response, including its current state
+func (s *Service) windowToResponse(w *model.MaintenanceWindow) *WindowResponse {
+	resp := &WindowResponse{
+		ID:             w.ID,
+		Name:           w.Name,
+		Description:    w.Description,
+		Kind:           w.Kind,
+		CronExpression: w.CronExpression,
+		Duration:       w.Duration,
+		Timezone:       w.Timezone,
+		ScopeType:      w.ScopeType,
+		ScopeID:        w.ScopeID,
+		Action:         w.Action,
+		Enabled:        w.Enabled,
+		CreatedBy:      w.CreatedBy,
+		CreatorName:    w.Creator.Username,
+		CreatedAt:      w.CreatedAt,
+		UpdatedAt:      w.UpdatedAt,
+	}
+
+	if w.ScopeID != nil {
+		var name string
+		switch w.ScopeType {
+		case ScopeEnvironment:
+			s.db.Model(&model.Environment{}).Where("id = ?", *w.ScopeID).Pluck("name", &name)
+		case ScopeProject:
+			s.db.Model(&model.Project{}).Where("id = ?", *w.ScopeID).Pluck("name", &name)
+		case ScopeAsset:
+			s.db.Model(&model.Asset{}).Where("id = ?", *w.ScopeID).Pluck("host_name", &name)
+		}
+		resp.ScopeName = name
+	}
+
+	if ev, err := newEvaluator(w); err == nil {
+		now := time.Now()
+		if end, ok := ev.activeAt(now); ok {
+			resp.Active = true
+			resp.ActiveUntil = &end
+		}
+		if next := ev.nextStart(now); !next.IsZero() {
+			resp.NextStart = &next
+		}
+	}
+	return resp
+}
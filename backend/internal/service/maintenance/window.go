@@ -0,0 +1,231 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// maxMergedWindows 计算连续重叠窗口的结束时间时最多合并的次数，防止表达式过密时死循环
+const maxMergedWindows = 1000
+
+// ErrOverrideNotAllowed is returned when a non-admin asks to override maintenance windows
+var ErrOverrideNotAllowed = errors.New("only administrators can override maintenance windows")
+
+// BlockedError describes why a run is not allowed right now
+type BlockedError struct {
+	WindowID   uint       `json:"window_id"`
+	WindowName string     `json:"window_name"`
+	Kind       string     `json:"kind"`
+	Action     string     `json:"action"` // 窗口配置的处理方式：reject, defer
+	AssetID    uint       `json:"asset_id"`
+	HostName   string     `json:"host_name"`
+	Until      *time.Time `json:"until,omitempty"` // 最早允许执行的时间，无法确定时为空
+	Reason     string     `json:"reason"`
+}
+
+func (e *BlockedError) Error() string {
+	return e.Reason
+}
+
+// parseSchedule parses a 6-field cron expression in the given time zone
+func parseSchedule(expr, tz string) (cron.Schedule, error) {
+	if tz != "" {
+		expr = "CRON_TZ=" + tz + " " + expr
+	}
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return parser.Parse(expr)
+}
+
+// evaluator answers "is the window open" questions for one window
+type evaluator struct {
+	window   *model.MaintenanceWindow
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+func newEvaluator(w *model.MaintenanceWindow) (*evaluator, error) {
+	schedule, err := parseSchedule(w.CronExpression, w.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &evaluator{window: w, schedule: schedule, duration: time.Duration(w.Duration) * time.Minute}, nil
+}
+
+// activeAt reports whether the window is open at t and, if so, when it closes.
+// Overlapping occurrences are merged into one continuous window.
+func (e *evaluator) activeAt(t time.Time) (time.Time, bool) {
+	// 开始时间落在 (t-duration, t] 内的窗口在 t 时刻处于开启状态
+	start := e.schedule.Next(t.Add(-e.duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	end := start.Add(e.duration)
+	for i := 0; i < maxMergedWindows; i++ {
+		next := e.schedule.Next(start)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		start = next
+		end = next.Add(e.duration)
+	}
+	return end, true
+}
+
+// nextStart returns the next time the window opens after t
+func (e *evaluator) nextStart(t time.Time) time.Time {
+	return e.schedule.Next(t)
+}
+
+type assetScope struct {
+	ID            uint
+	HostName      string
+	ProjectID     *uint
+	EnvironmentID *uint
+}
+
+// appliesTo reports whether the window covers the asset
+func appliesTo(w *model.MaintenanceWindow, a *assetScope) bool {
+	switch w.ScopeType {
+	case ScopeGlobal:
+		return true
+	case ScopeAsset:
+		return w.ScopeID != nil && *w.ScopeID == a.ID
+	case ScopeProject:
+		return w.ScopeID != nil && a.ProjectID != nil && *w.ScopeID == *a.ProjectID
+	case ScopeEnvironment:
+		return w.ScopeID != nil && a.EnvironmentID != nil && *w.ScopeID == *a.EnvironmentID
+	}
+	return false
+}
+
+// Check returns a *BlockedError if any of the assets may not be changed at time at.
+// A host is blocked while a blackout window covering it is open, or when allow
+// windows cover it and none of them is open.
+func (s *Service) Check(assetIDs []uint, at time.Time) error {
+	if len(assetIDs) == 0 {
+		return nil
+	}
+
+	var assets []assetScope
+	if err := s.db.Model(&model.Asset{}).
+		Select("id, host_name, project_id, environment_id").
+		Where("id IN ?", assetIDs).
+		Find(&assets).Error; err != nil {
+		return err
+	}
+
+	var windows []model.MaintenanceWindow
+	if err := s.db.Where("enabled = ?", true).Order("id").Find(&windows).Error; err != nil {
+		return err
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+
+	evaluators := make([]*evaluator, 0, len(windows))
+	for i := range windows {
+		ev, err := newEvaluator(&windows[i])
+		if err != nil {
+			continue
+		}
+		evaluators = append(evaluators, ev)
+	}
+
+	for i := range assets {
+		if blocked := checkAsset(&assets[i], evaluators, at); blocked != nil {
+			return blocked
+		}
+	}
+	return nil
+}
+
+// checkAsset evaluates all windows that cover one asset
+func checkAsset(a *assetScope, evaluators []*evaluator, at time.Time) *BlockedError {
+	var allow []*evaluator
+	for _, ev := range evaluators {
+		if !appliesTo(ev.window, a) {
+			continue
+		}
+		if ev.window.Kind == KindAllow {
+			allow = append(allow, ev)
+			continue
+		}
+		if end, ok := ev.activeAt(at); ok {
+			return &BlockedError{
+				WindowID:   ev.window.ID,
+				WindowName: ev.window.Name,
+				Kind:       ev.window.Kind,
+				Action:     ev.window.Action,
+				AssetID:    a.ID,
+				HostName:   a.HostName,
+				Until:      &end,
+				Reason: fmt.Sprintf("host %s is in blackout window %q until %s",
+					a.HostName, ev.window.Name, end.Format(time.RFC3339)),
+			}
+		}
+	}
+
+	if len(allow) == 0 {
+		return nil
+	}
+	var next *evaluator
+	var nextAt time.Time
+	for _, ev := range allow {
+		if _, ok := ev.activeAt(at); ok {
+			return nil
+		}
+		if n := ev.nextStart(at); !n.IsZero() && (nextAt.IsZero() || n.Before(nextAt)) {
+			next, nextAt = ev, n
+		}
+	}
+
+	blocked := &BlockedError{
+		Kind:     KindAllow,
+		Action:   ActionReject,
+		AssetID:  a.ID,
+		HostName: a.HostName,
+		Reason:   fmt.Sprintf("host %s may only be changed inside an approved maintenance window", a.HostName),
+	}
+	if next != nil {
+		blocked.WindowID = next.window.ID
+		blocked.WindowName = next.window.Name
+		blocked.Action = next.window.Action
+		blocked.Until = &nextAt
+		blocked.Reason = fmt.Sprintf("host %s may only be changed inside an approved maintenance window; next window %q opens at %s",
+			a.HostName, next.window.Name, nextAt.Format(time.RFC3339))
+	}
+	return blocked
+}
+
+// Enforce checks the assets against maintenance windows at the current time.
+// When override is set, administrators bypass the check; other users get
+// ErrOverrideNotAllowed if a window would have blocked the run.
+func (s *Service) Enforce(assetIDs []uint, userID uint, override bool) error {
+	err := s.Check(assetIDs, time.Now())
+	if err == nil || !override {
+		return err
+	}
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		return err
+	}
+
+	isAdmin, aerr := s.authzSvc.IsAdmin(userID)
+	if aerr != nil {
+		return aerr
+	}
+	if !isAdmin {
+		return ErrOverrideNotAllowed
+	}
+	return nil
+}
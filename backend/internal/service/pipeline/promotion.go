@@ -0,0 +1,520 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+)
+
+// Promotion statuses; once deployed the deployment's status tells how it went
+const (
+	PromotionPending  = "pending_approval" // 等待审批
+	PromotionRejected = "rejected"         // 审批被拒绝
+	PromotionDeployed = "deployed"         // 已发起部署
+	PromotionFailed   = "failed"           // 发起部署失败
+)
+
+// defaultMatrixVersions 版本矩阵默认展示的版本数
+const defaultMatrixVersions = 20
+
+var (
+	// ErrStageNotFound is returned when the stage is not part of the pipeline
+	ErrStageNotFound = errors.New("stage not found in pipeline")
+	// ErrPromotionNotFound is returned when a promotion does not exist
+	ErrPromotionNotFound = errors.New("promotion not found")
+	// ErrPromotionNotPending is returned when reviewing a promotion that is not awaiting approval
+	ErrPromotionNotPending = errors.New("promotion is not awaiting approval")
+	// ErrPromotionBlocked is returned when the version has not succeeded in the previous stage
+	ErrPromotionBlocked = errors.New("version has not been deployed successfully to the previous stage")
+	// ErrNotApprover is returned when the user may not review promotions to the stage
+	ErrNotApprover = errors.New("you are not an approver of this stage")
+	// ErrSelfApproval is returned when the requester tries to review their own promotion
+	ErrSelfApproval = errors.New("promotions must be reviewed by someone other than the requester")
+)
+
+// PromoteRequest represents a request to deploy a version to a pipeline stage
+type PromoteRequest struct {
+	StageID uint   `json:"stage_id" binding:"required"`
+	Version string `json:"version" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// ReviewRequest represents an approval decision
+type ReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// PromotionResponse represents a promotion in the pipeline history
+type PromotionResponse struct {
+	ID               uint       `json:"id"`
+	PipelineID       uint       `json:"pipeline_id"`
+	StageID          uint       `json:"stage_id"`
+	StageName        string     `json:"stage_name"`
+	FromStageID      *uint      `json:"from_stage_id,omitempty"`
+	FromStageName    string     `json:"from_stage_name,omitempty"`
+	Version          string     `json:"version"`
+	Status           string     `json:"status"`
+	DeploymentID     *uint      `json:"deployment_id,omitempty"`
+	DeploymentStatus string     `json:"deployment_status,omitempty"`
+	RequestedBy      uint       `json:"requested_by"`
+	RequesterName    string     `json:"requester_name"`
+	ReviewedBy       *uint      `json:"reviewed_by,omitempty"`
+	ReviewerName     string     `json:"reviewer_name,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+	Comment          string     `json:"comment"`
+	ReviewNote       string     `json:"review_note"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// ListPromotionsFilter filters the promotion history
+type ListPromotionsFilter struct {
+	StageID  uint
+	Version  string
+	Page     int
+	PageSize int
+}
+
+// MatrixCell is the state of one version in one stage
+type MatrixCell struct {
+	StageID      uint       `json:"stage_id"`
+	Status       string     `json:"status"` // 最近一次晋级的状态，已部署时为部署状态；为空表示未部署过
+	PromotionID  *uint      `json:"promotion_id,omitempty"`
+	DeploymentID *uint      `json:"deployment_id,omitempty"`
+	Promotable   bool       `json:"promotable"` // 上一阶段已部署成功，可以晋级到该阶段
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// MatrixRow is one version across the pipeline's stages
+type MatrixRow struct {
+	Version string       `json:"version"`
+	Cells   []MatrixCell `json:"cells"` // 与 stages 顺序一致
+}
+
+// MatrixResponse shows each version's status in each stage
+type MatrixResponse struct {
+	Stages   []StageResponse `json:"stages"`
+	Versions []MatrixRow     `json:"versions"` // 最近有晋级活动的版本在前
+}
+
+// Promote deploys a version to a stage. Except for the first stage the version
+// must have been deployed successfully to the previous stage; stages with an
+// approval gate record a pending promotion instead of deploying.
+func (s *Service) Promote(pipelineID uint, req *PromoteRequest, userID uint) (*PromotionResponse, error) {
+	pipeline, err := s.loadPipeline(pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	stage, previous := findStage(pipeline, req.StageID)
+	if stage == nil {
+		return nil, ErrStageNotFound
+	}
+	version := strings.TrimSpace(req.Version)
+	if err := s.checkPrevious(previous, version); err != nil {
+		return nil, err
+	}
+
+	var pending int64
+	s.db.Model(&model.PipelinePromotion{}).
+		Where("stage_id = ? AND version = ? AND status = ?", stage.ID, version, PromotionPending).
+		Count(&pending)
+	if pending > 0 {
+		return nil, fmt.Errorf("version %s is already awaiting approval for stage %s", version, stage.Name)
+	}
+
+	promotion := model.PipelinePromotion{
+		PipelineID:  pipeline.ID,
+		StageID:     stage.ID,
+		Version:     version,
+		Status:      PromotionDeployed,
+		RequestedBy: userID,
+		Comment:     req.Comment,
+	}
+	if previous != nil {
+		promotion.FromStageID = &previous.ID
+	}
+	if stage.RequireApproval {
+		promotion.Status = PromotionPending
+	}
+	if err := s.db.Create(&promotion).Error; err != nil {
+		return nil, err
+	}
+	if stage.RequireApproval {
+		return s.GetPromotion(promotion.ID)
+	}
+
+	if err := s.deploy(pipeline, stage, &promotion); err != nil {
+		return nil, err
+	}
+	return s.GetPromotion(promotion.ID)
+}
+
+// Approve approves a pending promotion and starts its deployment as the requester
+func (s *Service) Approve(id uint, req *ReviewRequest, userID uint) (*PromotionResponse, error) {
+	promotion, pipeline, stage, previous, err := s.loadPending(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	// 审批期间上一阶段可能已重新部署，再次确认版本仍可晋级
+	if err := s.checkPrevious(previous, promotion.Version); err != nil {
+		return nil, err
+	}
+	if err := s.review(promotion, PromotionDeployed, req.Note, userID); err != nil {
+		return nil, err
+	}
+	if err := s.deploy(pipeline, stage, promotion); err != nil {
+		return nil, err
+	}
+	return s.GetPromotion(id)
+}
+
+// Reject rejects a pending promotion
+func (s *Service) Reject(id uint, req *ReviewRequest, userID uint) (*PromotionResponse, error) {
+	promotion, _, _, _, err := s.loadPending(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.review(promotion, PromotionRejected, req.Note, userID); err != nil {
+		return nil, err
+	}
+	return s.GetPromotion(id)
+}
+
+// GetPromotion retrieves a promotion by ID
+func (s *Service) GetPromotion(id uint) (*PromotionResponse, error) {
+	var promotion model.PipelinePromotion
+	if err := s.db.Preload("Requester").Preload("Reviewer").First(&promotion, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromotionNotFound
+		}
+		return nil, err
+	}
+	return &s.promotionsToResponse([]model.PipelinePromotion{promotion})[0], nil
+}
+
+// ListPromotions returns a pipeline's promotion history, newest first
+func (s *Service) ListPromotions(pipelineID uint, filter ListPromotionsFilter) ([]PromotionResponse, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	query := s.db.Model(&model.PipelinePromotion{}).Where("pipeline_id = ?", pipelineID)
+	if filter.StageID > 0 {
+		query = query.Where("stage_id = ?", filter.StageID)
+	}
+	if filter.Version != "" {
+		query = query.Where("version = ?", filter.Version)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var promotions []model.PipelinePromotion
+	if err := query.Preload("Requester").Preload("Reviewer").Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&promotions).Error; err != nil {
+		return nil, 0, err
+	}
+	return s.promotionsToResponse(promotions), total, nil
+}
+
+// Matrix returns the status of the most recently promoted versions in every stage
+func (s *Service) Matrix(pipelineID uint, limit int) (*MatrixResponse, error) {
+	pipeline, err := s.loadPipeline(pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultMatrixVersions
+	}
+
+	var versions []string
+	if err := s.db.Model(&model.PipelinePromotion{}).
+		Select("version").Where("pipeline_id = ?", pipelineID).
+		Group("version").Order("MAX(id) DESC").Limit(limit).
+		Pluck("version", &versions).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &MatrixResponse{Stages: pipelineToResponse(pipeline).Stages, Versions: []MatrixRow{}}
+	if len(versions) == 0 {
+		return resp, nil
+	}
+
+	var promotions []model.PipelinePromotion
+	if err := s.db.Where("pipeline_id = ? AND version IN ?", pipelineID, versions).
+		Order("id").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+	statuses, err := s.deploymentStatuses(promotions)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按 id 升序遍历，后面的晋级覆盖前面的，得到每个版本在每个阶段的最近状态
+	type key struct {
+		version string
+		stageID uint
+	}
+	latest := make(map[key]*model.PipelinePromotion)
+	deployed := make(map[key]string) // 最近一次部署的状态
+	for i := range promotions {
+		p := &promotions[i]
+		k := key{p.Version, p.StageID}
+		latest[k] = p
+		if p.DeploymentID != nil {
+			deployed[k] = statuses[*p.DeploymentID]
+		}
+	}
+
+	for _, version := range versions {
+		row := MatrixRow{Version: version, Cells: make([]MatrixCell, len(pipeline.Stages))}
+		for i, stage := range pipeline.Stages {
+			cell := MatrixCell{
+				StageID:    stage.ID,
+				Promotable: i == 0 || deployed[key{version, pipeline.Stages[i-1].ID}] == "success",
+			}
+			if p := latest[key{version, stage.ID}]; p != nil {
+				cell.PromotionID = &p.ID
+				cell.DeploymentID = p.DeploymentID
+				cell.Status = promotionStatus(p, statuses)
+				updatedAt := p.UpdatedAt
+				cell.UpdatedAt = &updatedAt
+			}
+			row.Cells[i] = cell
+		}
+		resp.Versions = append(resp.Versions, row)
+	}
+	return resp, nil
+}
+
+// deploy starts the deployment of a promotion to its stage and records the
+// outcome; a deployment that could not be started marks the promotion failed
+func (s *Service) deploy(pipeline *model.ReleasePipeline, stage *model.PipelineStage, promotion *model.PipelinePromotion) error {
+	environmentID := stage.EnvironmentID
+	resp, err := s.deploymentSvc.Deploy(pipeline.ModuleID, &deployment.DeployRequest{
+		Version:       promotion.Version,
+		AssetIDs:      parseIDs(stage.AssetIDs),
+		TriggerType:   "pipeline",
+		EnvironmentID: &environmentID,
+	}, promotion.RequestedBy)
+	if err != nil {
+		s.db.Model(promotion).Updates(map[string]interface{}{"status": PromotionFailed, "error": err.Error()})
+		return err
+	}
+	promotion.DeploymentID = &resp.ID
+	return s.db.Model(promotion).Update("deployment_id", resp.ID).Error
+}
+
+// checkPrevious requires the most recent deployment of the version to the previous stage to have succeeded
+func (s *Service) checkPrevious(previous *model.PipelineStage, version string) error {
+	if previous == nil {
+		return nil
+	}
+	var last model.PipelinePromotion
+	err := s.db.Where("stage_id = ? AND version = ? AND deployment_id IS NOT NULL", previous.ID, version).
+		Order("id DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s has not been deployed to %s", ErrPromotionBlocked, version, previous.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	var d model.Deployment
+	if err := s.db.Select("id", "status").First(&d, *last.DeploymentID).Error; err != nil {
+		return err
+	}
+	if d.Status != "success" {
+		return fmt.Errorf("%w: the last deployment of %s to %s is %s", ErrPromotionBlocked, version, previous.Name, d.Status)
+	}
+	return nil
+}
+
+// loadPending loads a promotion awaiting approval and checks the user may review it
+func (s *Service) loadPending(id, userID uint) (*model.PipelinePromotion, *model.ReleasePipeline, *model.PipelineStage, *model.PipelineStage, error) {
+	var promotion model.PipelinePromotion
+	if err := s.db.First(&promotion, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil, nil, ErrPromotionNotFound
+		}
+		return nil, nil, nil, nil, err
+	}
+	if promotion.Status != PromotionPending {
+		return nil, nil, nil, nil, ErrPromotionNotPending
+	}
+	pipeline, err := s.loadPipeline(promotion.PipelineID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	stage, previous := findStage(pipeline, promotion.StageID)
+	if stage == nil {
+		return nil, nil, nil, nil, ErrStageNotFound
+	}
+
+	if promotion.RequestedBy == userID {
+		return nil, nil, nil, nil, ErrSelfApproval
+	}
+	ok, err := s.canApprove(stage, userID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if !ok {
+		return nil, nil, nil, nil, ErrNotApprover
+	}
+	return &promotion, pipeline, stage, previous, nil
+}
+
+// canApprove reports whether the user is an approver of the stage; stages without approvers are reviewed by admins
+func (s *Service) canApprove(stage *model.PipelineStage, userID uint) (bool, error) {
+	approvers := parseIDs(stage.Approvers)
+	if len(approvers) == 0 {
+		return s.authzSvc.IsAdmin(userID)
+	}
+	for _, id := range approvers {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// review records the decision unless another reviewer decided first
+func (s *Service) review(promotion *model.PipelinePromotion, status, note string, userID uint) error {
+	now := time.Now()
+	result := s.db.Model(&model.PipelinePromotion{}).
+		Where("id = ? AND status = ?", promotion.ID, PromotionPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": userID,
+			"reviewed_at": now,
+			"review_note": note,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromotionNotPending
+	}
+	promotion.Status = status
+	return nil
+}
+
+// findStage returns the stage and the stage before it
+func findStage(pipeline *model.ReleasePipeline, stageID uint) (*model.PipelineStage, *model.PipelineStage) {
+	for i := range pipeline.Stages {
+		if pipeline.Stages[i].ID == stageID {
+			if i == 0 {
+				return &pipeline.Stages[i], nil
+			}
+			return &pipeline.Stages[i], &pipeline.Stages[i-1]
+		}
+	}
+	return nil, nil
+}
+
+// deploymentStatuses loads the status of the promotions' deployments
+func (s *Service) deploymentStatuses(promotions []model.PipelinePromotion) (map[uint]string, error) {
+	var ids []uint
+	for _, p := range promotions {
+		if p.DeploymentID != nil {
+			ids = append(ids, *p.DeploymentID)
+		}
+	}
+	statuses := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return statuses, nil
+	}
+
+	var deployments []model.Deployment
+	if err := s.db.Select("id", "status").Where("id IN ?", ids).Find(&deployments).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range deployments {
+		statuses[d.ID] = d.Status
+	}
+	return statuses, nil
+}
+
+// promotionStatus is the deployment's status once deployed, otherwise the promotion's
+func promotionStatus(p *model.PipelinePromotion, statuses map[uint]string) string {
+	if p.DeploymentID != nil {
+		if status, ok := statuses[*p.DeploymentID]; ok {
+			return status
+		}
+	}
+	return p.Status
+}
+
+func (s *Service) promotionsToResponse(promotions []model.PipelinePromotion) []PromotionResponse {
+	statuses, _ := s.deploymentStatuses(promotions)
+
+	// 已删除的阶段仍显示名称
+	stageNames := make(map[uint]string)
+	var stageIDs []uint
+	for _, p := range promotions {
+		stageIDs = append(stageIDs, p.StageID)
+		if p.FromStageID != nil {
+			stageIDs = append(stageIDs, *p.FromStageID)
+		}
+	}
+	if len(stageIDs) > 0 {
+		var stages []model.PipelineStage
+		s.db.Unscoped().Select("id", "name").Where("id IN ?", stageIDs).Find(&stages)
+		for _, st := range stages {
+			stageNames[st.ID] = st.Name
+		}
+	}
+
+	result := make([]PromotionResponse, len(promotions))
+	for i := range promotions {
+		p := &promotions[i]
+		resp := PromotionResponse{
+			ID:           p.ID,
+			PipelineID:   p.PipelineID,
+			StageID:      p.StageID,
+			StageName:    stageNames[p.StageID],
+			FromStageID:  p.FromStageID,
+			Version:      p.Version,
+			Status:       p.Status,
+			DeploymentID: p.DeploymentID,
+			RequestedBy:  p.RequestedBy,
+			ReviewedBy:   p.ReviewedBy,
+			ReviewedAt:   p.ReviewedAt,
+			Comment:      p.Comment,
+			ReviewNote:   p.ReviewNote,
+			Error:        p.Error,
+			CreatedAt:    p.CreatedAt,
+		}
+		if p.FromStageID != nil {
+			resp.FromStageName = stageNames[*p.FromStageID]
+		}
+		if p.DeploymentID != nil {
+			resp.DeploymentStatus = statuses[*p.DeploymentID]
+		}
+		if p.Requester.ID > 0 {
+			resp.RequesterName = p.Requester.Username
+		}
+		if p.Reviewer != nil {
+			resp.ReviewerName = p.Reviewer.Username
+		}
+		result[i] = resp
+	}
+	return result
+}
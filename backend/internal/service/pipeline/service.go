@@ -0,0 +1,362 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/authorization"
+	"github.com/kkops/backend/internal/service/deployment"
+)
+
+// ErrPipelineNotFound is returned when a release pipeline does not exist
+var ErrPipelineNotFound = errors.New("release pipeline not found")
+
+// Service manages release pipelines and promotes versions through their stages
+type Service struct {
+	db            *gorm.DB
+	deploymentSvc *deployment.Service
+	authzSvc      *authorization.Service
+}
+
+// NewService creates a new release pipeline service
+func NewService(db *gorm.DB, deploymentSvc *deployment.Service, authzSvc *authorization.Service) *Service {
+	return &Service{
+		db:            db,
+		deploymentSvc: deploymentSvc,
+		authzSvc:      authzSvc,
+	}
+}
+
+// StageRequest describes one environment stage of a pipeline
+type StageRequest struct {
+	ID              uint   `json:"id"` // 更新时传入已有阶段的 ID 以保留其晋级历史
+	Name            string `json:"name" binding:"required"`
+	EnvironmentID   uint   `json:"environment_id" binding:"required"`
+	AssetIDs        []uint `json:"asset_ids"`        // 为空时使用模块配置的主机（仅限模块自身的环境）
+	RequireApproval bool   `json:"require_approval"` // 晋级到该阶段需要审批
+	Approvers       []uint `json:"approvers"`        // 可审批的用户，为空时由管理员审批
+}
+
+// CreatePipelineRequest represents a request to create a release pipeline
+type CreatePipelineRequest struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	ModuleID    uint           `json:"module_id" binding:"required"`
+	Stages      []StageRequest `json:"stages" binding:"required,min=1,dive"` // 按晋级顺序排列
+}
+
+// UpdatePipelineRequest represents a request to update a release pipeline
+type UpdatePipelineRequest struct {
+	Name        string         `json:"name"`
+	Description *string        `json:"description"`
+	Stages      []StageRequest `json:"stages" binding:"omitempty,dive"` // 传入时整体替换阶段，未列出的已有阶段被删除
+}
+
+// StageResponse represents a pipeline stage
+type StageResponse struct {
+	ID              uint   `json:"id"`
+	Position        int    `json:"position"`
+	Name            string `json:"name"`
+	EnvironmentID   uint   `json:"environment_id"`
+	EnvironmentName string `json:"environment_name"`
+	AssetIDs        []uint `json:"asset_ids"`
+	RequireApproval bool   `json:"require_approval"`
+	Approvers       []uint `json:"approvers"`
+}
+
+// PipelineResponse represents a release pipeline
+type PipelineResponse struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	ModuleID    uint            `json:"module_id"`
+	ModuleName  string          `json:"module_name"`
+	Stages      []StageResponse `json:"stages"`
+	CreatedBy   uint            `json:"created_by"`
+	CreatorName string          `json:"creator_name"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// CreatePipeline creates a release pipeline for a deployment module
+func (s *Service) CreatePipeline(req *CreatePipelineRequest, userID uint) (*PipelineResponse, error) {
+	var module model.DeploymentModule
+	if err := s.db.First(&module, req.ModuleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("deployment module %d not found", req.ModuleID)
+		}
+		return nil, err
+	}
+	if err := s.validateStages(&module, req.Stages, nil); err != nil {
+		return nil, err
+	}
+
+	pipeline := model.ReleasePipeline{
+		Name:        req.Name,
+		Description: req.Description,
+		ModuleID:    req.ModuleID,
+		CreatedBy:   userID,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&pipeline).Error; err != nil {
+			return err
+		}
+		return saveStages(tx, pipeline.ID, req.Stages, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPipeline(pipeline.ID)
+}
+
+// GetPipeline retrieves a release pipeline with its stages
+func (s *Service) GetPipeline(id uint) (*PipelineResponse, error) {
+	pipeline, err := s.loadPipeline(id)
+	if err != nil {
+		return nil, err
+	}
+	return pipelineToResponse(pipeline), nil
+}
+
+// ListPipelines lists release pipelines, optionally for one module
+func (s *Service) ListPipelines(moduleID uint) ([]PipelineResponse, error) {
+	query := s.db.Preload("Module").Preload("Creator").
+		Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Stages.Environment").
+		Order("id DESC")
+	if moduleID > 0 {
+		query = query.Where("module_id = ?", moduleID)
+	}
+
+	var pipelines []model.ReleasePipeline
+	if err := query.Find(&pipelines).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]PipelineResponse, len(pipelines))
+	for i := range pipelines {
+		result[i] = *pipelineToResponse(&pipelines[i])
+	}
+	return result, nil
+}
+
+// UpdatePipeline updates a pipeline's name, description or stages. Stages passed
+// with their ID keep their promotion history.
+func (s *Service) UpdatePipeline(id uint, req *UpdatePipelineRequest) (*PipelineResponse, error) {
+	pipeline, err := s.loadPipeline(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		pipeline.Name = req.Name
+	}
+	if req.Description != nil {
+		pipeline.Description = *req.Description
+	}
+	if req.Stages != nil {
+		if len(req.Stages) == 0 {
+			return nil, errors.New("a pipeline needs at least one stage")
+		}
+		if err := s.validateStages(pipeline.Module, req.Stages, pipeline.Stages); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.ReleasePipeline{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"name": pipeline.Name, "description": pipeline.Description}).Error; err != nil {
+			return err
+		}
+		if req.Stages == nil {
+			return nil
+		}
+		return saveStages(tx, id, req.Stages, pipeline.Stages)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPipeline(id)
+}
+
+// DeletePipeline deletes a release pipeline; deployments it started are kept
+func (s *Service) DeletePipeline(id uint) error {
+	result := s.db.Delete(&model.ReleasePipeline{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPipelineNotFound
+	}
+	return nil
+}
+
+// loadPipeline loads a pipeline with its module and stages in promotion order
+func (s *Service) loadPipeline(id uint) (*model.ReleasePipeline, error) {
+	var pipeline model.ReleasePipeline
+	if err := s.db.Preload("Module").Preload("Creator").
+		Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Stages.Environment").
+		First(&pipeline, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPipelineNotFound
+		}
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// validateStages checks that every environment appears once and exists, that
+// each stage has target hosts and that stage IDs belong to the pipeline
+func (s *Service) validateStages(module *model.DeploymentModule, stages []StageRequest, existing []model.PipelineStage) error {
+	known := make(map[uint]bool, len(existing))
+	for _, st := range existing {
+		known[st.ID] = true
+	}
+
+	environments := make(map[uint]bool, len(stages))
+	for _, st := range stages {
+		if st.ID > 0 && !known[st.ID] {
+			return fmt.Errorf("stage %d does not belong to this pipeline", st.ID)
+		}
+		if environments[st.EnvironmentID] {
+			return fmt.Errorf("environment %d appears in more than one stage", st.EnvironmentID)
+		}
+		environments[st.EnvironmentID] = true
+
+		var count int64
+		if err := s.db.Model(&model.Environment{}).Where("id = ?", st.EnvironmentID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("environment %d not found", st.EnvironmentID)
+		}
+		// 模块配置的主机属于模块自身的环境，其他环境的阶段必须指定主机
+		moduleEnv := module.EnvironmentID != nil && *module.EnvironmentID == st.EnvironmentID
+		if len(st.AssetIDs) == 0 && (!moduleEnv || module.AssetIDs == "") {
+			return fmt.Errorf("stage %q has no target hosts", st.Name)
+		}
+	}
+	return nil
+}
+
+// saveStages writes the stages in the given order: stages with an ID are
+// updated, new ones created and existing stages left out are deleted
+func saveStages(tx *gorm.DB, pipelineID uint, stages []StageRequest, existing []model.PipelineStage) error {
+	kept := make(map[uint]bool, len(stages))
+	for i, st := range stages {
+		stage := model.PipelineStage{
+			ID:              st.ID,
+			PipelineID:      pipelineID,
+			Position:        i + 1,
+			Name:            st.Name,
+			EnvironmentID:   st.EnvironmentID,
+			AssetIDs:        joinIDs(st.AssetIDs),
+			RequireApproval: st.RequireApproval,
+			Approvers:       joinIDs(st.Approvers),
+		}
+		if st.ID > 0 {
+			kept[st.ID] = true
+			if err := tx.Model(&model.PipelineStage{}).Where("id = ?", st.ID).Updates(map[string]interface{}{
+				"position":         stage.Position,
+				"name":             stage.Name,
+				"environment_id":   stage.EnvironmentID,
+				"asset_ids":        stage.AssetIDs,
+				"require_approval": stage.RequireApproval,
+				"approvers":        stage.Approvers,
+			}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Create(&stage).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, st := range existing {
+		if !kept[st.ID] {
+			if err := tx.Delete(&model.PipelineStage{}, st.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func pipelineToResponse(p *model.ReleasePipeline) *PipelineResponse {
+	moduleName := ""
+	if p.Module != nil {
+		moduleName = p.Module.Name
+	}
+	creatorName := ""
+	if p.Creator.ID > 0 {
+		creatorName = p.Creator.Username
+	}
+
+	stages := make([]StageResponse, len(p.Stages))
+	for i := range p.Stages {
+		stages[i] = stageToResponse(&p.Stages[i])
+	}
+
+	return &PipelineResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		ModuleID:    p.ModuleID,
+		ModuleName:  moduleName,
+		Stages:      stages,
+		CreatedBy:   p.CreatedBy,
+		CreatorName: creatorName,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+func stageToResponse(st *model.PipelineStage) StageResponse {
+	environmentName := ""
+	if st.Environment != nil {
+		environmentName = st.Environment.Name
+	}
+	return StageResponse{
+		ID:              st.ID,
+		Position:        st.Position,
+		Name:            st.Name,
+		EnvironmentID:   st.EnvironmentID,
+		EnvironmentName: environmentName,
+		AssetIDs:        parseIDs(st.AssetIDs),
+		RequireApproval: st.RequireApproval,
+		Approvers:       parseIDs(st.Approvers),
+	}
+}
+
+// joinIDs stores IDs as a comma-separated string
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIDs parses a comma-separated ID list
+func parseIDs(s string) []uint {
+	result := []uint{}
+	for _, p := range strings.Split(s, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32); err == nil {
+			result = append(result, uint(id))
+		}
+	}
+	return result
+}
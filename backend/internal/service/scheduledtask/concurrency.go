@@ -0,0 +1,163 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// 并发策略：触发时上一次执行仍未结束的处理方式（参考 Kubernetes CronJob concurrencyPolicy）
+const (
+	ConcurrencyAllow   = "allow"   // 允许并发执行（默认）
+	ConcurrencySkip    = "skip"    // 跳过本次触发
+	ConcurrencyQueue   = "queue"   // 排队一次，上一次结束后立即执行；已有排队时跳过
+	ConcurrencyReplace = "replace" // 取消正在进行的执行，开始本次
+)
+
+// errReplaced 作为取消原因，标记被 replace 策略取代的执行
+var errReplaced = errors.New("被新的触发取代")
+
+// taskRuns 某个定时任务在本实例上的运行状态
+type taskRuns struct {
+	active map[uint]context.CancelCauseFunc // fireID -> 取消函数
+	queued *model.ScheduledTaskFire         // queue 策略下等待执行的触发
+}
+
+// ValidateConcurrencyPolicy 校验并发策略
+func ValidateConcurrencyPolicy(policy string) error {
+	switch policy {
+	case "", ConcurrencyAllow, ConcurrencySkip, ConcurrencyQueue, ConcurrencyReplace:
+		return nil
+	}
+	return fmt.Errorf("无效的并发策略: %s（可选 allow, skip, queue, replace）", policy)
+}
+
+// admit 按任务的并发策略决定本次触发是否立即执行；被跳过或排队的触发会记录原因
+func (s *Scheduler) admit(task *model.ScheduledTask, fire *model.ScheduledTaskFire) (context.Context, bool) {
+	s.runsMux.Lock()
+	defer s.runsMux.Unlock()
+
+	runs := s.runs[task.ID]
+	if runs == nil {
+		runs = &taskRuns{active: make(map[uint]context.CancelCauseFunc)}
+		s.runs[task.ID] = runs
+	}
+
+	if len(runs.active) > 0 {
+		switch task.ConcurrencyPolicy {
+		case ConcurrencySkip:
+			s.logger.Info("上一次执行仍在进行，跳过本次触发", zap.Uint("task_id", task.ID))
+			s.finishFire(fire, "skipped", "上一次执行仍在进行中")
+			return nil, false
+		case ConcurrencyQueue:
+			if runs.queued != nil {
+				s.finishFire(fire, "skipped", "已有等待执行的触发")
+				return nil, false
+			}
+			runs.queued = fire
+			s.db.Model(fire).Updates(map[string]interface{}{"status": "queued", "reason": "等待上一次执行结束"})
+			return nil, false
+		case ConcurrencyReplace:
+			for _, cancel := range runs.active {
+				cancel(errReplaced)
+			}
+			s.logger.Info("已取消上一次执行，开始本次触发", zap.Uint("task_id", task.ID))
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	runs.active[fire.ID] = cancel
+	return ctx, true
+}
+
+// release 移除结束的执行，若任务已无执行中的触发则返回排队的触发
+func (s *Scheduler) release(taskID, fireID uint) *model.ScheduledTaskFire {
+	s.runsMux.Lock()
+	defer s.runsMux.Unlock()
+
+	runs := s.runs[taskID]
+	if runs == nil {
+		return nil
+	}
+	if cancel, ok := runs.active[fireID]; ok {
+		cancel(nil)
+		delete(runs.active, fireID)
+	}
+	if len(runs.active) > 0 {
+		return nil
+	}
+
+	next := runs.queued
+	runs.queued = nil
+	if next == nil {
+		delete(s.runs, taskID)
+	}
+	return next
+}
+
+// runQueued 执行排队的触发（任务配置按最新状态重新加载）
+func (s *Scheduler) runQueued(fire *model.ScheduledTaskFire) {
+	var task model.ScheduledTask
+	if err := s.db.First(&task, fire.ScheduledTaskID).Error; err != nil || !task.Enabled {
+		s.finishFire(fire, "skipped", "定时任务已删除或禁用")
+		s.release(fire.ScheduledTaskID, fire.ID)
+		return
+	}
+	if !s.election.isLeader() {
+		s.finishFire(fire, "skipped", "当前实例已不是调度器主节点")
+		s.release(fire.ScheduledTaskID, fire.ID)
+		return
+	}
+
+	s.db.Model(fire).Updates(map[string]interface{}{"status": "running", "reason": ""})
+	ctx, admitted := s.admit(&task, fire)
+	if !admitted {
+		return
+	}
+	s.runFire(ctx, &task, fire)
+}
+
+// skipQueued 调度器停止时将排队中的触发标记为跳过
+func (s *Scheduler) skipQueued() {
+	s.runsMux.Lock()
+	defer s.runsMux.Unlock()
+
+	for _, runs := range s.runs {
+		if runs.queued != nil {
+			s.finishFire(runs.queued, "skipped", "调度器已停止")
+			runs.queued = nil
+		}
+	}
+}
+
+// finishFire 记录一次触发的最终状态
+func (s *Scheduler) finishFire(fire *model.ScheduledTaskFire, status, reason string) {
+	now := time.Now()
+	fire.Status = status
+	fire.Reason = reason
+	fire.FinishedAt = &now
+	if err := s.db.Model(fire).Updates(map[string]interface{}{
+		"status":      status,
+		"reason":      reason,
+		"finished_at": now,
+	}).Error; err != nil {
+		s.logger.Error("更新触发记录失败", zap.Uint("fire_id", fire.ID), zap.Error(err))
+	}
+
+	// 一次性任务的触发处理完毕（无论执行、跳过还是错过）后自动禁用
+	if result := s.db.Model(&model.ScheduledTask{}).
+		Where("id = ? AND schedule_type = ? AND enabled = ?", fire.ScheduledTaskID, ScheduleOnce, true).
+		Updates(map[string]interface{}{"enabled": false, "next_run_at": nil}); result.RowsAffected > 0 {
+		s.logger.Info("一次性任务已执行，自动禁用", zap.Uint("task_id", fire.ScheduledTaskID))
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+)
+
+// 定时任务的执行目标
+const (
+	TargetScript     = "script"     // 在目标主机上执行脚本（默认）
+	TargetDeployment = "deployment" // 部署指定模块的指定版本
+	TargetFacts      = "facts"      // 在目标主机上运行事实采集器并按映射规则更新资产
+)
+
+// deploymentPollInterval 等待部署结束时查询部署状态的间隔
+const deploymentPollInterval = 5 * time.Second
+
+// validateTarget 校验任务的执行目标；deployment 类型必须指定存在的模块和版本，facts 类型的采集器必须已注册
+func (s *Service) validateTarget(task *model.ScheduledTask) error {
+	switch task.TargetType {
+	case "", TargetScript:
+		task.TargetType = TargetScript
+		task.DeploymentModuleID = nil
+		task.DeploymentVersion = ""
+		task.FactCollectors = ""
+		return nil
+	case TargetFacts:
+		task.DeploymentModuleID = nil
+		task.DeploymentVersion = ""
+		return validateFactCollectors(task)
+	case TargetDeployment:
+		task.FactCollectors = ""
+	default:
+		return fmt.Errorf("无效的执行目标: %s（可选 script, deployment, facts）", task.TargetType)
+	}
+
+	if task.DeploymentModuleID == nil || *task.DeploymentModuleID == 0 {
+		return fmt.Errorf("定时部署必须指定 deployment_module_id")
+	}
+	task.DeploymentVersion = strings.TrimSpace(task.DeploymentVersion)
+	if task.DeploymentVersion == "" {
+		return fmt.Errorf("定时部署必须指定 deployment_version")
+	}
+	var module model.DeploymentModule
+	if err := s.db.Select("id").First(&module, *task.DeploymentModuleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("部署模块不存在")
+		}
+		return err
+	}
+	return nil
+}
+
+// targetAssetIDs 返回任务的目标主机；定时部署未指定主机时使用模块配置的主机
+func (s *Scheduler) targetAssetIDs(task *model.ScheduledTask) []uint {
+	assetIDs := s.parseAssetIDs(task.AssetIDs)
+	if len(assetIDs) > 0 || task.TargetType != TargetDeployment || task.DeploymentModuleID == nil {
+		return assetIDs
+	}
+
+	var module model.DeploymentModule
+	if err := s.db.Select("id, asset_ids").First(&module, *task.DeploymentModuleID).Error; err != nil {
+		return assetIDs
+	}
+	return s.parseAssetIDs(module.AssetIDs)
+}
+
+// runDeployment 为定时部署创建一条普通的部署记录并等待其结束，返回整体状态及原因。
+// 部署以任务创建者的身份发起，手动立即执行时以触发用户的身份发起
+func (s *Scheduler) runDeployment(ctx context.Context, task *model.ScheduledTask, trigger execTrigger) (string, string) {
+	taskID := task.ID
+	if task.DeploymentModuleID == nil {
+		s.service.UpdateTaskLastRun(taskID, "failed")
+		return "failed", "未指定部署模块"
+	}
+
+	userID := task.CreatedBy
+	if trigger.UserID != nil {
+		userID = *trigger.UserID
+	}
+
+	s.logger.Info("开始执行定时部署",
+		zap.Uint("task_id", taskID),
+		zap.Uint("module_id", *task.DeploymentModuleID),
+		zap.String("version", task.DeploymentVersion))
+
+	resp, err := s.deploymentSvc.Deploy(*task.DeploymentModuleID, &deployment.DeployRequest{
+		Version:             task.DeploymentVersion,
+		AssetIDs:            s.parseAssetIDs(task.AssetIDs),
+		OverrideMaintenance: trigger.OverrideMaintenance,
+		TriggerType:         trigger.Type,
+		ScheduledTaskID:     &taskID,
+		ChainRunID:          trigger.ChainRunID,
+	}, userID)
+	if err != nil {
+		s.logger.Error("创建部署失败", zap.Uint("task_id", taskID), zap.Error(err))
+		s.service.UpdateTaskLastRun(taskID, "failed")
+		return "failed", truncateReason("创建部署失败: " + err.Error())
+	}
+
+	status := s.waitDeployment(ctx, resp.ID)
+	s.service.UpdateTaskLastRun(taskID, status)
+	s.logger.Info("定时部署执行完成",
+		zap.Uint("task_id", taskID),
+		zap.Uint("deployment_id", resp.ID),
+		zap.String("status", status))
+	return status, fmt.Sprintf("部署记录 #%d", resp.ID)
+}
+
+// waitDeployment 等待部署进入终态；执行被取消（如 replace 策略）时同时取消部署
+func (s *Scheduler) waitDeployment(ctx context.Context, deploymentID uint) string {
+	ticker := time.NewTicker(deploymentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.deploymentSvc.CancelDeployment(deploymentID); err != nil {
+				s.logger.Warn("取消部署失败", zap.Uint("deployment_id", deploymentID), zap.Error(err))
+			}
+			return "cancelled"
+		case <-ticker.C:
+		}
+
+		var d model.Deployment
+		if err := s.db.Select("id, status").First(&d, deploymentID).Error; err != nil {
+			s.logger.Warn("查询部署状态失败", zap.Uint("deployment_id", deploymentID), zap.Error(err))
+			continue
+		}
+		switch d.Status {
+		case "success", "failed", "cancelled":
+			return d.Status
+		}
+	}
+}
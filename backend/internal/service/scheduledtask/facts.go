@@ -0,0 +1,66 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/facts"
+)
+
+// validateFactCollectors 规范化 facts 类型任务的采集器列表并校验其均已注册
+func validateFactCollectors(task *model.ScheduledTask) error {
+	names := splitCollectors(task.FactCollectors)
+	if _, err := facts.ResolveCollectors(names); err != nil {
+		return err
+	}
+	task.FactCollectors = strings.Join(names, ",")
+	return nil
+}
+
+// splitCollectors 解析逗号分隔的采集器名称
+func splitCollectors(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// collectFacts 在单个主机上运行任务配置的采集器，输出为采集结果摘要
+func (s *Scheduler) collectFacts(ctx context.Context, task *model.ScheduledTask, asset *model.Asset) (string, int, error) {
+	result, err := s.factsSvc.CollectAsset(ctx, asset.ID, splitCollectors(task.FactCollectors))
+	if err != nil {
+		return "", -1, err
+	}
+	if len(result.Conflicts) > 0 {
+		s.logger.Info("采集到的事实与资产信息不一致",
+			zap.Uint("task_id", task.ID),
+			zap.Uint("asset_id", asset.ID),
+			zap.Int("conflicts", len(result.Conflicts)))
+	}
+	// 部分采集器失败时整体仍视为成功，失败原因记录在输出中
+	return result.Summary(), 0, nil
+}
+
+// ingestFacts 将启用了资产更新的脚本任务输出的 JSON 作为事实保存并按映射规则更新资产
+func (s *Scheduler) ingestFacts(assetID uint, output string) {
+	result, err := s.factsSvc.IngestJSON(assetID, output)
+	if err != nil {
+		s.logger.Warn("解析资产信息失败", zap.Uint("asset_id", assetID), zap.Error(err))
+		return
+	}
+	s.logger.Info("已采集资产信息",
+		zap.Uint("asset_id", assetID),
+		zap.Strings("updated", result.Updated),
+		zap.Int("conflicts", len(result.Conflicts)))
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+const (
+	// leaseName 调度器主节点租约名称
+	leaseName = "scheduled-task-scheduler"
+	// fireRetention 触发去重记录的保留时间
+	fireRetention = 7 * 24 * time.Hour
+)
+
+// SchedulerStatus 调度器集群状态
+type SchedulerStatus struct {
+	InstanceID       string     `json:"instance_id"`       // 当前实例 ID
+	IsLeader         bool       `json:"is_leader"`         // 当前实例是否为主节点
+	Leader           string     `json:"leader"`            // 当前主节点实例 ID（租约已过期时为空）
+	LeaderSince      *time.Time `json:"leader_since"`      // 主节点获得租约的时间
+	LeaseRenewedAt   *time.Time `json:"lease_renewed_at"`  // 最近一次续约时间
+	LeaseExpiresAt   *time.Time `json:"lease_expires_at"`  // 租约到期时间
+	LeaseTTL         int        `json:"lease_ttl"`         // 租约时长（秒）
+	ScheduledEntries int        `json:"scheduled_entries"` // 当前实例注册的 Cron 任务数
+}
+
+// election 基于数据库租约表的主节点选举
+type election struct {
+	scheduler     *Scheduler
+	instanceID    string
+	leaseTTL      time.Duration
+	renewInterval time.Duration
+
+	mu         sync.RWMutex
+	leader     bool
+	lastRenew  time.Time
+	lastPruned time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newElection(s *Scheduler) *election {
+	cfg := s.cfg.Scheduler
+
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		hostname, _ := os.Hostname()
+		instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	leaseTTL := time.Duration(cfg.LeaseTTL) * time.Second
+	if leaseTTL <= 0 {
+		leaseTTL = 30 * time.Second
+	}
+	renewInterval := time.Duration(cfg.RenewInterval) * time.Second
+	if renewInterval <= 0 || renewInterval >= leaseTTL {
+		renewInterval = leaseTTL / 3
+	}
+
+	return &election{
+		scheduler:     s,
+		instanceID:    instanceID,
+		leaseTTL:      leaseTTL,
+		renewInterval: renewInterval,
+	}
+}
+
+// start 立即竞选一次，之后按续约间隔循环
+func (e *election) start() {
+	e.stopCh = make(chan struct{})
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.tick()
+		ticker := time.NewTicker(e.renewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stopCh:
+				return
+			case <-ticker.C:
+				e.tick()
+			}
+		}
+	}()
+}
+
+// stop 停止竞选；若当前为主节点则主动让出租约，其他副本无需等待过期即可接管
+func (e *election) stop() {
+	if e.stopCh == nil {
+		return
+	}
+	close(e.stopCh)
+	e.wg.Wait()
+
+	if e.isLeader() {
+		e.scheduler.db.Model(&model.SchedulerLease{}).
+			Where("name = ? AND holder = ?", leaseName, e.instanceID).
+			Update("expires_at", time.Now())
+		e.setLeader(false)
+	}
+}
+
+func (e *election) isLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+func (e *election) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
+
+// tick 续约或抢占租约，并根据结果启动/停止 Cron
+func (e *election) tick() {
+	s := e.scheduler
+	acquired, err := e.tryAcquire()
+	if err != nil {
+		s.logger.Error("调度器租约续约失败", zap.String("instance", e.instanceID), zap.Error(err))
+		// 无法续约时在租约到期前主动退位，避免与新主节点同时触发
+		e.mu.RLock()
+		expiring := e.leader && time.Since(e.lastRenew) >= e.leaseTTL-e.renewInterval
+		e.mu.RUnlock()
+		if expiring {
+			e.stepDown()
+		}
+		return
+	}
+
+	wasLeader := e.isLeader()
+	switch {
+	case acquired && !wasLeader:
+		e.mu.Lock()
+		e.leader = true
+		e.lastRenew = time.Now()
+		e.mu.Unlock()
+		s.reconcile()
+		s.cron.Start()
+		s.logger.Info("已成为调度器主节点，Cron 调度器已启动", zap.String("instance", e.instanceID))
+		// 处理停机或无主节点期间错过的触发
+		s.catchUp()
+	case acquired:
+		e.mu.Lock()
+		e.lastRenew = time.Now()
+		e.mu.Unlock()
+		// 同步其他副本通过 API 修改的任务
+		s.reconcile()
+		e.pruneFires()
+	case wasLeader:
+		e.stepDown()
+	}
+}
+
+// stepDown 失去租约后停止触发，正在执行的任务继续运行
+func (e *election) stepDown() {
+	e.setLeader(false)
+	e.scheduler.cron.Stop()
+	e.scheduler.logger.Warn("已失去调度器主节点租约，Cron 调度器已暂停", zap.String("instance", e.instanceID))
+}
+
+// tryAcquire 续约自己的租约，或在租约过期时抢占；使用数据库时间，避免各副本时钟偏差
+func (e *election) tryAcquire() (bool, error) {
+	result := e.scheduler.db.Exec(`
+		INSERT INTO scheduler_leases (name, holder, acquired_at, renewed_at, expires_at)
+		VALUES (?, ?, NOW(), NOW(), NOW() + make_interval(secs => ?))
+		ON CONFLICT (name) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN scheduler_leases.holder = EXCLUDED.holder
+				THEN scheduler_leases.acquired_at ELSE NOW() END,
+			renewed_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE scheduler_leases.holder = EXCLUDED.holder OR scheduler_leases.expires_at < NOW()`,
+		leaseName, e.instanceID, e.leaseTTL.Seconds())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// pruneFires 定期清理过期的触发去重记录
+func (e *election) pruneFires() {
+	if time.Since(e.lastPruned) < time.Hour {
+		return
+	}
+	e.lastPruned = time.Now()
+	e.scheduler.db.Where("fire_time < ?", time.Now().Add(-fireRetention)).Delete(&model.ScheduledTaskFire{})
+}
+
+// claimFire 认领一次调度触发，返回 false 表示该时刻已被其他实例执行
+func (s *Scheduler) claimFire(taskID uint, fireTime time.Time) (*model.ScheduledTaskFire, bool) {
+	fire := &model.ScheduledTaskFire{
+		ScheduledTaskID: taskID,
+		FireTime:        fireTime,
+		Instance:        s.election.instanceID,
+		Status:          "running",
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(fire)
+	if result.Error != nil {
+		s.logger.Error("写入触发记录失败", zap.Uint("task_id", taskID), zap.Error(result.Error))
+		return nil, false
+	}
+	return fire, result.RowsAffected == 1
+}
+
+// reconcile 将 Cron 注册表与数据库中启用的任务对齐
+func (s *Scheduler) reconcile() {
+	tasks, err := s.service.GetEnabledScheduledTasks()
+	if err != nil {
+		s.logger.Error("同步定时任务失败", zap.Error(err))
+		return
+	}
+
+	enabled := make(map[uint]bool, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		enabled[task.ID] = true
+
+		s.entriesMux.RLock()
+		spec, exists := s.specs[task.ID]
+		s.entriesMux.RUnlock()
+		if exists && spec == scheduleKey(task) {
+			continue
+		}
+		if err := s.AddTask(task); err != nil {
+			s.logger.Error("添加定时任务失败", zap.Uint("task_id", task.ID), zap.Error(err))
+		}
+	}
+
+	s.entriesMux.RLock()
+	var stale []uint
+	for taskID := range s.entries {
+		if !enabled[taskID] {
+			stale = append(stale, taskID)
+		}
+	}
+	s.entriesMux.RUnlock()
+	for _, taskID := range stale {
+		s.RemoveTask(taskID)
+	}
+}
+
+// Status 返回调度器集群状态
+func (s *Scheduler) Status() *SchedulerStatus {
+	status := &SchedulerStatus{
+		InstanceID: s.election.instanceID,
+		IsLeader:   s.election.isLeader(),
+		LeaseTTL:   int(s.election.leaseTTL.Seconds()),
+	}
+
+	s.entriesMux.RLock()
+	status.ScheduledEntries = len(s.entries)
+	s.entriesMux.RUnlock()
+
+	var lease model.SchedulerLease
+	if err := s.db.Where("name = ?", leaseName).First(&lease).Error; err == nil {
+		status.LeaseRenewedAt = &lease.RenewedAt
+		status.LeaseExpiresAt = &lease.ExpiresAt
+		if lease.ExpiresAt.After(time.Now()) {
+			status.Leader = lease.Holder
+			status.LeaderSince = &lease.AcquiredAt
+		}
+	}
+	return status
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/maintenance"
+)
+
+// maxDeferral 因维护窗口延后执行的最长时间，超过则直接拒绝本次触发
+const maxDeferral = 24 * time.Hour
+
+// deferredFire 等待维护窗口结束后执行的触发
+type deferredFire struct {
+	fire  *model.ScheduledTaskFire
+	timer *time.Timer
+}
+
+// checkMaintenance 检查任务目标主机是否处于维护窗口限制中；被拦截时按窗口配置
+// 拒绝（blocked）或延后（deferred）本次触发。返回 true 表示可以立即执行
+func (s *Scheduler) checkMaintenance(task *model.ScheduledTask, fire *model.ScheduledTaskFire) bool {
+	err := s.maintenanceSvc.Check(s.targetAssetIDs(task), time.Now())
+	if err == nil {
+		return true
+	}
+
+	var blocked *maintenance.BlockedError
+	if !errors.As(err, &blocked) {
+		s.logger.Error("检查维护窗口失败", zap.Uint("task_id", task.ID), zap.Error(err))
+		s.finishFire(fire, "failed", "检查维护窗口失败")
+		return false
+	}
+
+	if blocked.Action == maintenance.ActionDefer && blocked.Until != nil && time.Until(*blocked.Until) <= maxDeferral {
+		s.deferFire(fire, *blocked.Until, blocked.Reason)
+		return false
+	}
+
+	s.logger.Info("维护窗口拦截了定时任务触发",
+		zap.Uint("task_id", task.ID),
+		zap.Uint("window_id", blocked.WindowID),
+		zap.String("reason", blocked.Reason))
+	s.finishFire(fire, "blocked", truncateReason(blocked.Reason))
+	return false
+}
+
+// deferFire 将触发延后到 until 再执行，届时重新检查任务状态与维护窗口
+func (s *Scheduler) deferFire(fire *model.ScheduledTaskFire, until time.Time, reason string) {
+	s.logger.Info("维护窗口限制中，延后执行定时任务",
+		zap.Uint("task_id", fire.ScheduledTaskID),
+		zap.Time("until", until),
+		zap.String("reason", reason))
+	s.db.Model(fire).Updates(map[string]interface{}{
+		"status": "deferred",
+		"reason": truncateReason(fmt.Sprintf("延后至 %s：%s", until.Format(time.RFC3339), reason)),
+	})
+
+	s.runsMux.Lock()
+	defer s.runsMux.Unlock()
+	s.deferred[fire.ID] = &deferredFire{
+		fire: fire,
+		timer: time.AfterFunc(time.Until(until)+time.Second, func() {
+			s.runsMux.Lock()
+			delete(s.deferred, fire.ID)
+			s.runsMux.Unlock()
+
+			if !s.election.isLeader() {
+				s.finishFire(fire, "skipped", "当前实例已不是调度器主节点")
+				return
+			}
+			s.db.Model(fire).Updates(map[string]interface{}{"status": "running", "reason": ""})
+			s.handleFire(fire)
+		}),
+	}
+}
+
+// skipDeferred 调度器停止时将延后中的触发标记为跳过
+func (s *Scheduler) skipDeferred() {
+	s.runsMux.Lock()
+	defer s.runsMux.Unlock()
+
+	for id, d := range s.deferred {
+		if d.timer.Stop() {
+			s.finishFire(d.fire, "skipped", "调度器已停止")
+		}
+		delete(s.deferred, id)
+	}
+}
+
+// truncateReason 截断原因以适配触发记录的字段长度
+func truncateReason(reason string) string {
+	const maxLen = 255
+	r := []rune(reason)
+	if len(r) <= maxLen {
+		return reason
+	}
+	return string(r[:maxLen])
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// 错过触发策略：调度器停机（或无主节点）期间错过的触发如何处理
+const (
+	MisfireSkip    = "skip"     // 不补跑，仅记录错过（默认）
+	MisfireRunOnce = "run_once" // 补跑一次（最近一次错过的触发）
+	MisfireRunAll  = "run_all"  // 依次补跑，最多 MisfireMaxRuns 次（最近的若干次）
+)
+
+const (
+	// defaultMisfireMaxRuns run_all 策略未设置上限时的补跑次数
+	defaultMisfireMaxRuns = 10
+	// maxRecordedMisfires 单个任务最多逐条记录的错过触发数，更早的只计数
+	maxRecordedMisfires = 100
+)
+
+// ValidateMisfirePolicy 校验错过触发策略
+func ValidateMisfirePolicy(policy string, maxRuns, startingDeadline int) error {
+	switch policy {
+	case "", MisfireSkip, MisfireRunOnce, MisfireRunAll:
+	default:
+		return fmt.Errorf("无效的错过触发策略: %s（可选 skip, run_once, run_all）", policy)
+	}
+	if maxRuns < 0 {
+		return fmt.Errorf("misfire_max_runs 不能为负数")
+	}
+	if startingDeadline < 0 {
+		return fmt.Errorf("starting_deadline 不能为负数")
+	}
+	return nil
+}
+
+// catchUp 成为主节点时检查所有启用任务错过的触发并按策略处理
+func (s *Scheduler) catchUp() {
+	tasks, err := s.service.GetEnabledScheduledTasks()
+	if err != nil {
+		s.logger.Error("检查错过的触发失败", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	for i := range tasks {
+		task := tasks[i]
+		missed, dropped := s.missedFires(&task, now)
+		if len(missed) == 0 {
+			continue
+		}
+		s.logger.Warn("定时任务存在错过的触发",
+			zap.Uint("task_id", task.ID),
+			zap.String("name", task.Name),
+			zap.Int("missed", len(missed)+dropped),
+			zap.String("policy", task.MisfirePolicy))
+
+		// 每个任务的补跑按时间顺序串行执行，不同任务之间并行
+		go s.applyMisfirePolicy(&task, missed, dropped, now)
+	}
+}
+
+// missedFires 计算 (上次计划触发, now) 之间错过的触发时刻，只保留最近的若干个并返回被丢弃的数量
+// 起点为 NextRunAt（每次执行和启用时维护）；未设置时以 LastRunAt 为准，两者都没有说明从未调度过
+func (s *Scheduler) missedFires(task *model.ScheduledTask, now time.Time) ([]time.Time, int) {
+	schedule, err := taskSchedule(task)
+	if err != nil {
+		return nil, 0
+	}
+
+	var next time.Time
+	switch {
+	case task.NextRunAt != nil:
+		next = task.NextRunAt.Truncate(time.Second)
+	case task.LastRunAt != nil:
+		next = schedule.Next(*task.LastRunAt)
+	default:
+		return nil, 0
+	}
+
+	var missed []time.Time
+	dropped := 0
+	// 只统计到当前时刻之前，当前这一秒交给 Cron 正常触发
+	for !next.IsZero() && next.Before(now.Truncate(time.Second)) {
+		missed = append(missed, next)
+		if len(missed) > maxRecordedMisfires {
+			missed = missed[1:]
+			dropped++
+		}
+		next = schedule.Next(next)
+	}
+	return missed, dropped
+}
+
+// applyMisfirePolicy 记录错过的触发，并按策略补跑其中最近的若干次
+func (s *Scheduler) applyMisfirePolicy(task *model.ScheduledTask, missed []time.Time, dropped int, now time.Time) {
+	runs := 0
+	switch task.MisfirePolicy {
+	case MisfireRunOnce:
+		runs = 1
+	case MisfireRunAll:
+		runs = task.MisfireMaxRuns
+		if runs <= 0 {
+			runs = defaultMisfireMaxRuns
+		}
+	}
+
+	var deadline time.Time
+	if task.StartingDeadline > 0 {
+		deadline = now.Add(-time.Duration(task.StartingDeadline) * time.Second)
+	}
+
+	// 可补跑的是最近的 runs 次且未超过启动期限的触发
+	runFrom := len(missed) - runs
+	for i, fireTime := range missed {
+		if !s.election.isLeader() {
+			return
+		}
+		fire, ok := s.claimFire(task.ID, fireTime)
+		if !ok {
+			continue // 已由其他实例处理（例如停机前已开始执行）
+		}
+
+		reason := ""
+		switch {
+		case i < runFrom || runs == 0:
+			reason = fmt.Sprintf("调度器停机期间错过（策略: %s）", misfirePolicyName(task.MisfirePolicy))
+		case !deadline.IsZero() && fireTime.Before(deadline):
+			reason = fmt.Sprintf("超过启动期限 %d 秒，未补跑", task.StartingDeadline)
+		}
+		if reason != "" {
+			if i == 0 && dropped > 0 {
+				reason = fmt.Sprintf("%s；另有 %d 次更早的触发被错过", reason, dropped)
+			}
+			s.finishFire(fire, "missed", reason)
+			continue
+		}
+
+		s.logger.Info("补跑错过的触发", zap.Uint("task_id", task.ID), zap.Time("fire_time", fireTime))
+		s.handleFire(fire)
+	}
+
+	// 错过的触发处理完毕后更新下次执行时间，避免下次切换主节点时重复计算
+	s.db.Model(&model.ScheduledTask{}).Where("id = ? AND enabled = ?", task.ID, true).
+		Update("next_run_at", nextRunTime(task))
+}
+
+func misfirePolicyName(policy string) string {
+	if policy == "" {
+		return MisfireSkip
+	}
+	return policy
+}
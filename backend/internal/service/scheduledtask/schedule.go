@@ -0,0 +1,143 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// 调度类型
+const (
+	ScheduleCron     = "cron"     // 6 字段 Cron 表达式（默认）
+	ScheduleInterval = "interval" // 每 N 分钟执行一次
+	ScheduleOnce     = "once"     // 在指定时间执行一次，执行后自动禁用
+)
+
+// maxJitterSeconds 各主机错开执行的最大时长
+const maxJitterSeconds = 3600
+
+// intervalSchedule 每隔固定时长触发一次，触发时刻对齐到 Unix 纪元，
+// 保证各副本、重启前后计算出的触发时刻一致（用于触发去重和错过检测）
+type intervalSchedule struct {
+	every time.Duration
+}
+
+// Next 返回严格晚于 t 的下一个触发时刻
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	every := int64(s.every / time.Second)
+	next := (t.Unix()/every + 1) * every
+	return time.Unix(next, 0).In(t.Location())
+}
+
+// onceSchedule 只在 at 触发一次
+type onceSchedule struct {
+	at time.Time
+}
+
+// Next 返回 at（若晚于 t），否则返回零值表示不再触发
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at.In(t.Location())
+	}
+	return time.Time{}
+}
+
+// ValidateSchedule 按调度类型校验调度参数
+func ValidateSchedule(scheduleType, cronExpr string, intervalMinutes, jitterSeconds int, runAt *time.Time) error {
+	switch scheduleType {
+	case "", ScheduleCron:
+		if err := ValidateCronExpression(cronExpr); err != nil {
+			return err
+		}
+	case ScheduleInterval:
+		if intervalMinutes < 1 {
+			return fmt.Errorf("interval_minutes 必须大于等于 1")
+		}
+	case ScheduleOnce:
+		if runAt == nil || runAt.IsZero() {
+			return fmt.Errorf("一次性任务必须指定 run_at")
+		}
+	default:
+		return fmt.Errorf("无效的调度类型: %s（可选 cron, interval, once）", scheduleType)
+	}
+	if jitterSeconds < 0 || jitterSeconds > maxJitterSeconds {
+		return fmt.Errorf("jitter_seconds 必须在 0 到 %d 之间", maxJitterSeconds)
+	}
+	return nil
+}
+
+// taskSchedule 返回任务的调度计划
+func taskSchedule(task *model.ScheduledTask) (cron.Schedule, error) {
+	switch task.ScheduleType {
+	case ScheduleInterval:
+		if task.IntervalMinutes < 1 {
+			return nil, fmt.Errorf("interval_minutes 必须大于等于 1")
+		}
+		return intervalSchedule{every: time.Duration(task.IntervalMinutes) * time.Minute}, nil
+	case ScheduleOnce:
+		if task.RunAt == nil {
+			return nil, fmt.Errorf("一次性任务必须指定 run_at")
+		}
+		return onceSchedule{at: task.RunAt.Truncate(time.Second)}, nil
+	default:
+		return parseSchedule(task.CronExpression, task.Timezone)
+	}
+}
+
+// scheduleKey 任务调度计划的标识，用于判断已注册的 Cron 条目是否需要更新
+func scheduleKey(task *model.ScheduledTask) string {
+	switch task.ScheduleType {
+	case ScheduleInterval:
+		return fmt.Sprintf("@interval %dm", task.IntervalMinutes)
+	case ScheduleOnce:
+		if task.RunAt == nil {
+			return "@once"
+		}
+		return "@once " + task.RunAt.UTC().Format(time.RFC3339)
+	default:
+		return cronSpec(task.CronExpression, task.Timezone)
+	}
+}
+
+// nextRunTime 计算任务的下次执行时间，不再触发（如一次性任务已过期）时返回 nil
+func nextRunTime(task *model.ScheduledTask) *time.Time {
+	return nextRunAfter(task, time.Now())
+}
+
+// nextRunAfter 计算 after 之后的下一个调度时刻，不再触发时返回 nil
+func nextRunAfter(task *model.ScheduledTask, after time.Time) *time.Time {
+	schedule, err := taskSchedule(task)
+	if err != nil {
+		return nil
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// hostJitter 返回主机在本次执行中的错开延迟，按任务和主机哈希分布在 [0, jitter] 秒内，
+// 同一主机每次的延迟固定，不同主机彼此错开，避免同时访问共享基础设施
+func hostJitter(taskID, assetID uint, jitterSeconds int) time.Duration {
+	if jitterSeconds <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%d", taskID, assetID)
+	// FNV 对相邻 ID 的结果分布较集中，再做一次位混合
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x45d9f3b
+	x ^= x >> 16
+	return time.Duration(x%uint32(jitterSeconds+1)) * time.Second
+}
@@ -7,7 +7,7 @@ package scheduledtask
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -16,44 +16,62 @@ import (
 
 	"github.com/kkops/backend/internal/config"
 	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+	"github.com/kkops/backend/internal/service/facts"
+	"github.com/kkops/backend/internal/service/maintenance"
+	"github.com/kkops/backend/internal/service/secret"
+	taskService "github.com/kkops/backend/internal/service/task"
 	sshUtils "github.com/kkops/backend/internal/utils"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
-// AssetInfo 资产信息结构（用于解析任务输出）
-type AssetInfo struct {
-	Hostname string `json:"hostname"`
-	CPU      string `json:"cpu"`
-	Memory   string `json:"memory"`
-	Disk     string `json:"disk"`
-}
-
 // Scheduler Cron 调度器
+// 多副本部署时通过数据库租约选主，只有主节点运行 Cron；每次触发另外写入
+// ScheduledTaskFire 去重，保证主节点切换期间同一调度时刻也只执行一次
 type Scheduler struct {
-	cron       *cron.Cron
-	db         *gorm.DB
-	cfg        *config.Config
-	logger     *zap.Logger
-	entries    map[uint]cron.EntryID // taskID -> cronEntryID
-	entriesMux sync.RWMutex
-	service    *Service
+	cron           *cron.Cron
+	db             *gorm.DB
+	cfg            *config.Config
+	logger         *zap.Logger
+	entries        map[uint]cron.EntryID // taskID -> cronEntryID
+	specs          map[uint]string       // taskID -> 已注册的调度表达式，用于同步其他副本的修改
+	entriesMux     sync.RWMutex
+	runs           map[uint]*taskRuns     // taskID -> 本实例上的执行状态（并发策略）
+	deferred       map[uint]*deferredFire // fireID -> 因维护窗口延后的触发
+	runsMux        sync.Mutex
+	service        *Service
+	secretSvc      *secret.Service
+	maintenanceSvc *maintenance.Service
+	deploymentSvc  *deployment.Service
+	factsSvc       *facts.Service
+	election       *election
+	onComplete     taskService.CompletionHook
 }
 
 // NewScheduler 创建调度器
-func NewScheduler(db *gorm.DB, cfg *config.Config, logger *zap.Logger) *Scheduler {
-	return &Scheduler{
-		cron:    cron.New(cron.WithSeconds(), cron.WithChain(cron.Recover(cron.DefaultLogger))),
-		db:      db,
-		cfg:     cfg,
-		logger:  logger,
-		entries: make(map[uint]cron.EntryID),
-		service: NewService(db),
-	}
+func NewScheduler(db *gorm.DB, cfg *config.Config, logger *zap.Logger, secretSvc *secret.Service, maintenanceSvc *maintenance.Service, deploymentSvc *deployment.Service, factsSvc *facts.Service) *Scheduler {
+	s := &Scheduler{
+		cron:           cron.New(cron.WithSeconds(), cron.WithChain(cron.Recover(cron.DefaultLogger))),
+		db:             db,
+		cfg:            cfg,
+		logger:         logger,
+		entries:        make(map[uint]cron.EntryID),
+		specs:          make(map[uint]string),
+		runs:           make(map[uint]*taskRuns),
+		deferred:       make(map[uint]*deferredFire),
+		service:        NewService(db),
+		secretSvc:      secretSvc,
+		maintenanceSvc: maintenanceSvc,
+		deploymentSvc:  deploymentSvc,
+		factsSvc:       factsSvc,
+	}
+	s.election = newElection(s)
+	return s
 }
 
-// Start 启动调度器
+// Start 启动调度器：注册任务并开始竞选主节点，成为主节点后才开始触发任务
 func (s *Scheduler) Start() error {
 	// 加载所有启用的定时任务
 	tasks, err := s.service.GetEnabledScheduledTasks()
@@ -73,21 +91,23 @@ func (s *Scheduler) Start() error {
 			s.logger.Info("已添加定时任务",
 				zap.Uint("task_id", task.ID),
 				zap.String("name", task.Name),
-				zap.String("cron", task.CronExpression))
+				zap.String("schedule", scheduleKey(&task)))
 		}
 	}
 
-	// 启动 Cron 调度器
-	s.cron.Start()
-	s.logger.Info("Cron 调度器已启动")
+	// 开始竞选，成为主节点后启动 Cron 调度器
+	s.election.start()
 
 	return nil
 }
 
-// Stop 停止调度器
+// Stop 停止调度器并释放主节点租约
 func (s *Scheduler) Stop() {
+	s.election.stop()
 	ctx := s.cron.Stop()
 	<-ctx.Done()
+	s.skipQueued()
+	s.skipDeferred()
 	s.logger.Info("Cron 调度器已停止")
 }
 
@@ -104,17 +124,33 @@ func (s *Scheduler) AddTask(task *model.ScheduledTask) error {
 
 	// 添加新任务
 	taskID := task.ID // 捕获 task ID 以避免闭包问题
-	entryID, err := s.cron.AddFunc(task.CronExpression, func() {
-		s.executeTask(taskID)
-	})
+	schedule, err := taskSchedule(task)
 	if err != nil {
 		return fmt.Errorf("添加 Cron 任务失败: %w", err)
 	}
+	entryID := s.cron.Schedule(schedule, cron.FuncJob(func() {
+		s.executeTask(taskID, s.fireTime(taskID))
+	}))
 
 	s.entries[task.ID] = entryID
+	s.specs[task.ID] = scheduleKey(task)
 	return nil
 }
 
+// fireTime 返回任务本次的计划触发时刻，即 Cron 记录的该条目上次触发时间。
+// 不使用作业协程开始运行的时间：GC 停顿或调度延迟会让各副本算出不同的去重键
+func (s *Scheduler) fireTime(taskID uint) time.Time {
+	s.entriesMux.RLock()
+	entryID, ok := s.entries[taskID]
+	s.entriesMux.RUnlock()
+	if ok {
+		if prev := s.cron.Entry(entryID).Prev; !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Now().Truncate(time.Second)
+}
+
 // RemoveTask 从调度器移除任务
 func (s *Scheduler) RemoveTask(taskID uint) {
 	s.entriesMux.Lock()
@@ -123,6 +159,7 @@ func (s *Scheduler) RemoveTask(taskID uint) {
 	if entryID, exists := s.entries[taskID]; exists {
 		s.cron.Remove(entryID)
 		delete(s.entries, taskID)
+		delete(s.specs, taskID)
 		s.logger.Info("已移除定时任务", zap.Uint("task_id", taskID))
 	}
 }
@@ -138,28 +175,165 @@ func (s *Scheduler) UpdateTask(task *model.ScheduledTask) error {
 }
 
 // executeTask 执行定时任务
-func (s *Scheduler) executeTask(taskID uint) {
-	s.logger.Info("开始执行定时任务", zap.Uint("task_id", taskID))
+func (s *Scheduler) executeTask(taskID uint, fireTime time.Time) {
+	// 只有主节点执行；并且同一调度时刻只能被一个实例认领
+	if !s.election.isLeader() {
+		return
+	}
+	fire, ok := s.claimFire(taskID, fireTime)
+	if !ok {
+		s.logger.Info("该调度时刻已由其他实例执行，跳过", zap.Uint("task_id", taskID), zap.Time("fire_time", fireTime))
+		return
+	}
+	// 认领后立即按本次计划时刻推进下次执行时间，执行被跳过或排队时也保持准确
+	s.service.RefreshNextRunAt(taskID, fireTime)
+	s.handleFire(fire)
+}
+
+// handleFire 处理一次已认领的触发：检查任务状态并按并发策略执行
+func (s *Scheduler) handleFire(fire *model.ScheduledTaskFire) {
+	taskID := fire.ScheduledTaskID
 
 	// 获取任务详情
 	var task model.ScheduledTask
 	if err := s.db.First(&task, taskID).Error; err != nil {
 		s.logger.Error("获取定时任务失败", zap.Uint("task_id", taskID), zap.Error(err))
+		s.finishFire(fire, "failed", "获取定时任务失败")
 		return
 	}
 
 	// 检查任务是否仍然启用
 	if !task.Enabled {
 		s.logger.Warn("定时任务已禁用，跳过执行", zap.Uint("task_id", taskID))
+		s.finishFire(fire, "skipped", "定时任务已禁用")
+		return
+	}
+
+	// 目标主机处于维护窗口限制中时拒绝或延后
+	if !s.checkMaintenance(&task, fire) {
 		return
 	}
 
+	// 按并发策略决定本次触发是否执行
+	ctx, admitted := s.admit(&task, fire)
+	if !admitted {
+		return
+	}
+	s.runFire(ctx, &task, fire)
+}
+
+// runFire 执行一次已获准的触发，结束后按 queue 策略启动排队的触发
+func (s *Scheduler) runFire(ctx context.Context, task *model.ScheduledTask, fire *model.ScheduledTaskFire) {
+	status, reason := s.runTask(ctx, task, execTrigger{Type: "scheduled"})
+	if errors.Is(context.Cause(ctx), errReplaced) {
+		status, reason = "cancelled", errReplaced.Error()
+	}
+	s.finishFire(fire, status, reason)
+
+	if next := s.release(task.ID, fire.ID); next != nil {
+		go s.runQueued(next)
+	}
+}
+
+// SetCompletionHook 设置任务执行结束时的回调，用于触发作业链的下游作业
+func (s *Scheduler) SetCompletionHook(hook taskService.CompletionHook) {
+	s.onComplete = hook
+}
+
+// execTrigger 执行记录的触发来源
+type execTrigger struct {
+	Type                string // scheduled, manual, chain
+	UserID              *uint  // 手动触发的用户
+	OverrideMaintenance bool   // 手动触发时管理员已越过维护窗口
+	ChainRunID          *uint  // 由作业链触发时的链路记录 ID
+}
+
+// hostResult 单个主机的执行结果
+type hostResult struct {
+	host    string
+	success bool
+}
+
+// RunNow 立即在后台执行一次任务，不经过 Cron 和并发策略，也不影响调度计划
+func (s *Scheduler) RunNow(task *model.ScheduledTask, userID uint, overrideMaintenance bool) {
+	go func() {
+		trigger := execTrigger{Type: "manual", UserID: &userID, OverrideMaintenance: overrideMaintenance}
+		status, reason := s.runTask(context.Background(), task, trigger)
+		s.logger.Info("手动触发的定时任务执行结束",
+			zap.Uint("task_id", task.ID),
+			zap.Uint("user_id", userID),
+			zap.String("status", status),
+			zap.String("reason", reason))
+	}()
+}
+
+// RunChained 由作业链触发，在后台执行一次任务；与立即执行相同，不经过 Cron 和并发策略
+func (s *Scheduler) RunChained(taskID, chainRunID uint) error {
+	var task model.ScheduledTask
+	if err := s.db.First(&task, taskID).Error; err != nil {
+		return fmt.Errorf("定时任务不存在")
+	}
+	if err := s.maintenanceSvc.Enforce(s.targetAssetIDs(&task), 0, false); err != nil {
+		return err
+	}
+
+	go func() {
+		status, reason := s.runTask(context.Background(), &task, execTrigger{Type: "chain", ChainRunID: &chainRunID})
+		s.logger.Info("作业链触发的定时任务执行结束",
+			zap.Uint("task_id", task.ID),
+			zap.Uint("chain_run_id", chainRunID),
+			zap.String("status", status),
+			zap.String("reason", reason))
+	}()
+	return nil
+}
+
+// runTask 执行任务，返回整体状态及原因；执行结束后通知作业链
+func (s *Scheduler) runTask(ctx context.Context, task *model.ScheduledTask, trigger execTrigger) (string, string) {
+	var status, reason, version string
+	var failedHosts []string
+	if task.TargetType == TargetDeployment {
+		status, reason = s.runDeployment(ctx, task, trigger)
+		version = task.DeploymentVersion
+	} else {
+		status, reason, failedHosts = s.runScript(ctx, task, trigger)
+	}
+
+	// 跳过的执行没有真正运行，不触发下游作业
+	if s.onComplete != nil && status != "skipped" {
+		s.onComplete(taskService.JobResult{
+			JobType:     taskService.JobScheduledTask,
+			JobID:       task.ID,
+			Status:      status,
+			Version:     version,
+			FailedHosts: failedHosts,
+			ChainRunID:  trigger.ChainRunID,
+		})
+	}
+	return status, reason
+}
+
+// runScript 在所有目标主机上执行脚本（facts 类型为运行采集器），返回整体状态、原因及失败的主机
+func (s *Scheduler) runScript(ctx context.Context, task *model.ScheduledTask, trigger execTrigger) (string, string, []string) {
+	taskID := task.ID
+	s.logger.Info("开始执行定时任务", zap.Uint("task_id", taskID))
+
+	// 按固定版本或最新版本解析模板脚本（仅影响本次执行，不修改任务本身）
+	script, err := taskService.ResolveTemplateScript(s.db, task.TemplateID, task.TemplateVersion, task.Content, task.Type)
+	if err != nil {
+		s.logger.Error("解析模板版本失败", zap.Uint("task_id", taskID), zap.Error(err))
+		s.service.UpdateTaskLastRun(taskID, "failed")
+		return "failed", "解析模板版本失败", nil
+	}
+	task.Content = script.Content
+	task.Type = script.Type
+
 	// 解析目标主机
 	assetIDs := s.parseAssetIDs(task.AssetIDs)
 	if len(assetIDs) == 0 {
 		s.logger.Warn("定时任务没有目标主机，跳过执行", zap.Uint("task_id", taskID))
 		s.service.UpdateTaskLastRun(taskID, "skipped")
-		return
+		return "skipped", "没有目标主机", nil
 	}
 
 	// 获取主机信息
@@ -167,19 +341,26 @@ func (s *Scheduler) executeTask(taskID uint) {
 	if err := s.db.Preload("SSHKey").Where("id IN ?", assetIDs).Find(&assets).Error; err != nil {
 		s.logger.Error("获取主机信息失败", zap.Uint("task_id", taskID), zap.Error(err))
 		s.service.UpdateTaskLastRun(taskID, "failed")
-		return
+		return "failed", "获取主机信息失败", nil
 	}
 
 	// 在所有主机上执行任务
 	var wg sync.WaitGroup
-	results := make(chan bool, len(assets))
+	results := make(chan hostResult, len(assets))
 
 	for _, asset := range assets {
 		wg.Add(1)
 		go func(a model.Asset) {
 			defer wg.Done()
-			success := s.executeOnAsset(&task, &a)
-			results <- success
+			// 定时触发时各主机按 jitter 错开开始，手动执行立即开始；被取消时不再等待
+			if delay := hostJitter(task.ID, a.ID, task.JitterSeconds); delay > 0 && trigger.Type == "scheduled" {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+				}
+			}
+			success := s.executeOnAsset(ctx, task, &a, script.Version, trigger)
+			results <- hostResult{host: a.HostName, success: success}
 		}(asset)
 	}
 
@@ -191,11 +372,13 @@ func (s *Scheduler) executeTask(taskID uint) {
 
 	// 统计执行结果
 	var successCount, failCount int
-	for success := range results {
-		if success {
+	var failedHosts []string
+	for result := range results {
+		if result.success {
 			successCount++
 		} else {
 			failCount++
+			failedHosts = append(failedHosts, result.host)
 		}
 	}
 
@@ -215,16 +398,20 @@ func (s *Scheduler) executeTask(taskID uint) {
 		zap.Int("success", successCount),
 		zap.Int("failed", failCount),
 		zap.String("status", status))
+	return status, "", failedHosts
 }
 
 // executeOnAsset 在单个主机上执行任务
-func (s *Scheduler) executeOnAsset(task *model.ScheduledTask, asset *model.Asset) bool {
+func (s *Scheduler) executeOnAsset(ctx context.Context, task *model.ScheduledTask, asset *model.Asset, templateVersion *int, trigger execTrigger) bool {
 	// 创建执行记录
 	now := time.Now()
 	execution := &model.TaskExecution{
 		ScheduledTaskID: &task.ID,
+		TemplateVersion: templateVersion,
 		AssetID:         asset.ID,
-		TriggerType:     "scheduled",
+		TriggerType:     trigger.Type,
+		TriggeredBy:     trigger.UserID,
+		ChainRunID:      trigger.ChainRunID,
 		Status:          "running",
 		StartedAt:       &now,
 	}
@@ -237,8 +424,15 @@ func (s *Scheduler) executeOnAsset(task *model.ScheduledTask, asset *model.Asset
 		return false
 	}
 
-	// 执行命令
-	output, exitCode, err := s.executeCommand(task, asset)
+	// 执行命令；facts 类型运行事实采集器
+	var output string
+	var exitCode int
+	var err error
+	if task.TargetType == TargetFacts {
+		output, exitCode, err = s.collectFacts(ctx, task, asset)
+	} else {
+		output, exitCode, err = s.executeCommand(ctx, task, asset, trigger.ChainRunID)
+	}
 
 	// 更新执行记录
 	finishedAt := time.Now()
@@ -246,7 +440,10 @@ func (s *Scheduler) executeOnAsset(task *model.ScheduledTask, asset *model.Asset
 	execution.Output = output
 	execution.ExitCode = &exitCode
 
-	if err != nil {
+	if err != nil && errors.Is(context.Cause(ctx), errReplaced) {
+		execution.Status = "cancelled"
+		execution.Error = errReplaced.Error()
+	} else if err != nil {
 		execution.Status = "failed"
 		execution.Error = err.Error()
 		s.logger.Error("执行命令失败",
@@ -260,8 +457,8 @@ func (s *Scheduler) executeOnAsset(task *model.ScheduledTask, asset *model.Asset
 		execution.Status = "success"
 
 		// 如果启用了资产更新，解析输出并更新资产信息
-		if task.UpdateAssets {
-			s.updateAssetFromOutput(asset.ID, output)
+		if task.UpdateAssets && task.TargetType != TargetFacts {
+			s.ingestFacts(asset.ID, output)
 		}
 	}
 
@@ -269,56 +466,20 @@ func (s *Scheduler) executeOnAsset(task *model.ScheduledTask, asset *model.Asset
 	return execution.Status == "success"
 }
 
-// updateAssetFromOutput 从输出解析并更新资产信息
-func (s *Scheduler) updateAssetFromOutput(assetID uint, output string) {
-	// 尝试从输出中提取 JSON 部分
-	jsonStart := strings.Index(output, "{")
-	jsonEnd := strings.LastIndex(output, "}")
-	if jsonStart == -1 || jsonEnd == -1 || jsonEnd < jsonStart {
-		s.logger.Warn("无法从输出中提取 JSON", zap.Uint("asset_id", assetID))
-		return
-	}
-
-	jsonStr := output[jsonStart : jsonEnd+1]
-
-	var info AssetInfo
-	if err := json.Unmarshal([]byte(jsonStr), &info); err != nil {
-		s.logger.Error("解析资产信息 JSON 失败",
-			zap.Uint("asset_id", assetID),
-			zap.Error(err),
-			zap.String("json", jsonStr))
-		return
-	}
-
-	// 更新资产信息
-	updates := map[string]interface{}{}
-	if info.CPU != "" {
-		updates["cpu"] = info.CPU
-	}
-	if info.Memory != "" {
-		updates["memory"] = info.Memory
-	}
-	if info.Disk != "" {
-		updates["disk"] = info.Disk
+// executeCommand 执行命令（输出和错误中的密钥值已脱敏）
+func (s *Scheduler) executeCommand(ctx context.Context, task *model.ScheduledTask, asset *model.Asset, chainRunID *uint) (string, int, error) {
+	if asset.SSHKey == nil {
+		return "", -1, fmt.Errorf("主机 %s 没有配置 SSH 密钥", asset.HostName)
 	}
 
-	if len(updates) > 0 {
-		if err := s.db.Model(&model.Asset{}).Where("id = ?", assetID).Updates(updates).Error; err != nil {
-			s.logger.Error("更新资产信息失败",
-				zap.Uint("asset_id", assetID),
-				zap.Error(err))
-		} else {
-			s.logger.Info("已更新资产信息",
-				zap.Uint("asset_id", assetID),
-				zap.Any("updates", updates))
-		}
+	// 按主机所属项目/环境解析脚本中的密钥引用
+	resolved, err := s.secretSvc.Resolve(task.Content, task.Type, asset.ProjectID, asset.EnvironmentID)
+	if err != nil {
+		return "", -1, err
 	}
-}
-
-// executeCommand 执行命令
-func (s *Scheduler) executeCommand(task *model.ScheduledTask, asset *model.Asset) (string, int, error) {
-	if asset.SSHKey == nil {
-		return "", -1, fmt.Errorf("主机 %s 没有配置 SSH 密钥", asset.HostName)
+	// 作业链触发时注入上游作业的上下文
+	for k, v := range taskService.ChainEnv(s.db, chainRunID) {
+		resolved.Env[k] = v
 	}
 
 	// 获取 SSH 用户
@@ -381,11 +542,15 @@ func (s *Scheduler) executeCommand(task *model.ScheduledTask, asset *model.Asset
 	if timeout == 0 {
 		timeout = 5 * time.Minute
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// 执行命令
-	return client.ExecuteCommandWithTimeout(ctx, task.Content)
+	// 执行命令，密钥通过环境变量注入
+	output, exitCode, err := client.ExecuteCommandWithEnv(ctx, resolved.Script, resolved.Env)
+	if err != nil {
+		err = errors.New(resolved.Mask(err.Error()))
+	}
+	return resolved.Mask(output), exitCode, err
 }
 
 // parseAssetIDs 解析主机 ID 字符串
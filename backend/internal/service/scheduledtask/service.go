@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/kkops/backend/internal/model"
+	taskService "github.com/kkops/backend/internal/service/task"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
@@ -32,55 +33,106 @@ func (s *Service) SetScheduler(scheduler *Scheduler) {
 	s.scheduler = scheduler
 }
 
+// GetSchedulerStatus 获取调度器主节点状态
+func (s *Service) GetSchedulerStatus() (*SchedulerStatus, error) {
+	if s.scheduler == nil {
+		return nil, fmt.Errorf("调度器未启动")
+	}
+	return s.scheduler.Status(), nil
+}
+
 // CreateScheduledTaskRequest 创建定时任务请求
 type CreateScheduledTaskRequest struct {
-	Name           string `json:"name" binding:"required"`
-	Description    string `json:"description"`
-	CronExpression string `json:"cron_expression" binding:"required"`
-	TemplateID     *uint  `json:"template_id"`
-	Content        string `json:"content"`
-	Type           string `json:"type"`
-	AssetIDs       []uint `json:"asset_ids"`
-	Timeout        int    `json:"timeout"`
-	Enabled        bool   `json:"enabled"`
-	UpdateAssets   bool   `json:"update_assets"` // 是否更新资产信息
+	Name               string     `json:"name" binding:"required"`
+	Description        string     `json:"description"`
+	TargetType         string     `json:"target_type"`          // script（默认）, deployment, facts
+	DeploymentModuleID *uint      `json:"deployment_module_id"` // deployment 类型必填
+	DeploymentVersion  string     `json:"deployment_version"`   // deployment 类型必填
+	FactCollectors     []string   `json:"fact_collectors"`      // facts 类型：运行的采集器，为空时运行全部
+	ScheduleType       string     `json:"schedule_type"`        // cron（默认）, interval, once
+	CronExpression     string     `json:"cron_expression"`      // cron 类型必填
+	IntervalMinutes    int        `json:"interval_minutes"`     // interval 类型必填
+	RunAt              *time.Time `json:"run_at"`               // once 类型必填
+	JitterSeconds      int        `json:"jitter_seconds"`       // 各主机在 [0, N] 秒内错开执行
+	Timezone           string     `json:"timezone"`             // IANA 时区，为空时使用服务器本地时区
+	TemplateID         *uint      `json:"template_id"`
+	TemplateVersion    *int       `json:"template_version"` // nil 使用自身脚本，0 跟随模板最新版本，>0 固定版本
+	Content            string     `json:"content"`
+	Type               string     `json:"type"`
+	AssetIDs           []uint     `json:"asset_ids"`
+	Timeout            int        `json:"timeout"`
+	Enabled            bool       `json:"enabled"`
+	UpdateAssets       bool       `json:"update_assets"`      // 是否更新资产信息
+	ConcurrencyPolicy  string     `json:"concurrency_policy"` // allow（默认）, skip, queue, replace
+	MisfirePolicy      string     `json:"misfire_policy"`     // skip（默认）, run_once, run_all
+	MisfireMaxRuns     int        `json:"misfire_max_runs"`   // run_all 最多补跑次数，默认 10
+	StartingDeadline   int        `json:"starting_deadline"`  // 秒，超过该时长的错过触发不再补跑，0 表示不限制
 }
 
 // UpdateScheduledTaskRequest 更新定时任务请求
 type UpdateScheduledTaskRequest struct {
-	Name           string `json:"name"`
-	Description    string `json:"description"`
-	CronExpression string `json:"cron_expression"`
-	TemplateID     *uint  `json:"template_id"`
-	Content        string `json:"content"`
-	Type           string `json:"type"`
-	AssetIDs       []uint `json:"asset_ids"`
-	Timeout        int    `json:"timeout"`
-	Enabled        *bool  `json:"enabled"`
-	UpdateAssets   *bool  `json:"update_assets"` // 是否更新资产信息
+	Name               string     `json:"name"`
+	Description        string     `json:"description"`
+	TargetType         string     `json:"target_type"`
+	DeploymentModuleID *uint      `json:"deployment_module_id"`
+	DeploymentVersion  string     `json:"deployment_version"`
+	FactCollectors     []string   `json:"fact_collectors"` // 传空数组表示运行全部采集器
+	ScheduleType       string     `json:"schedule_type"`
+	CronExpression     string     `json:"cron_expression"`
+	IntervalMinutes    *int       `json:"interval_minutes"`
+	RunAt              *time.Time `json:"run_at"`
+	JitterSeconds      *int       `json:"jitter_seconds"`
+	Timezone           *string    `json:"timezone"` // 空字符串表示改回服务器本地时区
+	TemplateID         *uint      `json:"template_id"`
+	TemplateVersion    *int       `json:"template_version"` // 0 跟随最新版本，>0 固定版本，<0 取消关联改用自身脚本
+	Content            string     `json:"content"`
+	Type               string     `json:"type"`
+	AssetIDs           []uint     `json:"asset_ids"`
+	Timeout            int        `json:"timeout"`
+	Enabled            *bool      `json:"enabled"`
+	UpdateAssets       *bool      `json:"update_assets"` // 是否更新资产信息
+	ConcurrencyPolicy  string     `json:"concurrency_policy"`
+	MisfirePolicy      string     `json:"misfire_policy"`
+	MisfireMaxRuns     *int       `json:"misfire_max_runs"`
+	StartingDeadline   *int       `json:"starting_deadline"`
 }
 
 // ScheduledTaskResponse 定时任务响应
 type ScheduledTaskResponse struct {
-	ID             uint       `json:"id"`
-	Name           string     `json:"name"`
-	Description    string     `json:"description"`
-	CronExpression string     `json:"cron_expression"`
-	TemplateID     *uint      `json:"template_id,omitempty"`
-	TemplateName   string     `json:"template_name,omitempty"`
-	Content        string     `json:"content"`
-	Type           string     `json:"type"`
-	AssetIDs       []uint     `json:"asset_ids"`
-	Timeout        int        `json:"timeout"`
-	Enabled        bool       `json:"enabled"`
-	UpdateAssets   bool       `json:"update_assets"` // 是否更新资产信息
-	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
-	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
-	LastStatus     string     `json:"last_status,omitempty"`
-	CreatedBy      uint       `json:"created_by"`
-	CreatorName    string     `json:"creator_name,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID                   uint       `json:"id"`
+	Name                 string     `json:"name"`
+	Description          string     `json:"description"`
+	TargetType           string     `json:"target_type"`
+	DeploymentModuleID   *uint      `json:"deployment_module_id,omitempty"`
+	DeploymentModuleName string     `json:"deployment_module_name,omitempty"`
+	DeploymentVersion    string     `json:"deployment_version,omitempty"`
+	FactCollectors       []string   `json:"fact_collectors,omitempty"`
+	ScheduleType         string     `json:"schedule_type"`
+	CronExpression       string     `json:"cron_expression"`
+	IntervalMinutes      int        `json:"interval_minutes"`
+	RunAt                *time.Time `json:"run_at,omitempty"`
+	JitterSeconds        int        `json:"jitter_seconds"`
+	Timezone             string     `json:"timezone"`
+	TemplateID           *uint      `json:"template_id,omitempty"`
+	TemplateVersion      *int       `json:"template_version"`
+	TemplateName         string     `json:"template_name,omitempty"`
+	Content              string     `json:"content"`
+	Type                 string     `json:"type"`
+	AssetIDs             []uint     `json:"asset_ids"`
+	Timeout              int        `json:"timeout"`
+	Enabled              bool       `json:"enabled"`
+	UpdateAssets         bool       `json:"update_assets"` // 是否更新资产信息
+	ConcurrencyPolicy    string     `json:"concurrency_policy"`
+	MisfirePolicy        string     `json:"misfire_policy"`
+	MisfireMaxRuns       int        `json:"misfire_max_runs"`
+	StartingDeadline     int        `json:"starting_deadline"`
+	LastRunAt            *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt            *time.Time `json:"next_run_at,omitempty"`
+	LastStatus           string     `json:"last_status,omitempty"`
+	CreatedBy            uint       `json:"created_by"`
+	CreatorName          string     `json:"creator_name,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
 }
 
 // ListScheduledTasksResponse 定时任务列表响应
@@ -101,10 +153,9 @@ func ValidateCronExpression(expr string) error {
 	return nil
 }
 
-// GetNextRunTime 获取下次执行时间（使用 6 字段格式）
-func GetNextRunTime(cronExpr string) (*time.Time, error) {
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-	schedule, err := parser.Parse(cronExpr)
+// GetNextRunTime 获取下次执行时间（使用 6 字段格式），timezone 为空时按服务器本地时区计算
+func GetNextRunTime(cronExpr, timezone string) (*time.Time, error) {
+	schedule, err := parseSchedule(cronExpr, timezone)
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +165,23 @@ func GetNextRunTime(cronExpr string) (*time.Time, error) {
 
 // CreateScheduledTask 创建定时任务
 func (s *Service) CreateScheduledTask(userID uint, req CreateScheduledTaskRequest) (*ScheduledTaskResponse, error) {
-	// 验证 Cron 表达式
-	if err := ValidateCronExpression(req.CronExpression); err != nil {
+	// 验证调度计划
+	if req.ScheduleType == "" {
+		req.ScheduleType = ScheduleCron
+	}
+	if err := ValidateSchedule(req.ScheduleType, req.CronExpression, req.IntervalMinutes, req.JitterSeconds, req.RunAt); err != nil {
+		return nil, err
+	}
+	if req.Enabled && req.ScheduleType == ScheduleOnce && !req.RunAt.After(time.Now()) {
+		return nil, fmt.Errorf("一次性任务的执行时间必须晚于当前时间")
+	}
+	if err := ValidateTimezone(req.Timezone); err != nil {
+		return nil, err
+	}
+	if err := ValidateConcurrencyPolicy(req.ConcurrencyPolicy); err != nil {
+		return nil, err
+	}
+	if err := ValidateMisfirePolicy(req.MisfirePolicy, req.MisfireMaxRuns, req.StartingDeadline); err != nil {
 		return nil, err
 	}
 
@@ -132,6 +198,9 @@ func (s *Service) CreateScheduledTask(userID uint, req CreateScheduledTaskReques
 			req.Type = template.Type
 		}
 	}
+	if err := taskService.ValidateTemplateVersion(s.db, req.TemplateID, req.TemplateVersion); err != nil {
+		return nil, err
+	}
 
 	// 设置默认值
 	if req.Type == "" {
@@ -140,11 +209,11 @@ func (s *Service) CreateScheduledTask(userID uint, req CreateScheduledTaskReques
 	if req.Timeout == 0 {
 		req.Timeout = 300
 	}
-
-	// 计算下次执行时间
-	var nextRunAt *time.Time
-	if req.Enabled {
-		nextRunAt, _ = GetNextRunTime(req.CronExpression)
+	if req.ConcurrencyPolicy == "" {
+		req.ConcurrencyPolicy = ConcurrencyAllow
+	}
+	if req.MisfirePolicy == "" {
+		req.MisfirePolicy = MisfireSkip
 	}
 
 	// 将 AssetIDs 转换为字符串
@@ -154,18 +223,39 @@ func (s *Service) CreateScheduledTask(userID uint, req CreateScheduledTaskReques
 	}
 
 	task := &model.ScheduledTask{
-		Name:           req.Name,
-		Description:    req.Description,
-		CronExpression: req.CronExpression,
-		TemplateID:     req.TemplateID,
-		Content:        req.Content,
-		Type:           req.Type,
-		AssetIDs:       strings.Join(assetIDStrs, ","),
-		Timeout:        req.Timeout,
-		Enabled:        req.Enabled,
-		UpdateAssets:   req.UpdateAssets,
-		NextRunAt:      nextRunAt,
-		CreatedBy:      userID,
+		Name:               req.Name,
+		Description:        req.Description,
+		TargetType:         req.TargetType,
+		DeploymentModuleID: req.DeploymentModuleID,
+		DeploymentVersion:  req.DeploymentVersion,
+		FactCollectors:     strings.Join(req.FactCollectors, ","),
+		ScheduleType:       req.ScheduleType,
+		CronExpression:     req.CronExpression,
+		IntervalMinutes:    req.IntervalMinutes,
+		RunAt:              req.RunAt,
+		JitterSeconds:      req.JitterSeconds,
+		Timezone:           req.Timezone,
+		TemplateID:         req.TemplateID,
+		TemplateVersion:    req.TemplateVersion,
+		Content:            req.Content,
+		Type:               req.Type,
+		AssetIDs:           strings.Join(assetIDStrs, ","),
+		Timeout:            req.Timeout,
+		Enabled:            req.Enabled,
+		UpdateAssets:       req.UpdateAssets,
+		ConcurrencyPolicy:  req.ConcurrencyPolicy,
+		MisfirePolicy:      req.MisfirePolicy,
+		MisfireMaxRuns:     req.MisfireMaxRuns,
+		StartingDeadline:   req.StartingDeadline,
+		CreatedBy:          userID,
+	}
+	if err := s.validateTarget(task); err != nil {
+		return nil, err
+	}
+
+	// 计算下次执行时间
+	if task.Enabled {
+		task.NextRunAt = nextRunTime(task)
 	}
 
 	if err := s.db.Create(task).Error; err != nil {
@@ -186,7 +276,7 @@ func (s *Service) CreateScheduledTask(userID uint, req CreateScheduledTaskReques
 // GetScheduledTask 获取定时任务
 func (s *Service) GetScheduledTask(id uint) (*ScheduledTaskResponse, error) {
 	var task model.ScheduledTask
-	if err := s.db.Preload("Template").Preload("Creator").First(&task, id).Error; err != nil {
+	if err := s.db.Preload("Template").Preload("Creator").Preload("DeploymentModule").First(&task, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("定时任务不存在")
 		}
@@ -197,7 +287,7 @@ func (s *Service) GetScheduledTask(id uint) (*ScheduledTaskResponse, error) {
 }
 
 // ListScheduledTasks 获取定时任务列表
-func (s *Service) ListScheduledTasks(page, pageSize int, enabled *bool) (*ListScheduledTasksResponse, error) {
+func (s *Service) ListScheduledTasks(page, pageSize int, enabled *bool, targetType string, moduleID *uint) (*ListScheduledTasksResponse, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -212,13 +302,23 @@ func (s *Service) ListScheduledTasks(page, pageSize int, enabled *bool) (*ListSc
 	if enabled != nil {
 		query = query.Where("enabled = ?", *enabled)
 	}
+	switch targetType {
+	case "":
+	case TargetScript:
+		query = query.Where("target_type = ? OR target_type = '' OR target_type IS NULL", TargetScript)
+	default:
+		query = query.Where("target_type = ?", targetType)
+	}
+	if moduleID != nil {
+		query = query.Where("deployment_module_id = ?", *moduleID)
+	}
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, err
 	}
 
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Template").Preload("Creator").
+	if err := query.Preload("Template").Preload("Creator").Preload("DeploymentModule").
 		Order("created_at DESC").
 		Offset(offset).Limit(pageSize).
 		Find(&tasks).Error; err != nil {
@@ -248,12 +348,30 @@ func (s *Service) UpdateScheduledTask(id uint, req UpdateScheduledTaskRequest) (
 		return nil, err
 	}
 
-	// 验证 Cron 表达式
+	// 调度计划（在所有字段更新后统一校验）
+	if req.ScheduleType != "" {
+		task.ScheduleType = req.ScheduleType
+	}
 	if req.CronExpression != "" {
-		if err := ValidateCronExpression(req.CronExpression); err != nil {
+		task.CronExpression = req.CronExpression
+	}
+	if req.IntervalMinutes != nil {
+		task.IntervalMinutes = *req.IntervalMinutes
+	}
+	if req.RunAt != nil {
+		task.RunAt = req.RunAt
+	}
+	if req.JitterSeconds != nil {
+		task.JitterSeconds = *req.JitterSeconds
+	}
+	if err := ValidateSchedule(task.ScheduleType, task.CronExpression, task.IntervalMinutes, task.JitterSeconds, task.RunAt); err != nil {
+		return nil, err
+	}
+	if req.Timezone != nil {
+		if err := ValidateTimezone(*req.Timezone); err != nil {
 			return nil, err
 		}
-		task.CronExpression = req.CronExpression
+		task.Timezone = *req.Timezone
 	}
 
 	// 更新字段
@@ -263,9 +381,34 @@ func (s *Service) UpdateScheduledTask(id uint, req UpdateScheduledTaskRequest) (
 	if req.Description != "" {
 		task.Description = req.Description
 	}
+	if req.TargetType != "" {
+		task.TargetType = req.TargetType
+	}
+	if req.DeploymentModuleID != nil {
+		task.DeploymentModuleID = req.DeploymentModuleID
+	}
+	if req.DeploymentVersion != "" {
+		task.DeploymentVersion = req.DeploymentVersion
+	}
+	if req.FactCollectors != nil {
+		task.FactCollectors = strings.Join(req.FactCollectors, ",")
+	}
+	if err := s.validateTarget(&task); err != nil {
+		return nil, err
+	}
 	if req.TemplateID != nil {
 		task.TemplateID = req.TemplateID
 	}
+	if req.TemplateVersion != nil {
+		if *req.TemplateVersion < 0 {
+			task.TemplateVersion = nil
+		} else {
+			task.TemplateVersion = req.TemplateVersion
+		}
+	}
+	if err := taskService.ValidateTemplateVersion(s.db, task.TemplateID, task.TemplateVersion); err != nil {
+		return nil, err
+	}
 	if req.Content != "" {
 		task.Content = req.Content
 	}
@@ -284,16 +427,39 @@ func (s *Service) UpdateScheduledTask(id uint, req UpdateScheduledTaskRequest) (
 	}
 	if req.Enabled != nil {
 		task.Enabled = *req.Enabled
-		// 更新下次执行时间
-		if *req.Enabled {
-			task.NextRunAt, _ = GetNextRunTime(task.CronExpression)
-		} else {
-			task.NextRunAt = nil
-		}
 	}
 	if req.UpdateAssets != nil {
 		task.UpdateAssets = *req.UpdateAssets
 	}
+	if req.ConcurrencyPolicy != "" {
+		if err := ValidateConcurrencyPolicy(req.ConcurrencyPolicy); err != nil {
+			return nil, err
+		}
+		task.ConcurrencyPolicy = req.ConcurrencyPolicy
+	}
+	if req.MisfirePolicy != "" {
+		task.MisfirePolicy = req.MisfirePolicy
+	}
+	if req.MisfireMaxRuns != nil {
+		task.MisfireMaxRuns = *req.MisfireMaxRuns
+	}
+	if req.StartingDeadline != nil {
+		task.StartingDeadline = *req.StartingDeadline
+	}
+	if err := ValidateMisfirePolicy(task.MisfirePolicy, task.MisfireMaxRuns, task.StartingDeadline); err != nil {
+		return nil, err
+	}
+
+	if task.Enabled && task.ScheduleType == ScheduleOnce && !task.RunAt.After(time.Now()) {
+		return nil, fmt.Errorf("一次性任务的执行时间必须晚于当前时间")
+	}
+
+	// 调度计划或时区变化后都需要重新计算下次执行时间
+	if task.Enabled {
+		task.NextRunAt = nextRunTime(&task)
+	} else {
+		task.NextRunAt = nil
+	}
 
 	if err := s.db.Save(&task).Error; err != nil {
 		return nil, fmt.Errorf("更新定时任务失败: %w", err)
@@ -360,14 +526,24 @@ func (s *Service) UpdateTaskLastRun(id uint, status string) error {
 	// 计算下次执行时间
 	var task model.ScheduledTask
 	if err := s.db.First(&task, id).Error; err == nil && task.Enabled {
-		if nextRunAt, err := GetNextRunTime(task.CronExpression); err == nil {
-			updates["next_run_at"] = nextRunAt
-		}
+		updates["next_run_at"] = nextRunTime(&task)
 	}
 
 	return s.db.Model(&model.ScheduledTask{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// RefreshNextRunAt 按任务的调度计划重新计算并保存 fireTime 之后的下次执行时间
+func (s *Service) RefreshNextRunAt(id uint, fireTime time.Time) error {
+	var task model.ScheduledTask
+	if err := s.db.First(&task, id).Error; err != nil {
+		return err
+	}
+	if !task.Enabled {
+		return nil
+	}
+	return s.db.Model(&model.ScheduledTask{}).Where("id = ?", id).Update("next_run_at", nextRunAfter(&task, fireTime)).Error
+}
+
 // GetScheduledTaskExecutions 获取定时任务的执行历史
 func (s *Service) GetScheduledTaskExecutions(taskID uint, page, pageSize int) ([]model.TaskExecution, int64, error) {
 	if page < 1 {
@@ -396,25 +572,135 @@ func (s *Service) GetScheduledTaskExecutions(taskID uint, page, pageSize int) ([
 	return executions, total, nil
 }
 
+// GetScheduledTaskFires 获取定时任务的触发历史（包括被跳过、排队和取消的触发及原因）
+func (s *Service) GetScheduledTaskFires(taskID uint, page, pageSize int) ([]model.ScheduledTaskFire, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	var fires []model.ScheduledTaskFire
+	var total int64
+
+	query := s.db.Model(&model.ScheduledTaskFire{}).Where("scheduled_task_id = ?", taskID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("fire_time DESC").
+		Offset(offset).Limit(pageSize).
+		Find(&fires).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return fires, total, nil
+}
+
+// RunNowRequest 立即执行请求，未填写的字段沿用任务配置
+type RunNowRequest struct {
+	AssetIDs            []uint `json:"asset_ids"`            // 覆盖目标主机
+	Timeout             int    `json:"timeout"`              // 覆盖超时时间（秒）
+	OverrideMaintenance bool   `json:"override_maintenance"` // 仅管理员：越过维护窗口立即执行
+}
+
+// RunNowResponse 立即执行响应
+type RunNowResponse struct {
+	TaskID      uint   `json:"task_id"`
+	AssetIDs    []uint `json:"asset_ids"`
+	Timeout     int    `json:"timeout"`
+	TriggerType string `json:"trigger_type"`
+	TriggeredBy uint   `json:"triggered_by"`
+}
+
+// RunScheduledTaskNow 立即执行一次定时任务，不修改任务的调度计划和配置；
+// 执行记录的 TriggerType 为 manual 并记录触发用户，可通过执行历史查看结果
+func (s *Service) RunScheduledTaskNow(id, userID uint, req RunNowRequest) (*RunNowResponse, error) {
+	if s.scheduler == nil {
+		return nil, fmt.Errorf("调度器未启动")
+	}
+
+	var task model.ScheduledTask
+	if err := s.db.First(&task, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("定时任务不存在")
+		}
+		return nil, err
+	}
+
+	if req.Timeout < 0 {
+		return nil, fmt.Errorf("timeout 不能为负数")
+	}
+	if req.Timeout > 0 {
+		task.Timeout = req.Timeout
+	}
+	if len(req.AssetIDs) > 0 {
+		var count int64
+		if err := s.db.Model(&model.Asset{}).Where("id IN ?", req.AssetIDs).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int(count) != len(req.AssetIDs) {
+			return nil, fmt.Errorf("部分目标主机不存在")
+		}
+		assetIDStrs := make([]string, len(req.AssetIDs))
+		for i, assetID := range req.AssetIDs {
+			assetIDStrs[i] = strconv.FormatUint(uint64(assetID), 10)
+		}
+		task.AssetIDs = strings.Join(assetIDStrs, ",")
+	}
+	assetIDs := s.scheduler.targetAssetIDs(&task)
+	if len(assetIDs) == 0 {
+		return nil, fmt.Errorf("定时任务没有目标主机")
+	}
+	if err := s.scheduler.maintenanceSvc.Enforce(assetIDs, userID, req.OverrideMaintenance); err != nil {
+		return nil, err
+	}
+
+	s.scheduler.RunNow(&task, userID, req.OverrideMaintenance)
+
+	return &RunNowResponse{
+		TaskID:      task.ID,
+		AssetIDs:    assetIDs,
+		Timeout:     task.Timeout,
+		TriggerType: "manual",
+		TriggeredBy: userID,
+	}, nil
+}
+
 // taskToResponse 将模型转换为响应
 func (s *Service) taskToResponse(task *model.ScheduledTask) *ScheduledTaskResponse {
 	resp := &ScheduledTaskResponse{
-		ID:             task.ID,
-		Name:           task.Name,
-		Description:    task.Description,
-		CronExpression: task.CronExpression,
-		TemplateID:     task.TemplateID,
-		Content:        task.Content,
-		Type:           task.Type,
-		Timeout:        task.Timeout,
-		Enabled:        task.Enabled,
-		UpdateAssets:   task.UpdateAssets,
-		LastRunAt:      task.LastRunAt,
-		NextRunAt:      task.NextRunAt,
-		LastStatus:     task.LastStatus,
-		CreatedBy:      task.CreatedBy,
-		CreatedAt:      task.CreatedAt,
-		UpdatedAt:      task.UpdatedAt,
+		ID:                 task.ID,
+		Name:               task.Name,
+		Description:        task.Description,
+		TargetType:         task.TargetType,
+		DeploymentModuleID: task.DeploymentModuleID,
+		DeploymentVersion:  task.DeploymentVersion,
+		ScheduleType:       task.ScheduleType,
+		CronExpression:     task.CronExpression,
+		IntervalMinutes:    task.IntervalMinutes,
+		RunAt:              task.RunAt,
+		JitterSeconds:      task.JitterSeconds,
+		Timezone:           task.Timezone,
+		TemplateID:         task.TemplateID,
+		TemplateVersion:    task.TemplateVersion,
+		Content:            task.Content,
+		Type:               task.Type,
+		Timeout:            task.Timeout,
+		Enabled:            task.Enabled,
+		UpdateAssets:       task.UpdateAssets,
+		ConcurrencyPolicy:  task.ConcurrencyPolicy,
+		MisfirePolicy:      task.MisfirePolicy,
+		MisfireMaxRuns:     task.MisfireMaxRuns,
+		StartingDeadline:   task.StartingDeadline,
+		LastRunAt:          task.LastRunAt,
+		NextRunAt:          task.NextRunAt,
+		LastStatus:         task.LastStatus,
+		CreatedBy:          task.CreatedBy,
+		CreatedAt:          task.CreatedAt,
+		UpdatedAt:          task.UpdatedAt,
 	}
 
 	// 解析 AssetIDs
@@ -438,63 +724,92 @@ func (s *Service) taskToResponse(task *model.ScheduledTask) *ScheduledTaskRespon
 		resp.CreatorName = task.Creator.Username
 	}
 
+	if resp.TargetType == "" {
+		resp.TargetType = TargetScript
+	}
+	if task.DeploymentModule != nil {
+		resp.DeploymentModuleName = task.DeploymentModule.Name
+	}
+	resp.FactCollectors = splitCollectors(task.FactCollectors)
+
 	return resp
 }
 
 // ExportScheduledTaskConfig 导出定时任务配置结构
 type ExportScheduledTaskConfig struct {
-	Name           string   `json:"name"`
-	Description    string   `json:"description"`
-	CronExpression string   `json:"cron_expression"`
-	TemplateName   string   `json:"template_name,omitempty"` // 模板名称（如果有）
-	Content        string   `json:"content"`                  // 脚本内容（如果没有模板或自定义）
-	Type           string   `json:"type"`
-	Timeout        int      `json:"timeout"`
-	Enabled        bool     `json:"enabled"`
-	UpdateAssets   bool     `json:"update_assets"`
-	TargetHosts    []string `json:"target_hosts"` // 主机名或 IP 列表
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	ScheduleType      string     `json:"schedule_type,omitempty"`
+	CronExpression    string     `json:"cron_expression,omitempty"`
+	IntervalMinutes   int        `json:"interval_minutes,omitempty"`
+	RunAt             *time.Time `json:"run_at,omitempty"`
+	JitterSeconds     int        `json:"jitter_seconds,omitempty"`
+	Timezone          string     `json:"timezone,omitempty"`
+	TemplateName      string     `json:"template_name,omitempty"` // 模板名称（如果有）
+	Content           string     `json:"content"`                 // 脚本内容（如果没有模板或自定义）
+	Type              string     `json:"type"`
+	Timeout           int        `json:"timeout"`
+	Enabled           bool       `json:"enabled"`
+	UpdateAssets      bool       `json:"update_assets"`
+	ConcurrencyPolicy string     `json:"concurrency_policy,omitempty"`
+	MisfirePolicy     string     `json:"misfire_policy,omitempty"`
+	MisfireMaxRuns    int        `json:"misfire_max_runs,omitempty"`
+	StartingDeadline  int        `json:"starting_deadline,omitempty"`
+	TargetHosts       []string   `json:"target_hosts"` // 主机名或 IP 列表
 }
 
 // ExportScheduledTasksConfig 导出定时任务配置根结构
 type ExportScheduledTasksConfig struct {
-	Version  string                    `json:"version"`
-	ExportAt string                    `json:"export_at"`
+	Version  string                      `json:"version"`
+	ExportAt string                      `json:"export_at"`
 	Tasks    []ExportScheduledTaskConfig `json:"tasks"`
 }
 
 // ImportScheduledTaskConfig 导入定时任务配置结构
 type ImportScheduledTaskConfig struct {
-	Name           string   `json:"name" binding:"required"`
-	Description    string   `json:"description"`
-	CronExpression string   `json:"cron_expression" binding:"required"`
-	TemplateName   string   `json:"template_name"`   // 模板名称（可选）
-	Content        string   `json:"content"`         // 脚本内容（如果没有模板）
-	Type           string   `json:"type"`
-	Timeout        int      `json:"timeout"`
-	Enabled        bool     `json:"enabled"`
-	UpdateAssets   bool     `json:"update_assets"`
-	TargetHosts    []string `json:"target_hosts"` // 主机名或 IP 列表
+	Name              string     `json:"name" binding:"required"`
+	Description       string     `json:"description"`
+	ScheduleType      string     `json:"schedule_type,omitempty"`
+	CronExpression    string     `json:"cron_expression"`
+	IntervalMinutes   int        `json:"interval_minutes,omitempty"`
+	RunAt             *time.Time `json:"run_at,omitempty"`
+	JitterSeconds     int        `json:"jitter_seconds,omitempty"`
+	Timezone          string     `json:"timezone,omitempty"`
+	TemplateName      string     `json:"template_name"` // 模板名称（可选）
+	Content           string     `json:"content"`       // 脚本内容（如果没有模板）
+	Type              string     `json:"type"`
+	Timeout           int        `json:"timeout"`
+	Enabled           bool       `json:"enabled"`
+	UpdateAssets      bool       `json:"update_assets"`
+	ConcurrencyPolicy string     `json:"concurrency_policy,omitempty"`
+	MisfirePolicy     string     `json:"misfire_policy,omitempty"`
+	MisfireMaxRuns    int        `json:"misfire_max_runs,omitempty"`
+	StartingDeadline  int        `json:"starting_deadline,omitempty"`
+	TargetHosts       []string   `json:"target_hosts"` // 主机名或 IP 列表
 }
 
 // ImportScheduledTasksConfig 导入定时任务配置根结构
 type ImportScheduledTasksConfig struct {
-	Version string                    `json:"version"`
+	Version string                      `json:"version"`
 	Tasks   []ImportScheduledTaskConfig `json:"tasks" binding:"required"`
 }
 
 // ImportScheduledTasksResult 导入定时任务结果
 type ImportScheduledTasksResult struct {
-	Total     int      `json:"total"`
-	Success   int      `json:"success"`
-	Failed    int      `json:"failed"`
-	Errors    []string `json:"errors,omitempty"`
-	Skipped   []string `json:"skipped,omitempty"`
+	Total   int      `json:"total"`
+	Success int      `json:"success"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+	Skipped []string `json:"skipped,omitempty"`
 }
 
 // ExportScheduledTasks 导出所有定时任务
 func (s *Service) ExportScheduledTasks() (*ExportScheduledTasksConfig, error) {
+	// 定时部署引用的部署模块 ID 在其他环境中没有意义，只导出脚本类任务
 	var tasks []model.ScheduledTask
-	if err := s.db.Preload("Template").Find(&tasks).Error; err != nil {
+	if err := s.db.Preload("Template").
+		Where("target_type = ? OR target_type = '' OR target_type IS NULL", TargetScript).
+		Find(&tasks).Error; err != nil {
 		return nil, err
 	}
 
@@ -519,16 +834,25 @@ func (s *Service) ExportScheduledTasks() (*ExportScheduledTasksConfig, error) {
 		}
 
 		exportTasks[i] = ExportScheduledTaskConfig{
-			Name:           t.Name,
-			Description:    t.Description,
-			CronExpression: t.CronExpression,
-			TemplateName:   templateName,
-			Content:        t.Content,
-			Type:           t.Type,
-			Timeout:        t.Timeout,
-			Enabled:        t.Enabled,
-			UpdateAssets:   t.UpdateAssets,
-			TargetHosts:    targetHosts,
+			Name:              t.Name,
+			Description:       t.Description,
+			ScheduleType:      t.ScheduleType,
+			CronExpression:    t.CronExpression,
+			IntervalMinutes:   t.IntervalMinutes,
+			RunAt:             t.RunAt,
+			JitterSeconds:     t.JitterSeconds,
+			Timezone:          t.Timezone,
+			TemplateName:      templateName,
+			Content:           t.Content,
+			Type:              t.Type,
+			Timeout:           t.Timeout,
+			Enabled:           t.Enabled,
+			UpdateAssets:      t.UpdateAssets,
+			ConcurrencyPolicy: t.ConcurrencyPolicy,
+			MisfirePolicy:     t.MisfirePolicy,
+			MisfireMaxRuns:    t.MisfireMaxRuns,
+			StartingDeadline:  t.StartingDeadline,
+			TargetHosts:       targetHosts,
 		}
 	}
 
@@ -627,18 +951,51 @@ func (s *Service) ImportScheduledTasks(config *ImportScheduledTasksConfig, userI
 			result.Errors = append(result.Errors, fmt.Sprintf("任务缺少必填字段 'name'"))
 			continue
 		}
-		if t.CronExpression == "" {
+		scheduleType := t.ScheduleType
+		if scheduleType == "" {
+			scheduleType = ScheduleCron
+		}
+		if scheduleType == ScheduleCron && t.CronExpression == "" {
 			result.Failed++
 			result.Errors = append(result.Errors, fmt.Sprintf("任务 '%s': 缺少必填字段 'cron_expression'", t.Name))
 			continue
 		}
 
-		// 验证 Cron 表达式
-		if err := ValidateCronExpression(t.CronExpression); err != nil {
+		// 验证调度计划
+		if err := ValidateSchedule(scheduleType, t.CronExpression, t.IntervalMinutes, t.JitterSeconds, t.RunAt); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("任务 '%s': %v", t.Name, err))
+			continue
+		}
+		enabled := t.Enabled
+		if enabled && scheduleType == ScheduleOnce && !t.RunAt.After(time.Now()) {
+			enabled = false
+			result.Skipped = append(result.Skipped, fmt.Sprintf("任务 '%s': 一次性任务的执行时间已过，已导入为禁用状态", t.Name))
+		}
+		if err := ValidateTimezone(t.Timezone); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("任务 '%s': %v", t.Name, err))
+			continue
+		}
+
+		if err := ValidateConcurrencyPolicy(t.ConcurrencyPolicy); err != nil {
 			result.Failed++
 			result.Errors = append(result.Errors, fmt.Sprintf("任务 '%s': %v", t.Name, err))
 			continue
 		}
+		concurrencyPolicy := t.ConcurrencyPolicy
+		if concurrencyPolicy == "" {
+			concurrencyPolicy = ConcurrencyAllow
+		}
+		if err := ValidateMisfirePolicy(t.MisfirePolicy, t.MisfireMaxRuns, t.StartingDeadline); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("任务 '%s': %v", t.Name, err))
+			continue
+		}
+		misfirePolicy := t.MisfirePolicy
+		if misfirePolicy == "" {
+			misfirePolicy = MisfireSkip
+		}
 
 		// 检查是否已存在同名任务
 		if s.taskExistsByName(t.Name) {
@@ -706,12 +1063,6 @@ func (s *Service) ImportScheduledTasks(config *ImportScheduledTasksConfig, userI
 			}
 		}
 
-		// 计算下次执行时间
-		var nextRunAt *time.Time
-		if t.Enabled {
-			nextRunAt, _ = GetNextRunTime(t.CronExpression)
-		}
-
 		// 将 AssetIDs 转换为字符串
 		assetIDStrs := make([]string, len(assetIDs))
 		for i, id := range assetIDs {
@@ -720,18 +1071,29 @@ func (s *Service) ImportScheduledTasks(config *ImportScheduledTasksConfig, userI
 
 		// 创建定时任务
 		task := &model.ScheduledTask{
-			Name:           t.Name,
-			Description:    t.Description,
-			CronExpression: t.CronExpression,
-			TemplateID:     templateID,
-			Content:        content,
-			Type:           taskTypeFromTemplate,
-			AssetIDs:       strings.Join(assetIDStrs, ","),
-			Timeout:        timeout,
-			Enabled:        t.Enabled,
-			UpdateAssets:   t.UpdateAssets,
-			NextRunAt:      nextRunAt,
-			CreatedBy:      userID,
+			Name:              t.Name,
+			Description:       t.Description,
+			ScheduleType:      scheduleType,
+			CronExpression:    t.CronExpression,
+			IntervalMinutes:   t.IntervalMinutes,
+			RunAt:             t.RunAt,
+			JitterSeconds:     t.JitterSeconds,
+			Timezone:          t.Timezone,
+			TemplateID:        templateID,
+			Content:           content,
+			Type:              taskTypeFromTemplate,
+			AssetIDs:          strings.Join(assetIDStrs, ","),
+			Timeout:           timeout,
+			Enabled:           enabled,
+			UpdateAssets:      t.UpdateAssets,
+			ConcurrencyPolicy: concurrencyPolicy,
+			MisfirePolicy:     misfirePolicy,
+			MisfireMaxRuns:    t.MisfireMaxRuns,
+			StartingDeadline:  t.StartingDeadline,
+			CreatedBy:         userID,
+		}
+		if task.Enabled {
+			task.NextRunAt = nextRunTime(task)
 		}
 
 		if err := s.db.Create(task).Error; err != nil {
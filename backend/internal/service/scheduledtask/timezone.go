@@ -0,0 +1,218 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scheduledtask
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	// 内置 IANA 时区数据库，避免依赖宿主机的 /usr/share/zoneinfo
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+const (
+	defaultUpcomingCount = 10
+	maxUpcomingCount     = 100
+	defaultCalendarLimit = 1000
+	maxCalendarLimit     = 5000
+	defaultCalendarRange = 24 * time.Hour
+	maxCalendarRange     = 31 * 24 * time.Hour
+)
+
+// UpcomingFire 一次即将到来的触发
+type UpcomingFire struct {
+	TaskID    uint      `json:"task_id"`
+	TaskName  string    `json:"task_name"`
+	Timezone  string    `json:"timezone"`
+	FireTime  time.Time `json:"fire_time"`  // 按任务时区表示的触发时间
+	LocalTime string    `json:"local_time"` // 任务时区下的墙上时间，便于核对夏令时
+}
+
+// UpcomingFiresResponse 单个任务的后续触发时间
+type UpcomingFiresResponse struct {
+	TaskID   uint           `json:"task_id"`
+	Timezone string         `json:"timezone"`
+	Fires    []UpcomingFire `json:"fires"`
+}
+
+// FireCollision 同一时刻有多个任务触发
+type FireCollision struct {
+	FireTime  time.Time `json:"fire_time"`
+	TaskIDs   []uint    `json:"task_ids"`
+	TaskNames []string  `json:"task_names"`
+}
+
+// ScheduleCalendarResponse 时间窗口内所有启用任务的触发日历
+type ScheduleCalendarResponse struct {
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Fires      []UpcomingFire  `json:"fires"`
+	Collisions []FireCollision `json:"collisions"`
+	Truncated  bool            `json:"truncated"` // 触发次数超过 limit 时为 true，结果只包含最早的 limit 次
+}
+
+// ValidateTimezone 验证 IANA 时区名称，空字符串表示服务器本地时区
+func ValidateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("无效的时区: %s，请使用 IANA 时区名称，例如 Asia/Shanghai", tz)
+	}
+	return nil
+}
+
+// cronSpec 返回注册到 Cron 的表达式，带时区时使用 CRON_TZ 前缀
+func cronSpec(expr, tz string) string {
+	if tz == "" {
+		return expr
+	}
+	return "CRON_TZ=" + tz + " " + expr
+}
+
+// parseSchedule 按任务时区解析 6 字段 Cron 表达式
+func parseSchedule(expr, tz string) (cron.Schedule, error) {
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return parser.Parse(cronSpec(expr, tz))
+}
+
+// timezoneName 返回时区的展示名称
+func timezoneName(tz string) string {
+	if tz == "" {
+		return time.Local.String()
+	}
+	return tz
+}
+
+func newUpcomingFire(task *model.ScheduledTask, t time.Time) UpcomingFire {
+	if loc, err := time.LoadLocation(task.Timezone); err == nil && task.Timezone != "" {
+		t = t.In(loc)
+	}
+	return UpcomingFire{
+		TaskID:    task.ID,
+		TaskName:  task.Name,
+		Timezone:  timezoneName(task.Timezone),
+		FireTime:  t,
+		LocalTime: t.Format("2006-01-02 15:04:05 MST"),
+	}
+}
+
+// GetUpcomingFires 获取单个任务接下来 count 次的触发时间
+func (s *Service) GetUpcomingFires(id uint, count int) (*UpcomingFiresResponse, error) {
+	if count <= 0 {
+		count = defaultUpcomingCount
+	}
+	if count > maxUpcomingCount {
+		count = maxUpcomingCount
+	}
+
+	var task model.ScheduledTask
+	if err := s.db.First(&task, id).Error; err != nil {
+		return nil, fmt.Errorf("定时任务不存在")
+	}
+	schedule, err := taskSchedule(&task)
+	if err != nil {
+		return nil, fmt.Errorf("解析调度计划失败: %w", err)
+	}
+
+	resp := &UpcomingFiresResponse{
+		TaskID:   task.ID,
+		Timezone: timezoneName(task.Timezone),
+		Fires:    make([]UpcomingFire, 0, count),
+	}
+	next := time.Now()
+	for i := 0; i < count; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		resp.Fires = append(resp.Fires, newUpcomingFire(&task, next))
+	}
+	return resp, nil
+}
+
+// GetScheduleCalendar 获取 [from, to) 窗口内所有启用任务的触发时间，并标出同一时刻触发的任务
+func (s *Service) GetScheduleCalendar(from, to time.Time, limit int) (*ScheduleCalendarResponse, error) {
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() {
+		to = from.Add(defaultCalendarRange)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	if to.Sub(from) > maxCalendarRange {
+		return nil, fmt.Errorf("时间窗口不能超过 %d 天", int(maxCalendarRange/(24*time.Hour)))
+	}
+	if limit <= 0 {
+		limit = defaultCalendarLimit
+	}
+	if limit > maxCalendarLimit {
+		limit = maxCalendarLimit
+	}
+
+	tasks, err := s.GetEnabledScheduledTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ScheduleCalendarResponse{
+		From:       from,
+		To:         to,
+		Fires:      []UpcomingFire{},
+		Collisions: []FireCollision{},
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		schedule, err := taskSchedule(task)
+		if err != nil {
+			continue
+		}
+		// 每个任务最多取 limit+1 次即可判断是否截断
+		count := 0
+		for next := schedule.Next(from.Add(-time.Second)); !next.IsZero() && next.Before(to); next = schedule.Next(next) {
+			if count > limit {
+				break
+			}
+			resp.Fires = append(resp.Fires, newUpcomingFire(task, next))
+			count++
+		}
+	}
+
+	sort.SliceStable(resp.Fires, func(i, j int) bool {
+		if resp.Fires[i].FireTime.Equal(resp.Fires[j].FireTime) {
+			return resp.Fires[i].TaskID < resp.Fires[j].TaskID
+		}
+		return resp.Fires[i].FireTime.Before(resp.Fires[j].FireTime)
+	})
+	if len(resp.Fires) > limit {
+		resp.Fires = resp.Fires[:limit]
+		resp.Truncated = true
+	}
+
+	// 相邻且时刻相同的触发即为冲突
+	for i := 0; i < len(resp.Fires); {
+		j := i + 1
+		for j < len(resp.Fires) && resp.Fires[j].FireTime.Equal(resp.Fires[i].FireTime) {
+			j++
+		}
+		if j-i > 1 {
+			collision := FireCollision{FireTime: resp.Fires[i].FireTime}
+			for _, f := range resp.Fires[i:j] {
+				collision.TaskIDs = append(collision.TaskIDs, f.TaskID)
+				collision.TaskNames = append(collision.TaskNames, f.TaskName)
+			}
+			resp.Collisions = append(resp.Collisions, collision)
+		}
+		i = j
+	}
+	return resp, nil
+}
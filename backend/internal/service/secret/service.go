@@ -0,0 +1,350 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// MaskText 替换输出中密钥值的占位文本
+const MaskText = "******"
+
+var (
+	namePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	referencePattern = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Service handles secret storage and script injection
+type Service struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewService creates a new secret service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{db: db, config: cfg}
+}
+
+// CreateSecretRequest represents a request to create a secret
+type CreateSecretRequest struct {
+	Name          string `json:"name" binding:"required"`
+	ProjectID     *uint  `json:"project_id"`
+	EnvironmentID *uint  `json:"environment_id"`
+	Value         string `json:"value" binding:"required"`
+	Description   string `json:"description"`
+}
+
+// UpdateSecretRequest represents a request to update a secret
+type UpdateSecretRequest struct {
+	Value       string `json:"value"` // 为空时保持原值
+	Description string `json:"description"`
+}
+
+// SecretResponse represents a secret response (the value is never returned)
+type SecretResponse struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	Reference       string    `json:"reference"` // 脚本中的引用写法
+	EnvName         string    `json:"env_name"`  // 注入的环境变量名
+	ProjectID       *uint     `json:"project_id"`
+	ProjectName     string    `json:"project_name"`
+	EnvironmentID   *uint     `json:"environment_id"`
+	EnvironmentName string    `json:"environment_name"`
+	Description     string    `json:"description"`
+	CreatedBy       uint      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Resolved holds a script whose secret references were rewritten to
+// environment variable lookups, plus the variables to inject for it
+type Resolved struct {
+	Script string
+	Env    map[string]string
+	values []string
+}
+
+// Mask replaces every injected secret value in s with MaskText
+func (r *Resolved) Mask(s string) string {
+	if r == nil {
+		return s
+	}
+	return Mask(s, r.values)
+}
+
+// Export adds an environment variable for the script; secret values are masked in its output
+func (r *Resolved) Export(name, value string, secret bool) {
+	r.Env[name] = value
+	if secret {
+		r.values = append(r.values, value)
+	}
+}
+
+// Mask replaces every occurrence of the given values in s with MaskText
+func Mask(s string, values []string) string {
+	if s == "" || len(values) == 0 {
+		return s
+	}
+	// 先替换较长的值，避免部分匹配
+	sorted := append([]string(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, v := range sorted {
+		if v != "" {
+			s = strings.ReplaceAll(s, v, MaskText)
+		}
+	}
+	return s
+}
+
+// EnvName returns the environment variable a secret is injected as
+func EnvName(name string) string {
+	return "SECRET_" + strings.ToUpper(name)
+}
+
+// References returns the distinct secret names referenced in content
+func References(content string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range referencePattern.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// CreateSecret creates a new encrypted secret
+func (s *Service) CreateSecret(userID uint, req *CreateSecretRequest) (*SecretResponse, error) {
+	if !namePattern.MatchString(req.Name) {
+		return nil, errors.New("secret name must start with a letter or underscore and contain only letters, digits and underscores")
+	}
+	if err := s.checkName(req.Name, req.ProjectID, req.EnvironmentID); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.Encrypt([]byte(req.Value), s.config.Encryption.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	secret := model.Secret{
+		Name:          req.Name,
+		ProjectID:     req.ProjectID,
+		EnvironmentID: req.EnvironmentID,
+		Value:         encrypted,
+		Description:   req.Description,
+		CreatedBy:     userID,
+	}
+	if err := s.db.Create(&secret).Error; err != nil {
+		return nil, err
+	}
+
+	return s.GetSecret(secret.ID)
+}
+
+// GetSecret retrieves a secret's metadata by ID
+func (s *Service) GetSecret(id uint) (*SecretResponse, error) {
+	var secret model.Secret
+	if err := s.db.Preload("Project").Preload("Environment").First(&secret, id).Error; err != nil {
+		return nil, err
+	}
+	return secretToResponse(&secret), nil
+}
+
+// ListSecrets retrieves secrets with optional project and environment filters
+func (s *Service) ListSecrets(projectID, environmentID *uint) ([]SecretResponse, error) {
+	query := s.db.Preload("Project").Preload("Environment")
+	if projectID != nil {
+		query = query.Where("project_id = ?", *projectID)
+	}
+	if environmentID != nil {
+		query = query.Where("environment_id = ?", *environmentID)
+	}
+
+	var secrets []model.Secret
+	if err := query.Order("name ASC").Find(&secrets).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]SecretResponse, len(secrets))
+	for i := range secrets {
+		result[i] = *secretToResponse(&secrets[i])
+	}
+	return result, nil
+}
+
+// UpdateSecret updates a secret's value or description
+func (s *Service) UpdateSecret(id uint, req *UpdateSecretRequest) (*SecretResponse, error) {
+	var secret model.Secret
+	if err := s.db.First(&secret, id).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Value != "" {
+		encrypted, err := utils.Encrypt([]byte(req.Value), s.config.Encryption.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+		}
+		secret.Value = encrypted
+	}
+	if req.Description != "" {
+		secret.Description = req.Description
+	}
+
+	if err := s.db.Save(&secret).Error; err != nil {
+		return nil, err
+	}
+	return s.GetSecret(id)
+}
+
+// DeleteSecret deletes a secret
+func (s *Service) DeleteSecret(id uint) error {
+	return s.db.Delete(&model.Secret{}, id).Error
+}
+
+// Resolve rewrites ${secret:name} references in script to environment variable
+// lookups and decrypts the referenced values for injection. The most specific
+// secret wins: project+environment, then project, then environment, then global.
+func (s *Service) Resolve(script, scriptType string, projectID, environmentID *uint) (*Resolved, error) {
+	resolved := &Resolved{Script: script, Env: map[string]string{}}
+	names := References(script)
+	if len(names) == 0 {
+		return resolved, nil
+	}
+
+	for _, name := range names {
+		value, err := s.lookup(name, projectID, environmentID)
+		if err != nil {
+			return nil, err
+		}
+		envName := EnvName(name)
+		resolved.Env[envName] = value
+		resolved.values = append(resolved.values, value)
+	}
+
+	resolved.Script = referencePattern.ReplaceAllStringFunc(script, func(ref string) string {
+		name := referencePattern.FindStringSubmatch(ref)[1]
+		if scriptType == "python" {
+			return fmt.Sprintf("__import__('os').environ['%s']", EnvName(name))
+		}
+		return "${" + EnvName(name) + "}"
+	})
+	return resolved, nil
+}
+
+// Lookup returns the decrypted value of the most specific secret with the given
+// name, for credentials used by the server itself rather than injected into scripts
+func (s *Service) Lookup(name string, projectID, environmentID *uint) (string, error) {
+	return s.lookup(name, projectID, environmentID)
+}
+
+// lookup finds and decrypts the most specific secret for the given scope; names
+// match case-insensitively like checkName
+func (s *Service) lookup(name string, projectID, environmentID *uint) (string, error) {
+	var candidates []model.Secret
+	if err := s.db.Where("UPPER(name) = ?", strings.ToUpper(name)).Find(&candidates).Error; err != nil {
+		return "", err
+	}
+
+	var best *model.Secret
+	bestScore := -1
+	for i := range candidates {
+		c := &candidates[i]
+		score := 0
+		if c.ProjectID != nil {
+			if projectID == nil || *c.ProjectID != *projectID {
+				continue
+			}
+			score += 2
+		}
+		if c.EnvironmentID != nil {
+			if environmentID == nil || *c.EnvironmentID != *environmentID {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+
+	plaintext, err := utils.Decrypt(best.Value, s.config.Encryption.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return string(plaintext), nil
+}
+
+// checkName rejects a name that is already used in the same scope, or that differs
+// only in case from a secret in an overlapping scope. Names are matched
+// case-insensitively because they share one environment variable (see EnvName):
+// db_pass and DB_PASS are both SECRET_DB_PASS.
+func (s *Service) checkName(name string, projectID, environmentID *uint) error {
+	var existing []model.Secret
+	if err := s.db.Where("UPPER(name) = ?", strings.ToUpper(name)).Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, e := range existing {
+		if sameScope(e.ProjectID, projectID) && sameScope(e.EnvironmentID, environmentID) {
+			return errors.New("secret with the same name already exists in this scope")
+		}
+		// 作用域可能同时生效时名称必须完全一致，才能按优先级覆盖而不是互相冲突
+		if e.Name != name && overlaps(e.ProjectID, projectID) && overlaps(e.EnvironmentID, environmentID) {
+			return fmt.Errorf("secret name %s conflicts with %s in an overlapping scope: both are injected as %s", name, e.Name, EnvName(name))
+		}
+	}
+	return nil
+}
+
+// sameScope reports whether two optional scope IDs are equal
+func sameScope(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// overlaps reports whether two optional scope IDs can apply together (unset applies to all)
+func overlaps(a, b *uint) bool {
+	return a == nil || b == nil || *a == *b
+}
+
+func secretToResponse(s *model.Secret) *SecretResponse {
+	resp := &SecretResponse{
+		ID:            s.ID,
+		Name:          s.Name,
+		Reference:     "${secret:" + s.Name + "}",
+		EnvName:       EnvName(s.Name),
+		ProjectID:     s.ProjectID,
+		EnvironmentID: s.EnvironmentID,
+		Description:   s.Description,
+		CreatedBy:     s.CreatedBy,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+	}
+	if s.Project != nil {
+		resp.ProjectName = s.Project.Name
+	}
+	if s.Environment != nil {
+		resp.EnvironmentName = s.Environment.Name
+	}
+	return resp
+}
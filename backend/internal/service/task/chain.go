@@ -0,0 +1,56 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package task
+
+import (
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+)
+
+// Job types that can start or be started by a job chain
+const (
+	JobTask          = "task"           // 运维执行任务
+	JobScheduledTask = "scheduled_task" // 定时任务
+	JobDeployment    = "deployment"     // 部署模块
+)
+
+// JobResult describes a finished task run, scheduled task run or deployment
+type JobResult struct {
+	JobType     string   // task, scheduled_task, deployment
+	JobID       uint     // task ID, scheduled task ID or deployment module ID
+	RunID       uint     // deployment ID for deployments, 0 otherwise
+	Status      string   // success, failed, partial, cancelled
+	Version     string   // deployed version, if any
+	FailedHosts []string // hosts that did not succeed
+	ChainRunID  *uint    // chain run that started this job, if any
+}
+
+// CompletionHook is called when a job finishes so that chained jobs can be started
+type CompletionHook func(JobResult)
+
+// ChainEnv returns the upstream context of a chained run as environment
+// variables for the downstream script. It returns nil for runs that were not
+// started by a job chain.
+func ChainEnv(db *gorm.DB, chainRunID *uint) map[string]string {
+	if chainRunID == nil {
+		return nil
+	}
+	var run model.JobChainRun
+	if err := db.First(&run, *chainRunID).Error; err != nil {
+		return nil
+	}
+	return map[string]string{
+		"KKOPS_CHAIN_RUN_ID":          strconv.FormatUint(uint64(run.ID), 10),
+		"KKOPS_UPSTREAM_TYPE":         run.SourceType,
+		"KKOPS_UPSTREAM_ID":           strconv.FormatUint(uint64(run.SourceID), 10),
+		"KKOPS_UPSTREAM_STATUS":       run.SourceStatus,
+		"KKOPS_UPSTREAM_VERSION":      run.SourceVersion,
+		"KKOPS_UPSTREAM_FAILED_HOSTS": run.FailedHosts,
+	}
+}
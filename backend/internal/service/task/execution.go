@@ -10,32 +10,54 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/kkops/backend/internal/config"
 	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/secret"
+	"github.com/kkops/backend/internal/service/maintenance"
 	"github.com/kkops/backend/internal/service/sshkey"
 	"github.com/kkops/backend/internal/utils"
 )
 
 // ExecutionService handles task execution
 type ExecutionService struct {
-	db        *gorm.DB
-	config    *config.Config
-	sshkeySvc *sshkey.Service
+	db             *gorm.DB
+	config         *config.Config
+	sshkeySvc      *sshkey.Service
+	secretSvc      *secret.Service
+	maintenanceSvc *maintenance.Service
+	onComplete     CompletionHook
 }
 
 // NewExecutionService creates a new task execution service
-func NewExecutionService(db *gorm.DB, cfg *config.Config, sshkeySvc *sshkey.Service) *ExecutionService {
+func NewExecutionService(db *gorm.DB, cfg *config.Config, sshkeySvc *sshkey.Service, secretSvc *secret.Service, maintenanceSvc *maintenance.Service) *ExecutionService {
 	return &ExecutionService{
-		db:        db,
-		config:    cfg,
-		sshkeySvc: sshkeySvc,
+		db:             db,
+		config:         cfg,
+		sshkeySvc:      sshkeySvc,
+		secretSvc:      secretSvc,
+		maintenanceSvc: maintenanceSvc,
 	}
 }
 
+// SetCompletionHook registers a callback that is invoked once every execution of a run has finished
+func (s *ExecutionService) SetCompletionHook(hook CompletionHook) {
+	s.onComplete = hook
+}
+
+// ExecuteOptions controls how a task run is started and recorded
+type ExecuteOptions struct {
+	ExecutionType       string // sync or async
+	TriggerType         string // manual, webhook, chain
+	TriggeredBy         *uint  // user who started a manual run
+	OverrideMaintenance bool   // 管理员越过维护窗口
+	ChainRunID          *uint  // job chain run that started this run
+}
+
 // CreateTaskExecutions creates execution records for a task
 func (s *ExecutionService) CreateTaskExecutions(taskID uint, assetIDs []uint) error {
 	executions := make([]model.TaskExecution, len(assetIDs))
@@ -72,6 +94,23 @@ func parseTaskAssetIDs(assetIDsStr string) []uint {
 
 // ExecuteTask executes a task on all target assets
 func (s *ExecutionService) ExecuteTask(taskID uint, executionType string) error {
+	return s.ExecuteTaskWithTrigger(taskID, executionType, "manual")
+}
+
+// ExecuteTaskWithTrigger executes a task and records how the run was triggered (manual, webhook)
+func (s *ExecutionService) ExecuteTaskWithTrigger(taskID uint, executionType, triggerType string) error {
+	return s.ExecuteTaskWithOptions(taskID, ExecuteOptions{ExecutionType: executionType, TriggerType: triggerType})
+}
+
+// ExecuteTaskWithOptions executes a task on all target assets. Runs that touch
+// hosts inside a blocking maintenance window are rejected unless an
+// administrator overrides the window.
+func (s *ExecutionService) ExecuteTaskWithOptions(taskID uint, opts ExecuteOptions) error {
+	executionType := opts.ExecutionType
+	if opts.TriggerType == "" {
+		opts.TriggerType = "manual"
+	}
+
 	// Get the task
 	var task model.Task
 	if err := s.db.First(&task, taskID).Error; err != nil {
@@ -84,6 +123,20 @@ func (s *ExecutionService) ExecuteTask(taskID uint, executionType string) error
 		return fmt.Errorf("no assets configured for this task")
 	}
 
+	var userID uint
+	if opts.TriggeredBy != nil {
+		userID = *opts.TriggeredBy
+	}
+	if err := s.maintenanceSvc.Enforce(assetIDs, userID, opts.OverrideMaintenance); err != nil {
+		return err
+	}
+
+	// Resolve the script from the pinned or latest template version
+	script, err := ResolveTemplateScript(s.db, task.TemplateID, task.TemplateVersion, task.Content, task.Type)
+	if err != nil {
+		return err
+	}
+
 	// Update task status
 	task.Status = "running"
 	now := time.Now()
@@ -97,20 +150,37 @@ func (s *ExecutionService) ExecuteTask(taskID uint, executionType string) error
 	execTaskID := task.ID
 	for i, assetID := range assetIDs {
 		executions[i] = model.TaskExecution{
-			TaskID:  &execTaskID,
-			AssetID: assetID,
-			Status:  "pending",
+			TaskID:          &execTaskID,
+			TemplateVersion: script.Version,
+			AssetID:         assetID,
+			TriggerType:     opts.TriggerType,
+			TriggeredBy:     opts.TriggeredBy,
+			ChainRunID:      opts.ChainRunID,
+			Status:          "pending",
 		}
 	}
 	if err := s.db.Create(&executions).Error; err != nil {
 		return fmt.Errorf("failed to create execution records: %w", err)
 	}
 
+	// Executions run the resolved script; the stored task is left unchanged
+	task.Content = script.Content
+	task.Type = script.Type
+
 	if executionType == "async" {
-		// Execute asynchronously in goroutines
-		for _, exec := range executions {
-			go s.executeTaskOnAsset(context.Background(), task, exec.ID)
-		}
+		// Execute asynchronously in goroutines and report the run once all have finished
+		go func() {
+			var wg sync.WaitGroup
+			for _, exec := range executions {
+				wg.Add(1)
+				go func(executionID uint) {
+					defer wg.Done()
+					s.executeTaskOnAsset(context.Background(), task, executionID)
+				}(exec.ID)
+			}
+			wg.Wait()
+			s.notifyCompletion(task.ID, executions, opts.ChainRunID)
+		}()
 		return nil
 	}
 
@@ -124,9 +194,49 @@ func (s *ExecutionService) ExecuteTask(taskID uint, executionType string) error
 
 	// Update task status based on execution results
 	s.updateTaskStatus(taskID)
+	s.notifyCompletion(task.ID, executions, opts.ChainRunID)
 	return nil
 }
 
+// notifyCompletion reports the outcome of a finished run to the completion hook
+func (s *ExecutionService) notifyCompletion(taskID uint, executions []model.TaskExecution, chainRunID *uint) {
+	if s.onComplete == nil {
+		return
+	}
+
+	ids := make([]uint, len(executions))
+	for i, exec := range executions {
+		ids[i] = exec.ID
+	}
+	var finished []model.TaskExecution
+	if err := s.db.Preload("Asset").Where("id IN ?", ids).Find(&finished).Error; err != nil {
+		return
+	}
+
+	result := JobResult{JobType: JobTask, JobID: taskID, Status: "success", ChainRunID: chainRunID}
+	cancelled := false
+	for _, exec := range finished {
+		switch exec.Status {
+		case "success":
+			continue
+		case "cancelled":
+			cancelled = true
+		default:
+			result.Status = "failed"
+		}
+		host := exec.Asset.HostName
+		if host == "" {
+			host = exec.Asset.IP
+		}
+		result.FailedHosts = append(result.FailedHosts, host)
+	}
+	if cancelled && result.Status == "success" {
+		result.Status = "cancelled"
+	}
+
+	s.onComplete(result)
+}
+
 // executeTaskOnAsset executes a task on a specific asset
 func (s *ExecutionService) executeTaskOnAsset(ctx context.Context, task model.Task, executionID uint) error {
 	var execution model.TaskExecution
@@ -152,6 +262,23 @@ func (s *ExecutionService) executeTaskOnAsset(ctx context.Context, task model.Ta
 		return err
 	}
 
+	// Resolve secret references using the asset's project and environment
+	resolved, err := s.secretSvc.Resolve(task.Content, task.Type, asset.ProjectID, asset.EnvironmentID)
+	if err != nil {
+		execution.Status = "failed"
+		execution.Error = err.Error()
+		now := time.Now()
+		execution.FinishedAt = &now
+		s.db.Save(&execution)
+		s.updateTaskStatus(task.ID)
+		return err
+	}
+
+	// Chained runs receive the upstream job's context as environment variables
+	for k, v := range ChainEnv(s.db, execution.ChainRunID) {
+		resolved.Env[k] = v
+	}
+
 	// Connect to asset via SSH
 	sshClient, err := s.connectToAsset(asset)
 	if err != nil {
@@ -167,8 +294,8 @@ func (s *ExecutionService) executeTaskOnAsset(ctx context.Context, task model.Ta
 	defer sshClient.Close()
 
 	// Execute the task content with timeout
-	command := s.buildCommand(task.Content, task.Type)
-	
+	command := s.buildCommand(resolved.Script, task.Type)
+
 	// Use task timeout or default to 600 seconds (10 minutes)
 	timeout := time.Duration(task.Timeout) * time.Second
 	if timeout <= 0 {
@@ -177,12 +304,12 @@ func (s *ExecutionService) executeTaskOnAsset(ctx context.Context, task model.Ta
 	execCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	
-	output, exitCode, err := sshClient.ExecuteCommandWithTimeout(execCtx, command)
+	output, exitCode, err := sshClient.ExecuteCommandWithEnv(execCtx, command, resolved.Env)
 
-	// Update execution result
+	// Update execution result (secret values are masked before storing)
 	now = time.Now()
 	execution.FinishedAt = &now
-	execution.Output = output
+	execution.Output = resolved.Mask(output)
 	execution.ExitCode = &exitCode
 
 	if err != nil {
@@ -192,7 +319,7 @@ func (s *ExecutionService) executeTaskOnAsset(ctx context.Context, task model.Ta
 		} else if err == context.Canceled {
 			execution.Error = "execution was cancelled"
 		} else {
-			execution.Error = err.Error()
+			execution.Error = resolved.Mask(err.Error())
 		}
 	} else if exitCode == 0 {
 		execution.Status = "success"
@@ -18,6 +18,9 @@ import (
 	"github.com/kkops/backend/internal/service/authorization"
 )
 
+// ErrTemplateManagedByGit is returned when modifying a template synced from a Git repository
+var ErrTemplateManagedByGit = errors.New("template is managed by a git repository; change it in git instead")
+
 // Service handles task and template management business logic
 type Service struct {
 	db       *gorm.DB
@@ -46,57 +49,65 @@ type UpdateTemplateRequest struct {
 	Description string `json:"description"`
 	Content     string `json:"content"`
 	Type        string `json:"type"`
+	ChangeNote  string `json:"change_note"` // 版本变更说明
 }
 
 // TemplateResponse represents a task template response
 type TemplateResponse struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Content     string `json:"content"`
-	Type        string `json:"type"`
-	CreatedBy   uint   `json:"created_by"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ID              uint   `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Content         string `json:"content"`
+	Type            string `json:"type"`
+	LatestVersion   int    `json:"latest_version"`
+	GitRepositoryID *uint  `json:"git_repository_id"`
+	GitPath         string `json:"git_path"`
+	ManagedByGit    bool   `json:"managed_by_git"` // 由 Git 托管的模板只读
+	CreatedBy       uint   `json:"created_by"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
 }
 
 // CreateTaskRequest represents a request to create a task
 type CreateTaskRequest struct {
-	TemplateID  *uint  `json:"template_id"`
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	Content     string `json:"content" binding:"required"`
-	Type        string `json:"type"`      // shell, python, etc.
-	Timeout     int    `json:"timeout"`   // Execution timeout in seconds (default 600)
-	AssetIDs    []uint `json:"asset_ids"` // Target assets for execution (stored for later use)
+	TemplateID      *uint  `json:"template_id"`
+	TemplateVersion *int   `json:"template_version"` // nil 使用自身脚本，0 跟随模板最新版本，>0 固定版本
+	Name            string `json:"name" binding:"required"`
+	Description     string `json:"description"`
+	Content         string `json:"content" binding:"required"`
+	Type            string `json:"type"`      // shell, python, etc.
+	Timeout         int    `json:"timeout"`   // Execution timeout in seconds (default 600)
+	AssetIDs        []uint `json:"asset_ids"` // Target assets for execution (stored for later use)
 }
 
 // UpdateTaskRequest represents a request to update a task
 type UpdateTaskRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Content     string `json:"content"`
-	Type        string `json:"type"`
-	Timeout     int    `json:"timeout"` // Execution timeout in seconds
-	Status      string `json:"status"`
+	TemplateVersion *int   `json:"template_version"` // 0 跟随最新版本，>0 固定版本，<0 取消关联改用自身脚本
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Content         string `json:"content"`
+	Type            string `json:"type"`
+	Timeout         int    `json:"timeout"` // Execution timeout in seconds
+	Status          string `json:"status"`
 }
 
 // TaskResponse represents a task response
 type TaskResponse struct {
-	ID          uint    `json:"id"`
-	TemplateID  *uint   `json:"template_id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Content     string  `json:"content"`
-	Type        string  `json:"type"`
-	Timeout     int     `json:"timeout"` // Execution timeout in seconds
-	Status      string  `json:"status"`
-	AssetIDs    []uint  `json:"asset_ids"`
-	CreatedBy   uint    `json:"created_by"`
-	StartedAt   *string `json:"started_at"`
-	FinishedAt  *string `json:"finished_at"`
-	CreatedAt   string  `json:"created_at"`
-	UpdatedAt   string  `json:"updated_at"`
+	ID              uint    `json:"id"`
+	TemplateID      *uint   `json:"template_id"`
+	TemplateVersion *int    `json:"template_version"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description"`
+	Content         string  `json:"content"`
+	Type            string  `json:"type"`
+	Timeout         int     `json:"timeout"` // Execution timeout in seconds
+	Status          string  `json:"status"`
+	AssetIDs        []uint  `json:"asset_ids"`
+	CreatedBy       uint    `json:"created_by"`
+	StartedAt       *string `json:"started_at"`
+	FinishedAt      *string `json:"finished_at"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
 }
 
 // CreateTemplate creates a new task template
@@ -113,20 +124,18 @@ func (s *Service) CreateTemplate(userID uint, req *CreateTemplateRequest) (*Temp
 		template.Type = "shell"
 	}
 
-	if err := s.db.Create(&template).Error; err != nil {
+	// 创建模板的同时生成第 1 个版本
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&template).Error; err != nil {
+			return err
+		}
+		return SaveTemplateVersion(tx, &template, userID, "initial version")
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &TemplateResponse{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		Content:     template.Content,
-		Type:        template.Type,
-		CreatedBy:   template.CreatedBy,
-		CreatedAt:   template.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   template.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return templateToResponse(&template), nil
 }
 
 // GetTemplate retrieves a task template by ID
@@ -136,16 +145,7 @@ func (s *Service) GetTemplate(id uint) (*TemplateResponse, error) {
 		return nil, err
 	}
 
-	return &TemplateResponse{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		Content:     template.Content,
-		Type:        template.Type,
-		CreatedBy:   template.CreatedBy,
-		CreatedAt:   template.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   template.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return templateToResponse(&template), nil
 }
 
 // ListTemplates retrieves all task templates
@@ -156,29 +156,25 @@ func (s *Service) ListTemplates() ([]TemplateResponse, error) {
 	}
 
 	result := make([]TemplateResponse, len(templates))
-	for i, template := range templates {
-		result[i] = TemplateResponse{
-			ID:          template.ID,
-			Name:        template.Name,
-			Description: template.Description,
-			Content:     template.Content,
-			Type:        template.Type,
-			CreatedBy:   template.CreatedBy,
-			CreatedAt:   template.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:   template.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		}
+	for i := range templates {
+		result[i] = *templateToResponse(&templates[i])
 	}
 
 	return result, nil
 }
 
-// UpdateTemplate updates a task template
-func (s *Service) UpdateTemplate(id uint, req *UpdateTemplateRequest) (*TemplateResponse, error) {
+// UpdateTemplate updates a task template. Every change is saved as a new immutable version.
+func (s *Service) UpdateTemplate(userID, id uint, req *UpdateTemplateRequest) (*TemplateResponse, error) {
 	var template model.TaskTemplate
 	if err := s.db.First(&template, id).Error; err != nil {
 		return nil, err
 	}
 
+	if template.GitRepositoryID != nil {
+		return nil, ErrTemplateManagedByGit
+	}
+
+	original := template
 	if req.Name != "" {
 		template.Name = req.Name
 	}
@@ -192,25 +188,32 @@ func (s *Service) UpdateTemplate(id uint, req *UpdateTemplateRequest) (*Template
 		template.Type = req.Type
 	}
 
-	if err := s.db.Save(&template).Error; err != nil {
+	// 内容未变化时不生成新版本
+	if template.Name == original.Name && template.Description == original.Description &&
+		template.Content == original.Content && template.Type == original.Type {
+		return templateToResponse(&template), nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return SaveTemplateVersion(tx, &template, userID, req.ChangeNote)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &TemplateResponse{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		Content:     template.Content,
-		Type:        template.Type,
-		CreatedBy:   template.CreatedBy,
-		CreatedAt:   template.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   template.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return templateToResponse(&template), nil
 }
 
 // DeleteTemplate deletes a task template
 func (s *Service) DeleteTemplate(id uint) error {
-	return s.db.Delete(&model.TaskTemplate{}, id).Error
+	var template model.TaskTemplate
+	if err := s.db.First(&template, id).Error; err != nil {
+		return err
+	}
+	if template.GitRepositoryID != nil {
+		return ErrTemplateManagedByGit
+	}
+	return s.db.Delete(&template).Error
 }
 
 // CreateTask creates a new task (without execution records - those are created on Execute)
@@ -230,6 +233,10 @@ func (s *Service) CreateTask(userID uint, req *CreateTaskRequest) (*TaskResponse
 		}
 	}
 
+	if err := ValidateTemplateVersion(s.db, req.TemplateID, req.TemplateVersion); err != nil {
+		return nil, err
+	}
+
 	// 检查用户对目标资产的访问权限
 	if len(req.AssetIDs) > 0 && s.authzSvc != nil {
 		authorizedAssets, err := s.authzSvc.HasMultipleAssetAccess(userID, req.AssetIDs)
@@ -258,7 +265,8 @@ func (s *Service) CreateTask(userID uint, req *CreateTaskRequest) (*TaskResponse
 	}
 
 	task := model.Task{
-		TemplateID:  req.TemplateID,
+		TemplateID:      req.TemplateID,
+		TemplateVersion: req.TemplateVersion,
 		Name:        req.Name,
 		Description: req.Description,
 		Content:     req.Content,
@@ -339,6 +347,16 @@ func (s *Service) UpdateTask(id uint, req *UpdateTaskRequest) (*TaskResponse, er
 	if req.Status != "" {
 		task.Status = req.Status
 	}
+	if req.TemplateVersion != nil {
+		if *req.TemplateVersion < 0 {
+			task.TemplateVersion = nil
+		} else {
+			if err := ValidateTemplateVersion(s.db, task.TemplateID, req.TemplateVersion); err != nil {
+				return nil, err
+			}
+			task.TemplateVersion = req.TemplateVersion
+		}
+	}
 
 	if err := s.db.Save(&task).Error; err != nil {
 		return nil, err
@@ -375,8 +393,9 @@ func parseAssetIDs(assetIDsStr string) []uint {
 // taskToResponse converts a task model to response
 func (s *Service) taskToResponse(task model.Task) *TaskResponse {
 	resp := &TaskResponse{
-		ID:          task.ID,
-		TemplateID:  task.TemplateID,
+		ID:              task.ID,
+		TemplateID:      task.TemplateID,
+		TemplateVersion: task.TemplateVersion,
 		Name:        task.Name,
 		Description: task.Description,
 		Content:     task.Content,
@@ -401,6 +420,24 @@ func (s *Service) taskToResponse(task model.Task) *TaskResponse {
 	return resp
 }
 
+// templateToResponse converts a task template model to response
+func templateToResponse(template *model.TaskTemplate) *TemplateResponse {
+	return &TemplateResponse{
+		ID:              template.ID,
+		Name:            template.Name,
+		Description:     template.Description,
+		Content:         template.Content,
+		Type:            template.Type,
+		LatestVersion:   template.LatestVersion,
+		GitRepositoryID: template.GitRepositoryID,
+		GitPath:         template.GitPath,
+		ManagedByGit:    template.GitRepositoryID != nil,
+		CreatedBy:       template.CreatedBy,
+		CreatedAt:       template.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:       template.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
 // ExportTemplateConfig 导出模板配置结构
 type ExportTemplateConfig struct {
 	Name        string `json:"name"`
@@ -506,7 +543,13 @@ func (s *Service) ImportTemplates(config *ImportTemplatesConfig, userID uint) (*
 			CreatedBy:   userID,
 		}
 
-		if err := s.db.Create(&template).Error; err != nil {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&template).Error; err != nil {
+				return err
+			}
+			return SaveTemplateVersion(tx, &template, userID, "imported")
+		})
+		if err != nil {
 			result.Failed++
 			result.Errors = append(result.Errors, fmt.Sprintf("模板 '%s': 创建失败: %v", t.Name, err))
 			continue
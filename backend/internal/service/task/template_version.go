@@ -0,0 +1,208 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// RestoreTemplateVersionRequest represents a request to restore a template version
+type RestoreTemplateVersionRequest struct {
+	ChangeNote string `json:"change_note"`
+}
+
+// TemplateVersionResponse represents a template version response
+type TemplateVersionResponse struct {
+	ID          uint   `json:"id"`
+	TemplateID  uint   `json:"template_id"`
+	Version     int    `json:"version"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	ChangeNote  string `json:"change_note"`
+	CreatedBy   uint   `json:"created_by"`
+	CreatorName string `json:"creator_name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// TemplateDiffResponse represents a diff between two template versions
+type TemplateDiffResponse struct {
+	TemplateID  uint   `json:"template_id"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	Diff        string `json:"diff"` // unified diff of the script content
+	TypeChanged bool   `json:"type_changed"`
+}
+
+// TemplateScript is the script that a template reference resolves to at run time
+type TemplateScript struct {
+	Content string
+	Type    string
+	Version *int // 实际使用的模板版本，未使用模板时为 nil
+}
+
+// ResolveTemplateScript returns the script a task, scheduled task or deployment module runs.
+// templateVersion nil keeps the caller's own content, 0 follows the template's latest
+// version and a positive value pins that exact version.
+func ResolveTemplateScript(db *gorm.DB, templateID *uint, templateVersion *int, content, scriptType string) (*TemplateScript, error) {
+	if templateID == nil || *templateID == 0 || templateVersion == nil {
+		return &TemplateScript{Content: content, Type: scriptType}, nil
+	}
+
+	if *templateVersion == 0 {
+		var template model.TaskTemplate
+		if err := db.First(&template, *templateID).Error; err != nil {
+			return nil, fmt.Errorf("template %d not found", *templateID)
+		}
+		version := template.LatestVersion
+		return &TemplateScript{Content: template.Content, Type: template.Type, Version: &version}, nil
+	}
+
+	var v model.TaskTemplateVersion
+	if err := db.Where("template_id = ? AND version = ?", *templateID, *templateVersion).First(&v).Error; err != nil {
+		return nil, fmt.Errorf("template %d version %d not found", *templateID, *templateVersion)
+	}
+	version := v.Version
+	return &TemplateScript{Content: v.Content, Type: v.Type, Version: &version}, nil
+}
+
+// ValidateTemplateVersion checks that a pinned template version exists
+func ValidateTemplateVersion(db *gorm.DB, templateID *uint, templateVersion *int) error {
+	if templateVersion == nil {
+		return nil
+	}
+	if templateID == nil || *templateID == 0 {
+		return errors.New("template_version requires a template")
+	}
+	if *templateVersion < 0 {
+		return errors.New("template_version must be 0 (latest) or a version number")
+	}
+	_, err := ResolveTemplateScript(db, templateID, templateVersion, "", "")
+	return err
+}
+
+// ListTemplateVersions retrieves all versions of a template, newest first
+func (s *Service) ListTemplateVersions(templateID uint) ([]TemplateVersionResponse, error) {
+	if err := s.db.First(&model.TaskTemplate{}, templateID).Error; err != nil {
+		return nil, err
+	}
+
+	var versions []model.TaskTemplateVersion
+	if err := s.db.Preload("Creator").Where("template_id = ?", templateID).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]TemplateVersionResponse, len(versions))
+	for i := range versions {
+		result[i] = *templateVersionToResponse(&versions[i])
+	}
+	return result, nil
+}
+
+// GetTemplateVersion retrieves a single template version
+func (s *Service) GetTemplateVersion(templateID uint, version int) (*TemplateVersionResponse, error) {
+	var v model.TaskTemplateVersion
+	if err := s.db.Preload("Creator").Where("template_id = ? AND version = ?", templateID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return templateVersionToResponse(&v), nil
+}
+
+// DiffTemplateVersions returns a unified diff between two versions of a template
+func (s *Service) DiffTemplateVersions(templateID uint, from, to int) (*TemplateDiffResponse, error) {
+	var fromVersion, toVersion model.TaskTemplateVersion
+	if err := s.db.Where("template_id = ? AND version = ?", templateID, from).First(&fromVersion).Error; err != nil {
+		return nil, fmt.Errorf("version %d not found", from)
+	}
+	if err := s.db.Where("template_id = ? AND version = ?", templateID, to).First(&toVersion).Error; err != nil {
+		return nil, fmt.Errorf("version %d not found", to)
+	}
+
+	return &TemplateDiffResponse{
+		TemplateID:  templateID,
+		FromVersion: from,
+		ToVersion:   to,
+		Diff:        utils.UnifiedDiff(fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to), fromVersion.Content, toVersion.Content, 3),
+		TypeChanged: fromVersion.Type != toVersion.Type,
+	}, nil
+}
+
+// RestoreTemplateVersion makes an old version current again by saving it as a new version
+func (s *Service) RestoreTemplateVersion(userID, templateID uint, version int, req *RestoreTemplateVersionRequest) (*TemplateResponse, error) {
+	var v model.TaskTemplateVersion
+	if err := s.db.Where("template_id = ? AND version = ?", templateID, version).First(&v).Error; err != nil {
+		return nil, fmt.Errorf("version %d not found", version)
+	}
+
+	note := req.ChangeNote
+	if note == "" {
+		note = fmt.Sprintf("restored from version %d", version)
+	}
+
+	var template model.TaskTemplate
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&template, templateID).Error; err != nil {
+			return err
+		}
+		if template.GitRepositoryID != nil {
+			return ErrTemplateManagedByGit
+		}
+		template.Name = v.Name
+		template.Description = v.Description
+		template.Content = v.Content
+		template.Type = v.Type
+		return SaveTemplateVersion(tx, &template, userID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templateToResponse(&template), nil
+}
+
+// SaveTemplateVersion saves the template and records its current state as the next version
+func SaveTemplateVersion(tx *gorm.DB, template *model.TaskTemplate, userID uint, note string) error {
+	template.LatestVersion++
+	if err := tx.Save(template).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&model.TaskTemplateVersion{
+		TemplateID:  template.ID,
+		Version:     template.LatestVersion,
+		Name:        template.Name,
+		Description: template.Description,
+		Content:     template.Content,
+		Type:        template.Type,
+		ChangeNote:  note,
+		CreatedBy:   userID,
+	}).Error
+}
+
+func templateVersionToResponse(v *model.TaskTemplateVersion) *TemplateVersionResponse {
+	return &TemplateVersionResponse{
+		ID:          v.ID,
+		TemplateID:  v.TemplateID,
+		Version:     v.Version,
+		Name:        v.Name,
+		Description: v.Description,
+		Content:     v.Content,
+		Type:        v.Type,
+		ChangeNote:  v.ChangeNote,
+		CreatedBy:   v.CreatedBy,
+		CreatorName: v.Creator.Username,
+		CreatedAt:   v.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,407 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package variable
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/secret"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// Scopes in increasing precedence; a variable at a later scope overrides the same key at an earlier one
+const (
+	ScopeProject            = "project"
+	ScopeEnvironment        = "environment"
+	ScopeProjectEnvironment = "project_environment"
+	ScopeModule             = "module"
+	ScopeModuleEnvironment  = "module_environment"
+)
+
+var scopeOrder = map[string]int{
+	ScopeProject:            1,
+	ScopeEnvironment:        2,
+	ScopeProjectEnvironment: 3,
+	ScopeModule:             4,
+	ScopeModuleEnvironment:  5,
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinKeys 部署内置变量，不能被自定义变量覆盖
+var builtinKeys = map[string]bool{
+	"VERSION":          true,
+	"MODULE_NAME":      true,
+	"PROJECT_NAME":     true,
+	"ENVIRONMENT_NAME": true,
+}
+
+// reservedPrefixes 密钥注入和作业链使用的环境变量前缀
+var reservedPrefixes = []string{"SECRET_", "KKOPS_"}
+
+// ErrVariableNotFound is returned when a variable does not exist
+var ErrVariableNotFound = errors.New("deployment variable not found")
+
+// Service manages deployment variables and computes the set in effect for a deployment
+type Service struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewService creates a new deployment variable service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{db: db, config: cfg}
+}
+
+// CreateVariableRequest represents a request to create a variable. The scope is
+// given by the IDs: a project, an environment, a project and environment, a
+// module, or a module in one environment.
+type CreateVariableRequest struct {
+	Key           string `json:"key" binding:"required"`
+	Value         string `json:"value"`
+	Secret        bool   `json:"secret"`
+	ProjectID     *uint  `json:"project_id"`
+	EnvironmentID *uint  `json:"environment_id"`
+	ModuleID      *uint  `json:"module_id"` // 模块变量不需要再指定项目
+	Description   string `json:"description"`
+}
+
+// UpdateVariableRequest represents a request to update a variable
+type UpdateVariableRequest struct {
+	Value       *string `json:"value"`  // 为空时保持原值
+	Secret      *bool   `json:"secret"` // 取消敏感标记时必须同时提供新值
+	Description *string `json:"description"`
+}
+
+// ListFilter filters the variable list
+type ListFilter struct {
+	ProjectID     uint
+	EnvironmentID uint
+	ModuleID      uint
+}
+
+// VariableResponse represents a variable; secret values are masked
+type VariableResponse struct {
+	ID              uint      `json:"id"`
+	Key             string    `json:"key"`
+	Value           string    `json:"value"`
+	Secret          bool      `json:"secret"`
+	Scope           string    `json:"scope"`
+	ProjectID       *uint     `json:"project_id"`
+	ProjectName     string    `json:"project_name"`
+	EnvironmentID   *uint     `json:"environment_id"`
+	EnvironmentName string    `json:"environment_name"`
+	ModuleID        *uint     `json:"module_id"`
+	ModuleName      string    `json:"module_name"`
+	Description     string    `json:"description"`
+	CreatedBy       uint      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Value is a variable in effect for a deployment
+type Value struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"` // 记录到部署和接口返回时敏感变量的值被掩码
+	Secret    bool   `json:"secret"`
+	Scope     string `json:"scope"`               // 生效值所在的级别
+	ID        uint   `json:"variable_id"`         // 生效的变量 ID
+	Overrides []uint `json:"overrides,omitempty"` // 被覆盖的低优先级变量 ID
+}
+
+// CreateVariable creates a variable after checking its key and scope
+func (s *Service) CreateVariable(userID uint, req *CreateVariableRequest) (*VariableResponse, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	v := model.DeploymentVariable{
+		Key:           req.Key,
+		Secret:        req.Secret,
+		ProjectID:     req.ProjectID,
+		EnvironmentID: req.EnvironmentID,
+		ModuleID:      req.ModuleID,
+		Description:   req.Description,
+		CreatedBy:     userID,
+	}
+	if v.ModuleID != nil {
+		v.ProjectID = nil
+	}
+	if v.ProjectID == nil && v.EnvironmentID == nil && v.ModuleID == nil {
+		return nil, errors.New("a variable needs a project, environment or module")
+	}
+	if s.scopeExists(&v) {
+		return nil, fmt.Errorf("variable %s already exists in this scope", v.Key)
+	}
+	if err := s.setValue(&v, req.Value); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&v).Error; err != nil {
+		return nil, err
+	}
+	return s.GetVariable(v.ID)
+}
+
+// GetVariable retrieves a variable by ID
+func (s *Service) GetVariable(id uint) (*VariableResponse, error) {
+	var v model.DeploymentVariable
+	if err := s.db.Preload("Project").Preload("Environment").Preload("Module").First(&v, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariableNotFound
+		}
+		return nil, err
+	}
+	return variableToResponse(&v), nil
+}
+
+// ListVariables lists variables defined directly on the given project, environment or module
+func (s *Service) ListVariables(filter ListFilter) ([]VariableResponse, error) {
+	query := s.db.Preload("Project").Preload("Environment").Preload("Module")
+	if filter.ProjectID > 0 {
+		query = query.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.EnvironmentID > 0 {
+		query = query.Where("environment_id = ?", filter.EnvironmentID)
+	}
+	if filter.ModuleID > 0 {
+		query = query.Where("module_id = ?", filter.ModuleID)
+	}
+
+	var vars []model.DeploymentVariable
+	if err := query.Order("key ASC, id ASC").Find(&vars).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]VariableResponse, len(vars))
+	for i := range vars {
+		result[i] = *variableToResponse(&vars[i])
+	}
+	return result, nil
+}
+
+// UpdateVariable updates a variable's value, secret flag or description
+func (s *Service) UpdateVariable(id uint, req *UpdateVariableRequest) (*VariableResponse, error) {
+	var v model.DeploymentVariable
+	if err := s.db.First(&v, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariableNotFound
+		}
+		return nil, err
+	}
+
+	value := req.Value
+	if value == nil {
+		current, err := s.plaintext(&v)
+		if err != nil {
+			return nil, err
+		}
+		value = &current
+	}
+	if req.Secret != nil && v.Secret && !*req.Secret && req.Value == nil {
+		// 不允许通过取消敏感标记读出原值
+		return nil, errors.New("value is required when a secret variable is made plain")
+	}
+	if req.Secret != nil {
+		v.Secret = *req.Secret
+	}
+	if err := s.setValue(&v, *value); err != nil {
+		return nil, err
+	}
+	if req.Description != nil {
+		v.Description = *req.Description
+	}
+
+	if err := s.db.Save(&v).Error; err != nil {
+		return nil, err
+	}
+	return s.GetVariable(id)
+}
+
+// DeleteVariable deletes a variable
+func (s *Service) DeleteVariable(id uint) error {
+	result := s.db.Delete(&model.DeploymentVariable{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVariableNotFound
+	}
+	return nil
+}
+
+// Effective returns the variables in effect for a deployment of the module to
+// the environment, sorted by key. For each key the variable at the scope with
+// the highest precedence wins; secret values are decrypted.
+func (s *Service) Effective(projectID uint, environmentID *uint, moduleID uint) ([]Value, error) {
+	conditions := []string{
+		"(module_id IS NULL AND project_id = ? AND environment_id IS NULL)",
+		"(module_id = ? AND environment_id IS NULL)",
+	}
+	args := []interface{}{projectID, moduleID}
+	if environmentID != nil {
+		conditions = append(conditions,
+			"(module_id IS NULL AND project_id IS NULL AND environment_id = ?)",
+			"(module_id IS NULL AND project_id = ? AND environment_id = ?)",
+			"(module_id = ? AND environment_id = ?)")
+		args = append(args, *environmentID, projectID, *environmentID, moduleID, *environmentID)
+	}
+
+	var vars []model.DeploymentVariable
+	if err := s.db.Where(strings.Join(conditions, " OR "), args...).Order("id").Find(&vars).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(vars, func(i, j int) bool {
+		return scopeOrder[scopeOf(&vars[i])] < scopeOrder[scopeOf(&vars[j])]
+	})
+
+	byKey := make(map[string]*Value)
+	for i := range vars {
+		v := &vars[i]
+		value, err := s.plaintext(v)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", v.Key, err)
+		}
+		effective := &Value{Key: v.Key, Value: value, Secret: v.Secret, Scope: scopeOf(v), ID: v.ID}
+		if prev, ok := byKey[v.Key]; ok {
+			effective.Overrides = append(prev.Overrides, prev.ID)
+		}
+		byKey[v.Key] = effective
+	}
+
+	result := make([]Value, 0, len(byKey))
+	for _, v := range byKey {
+		result = append(result, *v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+// Masked returns a copy of the values with secret values masked, for recording and display
+func Masked(values []Value) []Value {
+	result := make([]Value, len(values))
+	for i, v := range values {
+		if v.Secret {
+			v.Value = secret.MaskText
+		}
+		result[i] = v
+	}
+	return result
+}
+
+// setValue stores the value, encrypted for secret variables
+func (s *Service) setValue(v *model.DeploymentVariable, value string) error {
+	if !v.Secret {
+		v.Value = value
+		return nil
+	}
+	encrypted, err := utils.Encrypt([]byte(value), s.config.Encryption.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt variable: %w", err)
+	}
+	v.Value = encrypted
+	return nil
+}
+
+// plaintext returns the stored value, decrypting secret variables
+func (s *Service) plaintext(v *model.DeploymentVariable) (string, error) {
+	if !v.Secret {
+		return v.Value, nil
+	}
+	plaintext, err := utils.Decrypt(v.Value, s.config.Encryption.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt variable: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// scopeExists reports whether the key is already defined in exactly this scope
+func (s *Service) scopeExists(v *model.DeploymentVariable) bool {
+	query := s.db.Model(&model.DeploymentVariable{}).Where("key = ?", v.Key)
+	for column, id := range map[string]*uint{
+		"project_id":     v.ProjectID,
+		"environment_id": v.EnvironmentID,
+		"module_id":      v.ModuleID,
+	} {
+		if id == nil {
+			query = query.Where(column + " IS NULL")
+		} else {
+			query = query.Where(column+" = ?", *id)
+		}
+	}
+	var count int64
+	query.Count(&count)
+	return count > 0
+}
+
+// validateKey checks the key is usable as both ${KEY} and an environment variable name
+func validateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return errors.New("variable key must start with a letter or underscore and contain only letters, digits and underscores")
+	}
+	if builtinKeys[key] {
+		return fmt.Errorf("%s is a built-in deployment variable", key)
+	}
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(strings.ToUpper(key), prefix) {
+			return fmt.Errorf("variable keys must not start with %s", prefix)
+		}
+	}
+	return nil
+}
+
+// scopeOf returns the scope a variable is defined at
+func scopeOf(v *model.DeploymentVariable) string {
+	switch {
+	case v.ModuleID != nil && v.EnvironmentID != nil:
+		return ScopeModuleEnvironment
+	case v.ModuleID != nil:
+		return ScopeModule
+	case v.ProjectID != nil && v.EnvironmentID != nil:
+		return ScopeProjectEnvironment
+	case v.EnvironmentID != nil:
+		return ScopeEnvironment
+	}
+	return ScopeProject
+}
+
+func variableToResponse(v *model.DeploymentVariable) *VariableResponse {
+	resp := &VariableResponse{
+		ID:            v.ID,
+		Key:           v.Key,
+		Value:         v.Value,
+		Secret:        v.Secret,
+		Scope:         scopeOf(v),
+		ProjectID:     v.ProjectID,
+		EnvironmentID: v.EnvironmentID,
+		ModuleID:      v.ModuleID,
+		Description:   v.Description,
+		CreatedBy:     v.CreatedBy,
+		CreatedAt:     v.CreatedAt,
+		UpdatedAt:     v.UpdatedAt,
+	}
+	if v.Secret {
+		resp.Value = secret.MaskText
+	}
+	if v.Project != nil {
+		resp.ProjectName = v.Project.Name
+	}
+	if v.Environment != nil {
+		resp.EnvironmentName = v.Environment.Name
+	}
+	if v.Module != nil {
+		resp.ModuleName = v.Module.Name
+	}
+	return resp
+}
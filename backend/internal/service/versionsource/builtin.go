@@ -0,0 +1,418 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	httpTimeout     = 30 * time.Second
+	gitTimeout      = 60 * time.Second
+	maxResponseSize = 10 << 20
+	maxRegistryPage = 100 // Docker Registry 分页请求的上限
+)
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+func init() {
+	Register(&jsonSource{})
+	Register(&httpSource{})
+	Register(&dockerSource{})
+	Register(&gitSource{})
+	Register(&mavenSource{})
+	Register(&staticSource{})
+}
+
+// jsonSource reads the legacy {"versions": [...], "latest": "..."} format
+type jsonSource struct{}
+
+func (jsonSource) Type() string { return TypeJSON }
+func (jsonSource) Description() string {
+	return `自定义 JSON 接口，返回 {"versions": [...], "latest": "..."}`
+}
+func (jsonSource) Validate(cfg *Config) error { return requireURL(cfg) }
+
+func (jsonSource) Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error) {
+	body, _, err := get(ctx, cfg.URL, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	var resp struct {
+		Versions []string `json:"versions"`
+		Latest   string   `json:"latest"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, "", fmt.Errorf("failed to parse version response: %w", err)
+	}
+	return resp.Versions, resp.Latest, nil
+}
+
+// httpSource extracts versions from any JSON response with a JSONPath expression
+type httpSource struct{}
+
+func (httpSource) Type() string { return TypeHTTP }
+func (httpSource) Description() string {
+	return "通用 HTTP JSON 接口，通过 JSONPath（path）提取版本，如 $.data[*].tag"
+}
+
+func (httpSource) Validate(cfg *Config) error {
+	if err := requireURL(cfg); err != nil {
+		return err
+	}
+	if cfg.Path == "" {
+		return errors.New("version source path (JSONPath) is required")
+	}
+	_, err := compileJSONPath(cfg.Path)
+	return err
+}
+
+func (httpSource) Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error) {
+	path, err := compileJSONPath(cfg.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	body, _, err := get(ctx, cfg.URL, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, "", fmt.Errorf("failed to parse version response: %w", err)
+	}
+	return versionStrings(path.eval(doc)), "", nil
+}
+
+// dockerSource lists image tags from a Docker Registry v2 API
+type dockerSource struct{}
+
+func (dockerSource) Type() string { return TypeDocker }
+func (dockerSource) Description() string {
+	return "Docker Registry v2 镜像标签，url 为 Registry 地址，path 为镜像仓库名（如 library/nginx）"
+}
+
+func (dockerSource) Validate(cfg *Config) error {
+	if err := requireURL(cfg); err != nil {
+		return err
+	}
+	if strings.Trim(cfg.Path, "/") == "" {
+		return errors.New("version source path (repository name) is required")
+	}
+	return nil
+}
+
+func (dockerSource) Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	next := base.String() + "/v2/" + strings.Trim(cfg.Path, "/") + "/tags/list?n=1000"
+
+	// 未携带令牌访问返回 401 时，按 WWW-Authenticate 质询获取 Bearer 令牌后重试
+	var token *Auth
+	var tags []string
+	for page := 0; next != "" && page < maxRegistryPage; page++ {
+		reqAuth := auth
+		if token != nil {
+			reqAuth = token
+		}
+		body, header, err := get(ctx, next, reqAuth)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusUnauthorized && token == nil {
+			if token, err = registryToken(ctx, statusErr.header.Get("WWW-Authenticate"), auth); err != nil {
+				return nil, "", err
+			}
+			page--
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		var resp struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, "", fmt.Errorf("failed to parse tag list: %w", err)
+		}
+		tags = append(tags, resp.Tags...)
+		next = nextLink(base, header.Get("Link"))
+	}
+	return tags, "", nil
+}
+
+// registryToken fetches a bearer token for a registry's WWW-Authenticate challenge,
+// passing basic credentials to the token service when configured
+func registryToken(ctx context.Context, challenge string, auth *Auth) (*Auth, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, errors.New("registry returned status 401")
+	}
+	params := parseChallenge(challenge[len("bearer "):])
+	if params["realm"] == "" {
+		return nil, errors.New("registry auth challenge has no realm")
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return nil, err
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	var tokenAuth *Auth
+	if auth != nil && auth.Type == AuthBasic {
+		tokenAuth = auth
+	}
+	body, _, err := get(ctx, realm.String(), tokenAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registry token: %w", err)
+	}
+	var resp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	token := resp.Token
+	if token == "" {
+		token = resp.AccessToken
+	}
+	if token == "" {
+		return nil, errors.New("registry token service returned no token")
+	}
+	return &Auth{Type: AuthBearer, Secret: token}, nil
+}
+
+// parseChallenge parses key="value" pairs of an authentication challenge
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return params
+}
+
+// nextLink returns the URL of a Link: <...>; rel="next" header resolved against base
+func nextLink(base *url.URL, link string) string {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.IndexByte(link, '<'), strings.IndexByte(link, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+	ref, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// gitSource lists the tags of a local or remote Git repository
+type gitSource struct{}
+
+func (gitSource) Type() string { return TypeGit }
+func (gitSource) Description() string {
+	return "Git 仓库标签，url 为远程仓库地址或服务器上的本地路径"
+}
+
+func (gitSource) Validate(cfg *Config) error {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return errors.New("version source url (repository) is required")
+	}
+	if strings.HasPrefix(cfg.URL, "-") {
+		return errors.New("invalid repository url")
+	}
+	return nil
+}
+
+func (gitSource) Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--tags", "--refs", cfg.URL)
+	// 禁止交互式凭据提示；认证头通过环境变量传入，避免出现在进程参数中
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if header := gitAuthHeader(auth); header != "" {
+		cmd.Env = append(cmd.Env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0="+header)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, "", fmt.Errorf("git ls-remote: %s", msg)
+	}
+
+	var tags []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+		}
+	}
+	return tags, "", nil
+}
+
+func gitAuthHeader(auth *Auth) string {
+	if auth == nil {
+		return ""
+	}
+	switch auth.Type {
+	case AuthBasic:
+		return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Secret))
+	case AuthBearer:
+		return "Authorization: Bearer " + auth.Secret
+	case AuthHeader:
+		return auth.Header + ": " + auth.Secret
+	}
+	return ""
+}
+
+// mavenSource reads the versions of an artifact from maven-metadata.xml
+type mavenSource struct{}
+
+func (mavenSource) Type() string { return TypeMaven }
+func (mavenSource) Description() string {
+	return "Maven 仓库，url 为仓库地址、path 为 groupId:artifactId；path 为空时 url 即 maven-metadata.xml 地址"
+}
+
+func (mavenSource) Validate(cfg *Config) error {
+	if err := requireURL(cfg); err != nil {
+		return err
+	}
+	if cfg.Path != "" {
+		if group, artifact, ok := strings.Cut(cfg.Path, ":"); !ok || group == "" || artifact == "" {
+			return errors.New("version source path must be groupId:artifactId")
+		}
+	}
+	return nil
+}
+
+func (mavenSource) Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error) {
+	metadataURL := cfg.URL
+	if cfg.Path != "" {
+		group, artifact, _ := strings.Cut(cfg.Path, ":")
+		metadataURL = strings.TrimRight(cfg.URL, "/") + "/" + strings.ReplaceAll(group, ".", "/") + "/" + artifact + "/maven-metadata.xml"
+	}
+
+	body, _, err := get(ctx, metadataURL, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	var metadata struct {
+		Versioning struct {
+			Latest   string   `xml:"latest"`
+			Release  string   `xml:"release"`
+			Versions []string `xml:"versions>version"`
+		} `xml:"versioning"`
+	}
+	if err := xml.Unmarshal(body, &metadata); err != nil {
+		return nil, "", fmt.Errorf("failed to parse maven metadata: %w", err)
+	}
+	latest := metadata.Versioning.Release
+	if latest == "" {
+		latest = metadata.Versioning.Latest
+	}
+	return metadata.Versioning.Versions, latest, nil
+}
+
+// staticSource returns a fixed list of versions
+type staticSource struct{}
+
+func (staticSource) Type() string { return TypeStatic }
+func (staticSource) Description() string {
+	return "固定的版本列表（static），逗号或换行分隔，第一个为最新版本"
+}
+
+func (staticSource) Validate(cfg *Config) error {
+	if len(splitList(cfg.Static)) == 0 {
+		return errors.New("version source static list is empty")
+	}
+	return nil
+}
+
+func (staticSource) Fetch(_ context.Context, cfg *Config, _ *Auth) ([]string, string, error) {
+	return splitList(cfg.Static), "", nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// statusError is returned for non-200 responses
+type statusError struct {
+	url    string
+	code   int
+	header http.Header
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.url, e.code)
+}
+
+// get fetches a URL with the given credentials and returns the body and headers of a 200 response
+func get(ctx context.Context, rawURL string, auth *Auth) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth.Apply(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch versions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &statusError{url: redact(req.URL), code: resp.StatusCode, header: resp.Header}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, resp.Header, nil
+}
+
+// redact removes the query string, which may carry tokens, from a URL for error messages
+func redact(u *url.URL) string {
+	c := *u
+	c.RawQuery = ""
+	c.User = nil
+	return c.String()
+}
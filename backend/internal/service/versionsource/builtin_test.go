@@ -0,0 +1,246 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/secret"
+)
+
+// newTestService returns a service whose secrets store holds the given secrets
+func newTestService(t *testing.T, secrets map[string]string) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.Secret{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Encryption.Key = "test-key"
+	secretSvc := secret.NewService(db, cfg)
+	for name, value := range secrets {
+		if _, err := secretSvc.CreateSecret(1, &secret.CreateSecretRequest{Name: name, Value: value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewService(secretSvc)
+}
+
+func fetch(t *testing.T, svc *Service, cfg *Config) *Result {
+	t.Helper()
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	result, err := svc.Fetch(context.Background(), cfg, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func expectVersions(t *testing.T, result *Result, versions []string, latest string) {
+	t.Helper()
+	if !reflect.DeepEqual(result.Versions, versions) {
+		t.Errorf("versions = %v, want %v", result.Versions, versions)
+	}
+	if result.Latest != latest {
+		t.Errorf("latest = %q, want %q", result.Latest, latest)
+	}
+}
+
+func TestDockerSource(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			// 令牌服务只接受 basic 认证
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "robot" || pass != "registry-pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "registry-token"}`)
+		case "/v2/team/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer registry-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:team/app:pull"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/team/app/tags/list?n=2&last=1.1.0>; rel="next"`)
+				fmt.Fprint(w, `{"name": "team/app", "tags": ["1.0.0", "1.1.0"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"name": "team/app", "tags": ["2.0.0-rc.1", "2.0.0", "latest"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, map[string]string{"REGISTRY_PASS": "registry-pass"})
+	result := fetch(t, svc, &Config{
+		Type:     TypeDocker,
+		URL:      srv.URL,
+		Path:     "team/app",
+		AuthType: AuthBasic,
+		Username: "robot",
+		Secret:   "REGISTRY_PASS",
+	})
+	expectVersions(t, result, []string{"2.0.0", "2.0.0-rc.1", "1.1.0", "1.0.0", "latest"}, "2.0.0")
+
+	// 凭据错误时令牌服务拒绝
+	svc = newTestService(t, map[string]string{"REGISTRY_PASS": "wrong"})
+	cfg := &Config{Type: TypeDocker, URL: srv.URL, Path: "team/app", AuthType: AuthBasic, Username: "robot", Secret: "REGISTRY_PASS"}
+	if _, err := svc.Fetch(context.Background(), cfg, nil, nil, false); err == nil {
+		t.Error("expected an error with wrong registry credentials")
+	}
+}
+
+func TestMavenSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer maven-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/releases/com/example/app/maven-metadata.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<metadata>
+  <groupId>com.example</groupId>
+  <artifactId>app</artifactId>
+  <versioning>
+    <latest>1.3.0-SNAPSHOT</latest>
+    <release>1.2.0</release>
+    <versions>
+      <version>1.0.0</version>
+      <version>1.2.0</version>
+      <version>1.3.0-SNAPSHOT</version>
+    </versions>
+  </versioning>
+</metadata>`)
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, map[string]string{"MAVEN_TOKEN": "maven-token"})
+	result := fetch(t, svc, &Config{
+		Type:     TypeMaven,
+		URL:      srv.URL + "/releases",
+		Path:     "com.example:app",
+		AuthType: AuthBearer,
+		Secret:   "MAVEN_TOKEN",
+	})
+	expectVersions(t, result, []string{"1.3.0-SNAPSHOT", "1.2.0", "1.0.0"}, "1.2.0")
+
+	// 只保留正式版本
+	result = fetch(t, svc, &Config{
+		Type:     TypeMaven,
+		URL:      srv.URL + "/releases",
+		Path:     "com.example:app",
+		Filter:   `^\d+\.\d+\.\d+$`,
+		AuthType: AuthBearer,
+		Secret:   "MAVEN_TOKEN",
+	})
+	expectVersions(t, result, []string{"1.2.0", "1.0.0"}, "1.2.0")
+}
+
+func TestHTTPSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "api-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"tag": "v1.9.0"}, {"tag": "v1.10.0"}, {"tag": "v2.0.0-beta.2"}, {"tag": 3}]}`)
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, map[string]string{"API_KEY": "api-key"})
+	cfg := &Config{
+		Type:     TypeHTTP,
+		URL:      srv.URL,
+		Path:     "$.data[*].tag",
+		AuthType: AuthHeader,
+		Header:   "X-Api-Key",
+		Secret:   "API_KEY",
+	}
+	result := fetch(t, svc, cfg)
+	expectVersions(t, result, []string{"3", "v2.0.0-beta.2", "v1.10.0", "v1.9.0"}, "3")
+
+	cfg.Sort = SortNone
+	result = fetch(t, svc, cfg)
+	expectVersions(t, result, []string{"v1.9.0", "v1.10.0", "v2.0.0-beta.2", "3"}, "v1.9.0")
+}
+
+func TestJSONSourceBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "deploy" || pass != "json-pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"versions": ["1.0", "1.1", "0.9"], "latest": "1.1"}`)
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, map[string]string{"JSON_PASS": "json-pass"})
+	result := fetch(t, svc, &Config{URL: srv.URL, AuthType: AuthBasic, Username: "deploy", Secret: "JSON_PASS"})
+	// json 来源默认保持接口返回的顺序
+	expectVersions(t, result, []string{"1.0", "1.1", "0.9"}, "1.1")
+
+	svc = newTestService(t, nil)
+	if _, err := svc.Fetch(context.Background(), &Config{URL: srv.URL}, nil, nil, false); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "--quiet")
+	git("commit", "--quiet", "--allow-empty", "-m", "initial")
+	for _, tag := range []string{"v1.0.0", "v1.2.0", "v1.10.0", "v2.0.0-beta.1", "build-42"} {
+		git("tag", tag)
+	}
+
+	svc := newTestService(t, nil)
+	result := fetch(t, svc, &Config{Type: TypeGit, URL: dir})
+	expectVersions(t, result, []string{"v2.0.0-beta.1", "v1.10.0", "v1.2.0", "v1.0.0", "build-42"}, "v2.0.0-beta.1")
+
+	result = fetch(t, svc, &Config{Type: TypeGit, URL: dir, Filter: `^v1\.`})
+	expectVersions(t, result, []string{"v1.10.0", "v1.2.0", "v1.0.0"}, "v1.10.0")
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath expression. The supported subset covers what
+// version listings need: $, .name, ['name'], [index], [*] and .*
+type jsonPath []pathStep
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func compileJSONPath(expr string) (jsonPath, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath must start with $: %s", expr)
+	}
+
+	var path jsonPath
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, fmt.Errorf("recursive descent is not supported: %s", expr)
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name in JSONPath: %s", expr)
+			}
+			if name == "*" {
+				path = append(path, pathStep{wildcard: true})
+			} else {
+				path = append(path, pathStep{key: name})
+			}
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in JSONPath: %s", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				path = append(path, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				path = append(path, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in JSONPath: %s", inner, expr)
+				}
+				path = append(path, pathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in JSONPath: %s", rest[:1], expr)
+		}
+	}
+	return path, nil
+}
+
+// eval returns the values selected by the path; missing members select nothing
+func (p jsonPath) eval(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, step := range p {
+		var next []interface{}
+		for _, v := range current {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, child := range node {
+						next = append(next, child)
+					}
+				} else if child, ok := node[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				switch {
+				case step.wildcard:
+					next = append(next, node...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(node)
+					}
+					if i >= 0 && i < len(node) {
+						next = append(next, node[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// versionStrings converts the selected values to versions, flattening arrays
+func versionStrings(values []interface{}) []string {
+	var versions []string
+	for _, v := range values {
+		switch val := v.(type) {
+		case string:
+			versions = append(versions, val)
+		case float64:
+			versions = append(versions, strconv.FormatFloat(val, 'f', -1, 64))
+		case []interface{}:
+			versions = append(versions, versionStrings(val)...)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version; a leading "v" and missing minor or patch parts are accepted
+type semver struct {
+	parts []int
+	pre   []string
+}
+
+func parseSemver(v string) (semver, bool) {
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	var sv semver
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		sv.pre = strings.Split(v[i+1:], ".")
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) > 3 {
+		return semver{}, false
+	}
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		sv.parts = append(sv.parts, n)
+	}
+	for len(sv.parts) < 3 {
+		sv.parts = append(sv.parts, 0)
+	}
+	return sv, true
+}
+
+// compare returns -1, 0 or 1; a pre-release is lower than its release
+func (a semver) compare(b semver) int {
+	for i := 0; i < 3; i++ {
+		if a.parts[i] != b.parts[i] {
+			return cmpInt(a.parts[i], b.parts[i])
+		}
+	}
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		if c := comparePre(a.pre[i], b.pre[i]); c != 0 {
+			return c
+		}
+	}
+	return cmpInt(len(a.pre), len(b.pre))
+}
+
+// comparePre compares pre-release identifiers: numeric ones numerically and below alphanumeric ones
+func comparePre(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmpInt(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortVersions orders versions newest first. Versions that are not semantic
+// versions follow the semantic ones in reverse lexical order.
+func sortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, okA := parseSemver(versions[i])
+		b, okB := parseSemver(versions[j])
+		switch {
+		case okA && okB:
+			if c := a.compare(b); c != 0 {
+				return c > 0
+			}
+			return versions[i] > versions[j]
+		case okA:
+			return true
+		case okB:
+			return false
+		}
+		return versions[i] > versions[j]
+	})
+}
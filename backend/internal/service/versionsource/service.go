@@ -0,0 +1,149 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/kkops/backend/internal/service/secret"
+)
+
+// Result is the version list of a source
+type Result struct {
+	Versions  []string  `json:"versions"`
+	Latest    string    `json:"latest"`
+	Cached    bool      `json:"cached"` // 结果来自缓存
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// SourceInfo describes a registered source type
+type SourceInfo struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+// Service fetches versions from the configured sources and caches the results
+type Service struct {
+	secretSvc *secret.Service
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewService creates a new version source service
+func NewService(secretSvc *secret.Service) *Service {
+	return &Service{secretSvc: secretSvc, cache: make(map[string]cacheEntry)}
+}
+
+// ListSources returns the registered source types
+func (s *Service) ListSources() []SourceInfo {
+	sources := Sources()
+	result := make([]SourceInfo, len(sources))
+	for i, src := range sources {
+		result[i] = SourceInfo{Type: src.Type(), Description: src.Description()}
+	}
+	return result
+}
+
+// Fetch lists the versions of a source. Credentials are read from the secrets
+// store in the given scope; results are cached for the configured time unless
+// refresh is set.
+func (s *Service) Fetch(ctx context.Context, cfg *Config, projectID, environmentID *uint, refresh bool) (*Result, error) {
+	if !cfg.Configured() {
+		return nil, fmt.Errorf("version source not configured")
+	}
+	source, err := Lookup(cfg.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(cfg, projectID, environmentID)
+	if cfg.CacheSeconds > 0 && !refresh {
+		s.mu.Lock()
+		entry, ok := s.cache[key]
+		s.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			result := entry.result
+			result.Cached = true
+			return &result, nil
+		}
+	}
+
+	auth, err := s.auth(cfg, projectID, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	versions, latest, err := source.Fetch(ctx, cfg, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Filter != "" {
+		re, err := regexp.Compile(cfg.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version filter: %w", err)
+		}
+		filtered := versions[:0]
+		for _, v := range versions {
+			if re.MatchString(v) {
+				filtered = append(filtered, v)
+			}
+		}
+		versions = filtered
+		if latest != "" && !re.MatchString(latest) {
+			latest = ""
+		}
+	}
+	if cfg.sortSemver() {
+		sortVersions(versions)
+	}
+	if latest == "" && len(versions) > 0 {
+		latest = versions[0]
+	}
+
+	result := Result{Versions: versions, Latest: latest, FetchedAt: time.Now()}
+	if result.Versions == nil {
+		result.Versions = []string{}
+	}
+	if cfg.CacheSeconds > 0 {
+		s.mu.Lock()
+		s.cache[key] = cacheEntry{result: result, expires: result.FetchedAt.Add(time.Duration(cfg.CacheSeconds) * time.Second)}
+		s.mu.Unlock()
+	}
+	return &result, nil
+}
+
+// auth resolves the configured credentials from the secrets store
+func (s *Service) auth(cfg *Config, projectID, environmentID *uint) (*Auth, error) {
+	if cfg.AuthType == AuthNone {
+		return nil, nil
+	}
+	value, err := s.secretSvc.Lookup(cfg.Secret, projectID, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	return &Auth{Type: cfg.AuthType, Username: cfg.Username, Secret: value, Header: cfg.Header}, nil
+}
+
+// cacheKey identifies a configuration and scope; any configuration change misses the cache
+func cacheKey(cfg *Config, projectID, environmentID *uint) string {
+	data, _ := json.Marshal(struct {
+		Config      *Config
+		Project     *uint
+		Environment *uint
+	}{cfg, projectID, environmentID})
+	return string(data)
+}
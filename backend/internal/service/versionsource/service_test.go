@@ -0,0 +1,91 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSortVersions(t *testing.T) {
+	versions := []string{
+		"1.0.0-alpha", "0.9", "1.0.0", "nightly", "1.0.0-beta.11", "v1.1",
+		"1.0.0-rc.1", "1.0.0-alpha.1", "latest", "1.0.0-beta.2", "1.0.0-beta",
+	}
+	sortVersions(versions)
+	want := []string{
+		"v1.1", "1.0.0", "1.0.0-rc.1", "1.0.0-beta.11", "1.0.0-beta.2", "1.0.0-beta",
+		"1.0.0-alpha.1", "1.0.0-alpha", "0.9", "nightly", "latest",
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("sorted = %v, want %v", versions, want)
+	}
+}
+
+func TestFetchCache(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		fmt.Fprintf(w, `{"versions": ["1.%d.0"]}`, n)
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, nil)
+	cfg := &Config{URL: srv.URL, CacheSeconds: 60}
+	get := func(refresh bool) *Result {
+		t.Helper()
+		result, err := svc.Fetch(context.Background(), cfg, nil, nil, refresh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if r := get(false); r.Cached || r.Latest != "1.1.0" {
+		t.Fatalf("first fetch = %+v", r)
+	}
+	if r := get(false); !r.Cached || r.Latest != "1.1.0" || hits.Load() != 1 {
+		t.Fatalf("second fetch should hit the cache: %+v, hits %d", r, hits.Load())
+	}
+
+	// 刷新绕过缓存并更新缓存
+	if r := get(true); r.Cached || r.Latest != "1.2.0" {
+		t.Fatalf("refresh = %+v", r)
+	}
+	if r := get(false); !r.Cached || r.Latest != "1.2.0" {
+		t.Fatalf("fetch after refresh = %+v", r)
+	}
+
+	// 缓存过期后重新拉取
+	key := cacheKey(cfg, nil, nil)
+	svc.mu.Lock()
+	entry := svc.cache[key]
+	entry.expires = time.Now().Add(-time.Second)
+	svc.cache[key] = entry
+	svc.mu.Unlock()
+	if r := get(false); r.Cached || r.Latest != "1.3.0" || hits.Load() != 3 {
+		t.Fatalf("fetch after expiry = %+v, hits %d", r, hits.Load())
+	}
+
+	// 配置变化不命中缓存
+	cfg = &Config{URL: srv.URL, CacheSeconds: 60, Filter: "."}
+	if r := get(false); r.Cached || hits.Load() != 4 {
+		t.Fatalf("changed config should miss the cache: %+v", r)
+	}
+
+	// 不缓存时每次都拉取
+	cfg = &Config{URL: srv.URL}
+	get(false)
+	if r := get(false); r.Cached || hits.Load() != 6 {
+		t.Fatalf("uncached fetch = %+v, hits %d", r, hits.Load())
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package versionsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Built-in source types
+const (
+	TypeJSON   = "json"   // 早期的自定义格式 {"versions": [...], "latest": "..."}
+	TypeHTTP   = "http"   // 任意 JSON 接口，通过 JSONPath 提取版本
+	TypeDocker = "docker" // Docker Registry v2 镜像标签
+	TypeGit    = "git"    // Git 仓库标签（本地路径或远程地址）
+	TypeMaven  = "maven"  // Maven 仓库的 maven-metadata.xml
+	TypeStatic = "static" // 固定的版本列表
+)
+
+// Auth types
+const (
+	AuthNone   = ""
+	AuthBasic  = "basic"  // 用户名 + 密钥中的密码
+	AuthBearer = "bearer" // 密钥中的令牌
+	AuthHeader = "header" // 自定义请求头，值取自密钥
+)
+
+// Sort orders
+const (
+	SortSemver = "semver" // 按语义化版本从新到旧排序
+	SortNone   = "none"   // 保持来源返回的顺序
+)
+
+// Config describes where a module's versions come from
+type Config struct {
+	Type         string `json:"type"`          // json（默认）, http, docker, git, maven, static
+	URL          string `json:"url"`           // 接口地址、Registry 地址、仓库地址或 Maven 仓库地址
+	Path         string `json:"path"`          // http: JSONPath；docker: 镜像仓库名；maven: groupId:artifactId
+	Static       string `json:"static"`        // static: 版本列表，逗号或换行分隔
+	Filter       string `json:"filter"`        // 只保留匹配该正则表达式的版本
+	Sort         string `json:"sort"`          // semver, none；为空时 json 和 static 保持原顺序，其他按 semver 排序
+	AuthType     string `json:"auth_type"`     // basic, bearer, header；为空不认证
+	Username     string `json:"username"`      // basic 认证的用户名
+	Secret       string `json:"secret"`        // 保存密码、令牌或请求头值的密钥名称
+	Header       string `json:"header"`        // header 认证的请求头名称
+	CacheSeconds int    `json:"cache_seconds"` // 结果缓存时间，0 不缓存
+}
+
+// Auth carries the credentials resolved from the secrets store
+type Auth struct {
+	Type     string
+	Username string
+	Secret   string
+	Header   string
+}
+
+// Apply adds the credentials to an HTTP request
+func (a *Auth) Apply(req *http.Request) {
+	if a == nil {
+		return
+	}
+	switch a.Type {
+	case AuthBasic:
+		req.SetBasicAuth(a.Username, a.Secret)
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+a.Secret)
+	case AuthHeader:
+		req.Header.Set(a.Header, a.Secret)
+	}
+}
+
+// Source lists the versions available from one kind of version source
+type Source interface {
+	// Type is the unique source type, e.g. "docker"
+	Type() string
+	// Description is shown when listing source types
+	Description() string
+	// Validate checks the source specific settings of a configuration
+	Validate(cfg *Config) error
+	// Fetch returns the versions and, when the source reports one, the latest version
+	Fetch(ctx context.Context, cfg *Config, auth *Auth) ([]string, string, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Source{}
+)
+
+// Register makes a version source type available. It panics when a source
+// with the same type is already registered.
+func Register(s Source) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[s.Type()]; ok {
+		panic(fmt.Sprintf("versionsource: source %q registered twice", s.Type()))
+	}
+	registry[s.Type()] = s
+}
+
+// Sources returns all registered sources sorted by type
+func Sources() []Source {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := make([]Source, 0, len(registry))
+	for _, s := range registry {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type() < result[j].Type() })
+	return result
+}
+
+// Lookup returns the source registered for a type; an empty type is the legacy json source
+func Lookup(sourceType string) (Source, error) {
+	if sourceType == "" {
+		sourceType = TypeJSON
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	s, ok := registry[sourceType]
+	if !ok {
+		return nil, fmt.Errorf("unknown version source type: %s", sourceType)
+	}
+	return s, nil
+}
+
+// Validate checks a configuration; a configuration without URL and type is valid and disables the source
+func Validate(cfg *Config) error {
+	if !cfg.Configured() {
+		return nil
+	}
+	source, err := Lookup(cfg.Type)
+	if err != nil {
+		return err
+	}
+	if cfg.Filter != "" {
+		if _, err := regexp.Compile(cfg.Filter); err != nil {
+			return fmt.Errorf("invalid version filter: %w", err)
+		}
+	}
+	switch cfg.Sort {
+	case "", SortSemver, SortNone:
+	default:
+		return errors.New("version sort must be semver or none")
+	}
+	switch cfg.AuthType {
+	case AuthNone:
+	case AuthBasic, AuthBearer, AuthHeader:
+		if cfg.Secret == "" {
+			return errors.New("version source secret is required for authentication")
+		}
+		if cfg.AuthType == AuthHeader && strings.TrimSpace(cfg.Header) == "" {
+			return errors.New("version source header is required for header authentication")
+		}
+	default:
+		return errors.New("version source auth_type must be basic, bearer or header")
+	}
+	if cfg.CacheSeconds < 0 {
+		return errors.New("version source cache_seconds must not be negative")
+	}
+	return source.Validate(cfg)
+}
+
+// Configured reports whether the module has a version source
+func (c *Config) Configured() bool {
+	return c.URL != "" || (c.Type != "" && c.Type != TypeJSON)
+}
+
+// sortSemver reports whether the versions are sorted by semantic version
+func (c *Config) sortSemver() bool {
+	if c.Sort != "" {
+		return c.Sort == SortSemver
+	}
+	return c.Type != "" && c.Type != TypeJSON && c.Type != TypeStatic
+}
+
+func requireURL(cfg *Config) error {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return errors.New("version source url must be an http(s) URL")
+	}
+	return nil
+}
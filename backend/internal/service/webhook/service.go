@@ -0,0 +1,496 @@
+// Copyright (c) 2025 kk
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kkops/backend/internal/config"
+	"github.com/kkops/backend/internal/model"
+	"github.com/kkops/backend/internal/service/deployment"
+	"github.com/kkops/backend/internal/service/task"
+	"github.com/kkops/backend/internal/utils"
+)
+
+// Trigger targets and auth modes
+const (
+	TargetTask       = "task"
+	TargetDeployment = "deployment"
+
+	AuthModeToken = "token" // 持有 URL 即可触发
+	AuthModeHMAC  = "hmac"  // 还需携带 X-Webhook-Timestamp 与 X-Webhook-Signature
+)
+
+// signatureTolerance HMAC 签名时间戳允许的最大偏差；有效期内已接受的签名不能再次使用
+const signatureTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidToken is returned for unknown or revoked trigger tokens
+	ErrInvalidToken = errors.New("invalid webhook token")
+	// ErrInvalidSignature is returned when an HMAC trigger is called without a valid signature
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrReplayed is returned when a signed request that was already accepted is sent again
+	ErrReplayed = errors.New("webhook request was already delivered")
+	// ErrAssetNotAllowed is returned when a webhook call targets hosts outside the module's configured hosts
+	ErrAssetNotAllowed = errors.New("asset_ids must be a subset of the module's configured hosts")
+)
+
+// Service handles inbound webhook triggers
+type Service struct {
+	db            *gorm.DB
+	config        *config.Config
+	executionSvc  *task.ExecutionService
+	deploymentSvc *deployment.Service
+}
+
+// NewService creates a new webhook trigger service
+func NewService(db *gorm.DB, cfg *config.Config, executionSvc *task.ExecutionService, deploymentSvc *deployment.Service) *Service {
+	return &Service{
+		db:            db,
+		config:        cfg,
+		executionSvc:  executionSvc,
+		deploymentSvc: deploymentSvc,
+	}
+}
+
+// CreateTriggerRequest represents a request to create a webhook trigger
+type CreateTriggerRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	TargetType  string `json:"target_type" binding:"required,oneof=task deployment"`
+	TargetID    uint   `json:"target_id" binding:"required"`
+	AuthMode    string `json:"auth_mode" binding:"omitempty,oneof=token hmac"` // 默认 token
+}
+
+// UpdateTriggerRequest represents a request to update a webhook trigger
+type UpdateTriggerRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	AuthMode    string  `json:"auth_mode" binding:"omitempty,oneof=token hmac"`
+}
+
+// TriggerResponse represents a webhook trigger response
+type TriggerResponse struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	TargetType      string     `json:"target_type"`
+	TargetID        uint       `json:"target_id"`
+	TargetName      string     `json:"target_name"`
+	AuthMode        string     `json:"auth_mode"`
+	Status          string     `json:"status"`
+	TokenPrefix     string     `json:"token_prefix"`
+	Token           string     `json:"token,omitempty"`  // 仅在创建和轮换时返回
+	URL             string     `json:"url,omitempty"`    // 触发地址（相对路径），仅在创建和轮换时返回
+	Secret          string     `json:"secret,omitempty"` // HMAC 签名密钥，仅在创建和轮换时返回
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	TriggerCount    int        `json:"trigger_count"`
+	CreatedBy       uint       `json:"created_by"`
+	CreatorName     string     `json:"creator_name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// FireRequest carries the parameters of a webhook call
+type FireRequest struct {
+	Version  string `json:"version"`   // 部署版本（部署触发器必填，也可通过 ?version= 传入）
+	AssetIDs []uint `json:"asset_ids"` // 部署目标主机，须为模块配置主机的子集，留空使用模块配置
+}
+
+// FireResponse describes what a webhook call started
+type FireResponse struct {
+	TriggerID    uint   `json:"trigger_id"`
+	TargetType   string `json:"target_type"`
+	TargetID     uint   `json:"target_id"`
+	DeploymentID uint   `json:"deployment_id,omitempty"`
+	Message      string `json:"message"`
+}
+
+// CreateTrigger creates a webhook trigger and returns its token and secret once
+func (s *Service) CreateTrigger(userID uint, req *CreateTriggerRequest) (*TriggerResponse, error) {
+	if err := s.checkTarget(req.TargetType, req.TargetID); err != nil {
+		return nil, err
+	}
+
+	authMode := req.AuthMode
+	if authMode == "" {
+		authMode = AuthModeToken
+	}
+
+	trigger := model.WebhookTrigger{
+		Name:        req.Name,
+		Description: req.Description,
+		TargetType:  req.TargetType,
+		TargetID:    req.TargetID,
+		AuthMode:    authMode,
+		Status:      "active",
+		CreatedBy:   userID,
+	}
+	token, secret, err := s.generateCredentials(&trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&trigger).Error; err != nil {
+		return nil, err
+	}
+
+	return s.responseWithCredentials(trigger.ID, token, secret)
+}
+
+// GetTrigger retrieves a webhook trigger by ID (credentials are not returned)
+func (s *Service) GetTrigger(id uint) (*TriggerResponse, error) {
+	var trigger model.WebhookTrigger
+	if err := s.db.Preload("Creator").First(&trigger, id).Error; err != nil {
+		return nil, err
+	}
+	return s.triggerToResponse(&trigger), nil
+}
+
+// ListTriggers lists webhook triggers, optionally filtered by target
+func (s *Service) ListTriggers(targetType string, targetID uint) ([]TriggerResponse, error) {
+	query := s.db.Preload("Creator").Order("id DESC")
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID > 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var triggers []model.WebhookTrigger
+	if err := query.Find(&triggers).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]TriggerResponse, len(triggers))
+	for i := range triggers {
+		result[i] = *s.triggerToResponse(&triggers[i])
+	}
+	return result, nil
+}
+
+// UpdateTrigger updates a webhook trigger's name, description or auth mode
+func (s *Service) UpdateTrigger(id uint, req *UpdateTriggerRequest) (*TriggerResponse, error) {
+	var trigger model.WebhookTrigger
+	if err := s.db.First(&trigger, id).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		trigger.Name = req.Name
+	}
+	if req.Description != nil {
+		trigger.Description = *req.Description
+	}
+	if req.AuthMode != "" {
+		trigger.AuthMode = req.AuthMode
+	}
+
+	if err := s.db.Save(&trigger).Error; err != nil {
+		return nil, err
+	}
+	return s.GetTrigger(id)
+}
+
+// RotateTrigger issues a new token and signing secret; the old URL stops working
+// immediately. A revoked trigger is re-activated by rotation.
+func (s *Service) RotateTrigger(id uint) (*TriggerResponse, error) {
+	var trigger model.WebhookTrigger
+	if err := s.db.First(&trigger, id).Error; err != nil {
+		return nil, err
+	}
+
+	token, secret, err := s.generateCredentials(&trigger)
+	if err != nil {
+		return nil, err
+	}
+	trigger.Status = "active"
+
+	if err := s.db.Save(&trigger).Error; err != nil {
+		return nil, err
+	}
+	return s.responseWithCredentials(trigger.ID, token, secret)
+}
+
+// RevokeTrigger disables a webhook trigger without deleting it
+func (s *Service) RevokeTrigger(id uint) (*TriggerResponse, error) {
+	var trigger model.WebhookTrigger
+	if err := s.db.First(&trigger, id).Error; err != nil {
+		return nil, err
+	}
+
+	trigger.Status = "revoked"
+	if err := s.db.Save(&trigger).Error; err != nil {
+		return nil, err
+	}
+	return s.GetTrigger(id)
+}
+
+// DeleteTrigger deletes a webhook trigger
+func (s *Service) DeleteTrigger(id uint) error {
+	return s.db.Delete(&model.WebhookTrigger{}, id).Error
+}
+
+// Fire authenticates a webhook call and starts the trigger's task or deployment.
+// For HMAC triggers the signature is hex(HMAC-SHA256(secret, timestamp + "." + body)).
+func (s *Service) Fire(token string, body []byte, timestamp, signature, version string) (*FireResponse, error) {
+	var trigger model.WebhookTrigger
+	if err := s.db.Where("token_hash = ?", hashToken(token)).First(&trigger).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if trigger.Status != "active" {
+		return nil, ErrInvalidToken
+	}
+
+	if trigger.AuthMode == AuthModeHMAC {
+		if err := s.verifySignature(&trigger, body, timestamp, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	var req FireRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+	if version != "" {
+		req.Version = version
+	}
+
+	resp := &FireResponse{
+		TriggerID:  trigger.ID,
+		TargetType: trigger.TargetType,
+		TargetID:   trigger.TargetID,
+	}
+
+	switch trigger.TargetType {
+	case TargetTask:
+		if err := s.executionSvc.ExecuteTaskWithTrigger(trigger.TargetID, "async", "webhook"); err != nil {
+			return nil, err
+		}
+		resp.Message = "task execution started"
+	case TargetDeployment:
+		if req.Version == "" {
+			return nil, errors.New("version is required")
+		}
+		if err := s.checkAssets(trigger.TargetID, req.AssetIDs); err != nil {
+			return nil, err
+		}
+		deploy, err := s.deploymentSvc.Deploy(trigger.TargetID, &deployment.DeployRequest{
+			Version:     req.Version,
+			AssetIDs:    req.AssetIDs,
+			TriggerType: "webhook",
+		}, trigger.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		resp.DeploymentID = deploy.ID
+		resp.Message = "deployment started"
+	default:
+		return nil, fmt.Errorf("unsupported target type: %s", trigger.TargetType)
+	}
+
+	now := time.Now()
+	s.db.Model(&trigger).Updates(map[string]interface{}{
+		"last_triggered_at": now,
+		"trigger_count":     gorm.Expr("trigger_count + 1"),
+	})
+
+	return resp, nil
+}
+
+// verifySignature checks the timestamped HMAC signature of an HMAC trigger call
+func (s *Service) verifySignature(trigger *model.WebhookTrigger, body []byte, timestamp, signature string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > signatureTolerance || d < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	secret, err := utils.Decrypt(trigger.SecretEncrypted, s.config.Encryption.Key)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !hmac.Equal(got, expected) {
+		return ErrInvalidSignature
+	}
+	return s.recordDelivery(trigger.ID, hex.EncodeToString(expected), time.Unix(ts, 0).Add(signatureTolerance))
+}
+
+// recordDelivery remembers an accepted signature until its timestamp leaves the
+// tolerance window, so the same signed request cannot be replayed within it
+func (s *Service) recordDelivery(triggerID uint, signature string, expiresAt time.Time) error {
+	s.db.Where("expires_at < ?", time.Now()).Delete(&model.WebhookDelivery{})
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.WebhookDelivery{
+		TriggerID: triggerID,
+		Signature: signature,
+		ExpiresAt: expiresAt,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// checkAssets 持有 URL 即可调用，只允许在模块配置的主机中挑选目标，不能扩展到其它主机
+func (s *Service) checkAssets(moduleID uint, assetIDs []uint) error {
+	if len(assetIDs) == 0 {
+		return nil
+	}
+	var module model.DeploymentModule
+	if err := s.db.First(&module, moduleID).Error; err != nil {
+		return errors.New("deployment module not found")
+	}
+	allowed := make(map[uint]bool)
+	for _, id := range parseAssetIDs(module.AssetIDs) {
+		allowed[id] = true
+	}
+	for _, id := range assetIDs {
+		if !allowed[id] {
+			return ErrAssetNotAllowed
+		}
+	}
+	return nil
+}
+
+// checkTarget verifies that the trigger target exists
+func (s *Service) checkTarget(targetType string, targetID uint) error {
+	switch targetType {
+	case TargetTask:
+		if err := s.db.First(&model.Task{}, targetID).Error; err != nil {
+			return errors.New("task not found")
+		}
+	case TargetDeployment:
+		if err := s.db.First(&model.DeploymentModule{}, targetID).Error; err != nil {
+			return errors.New("deployment module not found")
+		}
+	default:
+		return fmt.Errorf("unsupported target type: %s", targetType)
+	}
+	return nil
+}
+
+// generateCredentials sets a fresh token and signing secret on the trigger and returns them in plaintext
+func (s *Service) generateCredentials(trigger *model.WebhookTrigger) (string, string, error) {
+	token, err := utils.GenerateAPIToken()
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := utils.GenerateAPIToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	encryptedSecret, err := utils.Encrypt([]byte(secret), s.config.Encryption.Key)
+	if err != nil {
+		return "", "", err
+	}
+
+	trigger.TokenHash = hashToken(token)
+	trigger.TokenPrefix = utils.GetTokenPrefix(token)
+	trigger.SecretEncrypted = encryptedSecret
+	return token, secret, nil
+}
+
+func (s *Service) responseWithCredentials(id uint, token, secret string) (*TriggerResponse, error) {
+	resp, err := s.GetTrigger(id)
+	if err != nil {
+		return nil, err
+	}
+	resp.Token = token
+	resp.URL = "/api/v1/webhooks/" + token
+	if resp.AuthMode == AuthModeHMAC {
+		resp.Secret = secret
+	}
+	return resp, nil
+}
+
+func (s *Service) triggerToResponse(t *model.WebhookTrigger) *TriggerResponse {
+	resp := &TriggerResponse{
+		ID:              t.ID,
+		Name:            t.Name,
+		Description:     t.Description,
+		TargetType:      t.TargetType,
+		TargetID:        t.TargetID,
+		AuthMode:        t.AuthMode,
+		Status:          t.Status,
+		TokenPrefix:     t.TokenPrefix,
+		LastTriggeredAt: t.LastTriggeredAt,
+		TriggerCount:    t.TriggerCount,
+		CreatedBy:       t.CreatedBy,
+		CreatorName:     t.Creator.Username,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+	}
+
+	switch t.TargetType {
+	case TargetTask:
+		var target model.Task
+		if s.db.Select("name").First(&target, t.TargetID).Error == nil {
+			resp.TargetName = target.Name
+		}
+	case TargetDeployment:
+		var target model.DeploymentModule
+		if s.db.Select("name").First(&target, t.TargetID).Error == nil {
+			resp.TargetName = target.Name
+		}
+	}
+	return resp
+}
+
+// hashToken returns the lookup hash of a trigger token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseAssetIDs(s string) []uint {
+	if s == "" {
+		return []uint{}
+	}
+
+	parts := strings.Split(s, ",")
+	result := make([]uint, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err == nil {
+			result = append(result, uint(id))
+		}
+	}
+	return result
+}
@@ -6,10 +6,13 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -192,3 +195,111 @@ func (c *SSHClient) Close() error {
 func (c *SSHClient) Client() *ssh.Client {
 	return c.client
 }
+
+// ExecuteCommandWithEnv executes a command with extra environment variables and a timeout.
+// Variables are sent with the SSH "env" request; if the server refuses them (AcceptEnv),
+// they are streamed over stdin and sourced by the remote shell instead, so values never
+// appear in the command line.
+func (c *SSHClient) ExecuteCommandWithEnv(ctx context.Context, command string, env map[string]string) (string, int, error) {
+	if len(env) == 0 {
+		return c.ExecuteCommandWithTimeout(ctx, command)
+	}
+
+	var output bytes.Buffer
+	exitCode, err := c.runWithEnv(ctx, command, env, &output, &output)
+	if err != nil {
+		return "", -1, err
+	}
+	return output.String(), exitCode, nil
+}
+
+// ExecuteCommandWithEnvSplit is like ExecuteCommandWithEnv but returns stdout and stderr separately
+func (c *SSHClient) ExecuteCommandWithEnvSplit(ctx context.Context, command string, env map[string]string) (string, string, int, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.runWithEnv(ctx, command, env, &stdout, &stderr)
+	if err != nil {
+		return "", "", -1, err
+	}
+	return stdout.String(), stderr.String(), exitCode, nil
+}
+
+// runWithEnv runs a command with environment variables, writing its output to stdout and stderr.
+// A non-zero exit status is returned as the exit code, not as an error.
+func (c *SSHClient) runWithEnv(ctx context.Context, command string, env map[string]string, stdout, stderr io.Writer) (int, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	accepted := true
+	for k, v := range env {
+		if err := session.Setenv(k, v); err != nil {
+			accepted = false
+			break
+		}
+	}
+
+	if !accepted {
+		// Setenv 失败后会话状态不确定，重新创建
+		session.Close()
+		session, err = c.client.NewSession()
+		if err != nil {
+			return -1, err
+		}
+		defer session.Close()
+
+		var exports strings.Builder
+		for k, v := range env {
+			exports.WriteString("export " + k + "='" + strings.ReplaceAll(v, "'", `'"'"'`) + "'\n")
+		}
+		session.Stdin = strings.NewReader(exports.String())
+		command = ". /dev/stdin\n" + command
+	}
+
+	// 输出写入在命令结束（或被终止）前完成，调用方在返回后读取
+	var mu sync.Mutex
+	session.Stdout = &lockedWriter{w: stdout, mu: &mu}
+	session.Stderr = &lockedWriter{w: stderr, mu: &mu}
+
+	type result struct {
+		exitCode int
+		err      error
+	}
+	resultCh := make(chan result, 1)
+
+	go func() {
+		err := session.Run(command)
+		exitCode := 0
+		if err != nil {
+			if exitError, ok := err.(*ssh.ExitError); ok {
+				exitCode = exitError.ExitStatus()
+				err = nil
+			}
+		}
+		resultCh <- result{exitCode: exitCode, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		return -1, ctx.Err()
+	case res := <-resultCh:
+		if res.err != nil {
+			return -1, res.err
+		}
+		return res.exitCode, nil
+	}
+}
+
+// lockedWriter serializes writes when stdout and stderr share one buffer
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}